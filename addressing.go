@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// pathStyle represents how buckets are addressed in requests.
+type pathStyle int
+
+const (
+	// Probe the endpoint to find an addressing style that works
+	PathStyleAuto pathStyle = iota
+
+	// Address buckets as part of the path, e.g., https://host/bucket/key
+	PathStylePath
+
+	// Address buckets as part of the host, e.g., https://bucket.host/key
+	PathStyleVirtual
+)
+
+// PathStyle represents a pathStyle, with helper functions to parse and produce
+// human readable representations of the identifier for use via the flag
+// module.
+type PathStyle pathStyle
+
+func (p PathStyle) String() string {
+	switch pathStyle(p) {
+	case PathStylePath:
+		return "path"
+	case PathStyleVirtual:
+		return "virtual"
+	default:
+		return "auto"
+	}
+}
+
+func (p *PathStyle) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "auto":
+		*p = PathStyle(PathStyleAuto)
+	case "path":
+		*p = PathStyle(PathStylePath)
+	case "virtual":
+		*p = PathStyle(PathStyleVirtual)
+	default:
+		return fmt.Errorf("valid path styles: auto, path, virtual")
+	}
+
+	return nil
+}
+
+// addressingWorks returns true if the error (or lack of one) returned by a
+// HeadBucket request shows that the bucket was correctly addressed, i.e., that
+// the request succeeded or was authenticated but denied access.
+func addressingWorks(err error) bool {
+	return err == nil || preflightStatusCode(err) == http.StatusForbidden
+}
+
+// probeAddressing sends HeadBucket requests for Bucket using the configured
+// addressing style, then the alternative, returning true if path-style
+// addressing should be used.  An error is returned if neither works.
+func probeAddressing(ctx context.Context, Bucket string, opts *Options) (bool, error) {
+	var errs []error
+
+	for _, usePathStyle := range []bool{!opts.DisablePathStyle, opts.DisablePathStyle} {
+		pool := opts.s3.WithPathStyle(usePathStyle)
+
+		s3client := pool.Get()
+		_, err := s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: &Bucket,
+		})
+		pool.Put(s3client)
+
+		if addressingWorks(err) {
+			return usePathStyle, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w",
+			PathStyle(pathStyleOf(usePathStyle)), err))
+	}
+
+	return false, errors.Join(errs...)
+}
+
+// pathStyleOf returns the pathStyle for the s3.Options UsePathStyle value.
+func pathStyleOf(usePathStyle bool) pathStyle {
+	if usePathStyle {
+		return PathStylePath
+	}
+	return PathStyleVirtual
+}
+
+// useAddressing probes the endpoint for the addressing style that works for
+// Bucket and, if it differs from the configured style, replaces Options.s3 with
+// an S3ClientPool using it.  If neither style works the configured style is
+// left in place, so that the error is reported by the requests that follow.
+func useAddressing(ctx context.Context, Bucket string, opts *Options) {
+	usePathStyle, err := probeAddressing(ctx, Bucket, opts)
+	if err != nil {
+		log.Printf("unable to probe addressing style for bucket %s: %s", Bucket, err)
+		return
+	}
+
+	if usePathStyle == !opts.DisablePathStyle {
+		if opts.Verbose {
+			log.Printf("using %s addressing for bucket %s",
+				PathStyle(pathStyleOf(usePathStyle)), Bucket)
+		}
+		return
+	}
+
+	log.Printf("bucket %s is not reachable using %s addressing, using %s addressing",
+		Bucket, PathStyle(pathStyleOf(!usePathStyle)), PathStyle(pathStyleOf(usePathStyle)))
+
+	opts.DisablePathStyle = !usePathStyle
+	opts.s3 = opts.s3.WithPathStyle(usePathStyle)
+}
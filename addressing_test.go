@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestProbeAddressing(t *testing.T) {
+	// a server that only recognizes virtual-host style requests, whose
+	// host is the bucket name
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "bucket.") && r.URL.Path == "/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				// send every request to the test server, regardless of
+				// the host name
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				},
+			},
+		},
+	}
+
+	opts := &Options{
+		s3: NewS3ClientPool(true, cfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String("http://s3.test")
+			o.UsePathStyle = true
+		}),
+	}
+
+	usePathStyle, err := probeAddressing(context.Background(), "bucket", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if usePathStyle {
+		t.Errorf("expected virtual-host addressing got path-style")
+	}
+}
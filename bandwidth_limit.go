@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// bandwidthQuantum is the maximum number of bytes granted to a single request
+// for bandwidth, requests are granted in turn so smaller values give finer
+// grained sharing between streams.
+const bandwidthQuantum = 32 * 1024
+
+// BandwidthLimiter limits the rate at which request bodies are sent to S3, in
+// total and optionally per object (see SetStreamRate).
+//
+// Each object being uploaded registers a BandwidthStream.  When fair is true
+// the limiter grants bandwidth to streams in turn (round-robin), so that every
+// object with data waiting to be sent receives an equal share of the limit
+// regardless of how many parts it has in flight.  When fair is false requests
+// are granted in the order they arrive, allowing an object with many parts
+// in flight to take a larger share of the limit.
+type BandwidthLimiter struct {
+	// rate in bytes per second, or 0 for no limit on the total
+	rate int64
+
+	// streamRate in bytes per second for each stream, or 0 for no limit
+	streamRate int64
+
+	// fair selects round-robin (true) or first-come (false) scheduling
+	fair bool
+
+	mu *sync.Mutex
+
+	// queues holds pending requests per stream, and order holds the
+	// round-robin order of streams with pending requests
+	queues map[*BandwidthStream][]*bandwidthRequest
+	order  []*BandwidthStream
+
+	// fifo holds pending requests in arrival order when not fair
+	fifo []*bandwidthRequest
+
+	// signal wakes the dispatcher when a request is queued
+	signal chan struct{}
+
+	// shared is used for request bodies not associated with a stream
+	shared *BandwidthStream
+}
+
+// bandwidthRequest is a request to send n bytes, granted is closed once the
+// bytes may be sent.
+type bandwidthRequest struct {
+	n        int
+	granted  chan struct{}
+	canceled bool
+}
+
+// NewBandwidthLimiter initializes a new BandwidthLimiter limiting uploads to
+// rate bytes per second, shared fairly across streams if fair is true.  If
+// rate is 0 then the total is not limited, only each stream per
+// SetStreamRate.
+func NewBandwidthLimiter(rate int64, fair bool) *BandwidthLimiter {
+	p := &BandwidthLimiter{
+		rate:   rate,
+		fair:   fair,
+		mu:     &sync.Mutex{},
+		queues: map[*BandwidthStream][]*bandwidthRequest{},
+		signal: make(chan struct{}, 1),
+	}
+
+	p.shared = p.Stream()
+
+	if rate > 0 {
+		go p.dispatch()
+	}
+
+	return p
+}
+
+// SetStreamRate additionally limits each stream to rate bytes per second, so
+// that a single object cannot take the whole of the limit.  Request bodies
+// not associated with a stream are not limited by it.
+func (p *BandwidthLimiter) SetStreamRate(rate int64) {
+	p.streamRate = rate
+}
+
+// Stream registers a new BandwidthStream, which should be closed once the
+// caller has finished sending data.
+func (p *BandwidthLimiter) Stream() *BandwidthStream {
+	return &BandwidthStream{l: p, mu: &sync.Mutex{}}
+}
+
+// next returns the next request to be granted, blocking until one is queued.
+func (p *BandwidthLimiter) next() *bandwidthRequest {
+	for {
+		p.mu.Lock()
+
+		var req *bandwidthRequest
+
+		if p.fair {
+			for req == nil && len(p.order) > 0 {
+				s := p.order[0]
+				p.order = p.order[1:]
+
+				q := p.queues[s]
+				if len(q) == 0 {
+					delete(p.queues, s)
+					continue
+				}
+
+				req, q = q[0], q[1:]
+				if len(q) == 0 {
+					delete(p.queues, s)
+				} else {
+					// more pending requests, go to the
+					// back of the line
+					p.queues[s] = q
+					p.order = append(p.order, s)
+				}
+
+				if req.canceled {
+					req = nil
+				}
+			}
+		} else {
+			for req == nil && len(p.fifo) > 0 {
+				req, p.fifo = p.fifo[0], p.fifo[1:]
+				if req.canceled {
+					req = nil
+				}
+			}
+		}
+
+		p.mu.Unlock()
+
+		if req != nil {
+			return req
+		}
+
+		<-p.signal
+	}
+}
+
+// dispatch grants queued requests, pacing them to the configured rate.
+func (p *BandwidthLimiter) dispatch() {
+	var next time.Time
+
+	for {
+		// wait for the next grant to be due before selecting which
+		// request to grant, so that every request queued in the
+		// meantime is considered
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		}
+
+		req := p.next()
+
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+
+		next = next.Add(time.Duration(req.n) * time.Second / time.Duration(p.rate))
+
+		close(req.granted)
+	}
+}
+
+// wait blocks until n bytes may be sent for stream s, or until the context is
+// canceled.
+func (p *BandwidthLimiter) wait(ctx context.Context, s *BandwidthStream, n int) error {
+	if p.rate <= 0 {
+		return nil
+	}
+
+	req := &bandwidthRequest{
+		n:       n,
+		granted: make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	if p.fair {
+		if _, ok := p.queues[s]; !ok {
+			p.order = append(p.order, s)
+		}
+		p.queues[s] = append(p.queues[s], req)
+	} else {
+		p.fifo = append(p.fifo, req)
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.signal <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-req.granted:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		req.canceled = true
+		p.mu.Unlock()
+		return context.Cause(ctx)
+	}
+}
+
+// HTTPClient wraps an s3.HTTPClient so that request bodies are sent at no more
+// than the configured rate.  The BandwidthStream for a request is taken from
+// its context (see WithBandwidthStream).
+func (p *BandwidthLimiter) HTTPClient(client s3.HTTPClient) s3.HTTPClient {
+	return &bandwidthHTTPClient{
+		client: client,
+		l:      p,
+	}
+}
+
+// BandwidthStream represents a single object competing for bandwidth.
+type BandwidthStream struct {
+	l *BandwidthLimiter
+
+	// next is the time the next bytes of the stream may be sent within
+	// the stream rate, guarded by mu
+	mu   *sync.Mutex
+	next time.Time
+}
+
+// pace blocks until n bytes may be sent for the stream within the stream rate
+// of its BandwidthLimiter, or until the context is canceled.
+func (s *BandwidthStream) pace(ctx context.Context, n int) error {
+	rate := s.l.streamRate
+	if rate <= 0 || s == s.l.shared {
+		return nil
+	}
+
+	s.mu.Lock()
+	if now := time.Now(); s.next.Before(now) {
+		s.next = now
+	}
+	due := s.next
+	s.next = s.next.Add(time.Duration(n) * time.Second / time.Duration(rate))
+	s.mu.Unlock()
+
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Close unregisters the stream from its BandwidthLimiter.  Any requests still
+// pending for the stream will continue to be granted.
+func (s *BandwidthStream) Close() error {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+
+	if len(s.l.queues[s]) == 0 {
+		delete(s.l.queues, s)
+	}
+
+	return nil
+}
+
+type bandwidthStreamKey struct{}
+
+// WithBandwidthStream returns a context carrying the BandwidthStream used to
+// limit request bodies sent using the context.
+func WithBandwidthStream(ctx context.Context, s *BandwidthStream) context.Context {
+	return context.WithValue(ctx, bandwidthStreamKey{}, s)
+}
+
+// bandwidthHTTPClient implements s3.HTTPClient, limiting the rate at which
+// request bodies are read by the underlying client.
+type bandwidthHTTPClient struct {
+	client s3.HTTPClient
+	l      *BandwidthLimiter
+}
+
+func (c *bandwidthHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return c.client.Do(req)
+	}
+
+	s, ok := req.Context().Value(bandwidthStreamKey{}).(*BandwidthStream)
+	if !ok || s.l != c.l {
+		s = c.l.shared
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = &bandwidthReader{
+		ctx: req.Context(),
+		rc:  req.Body,
+		s:   s,
+	}
+
+	return c.client.Do(req)
+}
+
+// bandwidthReader waits for a grant from the BandwidthLimiter for each chunk
+// of bytes read.
+type bandwidthReader struct {
+	ctx context.Context
+	rc  io.ReadCloser
+	s   *BandwidthStream
+}
+
+func (r *bandwidthReader) Read(b []byte) (int, error) {
+	if len(b) > bandwidthQuantum {
+		b = b[0:bandwidthQuantum]
+	}
+
+	n, err := r.rc.Read(b)
+	if n > 0 {
+		// wait for the stream rate first, so that a stream held back
+		// by it does not take grants from the others
+		if werr := r.s.pace(r.ctx, n); werr != nil {
+			return n, werr
+		}
+		if werr := r.s.l.wait(r.ctx, r.s, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+func (r *bandwidthReader) Close() error {
+	return r.rc.Close()
+}
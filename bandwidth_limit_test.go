@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Validate that BandwidthLimiter paces requests to the configured rate
+func TestBandwidthLimiterRate(t *testing.T) {
+	rate := int64(bandwidthQuantum * 20)
+	l := NewBandwidthLimiter(rate, true)
+	s := l.Stream()
+	defer s.Close()
+
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.wait(context.Background(), s, bandwidthQuantum); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// the first grant is immediate, the remaining 4 are paced
+	if elapsed, expect := time.Since(t0), 4*time.Second/20; elapsed < expect {
+		t.Errorf("expected at least %s elapsed, got %s", expect, elapsed)
+	}
+}
+
+// Validate that BandwidthLimiter shares bandwidth between streams fairly,
+// regardless of the number of concurrent requests per stream
+func TestBandwidthLimiterFair(t *testing.T) {
+	l := NewBandwidthLimiter(int64(bandwidthQuantum*100), true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	counts := make([]int, 2)
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	// stream 0 has 4 concurrent requesters, stream 1 has 1
+	for i, nrequesters := range []int{4, 1} {
+		s := l.Stream()
+		defer s.Close()
+
+		for j := 0; j < nrequesters; j++ {
+			wg.Add(1)
+			go func(i int, s *BandwidthStream) {
+				defer wg.Done()
+				for l.wait(ctx, s, bandwidthQuantum) == nil {
+					mu.Lock()
+					counts[i] += 1
+					mu.Unlock()
+				}
+			}(i, s)
+		}
+	}
+
+	wg.Wait()
+
+	if diff := counts[0] - counts[1]; diff < -2 || diff > 2 {
+		t.Errorf("expected fair grants, got %v", counts)
+	}
+}
+
+// Validate that the stream rate paces each stream separately, without a limit
+// on the total
+func TestBandwidthLimiterStreamRate(t *testing.T) {
+	l := NewBandwidthLimiter(0, true)
+	l.SetStreamRate(int64(bandwidthQuantum * 20))
+
+	wg := &sync.WaitGroup{}
+
+	t0 := time.Now()
+	for i := 0; i < 2; i++ {
+		s := l.Stream()
+		defer s.Close()
+
+		wg.Add(1)
+		go func(s *BandwidthStream) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := s.pace(context.Background(), bandwidthQuantum); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				if err := l.wait(context.Background(), s, bandwidthQuantum); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	// each stream paces its remaining 4 requests, concurrently
+	elapsed := time.Since(t0)
+	if expect := 4 * time.Second / 20; elapsed < expect || elapsed > 2*expect {
+		t.Errorf("expected about %s elapsed, got %s", expect, elapsed)
+	}
+
+	// the shared stream is not paced
+	t0 = time.Now()
+	for j := 0; j < 5; j++ {
+		if err := l.shared.pace(context.Background(), bandwidthQuantum); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if elapsed := time.Since(t0); elapsed > 4*time.Second/20 {
+		t.Errorf("expected the shared stream not to be paced, got %s", elapsed)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketRegionHeader is returned by S3 on HeadBucket responses, including on
+// 301 PermanentRedirect and 403 Forbidden error responses
+const bucketRegionHeader = "X-Amz-Bucket-Region"
+
+// detectBucketRegion returns the region Bucket is located in, if it differs
+// from the region the s3.Client is configured for, otherwise it returns "".
+// The region is taken from the HeadBucket response, falling back to
+// GetBucketLocation if the response does not include it.
+func detectBucketRegion(ctx context.Context, Bucket string, opts *Options) (string, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	configured := s3client.Options().Region
+
+	var region string
+
+	out, err := s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: &Bucket,
+	})
+	if err == nil {
+		if out.BucketRegion != nil {
+			region = *out.BucketRegion
+		}
+	} else {
+		var re *awshttp.ResponseError
+		if errors.As(err, &re) && re.Response != nil {
+			region = re.Response.Header.Get(bucketRegionHeader)
+		}
+	}
+
+	if region == "" {
+		loc, err := s3client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+			Bucket: &Bucket,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		region = bucketLocationRegion(loc.LocationConstraint)
+	}
+
+	if region == configured {
+		return "", nil
+	}
+
+	return region, nil
+}
+
+// bucketLocationRegion converts a LocationConstraint returned by
+// GetBucketLocation into a region name, buckets in us-east-1 have no location
+// constraint and buckets in eu-west-1 may use the legacy "EU" value.
+func bucketLocationRegion(loc types.BucketLocationConstraint) string {
+	switch loc {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	default:
+		return string(loc)
+	}
+}
+
+// useBucketRegion detects the region Bucket is located in and, if it differs
+// from the configured region, replaces Options.s3 with an S3ClientPool using
+// the bucket's region.  Failures to detect the region are logged, and the
+// configured region is left in place.
+func useBucketRegion(ctx context.Context, Bucket string, opts *Options) {
+	region, err := detectBucketRegion(ctx, Bucket, opts)
+	if err != nil {
+		log.Printf("unable to detect region of bucket %s: %s", Bucket, err)
+		return
+	}
+
+	if region == "" {
+		return
+	}
+
+	log.Printf("bucket %s is in region %s, using it instead of the configured region",
+		Bucket, region)
+
+	opts.s3 = opts.s3.WithRegion(region)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestBucketLocationRegion(t *testing.T) {
+	for i, tst := range []struct {
+		loc    types.BucketLocationConstraint
+		expect string
+	}{
+		{"", "us-east-1"},
+		{types.BucketLocationConstraintEu, "eu-west-1"},
+		{types.BucketLocationConstraintUsWest2, "us-west-2"},
+	} {
+		if actual := bucketLocationRegion(tst.loc); actual != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, actual)
+		}
+	}
+}
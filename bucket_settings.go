@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Condition keys of a bucket policy that are derived from the headers s3up
+// sends with an upload, mapped to the flags that control them.
+const (
+	policyKeySSE           = "s3:x-amz-server-side-encryption"
+	policyKeySSEKMSKeyId   = "s3:x-amz-server-side-encryption-aws-kms-key-id"
+	policyKeyContentSHA256 = "s3:x-amz-content-sha256"
+)
+
+var policyKeyFlags = map[string]string{
+	policyKeySSE:           "-sse",
+	policyKeySSEKMSKeyId:   "-sse-kms-key-id",
+	policyKeyContentSHA256: "-stream-parts",
+}
+
+// checkBucketSettings compares the default encryption, policy and versioning
+// of Bucket against the -sse, -sse-kms-key-id, -stream-parts and -delete
+// flags, logging a warning for each conflict found so that it is reported
+// before any object is uploaded rather than as each upload fails.  Settings
+// that cannot be read (e.g., without s3:GetBucketPolicy permission) are not
+// checked.
+func checkBucketSettings(ctx context.Context, Bucket string, opts *Options) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	if opts.Verbose {
+		log.Printf("checking settings of bucket %s", Bucket)
+	}
+
+	var warnings []string
+
+	enc, err := s3client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: &Bucket,
+	})
+	if err != nil {
+		if opts.Verbose {
+			log.Printf("unable to check bucket %s: GetBucketEncryption: %s", Bucket, err)
+		}
+	} else if enc.ServerSideEncryptionConfiguration != nil {
+		warnings = append(warnings, encryptionWarnings(Bucket,
+			enc.ServerSideEncryptionConfiguration.Rules, opts.objOpt)...)
+	}
+
+	policy, err := s3client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+		Bucket: &Bucket,
+	})
+	if err != nil {
+		if opts.Verbose {
+			log.Printf("unable to check bucket %s: GetBucketPolicy: %s", Bucket, err)
+		}
+	} else if policy.Policy != nil {
+		w, err := policyWarnings(Bucket, opts.key, *policy.Policy, uploadConditionValues(opts))
+		if err != nil && opts.Verbose {
+			log.Printf("unable to check bucket %s: policy: %s", Bucket, err)
+		}
+		warnings = append(warnings, w...)
+	}
+
+	versioning, err := s3client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: &Bucket,
+	})
+	if err != nil {
+		if opts.Verbose {
+			log.Printf("unable to check bucket %s: GetBucketVersioning: %s", Bucket, err)
+		}
+	} else if versioning.Status == types.BucketVersioningStatusEnabled && opts.Delete {
+		warnings = append(warnings, fmt.Sprintf(
+			"bucket %s is versioned, objects removed by -delete are retained as noncurrent versions",
+			Bucket))
+	}
+
+	for _, w := range warnings {
+		log.Printf("warning: %s", w)
+	}
+}
+
+// encryptionWarnings returns a warning if objOpt requests server-side
+// encryption that overrides the default encryption rules of Bucket.
+func encryptionWarnings(Bucket string, rules []types.ServerSideEncryptionRule, objOpt *ObjectOptions) []string {
+	var warnings []string
+
+	for _, rule := range rules {
+		def := rule.ApplyServerSideEncryptionByDefault
+		if def == nil || def.SSEAlgorithm == "" {
+			continue
+		}
+
+		sse := objOpt.ServerSideEncryption
+		if sse == "" {
+			continue
+		}
+
+		if string(sse) != string(def.SSEAlgorithm) {
+			warnings = append(warnings, fmt.Sprintf(
+				"-sse %s overrides the default encryption %s of bucket %s",
+				sse, def.SSEAlgorithm, Bucket))
+			continue
+		}
+
+		key := objOpt.SSEKMSKeyId
+		if key == "" || def.KMSMasterKeyID == nil || *def.KMSMasterKeyID == "" {
+			continue
+		}
+
+		defKey := *def.KMSMasterKeyID
+		if key != defKey && !strings.HasSuffix(defKey, "/"+key) && !strings.HasSuffix(key, "/"+defKey) {
+			warnings = append(warnings, fmt.Sprintf(
+				"-sse-kms-key-id %s overrides the default KMS key %s of bucket %s",
+				key, defKey, Bucket))
+		}
+	}
+
+	return warnings
+}
+
+// uploadConditionValues returns the values of the bucket policy condition keys
+// for the uploads requested by opts, keys that are not sent map to "".
+func uploadConditionValues(opts *Options) map[string]string {
+	values := map[string]string{
+		policyKeySSE:         string(opts.objOpt.ServerSideEncryption),
+		policyKeySSEKMSKeyId: opts.objOpt.SSEKMSKeyId,
+	}
+
+	// the payload hash of other uploads depends on the SDK and endpoint
+	if opts.StreamParts {
+		values[policyKeyContentSHA256] = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	}
+
+	return values
+}
+
+// policyStrings is a policy element that may be either a string or a list of
+// strings.
+type policyStrings []string
+
+func (p *policyStrings) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = policyStrings{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+
+	*p = l
+
+	return nil
+}
+
+// policyStatement is the subset of a bucket policy statement used to find
+// statements denying uploads.
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Action    policyStrings
+	Resource  policyStrings
+	Condition map[string]map[string]policyStrings
+}
+
+// policyStatements is the Statement element of a policy, which may be either
+// a single statement or a list of statements.
+type policyStatements []policyStatement
+
+func (p *policyStatements) UnmarshalJSON(b []byte) error {
+	var s policyStatement
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = policyStatements{s}
+		return nil
+	}
+
+	var l []policyStatement
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+
+	*p = l
+
+	return nil
+}
+
+// policyWarnings parses a bucket policy and returns a warning for each Deny
+// statement that would deny uploads under Key with the condition key values
+// in values.  Statements without conditions, or with conditions on keys not
+// in values, are not evaluated as they do not depend on the upload flags.
+func policyWarnings(Bucket, Key, policy string, values map[string]string) ([]string, error) {
+	var doc struct {
+		Statement policyStatements
+	}
+
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return nil, err
+	}
+
+	resource := "arn:aws:s3:::" + Bucket + "/" + Key
+
+	var warnings []string
+
+	for i, st := range doc.Statement {
+		if !strings.EqualFold(st.Effect, "Deny") || len(st.Condition) == 0 {
+			continue
+		}
+
+		if !slices.ContainsFunc(st.Action, func(a string) bool {
+			return policyMatch(a, "s3:PutObject", true)
+		}) {
+			continue
+		}
+
+		if !slices.ContainsFunc(st.Resource, func(r string) bool {
+			return policyMatch(policyResource(r), resource, false)
+		}) {
+			continue
+		}
+
+		denied, keys := policyConditionsMatch(st.Condition, values)
+		if !denied {
+			continue
+		}
+
+		sid := st.Sid
+		if sid == "" {
+			sid = fmt.Sprintf("#%d", i+1)
+		}
+
+		var flags []string
+		for _, key := range keys {
+			flags = append(flags, policyKeyFlags[key])
+		}
+
+		warnings = append(warnings, fmt.Sprintf(
+			"policy statement %s of bucket %s denies uploads with the current %s",
+			sid, Bucket, strings.Join(flags, ", ")))
+	}
+
+	return warnings, nil
+}
+
+// policyConditionsMatch returns true if every condition matches values, in
+// which case the condition keys are also returned.  Conditions that cannot be
+// evaluated do not match.
+func policyConditionsMatch(conditions map[string]map[string]policyStrings, values map[string]string) (bool, []string) {
+	var keys []string
+
+	for op, cond := range conditions {
+		for key, expect := range cond {
+			key = strings.ToLower(key)
+
+			value, ok := values[key]
+			if !ok || !policyConditionMatch(op, value, expect) {
+				return false, nil
+			}
+
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	slices.Sort(keys)
+
+	return true, keys
+}
+
+// policyConditionMatch evaluates a single condition operator, value is ""
+// if the condition key is not present in the request.
+func policyConditionMatch(op, value string, expect policyStrings) bool {
+	if strings.EqualFold(op, "Null") {
+		return slices.ContainsFunc(expect, func(e string) bool {
+			return strings.EqualFold(e, "true") == (value == "")
+		})
+	}
+
+	// keys are single valued, so ForAnyValue: and ForAllValues: are
+	// evaluated as the plain operator
+	if _, after, found := strings.Cut(op, ":"); found {
+		op = after
+	}
+
+	op, ifExists := strings.CutSuffix(op, "IfExists")
+	if value == "" {
+		// negated operators match when the key is not present
+		return ifExists || strings.Contains(op, "Not")
+	}
+
+	var like, fold bool
+
+	switch op {
+	case "StringEquals", "StringNotEquals", "ArnEquals", "ArnNotEquals":
+	case "StringLike", "StringNotLike", "ArnLike", "ArnNotLike":
+		like = true
+	case "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase":
+		fold = true
+	default:
+		return false
+	}
+
+	found := slices.ContainsFunc(expect, func(e string) bool {
+		if like {
+			return policyMatch(e, value, false)
+		} else if fold {
+			return strings.EqualFold(e, value)
+		}
+		return e == value
+	})
+
+	return found != strings.Contains(op, "Not")
+}
+
+// policyResource replaces the partition of a resource ARN with aws, so that
+// resources may be compared without knowing the partition of the bucket.
+func policyResource(r string) string {
+	fields := strings.SplitN(r, ":", 3)
+	if len(fields) == 3 && fields[0] == "arn" {
+		fields[1] = "aws"
+	}
+	return strings.Join(fields, ":")
+}
+
+// policyMatch matches s against a policy pattern using the * and ?
+// wildcards, ignoring case if fold is true.
+func policyMatch(pattern, s string, fold bool) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+
+	if fold {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(s)
+}
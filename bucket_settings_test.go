@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestEncryptionWarnings(t *testing.T) {
+	kms := []types.ServerSideEncryptionRule{{
+		ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+			SSEAlgorithm:   types.ServerSideEncryptionAwsKms,
+			KMSMasterKeyID: aws.String("arn:aws:kms:us-west-2:123456789012:key/abcd"),
+		},
+	}}
+
+	for i, tst := range []struct {
+		sse    types.ServerSideEncryption
+		keyID  string
+		expect int
+	}{
+		{"", "", 0},
+		{types.ServerSideEncryptionAes256, "", 1},
+		{types.ServerSideEncryptionAwsKms, "", 0},
+		{types.ServerSideEncryptionAwsKms, "abcd", 0},
+		{types.ServerSideEncryptionAwsKms, "efgh", 1},
+	} {
+		objOpt := &ObjectOptions{
+			ServerSideEncryption: tst.sse,
+			SSEKMSKeyId:          tst.keyID,
+		}
+
+		warnings := encryptionWarnings("bucket", kms, objOpt)
+		if len(warnings) != tst.expect {
+			t.Errorf("%d expected %d warnings, got %q", i, tst.expect, warnings)
+		}
+	}
+}
+
+func TestPolicyWarnings(t *testing.T) {
+	const policy = `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "RequireKMS",
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": "s3:PutObject",
+				"Resource": "arn:aws:s3:::bucket/data/*",
+				"Condition": {
+					"StringNotEquals": {"s3:x-amz-server-side-encryption": "aws:kms"}
+				}
+			},
+			{
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": ["s3:Put*"],
+				"Resource": ["arn:aws-us-gov:s3:::bucket/*"],
+				"Condition": {
+					"StringEquals": {"s3:x-amz-content-sha256": "STREAMING-UNSIGNED-PAYLOAD-TRAILER"}
+				}
+			},
+			{
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": "s3:PutObject",
+				"Resource": "arn:aws:s3:::bucket/*",
+				"Condition": {
+					"Bool": {"aws:SecureTransport": "false"}
+				}
+			}
+		]
+	}`
+
+	for i, tst := range []struct {
+		key    string
+		values map[string]string
+		expect string
+	}{
+		{"data/", map[string]string{policyKeySSE: ""},
+			"[policy statement RequireKMS of bucket bucket denies uploads with the current -sse]"},
+		{"data/", map[string]string{policyKeySSE: "AES256"},
+			"[policy statement RequireKMS of bucket bucket denies uploads with the current -sse]"},
+		{"data/", map[string]string{policyKeySSE: "aws:kms"}, "[]"},
+		{"other/", map[string]string{policyKeySSE: ""}, "[]"},
+		{"other/", map[string]string{policyKeySSE: "", policyKeyContentSHA256: "STREAMING-UNSIGNED-PAYLOAD-TRAILER"},
+			"[policy statement #2 of bucket bucket denies uploads with the current -stream-parts]"},
+	} {
+		warnings, err := policyWarnings("bucket", tst.key, policy, tst.values)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if actual := fmt.Sprint(warnings); actual != tst.expect {
+			t.Errorf("%d expected %s, got %s", i, tst.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errComposeArgs = errors.New(
+	"compose requires a non-prefix -key and one or more chunk <keys>")
+
+var errComposeManifest = errors.New(
+	"compose requires -compose-manifest, the json manifest the chunks were uploaded with")
+
+var errComposeChunk = errors.New(
+	"chunk does not match the manifest")
+
+// composeChunk describes an existing object copied as a part of a composed
+// object, with the checksums recorded for it in the manifest.
+type composeChunk struct {
+	key  string
+	size int64
+
+	// full-body checksums of the chunk, which are the part checksums
+	// of the composed object
+	md5 HashSum
+	sum HashSum
+}
+
+// readManifestRecords reads a json manifest, returning the records for
+// completed objects by <bucket>/<key>.
+func readManifestRecords(r io.Reader) (map[string]*ObjectReporting, error) {
+	var records []*ObjectReporting
+
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	found := map[string]*ObjectReporting{}
+
+	for _, rec := range records {
+		// skip the RunMetadata and RunEnd records
+		if rec.Bucket == "" || !rec.Completed || rec.FullChecksums == nil {
+			continue
+		}
+
+		found[path.Join(rec.Bucket, rec.Key)] = rec
+	}
+
+	return found, nil
+}
+
+// fullChecksum returns the full-body checksum for algo from an
+// ObjectChecksums.
+func fullChecksum(algo *ChecksumAlgorithm, p *ObjectChecksums) *ObjectChecksum {
+	switch algo {
+	case ChecksumAlgorithmMD5:
+		return p.ChecksumMD5
+	case ChecksumAlgorithmSHA256:
+		return p.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		return p.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		return p.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		return p.ChecksumCRC32
+	}
+	return nil
+}
+
+// newComposeChunk returns the composeChunk for the object Key, as recorded in
+// the manifest record rec, with the size and ETag reported by S3 in head.  An
+// error wrapping errComposeChunk is returned if the ETag does not match that
+// recorded in the manifest, or if the manifest lacks the checksums needed.
+func newComposeChunk(Key string, rec *ObjectReporting, algo *ChecksumAlgorithm, head *s3.HeadObjectOutput) (*composeChunk, error) {
+	md5Sum := fullChecksum(ChecksumAlgorithmMD5, rec.FullChecksums)
+	algoSum := fullChecksum(algo, rec.FullChecksums)
+
+	if md5Sum == nil || algoSum == nil {
+		return nil, fmt.Errorf("%w: %s: no MD5 or %s checksum (set -checksum to that used for the chunks)",
+			errComposeChunk, Key, algo)
+	}
+
+	if rec.ObjectAttributes != nil && rec.ObjectAttributes.ETag != nil && head.ETag != nil {
+		expect := strings.Trim(*rec.ObjectAttributes.ETag, `"`)
+		actual := strings.Trim(*head.ETag, `"`)
+		if expect != actual {
+			return nil, fmt.Errorf("%w: %s: ETag expected %s got %s",
+				errComposeChunk, Key, expect, actual)
+		}
+	}
+
+	p := &composeChunk{
+		key: Key,
+	}
+
+	if head.ContentLength != nil {
+		p.size = *head.ContentLength
+	}
+
+	var err error
+
+	if p.md5, err = hex.DecodeString(md5Sum.Hex); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errComposeChunk, Key, err)
+	}
+
+	if p.sum, err = base64.StdEncoding.DecodeString(algoSum.Base64); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errComposeChunk, Key, err)
+	}
+
+	return p, nil
+}
+
+// checkComposeSizes returns an error if the chunks cannot be copied as parts,
+// every part but the last must be at least MinPartSize bytes, and no part may
+// be more than MaxPartSize bytes.
+func checkComposeSizes(chunks []*composeChunk) error {
+	if len(chunks) > int(DefaultMaxPartID) {
+		return fmt.Errorf("%d chunks exceeds the maximum of %d parts",
+			len(chunks), DefaultMaxPartID)
+	}
+
+	for i, c := range chunks {
+		if c.size > MaxPartSize {
+			return fmt.Errorf("chunk %s: %d bytes exceeds the maximum part size of %d",
+				c.key, c.size, MaxPartSize)
+		}
+
+		if i < len(chunks)-1 && c.size < MinPartSize {
+			return fmt.Errorf("chunk %s: %d bytes is less than the minimum part size of %d",
+				c.key, c.size, MinPartSize)
+		}
+	}
+
+	return nil
+}
+
+// composeSums returns the ETag and the base64 hash-of-hashes checksum S3 is
+// expected to report for an object composed of chunks.
+func composeSums(chunks []*composeChunk, algo *ChecksumAlgorithm) (string, string) {
+	md5Hash := NewHasher(ChecksumAlgorithmMD5)()
+	algoHash := NewHasher(algo)()
+
+	for _, c := range chunks {
+		md5Hash.Write(c.md5)
+		algoHash.Write(c.sum)
+	}
+
+	return fmt.Sprintf("%s-%d", HashSum(md5Hash.Sum(nil)).Hex(), len(chunks)),
+		fmt.Sprintf("%s-%d", HashSum(algoHash.Sum(nil)).Base64(), len(chunks))
+}
+
+// copySource returns the CopySource naming the object Key in Bucket, URL
+// encoded, including any '+' which S3 would otherwise decode as a space.
+func copySource(Bucket, Key string) string {
+	source := (&url.URL{Path: Bucket + "/" + Key}).EscapedPath()
+	return strings.ReplaceAll(source, "+", "%2B")
+}
+
+// copyChunk copies the chunk as part partID of the upload, returning an error
+// if the part checksum reported by S3 does not match the manifest.
+func copyChunk(ctx context.Context, s3client *s3.Client, create *s3.CreateMultipartUploadInput, uploadID *string, partID int32, c *composeChunk, algo *ChecksumAlgorithm, opts *Options) (*types.CompletedPart, error) {
+	source := copySource(*create.Bucket, c.key)
+
+	if opts.Verbose {
+		log.Printf("copying %s as part %d of %s/%s", source, partID, *create.Bucket, *create.Key)
+	}
+
+	partCtx, cancel := withTimeout(ctx, opts.UploadPartTimeout)
+	defer cancel()
+
+	out, err := s3client.UploadPartCopy(partCtx, &s3.UploadPartCopyInput{
+		Bucket:     create.Bucket,
+		Key:        create.Key,
+		UploadId:   uploadID,
+		PartNumber: &partID,
+		CopySource: &source,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.CopyPartResult == nil {
+		return nil, fmt.Errorf("no result copying %s", source)
+	}
+
+	res := out.CopyPartResult
+
+	completed := &types.CompletedPart{
+		PartNumber:     &partID,
+		ETag:           res.ETag,
+		ChecksumCRC32:  res.ChecksumCRC32,
+		ChecksumCRC32C: res.ChecksumCRC32C,
+		ChecksumSHA1:   res.ChecksumSHA1,
+		ChecksumSHA256: res.ChecksumSHA256,
+	}
+
+	expect := c.sum.Base64()
+
+	var actual *string
+	switch algo {
+	case ChecksumAlgorithmSHA256:
+		actual = res.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		actual = res.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		actual = res.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		actual = res.ChecksumCRC32
+	}
+
+	if actual == nil {
+		// S3 did not report a part checksum, set the manifest value
+		// so that S3 verifies it when the upload is completed
+		switch algo {
+		case ChecksumAlgorithmSHA256:
+			completed.ChecksumSHA256 = &expect
+		case ChecksumAlgorithmSHA1:
+			completed.ChecksumSHA1 = &expect
+		case ChecksumAlgorithmCRC32C:
+			completed.ChecksumCRC32C = &expect
+		case ChecksumAlgorithmCRC32:
+			completed.ChecksumCRC32 = &expect
+		}
+	} else if *actual != expect {
+		return nil, fmt.Errorf("%w: part %d (%s) %s expected %s got %s",
+			ErrChecksumMismatch, partID, c.key, algo, expect, *actual)
+	}
+
+	return completed, nil
+}
+
+// composeObject creates the object Key in Bucket from chunks using
+// UploadPartCopy, so that no data is transferred by the client, aborting the
+// upload if any chunk cannot be copied.  The ETag and checksum S3 reports for
+// the completed object are compared against those expected from the manifest.
+func composeObject(ctx context.Context, Bucket, Key string, chunks []*composeChunk, algo *ChecksumAlgorithm, opts *Options) error {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:            &Bucket,
+		Key:               &Key,
+		ChecksumAlgorithm: algo.Type(),
+		Metadata:          runMetadata(opts.RunID),
+	}
+
+	opts.objOpt.applyCreateMultipartUpload(create)
+
+	createCtx, cancel := withTimeout(ctx, opts.CreateUploadTimeout)
+	created, err := s3client.CreateMultipartUpload(createCtx, create)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	abort := func() {
+		abortCtx, cancel := withTimeout(context.Background(), opts.AbortUploadTimeout)
+		defer cancel()
+
+		if _, err := s3client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   &Bucket,
+			Key:      &Key,
+			UploadId: created.UploadId,
+		}); err != nil {
+			log.Printf("unable to abort upload: %s/%s (upload-id %s): %s",
+				Bucket, Key, *created.UploadId, err)
+		}
+	}
+
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          &Bucket,
+		Key:             &Key,
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{},
+	}
+
+	for i, c := range chunks {
+		part, err := copyChunk(ctx, s3client, create, created.UploadId, int32(i+1), c, algo, opts)
+		if err != nil {
+			abort()
+			return fmt.Errorf("unable to copy %s: %w", c.key, err)
+		}
+
+		complete.MultipartUpload.Parts = append(complete.MultipartUpload.Parts, *part)
+	}
+
+	completeCtx, cancel := withTimeout(ctx, opts.CompleteUploadTimeout)
+	out, err := s3client.CompleteMultipartUpload(completeCtx, complete)
+	cancel()
+	if err != nil {
+		abort()
+		return err
+	}
+
+	expectETag, expectChecksum := composeSums(chunks, algo)
+
+	v := &UploadVerification{
+		ETag:           VerificationUnavailable,
+		Checksum:       VerificationUnavailable,
+		expectETag:     expectETag,
+		expectChecksum: expectChecksum,
+	}
+
+	if out.ETag != nil {
+		v.actualETag = strings.Trim(*out.ETag, `"`)
+		v.ETag = VerificationMatch
+		if v.actualETag != expectETag {
+			v.ETag = VerificationMismatch
+		}
+	}
+
+	if actual := map[*ChecksumAlgorithm]*string{
+		ChecksumAlgorithmCRC32:  out.ChecksumCRC32,
+		ChecksumAlgorithmCRC32C: out.ChecksumCRC32C,
+		ChecksumAlgorithmSHA1:   out.ChecksumSHA1,
+		ChecksumAlgorithmSHA256: out.ChecksumSHA256,
+	}[algo]; actual != nil {
+		v.actualChecksum = *actual
+		v.Checksum = VerificationMatch
+		if v.actualChecksum != expectChecksum {
+			v.Checksum = VerificationMismatch
+		}
+	}
+
+	return v.Err()
+}
+
+// runCompose implements "s3up compose", creating the object named by -key
+// from the chunk objects named by <keys> (in the same bucket, in order) using
+// UploadPartCopy, after checking each chunk against -compose-manifest.
+func runCompose(ctx context.Context, args []string) error {
+	opts, err := processFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.key == "" || strings.HasSuffix(opts.key, "/") || len(opts.globs) == 0 {
+		return errComposeArgs
+	}
+
+	if opts.ComposeManifest == "" {
+		return errComposeManifest
+	}
+
+	fh, err := os.Open(opts.ComposeManifest)
+	if err != nil {
+		return err
+	}
+
+	records, err := readManifestRecords(fh)
+	fh.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read -compose-manifest: %s: %w", opts.ComposeManifest, err)
+	}
+
+	if !opts.DisableRegionDetect {
+		useBucketRegion(ctx, opts.bucket, opts)
+	}
+
+	if opts.PathStyle == PathStyleAuto {
+		useAddressing(ctx, opts.bucket, opts)
+	}
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	var chunks []*composeChunk
+
+	for _, Key := range opts.globs {
+		rec, ok := records[path.Join(opts.bucket, Key)]
+		if !ok {
+			return fmt.Errorf("%w: %s/%s is not listed", errComposeChunk, opts.bucket, Key)
+		}
+
+		head, err := s3client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:       &opts.bucket,
+			Key:          &Key,
+			ChecksumMode: types.ChecksumModeEnabled,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to read chunk %s/%s: %w", opts.bucket, Key, err)
+		}
+
+		c, err := newComposeChunk(Key, rec, opts.ChecksumAlgorithm, head)
+		if err != nil {
+			return err
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	if err := checkComposeSizes(chunks); err != nil {
+		return err
+	}
+
+	if err := composeObject(ctx, opts.bucket, opts.key, chunks, opts.ChecksumAlgorithm, opts); err != nil {
+		return err
+	}
+
+	log.Printf("composed %s/%s from %d chunks", opts.bucket, opts.key, len(chunks))
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestComposeChunks(t *testing.T) {
+	manifest := `[
+  {"RunMetadata": {"RunID": "run-1"}},
+  {
+    "Bucket": "b",
+    "Key": "chunks/a.000",
+    "Completed": true,
+    "FullChecksums": {
+      "ChecksumMD5": {"Hex": "0cc175b9c0f1b6a831c399e269772661", "Base64": "DMF1ucDxtqgxw5niaXcmYQ=="},
+      "ChecksumSHA256": {"Hex": "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", "Base64": "ypeBEsobvcr6wjGzmiPcTaeG7/gUfE5yuYB3ha/uSLs="}
+    },
+    "ObjectAttributes": {"ETag": "0cc175b9c0f1b6a831c399e269772661"}
+  },
+  {"Bucket": "b", "Key": "chunks/a.001", "Completed": false},
+  {"RunEnd": {"RunID": "run-1"}}
+]`
+
+	records, err := readManifestRecords(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records["b/chunks/a.000"] == nil {
+		t.Fatalf("expected only the completed object, got %v", records)
+	}
+
+	rec := records["b/chunks/a.000"]
+
+	for i, tst := range []struct {
+		algo *ChecksumAlgorithm
+		etag string
+		err  error
+	}{
+		{ChecksumAlgorithmSHA256, `"0cc175b9c0f1b6a831c399e269772661"`, nil},
+		{ChecksumAlgorithmSHA256, `"92eb5ffee6ae2fec3ad71c777531578f"`, errComposeChunk},
+		{ChecksumAlgorithmCRC32C, `"0cc175b9c0f1b6a831c399e269772661"`, errComposeChunk},
+	} {
+		head := &s3.HeadObjectOutput{
+			ETag:          aws.String(tst.etag),
+			ContentLength: aws.Int64(1),
+		}
+
+		c, err := newComposeChunk("chunks/a.000", rec, tst.algo, head)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+			continue
+		}
+
+		if err == nil && (c.size != 1 || c.md5.Hex() != "0cc175b9c0f1b6a831c399e269772661") {
+			t.Errorf("%d unexpected chunk %+v", i, c)
+		}
+	}
+}
+
+func TestComposeSums(t *testing.T) {
+	a := []byte(strings.Repeat("a", 10))
+	b := []byte(strings.Repeat("b", 10))
+
+	chunk := func(data []byte) *composeChunk {
+		m := md5.Sum(data)
+		s := sha256.Sum256(data)
+		return &composeChunk{md5: m[:], sum: s[:], size: MinPartSize}
+	}
+
+	chunks := []*composeChunk{chunk(a), chunk(b)}
+
+	// the same sums are predicted for parts uploaded by S3Hasher
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, int64(len(a)))
+	s3hw.Write(append(a, b...))
+
+	etag, sum := composeSums(chunks, ChecksumAlgorithmSHA256)
+	if etag != s3hw.ETag() {
+		t.Errorf("expected ETag %s, got %s", s3hw.ETag(), etag)
+	}
+
+	if expect := s3hw.SumOfSums().Base64() + "-2"; sum != expect {
+		t.Errorf("expected checksum %s, got %s", expect, sum)
+	}
+
+	if err := checkComposeSizes(chunks); err != nil {
+		t.Errorf("expected valid sizes, got %s", err)
+	}
+
+	chunks[0].size = MinPartSize - 1
+	if err := checkComposeSizes(chunks); err == nil {
+		t.Errorf("expected error for a small chunk")
+	}
+
+	if s := copySource("b", "a b/c+d.dat"); s != "b/a%20b/c%2Bd.dat" {
+		t.Errorf("expected escaped copy source, got %s", s)
+	}
+}
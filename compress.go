@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var errCompressOptions = errors.New(
+	"-compress cannot be combined with -sync, -dedupe-db, -range-offset or -range-length")
+
+var errCompressNotFile = errors.New(
+	"compressed source is not a file")
+
+// Compression records the decision made by -compress for a source, for
+// reporting in the manifest.  Encoding is set if the source was compressed,
+// otherwise Skipped names the format it was already compressed with.
+type Compression struct {
+	Encoding string `json:",omitempty"`
+	Skipped  string `json:",omitempty"`
+
+	// sourceSize is the size of the uncompressed source, once it is read
+	sourceSize int64
+}
+
+// compressedMagic lists the leading bytes of compressed formats.
+var compressedMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"bzip2", []byte("BZh")},
+	{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}},
+	{"zip", []byte("PK\x03\x04")},
+	{"7z", []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+}
+
+// compressedExts maps the extensions of compressed formats, including media
+// formats that are compressed, to the format name.
+var compressedExts = map[string]string{
+	".gz":   "gzip",
+	".tgz":  "gzip",
+	".zst":  "zstd",
+	".xz":   "xz",
+	".txz":  "xz",
+	".bz2":  "bzip2",
+	".tbz2": "bzip2",
+	".lz4":  "lz4",
+	".zip":  "zip",
+	".7z":   "7z",
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".webp": "webp",
+	".mp3":  "mp3",
+	".mp4":  "mp4",
+	".mkv":  "mkv",
+}
+
+// compressedFormat returns the name of the compressed format of a source
+// named name starting with head, either by its extension or by the magic
+// number of the format, or "" if the source is not known to be compressed.
+func compressedFormat(name string, head []byte) string {
+	if format, ok := compressedExts[strings.ToLower(path.Ext(name))]; ok {
+		return format
+	}
+
+	for _, m := range compressedMagic {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+
+	return ""
+}
+
+// applyCompress applies -compress to obj, replacing its source with one
+// reading it compressed using gzip unless it is already compressed.  The
+// Content-Type is set from the uncompressed source, and the decision is
+// recorded for the manifest.
+func applyCompress(obj *uploadObject, opts *Options) error {
+	head := make([]byte, sniffLen)
+
+	var n int
+	var err error
+
+	if r, ok := obj.rc.(io.ReaderAt); ok {
+		n, err = r.ReadAt(head, 0)
+	} else {
+		// sources that cannot be read twice are peeked at instead
+		br := bufio.NewReaderSize(obj.rc, sniffLen)
+		head, err = br.Peek(sniffLen)
+		n = len(head)
+
+		obj.rc = &struct {
+			io.Reader
+			io.Closer
+		}{br, obj.rc}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if format := compressedFormat(obj.key, head[0:n]); format != "" {
+		obj.compression = &Compression{Skipped: format}
+		return nil
+	}
+
+	typ := obj.objOpt.withDefaults(opts.objOpt).mediaType(obj.key)
+	if typ == "application/octet-stream" && opts.SniffMediaTypes && n > 0 {
+		typ = http.DetectContentType(head[0:n])
+	}
+
+	objOpt := &ObjectOptions{}
+	if obj.objOpt != nil {
+		*objOpt = *obj.objOpt
+	}
+	objOpt.ContentType = typ
+	objOpt.ContentEncoding = "gzip"
+
+	obj.objOpt = objOpt
+	obj.compression = &Compression{Encoding: "gzip"}
+	obj.rc = &compressReadCloser{src: obj.rc, compression: obj.compression, mu: &sync.Mutex{}}
+
+	return nil
+}
+
+// compressReadCloser reads a source compressed using gzip, closing the source
+// once done.  The source is not read until the first call to Read, and if it
+// is a file it may still be stat'ed and locked (see statSource and
+// lockSource).
+type compressReadCloser struct {
+	src io.ReadCloser
+
+	// compression records the size of the source once it is read
+	compression *Compression
+
+	mu     *sync.Mutex
+	pr     *io.PipeReader
+	closed bool
+}
+
+// reader returns the compressed stream, starting to compress the source if
+// it has not yet been started.
+func (p *compressReadCloser) reader() *io.PipeReader {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pr != nil || p.closed {
+		return p.pr
+	}
+
+	pr, pw := io.Pipe()
+	p.pr = pr
+
+	go func(src io.Reader, pw *io.PipeWriter, compression *Compression) {
+		zw := gzip.NewWriter(pw)
+
+		buf := copyBuf.Get(copyBufSize)
+		defer copyBuf.Put(buf)
+
+		n, err := io.CopyBuffer(zw, src, buf)
+		if err == nil {
+			err = zw.Close()
+		}
+
+		// set before the compressed stream ends, so it is read once
+		// the upload completes
+		compression.sourceSize = n
+
+		pw.CloseWithError(err)
+	}(p.src, pw, p.compression)
+
+	return pr
+}
+
+func (p *compressReadCloser) Read(b []byte) (int, error) {
+	pr := p.reader()
+	if pr == nil {
+		return 0, os.ErrClosed
+	}
+	return pr.Read(b)
+}
+
+func (p *compressReadCloser) Stat() (os.FileInfo, error) {
+	if fh, ok := p.src.(interface{ Stat() (os.FileInfo, error) }); ok {
+		return fh.Stat()
+	}
+	return nil, errCompressNotFile
+}
+
+func (p *compressReadCloser) Fd() uintptr {
+	if fh, ok := p.src.(interface{ Fd() uintptr }); ok {
+		return fh.Fd()
+	}
+	return ^uintptr(0)
+}
+
+func (p *compressReadCloser) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	pr := p.pr
+	p.mu.Unlock()
+
+	if pr != nil {
+		pr.Close()
+	}
+
+	return p.src.Close()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Validate compressed sources are recognized by extension or magic number
+func TestCompressedFormat(t *testing.T) {
+	for i, tst := range []struct {
+		name   string
+		head   []byte
+		expect string
+	}{
+		{"a.txt", []byte("hello"), ""},
+		{"a.txt", nil, ""},
+		{"a.TGZ", nil, "gzip"},
+		{"a.jpg", nil, "jpeg"},
+		{"a", []byte{0x1f, 0x8b, 0x08}, "gzip"},
+		{"a", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, "zstd"},
+		{"a", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+		{"a", []byte("BZh91AY"), "bzip2"},
+	} {
+		actual := compressedFormat(tst.name, tst.head)
+		if actual != tst.expect {
+			t.Errorf("%d expected %q, got %q", i, tst.expect, actual)
+		}
+	}
+}
+
+// Validate -compress compresses sources that are not already compressed,
+// leaving the others to be uploaded as they are
+func TestApplyCompress(t *testing.T) {
+	dir := t.TempDir()
+
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(text)
+	zw.Close()
+
+	for i, tst := range []struct {
+		key      string
+		content  []byte
+		file     bool
+		expect   Compression
+		expectCT string
+	}{
+		{"a.txt", text, true, Compression{Encoding: "gzip"}, "text/plain; charset=utf-8"},
+		{"a.txt", text, false, Compression{Encoding: "gzip"}, "text/plain; charset=utf-8"},
+		{"a.bin", gz.Bytes(), true, Compression{Skipped: "gzip"}, ""},
+		{"a.bin", gz.Bytes(), false, Compression{Skipped: "gzip"}, ""},
+		{"empty", nil, true, Compression{Encoding: "gzip"}, "application/octet-stream"},
+	} {
+		obj := &uploadObject{bucket: "bucket", key: tst.key}
+
+		if tst.file {
+			name := filepath.Join(dir, tst.key)
+			if err := os.WriteFile(name, tst.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			fh, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj.rc = fh
+		} else {
+			obj.rc = io.NopCloser(bytes.NewBuffer(tst.content))
+		}
+
+		if err := applyCompress(obj, &Options{}); err != nil {
+			t.Errorf("%d unexpected error: %v", i, err)
+			continue
+		}
+
+		if obj.compression == nil || *obj.compression != tst.expect {
+			t.Errorf("%d expected %+v, got %+v", i, tst.expect, obj.compression)
+		}
+
+		var r io.Reader = obj.rc
+		if tst.expect.Encoding != "" {
+			if obj.objOpt.ContentEncoding != "gzip" || obj.objOpt.ContentType != tst.expectCT {
+				t.Errorf("%d expected gzip %s, got %+v", i, tst.expectCT, obj.objOpt)
+			}
+
+			if _, err := obj.rc.(interface{ Stat() (os.FileInfo, error) }).Stat(); (err == nil) != tst.file {
+				t.Errorf("%d expected Stat to succeed for files, got %v", i, err)
+			}
+
+			zr, err := gzip.NewReader(obj.rc)
+			if err != nil {
+				t.Errorf("%d unexpected error: %v", i, err)
+				obj.rc.Close()
+				continue
+			}
+			r = zr
+		} else if obj.objOpt != nil {
+			t.Errorf("%d expected no ObjectOptions, got %+v", i, obj.objOpt)
+		}
+
+		buf, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(buf, tst.content) {
+			t.Errorf("%d expected the source content, got %d bytes %v", i, len(buf), err)
+		}
+
+		if tst.expect.Encoding != "" && obj.compression.sourceSize != int64(len(tst.content)) {
+			t.Errorf("%d expected source size %d, got %d", i, len(tst.content), obj.compression.sourceSize)
+		}
+
+		obj.rc.Close()
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errDryRunChecksumOnly = errors.New(
+	"-dry-run cannot be combined with -checksum-only")
+
+// StoragePrice lists the price in USD of storing a GiB for a month, and of
+// 1000 PUT (PutObject, CreateMultipartUpload, UploadPart, and
+// CompleteMultipartUpload) requests, in a storage class.
+type StoragePrice struct {
+	PerGiBMonth float64
+	Per1000Puts float64
+}
+
+// PriceTable maps storage classes to their StoragePrice.
+type PriceTable map[types.StorageClass]StoragePrice
+
+// DefaultPriceTable lists approximate list prices for us-east-1, which are
+// sufficient for sanity checking the scale of a run but are not a quote.
+var DefaultPriceTable = PriceTable{
+	types.StorageClassStandard:           {0.023, 0.005},
+	types.StorageClassIntelligentTiering: {0.023, 0.005},
+	types.StorageClassStandardIa:         {0.0125, 0.01},
+	types.StorageClassOnezoneIa:          {0.01, 0.01},
+	types.StorageClassGlacierIr:          {0.004, 0.02},
+	types.StorageClassGlacier:            {0.0036, 0.03},
+	types.StorageClassDeepArchive:        {0.00099, 0.05},
+	types.StorageClassReducedRedundancy:  {0.024, 0.005},
+	types.StorageClassExpressOnezone:     {0.11, 0.00113},
+}
+
+// ReadPriceTable reads a PriceTable from r, starting from the
+// DefaultPriceTable.  Each line lists a storage class, the price per
+// GiB-month, and the price per 1000 PUT requests, separated by whitespace.
+// Blank lines and lines starting with # are ignored.
+func ReadPriceTable(r io.Reader) (PriceTable, error) {
+	prices := maps.Clone(DefaultPriceTable)
+
+	scanner := bufio.NewScanner(r)
+
+	lineno := 0
+	for scanner.Scan() {
+		lineno += 1
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected storage class, price per GiB-month, and price per 1000 PUTs", lineno)
+		}
+
+		class, err := parseStorageClass(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+
+		var price StoragePrice
+
+		if price.PerGiBMonth, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %w", lineno, err)
+		}
+
+		if price.Per1000Puts, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %w", lineno, err)
+		}
+
+		prices[class] = price
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// readPriceTableFile reads a PriceTable from the file at name.
+func readPriceTableFile(name string) (PriceTable, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	return ReadPriceTable(fh)
+}
+
+// classEstimate totals the objects that would be uploaded in a storage class.
+type classEstimate struct {
+	nobjects  int
+	nbytes    int64
+	nrequests int64
+}
+
+// costEstimate totals the requests and storage needed to upload objects,
+// without uploading them (see -dry-run).
+type costEstimate struct {
+	partSize int64
+	classes  map[types.StorageClass]*classEstimate
+
+	// nunknown counts the objects whose size is not known in advance,
+	// e.g., URLs, which are not included in the estimate
+	nunknown int
+}
+
+// newCostEstimate returns an empty costEstimate for objects uploaded using
+// parts of partSize.
+func newCostEstimate(partSize int64) *costEstimate {
+	return &costEstimate{
+		partSize: partSize,
+		classes:  map[types.StorageClass]*classEstimate{},
+	}
+}
+
+// add adds an object of size bytes in the storage class to the estimate, an
+// object with fewer than two parts is uploaded using a single PutObject
+// request, otherwise CreateMultipartUpload, UploadPart for each part, and
+// CompleteMultipartUpload requests are made.
+func (p *costEstimate) add(size int64, class types.StorageClass) {
+	if class == "" {
+		class = types.StorageClassStandard
+	}
+
+	est := p.classes[class]
+	if est == nil {
+		est = &classEstimate{}
+		p.classes[class] = est
+	}
+
+	parts := (size + p.partSize - 1) / p.partSize
+
+	est.nobjects += 1
+	est.nbytes += size
+
+	if parts <= 1 {
+		est.nrequests += 1
+	} else {
+		est.nrequests += parts + 2
+	}
+}
+
+// addObject adds an uploadObject to the estimate, using the storage class
+// set by its ObjectOptions or the defaults.
+func (p *costEstimate) addObject(obj *uploadObject, defaults *ObjectOptions) {
+	fi, ok := localFileInfo(obj.rc)
+	if !ok {
+		p.nunknown += 1
+		return
+	}
+
+	var class types.StorageClass
+	if objOpt := obj.objOpt.withDefaults(defaults); objOpt != nil {
+		class = objOpt.StorageClass
+	}
+
+	p.add(fi.Size(), class)
+}
+
+// lines returns a summary of the estimate, with a line per storage class and
+// the total, priced using prices.
+func (p *costEstimate) lines(prices PriceTable) []string {
+	GiB := float64(1024 * 1024 * 1024)
+
+	var lines []string
+	var nobjects int
+	var nbytes, nrequests int64
+	var storageCost, requestCost float64
+
+	classes := make([]types.StorageClass, 0, len(p.classes))
+	for class := range p.classes {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	for _, class := range classes {
+		est := p.classes[class]
+
+		nobjects += est.nobjects
+		nbytes += est.nbytes
+		nrequests += est.nrequests
+
+		price, ok := prices[class]
+		if !ok {
+			lines = append(lines, fmt.Sprintf(
+				"%s: %d objects, %s, %d requests (no price known)",
+				class, est.nobjects, ByteSize(est.nbytes), est.nrequests))
+			continue
+		}
+
+		storage := float64(est.nbytes) / GiB * price.PerGiBMonth
+		requests := float64(est.nrequests) / 1000 * price.Per1000Puts
+
+		storageCost += storage
+		requestCost += requests
+
+		lines = append(lines, fmt.Sprintf(
+			"%s: %d objects, %s, %d requests, $%.2f/month storage, $%.2f requests",
+			class, est.nobjects, ByteSize(est.nbytes), est.nrequests, storage, requests))
+	}
+
+	lines = append(lines, fmt.Sprintf(
+		"total: %d objects, %s, %d requests, $%.2f/month storage, $%.2f requests",
+		nobjects, ByteSize(nbytes), nrequests, storageCost, requestCost))
+
+	if p.nunknown > 0 {
+		lines = append(lines, fmt.Sprintf(
+			"%d objects of unknown size are not included", p.nunknown))
+	}
+
+	return lines
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Validate the number of requests estimated for objects of various sizes
+func TestCostEstimate(t *testing.T) {
+	for i, tst := range []struct {
+		size      int64
+		nrequests int64
+	}{
+		{0, 1},
+		{1, 1},
+		{100, 1},
+		{101, 4},
+		{1000, 12},
+	} {
+		est := newCostEstimate(100)
+		est.add(tst.size, "")
+
+		if got := est.classes[types.StorageClassStandard].nrequests; got != tst.nrequests {
+			t.Errorf("%d expected %d got %d", i, tst.nrequests, got)
+		}
+	}
+
+	prices, err := ReadPriceTable(strings.NewReader(`
+# storage-class  per-GiB-month  per-1000-PUTs
+deep_archive     1              1000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	est := newCostEstimate(1024 * 1024 * 1024)
+	est.add(2*1024*1024*1024, types.StorageClassDeepArchive)
+	est.add(1024*1024*1024, types.StorageClassStandard)
+	est.nunknown = 1
+
+	lines := est.lines(prices)
+
+	for i, tst := range []string{
+		"DEEP_ARCHIVE: 1 objects, 2GiB, 4 requests, $2.00/month storage, $4.00 requests",
+		"STANDARD: 1 objects, 1GiB, 1 requests, $0.02/month storage, $0.00 requests",
+		"total: 2 objects, 3GiB, 5 requests, $2.02/month storage, $4.00 requests",
+		"1 objects of unknown size are not included",
+	} {
+		if i >= len(lines) || lines[i] != tst {
+			t.Errorf("%d expected %q got %q", i, tst, lines)
+		}
+	}
+
+	for i, s := range []string{
+		"STANDARD 0.023",
+		"NOT_A_CLASS 1 1",
+		"STANDARD one 1",
+	} {
+		if _, err := ReadPriceTable(strings.NewReader(s)); err == nil {
+			t.Errorf("%d expected error got nil", i)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// createBucket creates Bucket in the region the s3.Client is configured for,
+// optionally enabling versioning and object lock per
+// Options.CreateBucketVersioning and Options.CreateBucketObjectLock.
+func createBucket(ctx context.Context, s3client *s3.Client, Bucket string, opts *Options) error {
+	region := s3client.Options().Region
+
+	log.Printf("creating bucket %s (region %s)", Bucket, region)
+
+	create := &s3.CreateBucketInput{
+		Bucket: &Bucket,
+	}
+
+	// us-east-1 is the default location, and must not be specified as a
+	// location constraint
+	if region != "" && region != "us-east-1" {
+		create.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+
+	// enabling object lock also enables versioning
+	if opts.CreateBucketObjectLock {
+		create.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+
+	if _, err := s3client.CreateBucket(ctx, create); err != nil {
+		return err
+	}
+
+	if opts.CreateBucketVersioning && !opts.CreateBucketObjectLock {
+		if opts.Verbose {
+			log.Printf("enabling versioning for bucket %s", Bucket)
+		}
+
+		_, err := s3client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+			Bucket: &Bucket,
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
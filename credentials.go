@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var errStaticCredentials = errors.New(
+	"-access-key and -secret-key must be specified together")
+
+var errNoSignStatic = errors.New(
+	"-no-sign-request cannot be combined with -access-key or -secret-key")
+
+var errNoSignRole = errors.New(
+	"-no-sign-request cannot be combined with -role-arn")
+
+var errCredentialFile = errors.New(
+	"a credential may be specified by flag or by file, not both")
+
+// readCredential returns value, or the contents of the file name (with any
+// leading and trailing white space removed) if one was specified.
+func readCredential(value, name string) (string, error) {
+	if name == "" {
+		return value, nil
+	}
+
+	if value != "" {
+		return "", errCredentialFile
+	}
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// credentialFilesInterval is how often files providing credentials are checked
+// for changes.
+const credentialFilesInterval = time.Minute
+
+// credentialFile associates a static credential with the file it is read from.
+type credentialFile struct {
+	value *string
+	name  string
+}
+
+// credentialFiles returns each static credential and the file it is read from.
+func (p *Options) credentialFiles() []credentialFile {
+	return []credentialFile{
+		{&p.AccessKey, p.AccessKeyFile},
+		{&p.SecretKey, p.SecretKeyFile},
+		{&p.SessionToken, p.SessionTokenFile},
+	}
+}
+
+// fileCredentials implements aws.CredentialsProvider for static credentials,
+// any of which may be read from files.  The returned credentials expire after
+// credentialFilesInterval, so that they are retrieved again and any files that
+// have been modified since they were last read are reloaded.
+type fileCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	files    []credentialFile
+	modTimes map[string]time.Time
+	mu       *sync.Mutex
+}
+
+// newFileCredentials initializes a new fileCredentials using the static
+// credentials and files specified in opts.
+func newFileCredentials(opts *Options) *fileCredentials {
+	p := &fileCredentials{
+		accessKey:    opts.AccessKey,
+		secretKey:    opts.SecretKey,
+		sessionToken: opts.SessionToken,
+		modTimes:     map[string]time.Time{},
+		mu:           &sync.Mutex{},
+	}
+
+	for _, file := range []credentialFile{
+		{&p.accessKey, opts.AccessKeyFile},
+		{&p.secretKey, opts.SecretKeyFile},
+		{&p.sessionToken, opts.SessionTokenFile},
+	} {
+		if file.name != "" {
+			p.files = append(p.files, file)
+		}
+	}
+
+	return p
+}
+
+func (p *fileCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, file := range p.files {
+		fi, err := os.Stat(file.name)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+
+		if fi.ModTime().Equal(p.modTimes[file.name]) {
+			continue
+		}
+
+		value, err := readCredential("", file.name)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+
+		if _, ok := p.modTimes[file.name]; ok && value != *file.value {
+			log.Printf("reloaded credentials from %s", file.name)
+		}
+
+		*file.value = value
+		p.modTimes[file.name] = fi.ModTime()
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     p.accessKey,
+		SecretAccessKey: p.secretKey,
+		SessionToken:    p.sessionToken,
+		Source:          "s3up command line",
+	}
+
+	if len(p.files) > 0 {
+		creds.CanExpire = true
+		creds.Expires = time.Now().Add(credentialFilesInterval)
+	}
+
+	return creds, nil
+}
+
+// checkCredentials validates the static credentials and roles specified on
+// the command line, if any.
+func checkCredentials(opts *Options) error {
+	if opts.NoSignRequest && len(opts.RoleARNs) > 0 {
+		return errNoSignRole
+	}
+
+	if opts.AccessKey == "" && opts.SecretKey == "" && opts.SessionToken == "" {
+		return nil
+	}
+
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return errStaticCredentials
+	}
+
+	if opts.NoSignRequest {
+		return errNoSignStatic
+	}
+
+	return nil
+}
+
+// assumeRoles returns a copy of cfg whose credentials are those of the last of
+// roles, each role being assumed in turn using the credentials of the one
+// before it (role chaining), starting with the credentials of cfg.
+func assumeRoles(cfg aws.Config, roles []string) aws.Config {
+	cfg = cfg.Copy()
+
+	for _, role := range roles {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role)
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg
+}
+
+// configLoadOptions returns the options used to load the AWS configuration,
+// selecting the profile and any credentials specified on the command line.
+func configLoadOptions(opts *Options) []func(*config.LoadOptions) error {
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithSharedConfigProfile(opts.Profile),
+	}
+
+	// a region given directly takes precedence over the environment and
+	// the profile, which then need not configure one
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(opts.Region))
+	}
+
+	// requests are sent unsigned, so no credentials need to be found
+	if opts.NoSignRequest {
+		loadOpts = append(loadOpts,
+			config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+
+	// static credentials take the place of the credential chain (the
+	// environment, shared files, and instance metadata)
+	if opts.AccessKey != "" {
+		loadOpts = append(loadOpts,
+			config.WithCredentialsProvider(
+				aws.NewCredentialsCache(newFileCredentials(opts))))
+	}
+
+	return loadOpts
+}
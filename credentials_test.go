@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+func TestConfigLoadOptions(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	opts := &Options{NoSignRequest: true}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), configLoadOptions(opts)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !aws.IsCredentialsProvider(cfg.Credentials, aws.AnonymousCredentials{}) {
+		t.Errorf("expected anonymous credentials got %T", cfg.Credentials)
+	}
+
+	// -region takes precedence over the environment
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	for i, tst := range []struct {
+		region string
+		expect string
+	}{
+		{"", "us-west-2"},
+		{"minio", "minio"},
+	} {
+		opts := &Options{Region: tst.region}
+
+		cfg, err := config.LoadDefaultConfig(context.Background(), configLoadOptions(opts)...)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if cfg.Region != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, cfg.Region)
+		}
+	}
+}
+
+func TestStaticCredentials(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENVIRONMENT")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "environment")
+
+	name := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(name, []byte("  secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := readCredential("", name)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := readCredential("value", name); !errors.Is(err, errCredentialFile) {
+		t.Errorf("expected errCredentialFile got %v", err)
+	}
+
+	opts := &Options{AccessKey: "AKID", SecretKey: secret, SessionToken: "token"}
+	if err := checkCredentials(opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), configLoadOptions(opts)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" {
+		t.Errorf("expected AKID, secret, token got %s, %s, %s",
+			creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	}
+
+	for i, opts := range []*Options{
+		{AccessKey: "AKID"},
+		{SecretKey: "secret"},
+		{SessionToken: "token"},
+	} {
+		if err := checkCredentials(opts); !errors.Is(err, errStaticCredentials) {
+			t.Errorf("%d expected errStaticCredentials got %v", i, err)
+		}
+	}
+
+	opts = &Options{AccessKey: "AKID", SecretKey: "secret", NoSignRequest: true}
+	if err := checkCredentials(opts); !errors.Is(err, errNoSignStatic) {
+		t.Errorf("expected errNoSignStatic got %v", err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(name, []byte("token1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newFileCredentials(&Options{
+		AccessKey:        "AKID",
+		SecretKey:        "secret",
+		SessionTokenFile: name,
+	})
+
+	for i, expect := range []string{"token1", "token2"} {
+		if i > 0 {
+			if err := os.WriteFile(name, []byte(expect), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		creds, err := p.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if creds.AccessKeyID != "AKID" || creds.SessionToken != expect {
+			t.Errorf("%d expected AKID, %s got %s, %s",
+				i, expect, creds.AccessKeyID, creds.SessionToken)
+		}
+
+		if !creds.CanExpire {
+			t.Errorf("%d expected credentials to expire", i)
+		}
+	}
+}
+
+func TestAssumeRoles(t *testing.T) {
+	cfg := aws.Config{Credentials: aws.AnonymousCredentials{}}
+
+	chained := assumeRoles(cfg, []string{
+		"arn:aws:iam::111111111111:role/a",
+		"arn:aws:iam::222222222222:role/b",
+	})
+
+	if !aws.IsCredentialsProvider(chained.Credentials, (*stscreds.AssumeRoleProvider)(nil)) {
+		t.Errorf("expected *stscreds.AssumeRoleProvider got %T", chained.Credentials)
+	}
+
+	if !aws.IsCredentialsProvider(cfg.Credentials, aws.AnonymousCredentials{}) {
+		t.Errorf("expected the original config to be unchanged got %T", cfg.Credentials)
+	}
+
+	opts := &Options{NoSignRequest: true, RoleARNs: []string{"arn"}}
+	if err := checkCredentials(opts); !errors.Is(err, errNoSignRole) {
+		t.Errorf("expected errNoSignRole got %v", err)
+	}
+}
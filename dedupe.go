@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errDedupeModeWithoutDB = errors.New(
+	"-dedupe-mode requires -dedupe-db")
+
+// maxCopyObjectSize is the largest object that may be copied using a single
+// CopyObject request.
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+// dedupeMode represents how sources whose content was already uploaded are
+// handled by -dedupe-db.
+type dedupeMode int
+
+const (
+	// Skip uploading the source
+	DedupeModeSkip dedupeMode = iota
+
+	// Copy the existing object to the key of the source, server-side
+	DedupeModeCopy
+)
+
+// DedupeMode represents a dedupeMode, with helper functions to parse and
+// produce human readable representations of the identifier for use via the
+// flag module.
+type DedupeMode dedupeMode
+
+func (p DedupeMode) String() string {
+	switch dedupeMode(p) {
+	case DedupeModeCopy:
+		return "copy"
+	default:
+		return "skip"
+	}
+}
+
+func (p *DedupeMode) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "skip":
+		*p = DedupeMode(DedupeModeSkip)
+	case "copy":
+		*p = DedupeMode(DedupeModeCopy)
+	default:
+		return fmt.Errorf("valid dedupe modes: skip, copy")
+	}
+
+	return nil
+}
+
+// DedupeEntry records an object uploaded with the full-body Checksum, encoded
+// as <algorithm>:<base64>, and Size.
+type DedupeEntry struct {
+	Checksum string
+	Size     int64
+	Bucket   string
+	Key      string
+}
+
+// DedupeDB is a database of the content checksums of uploaded objects, stored
+// as JSON lines (one DedupeEntry per line) which are appended to as objects
+// are uploaded, so that later runs can find sources already uploaded.
+type DedupeDB struct {
+	entries map[string]*DedupeEntry
+	w       io.WriteCloser
+	mu      *sync.Mutex
+}
+
+// dedupeKey returns the key for an entry with checksum and size.
+func dedupeKey(checksum string, size int64) string {
+	return fmt.Sprintf("%s:%d", checksum, size)
+}
+
+// dedupeChecksum encodes a full-body checksum for a DedupeEntry.
+func dedupeChecksum(algo *ChecksumAlgorithm, sum HashSum) string {
+	return algo.String() + ":" + sum.Base64()
+}
+
+// ReadDedupeDB reads the entries of a DedupeDB from r, lines that cannot be
+// parsed are logged and skipped.
+func ReadDedupeDB(r io.Reader) (*DedupeDB, error) {
+	p := &DedupeDB{
+		entries: map[string]*DedupeEntry{},
+		mu:      &sync.Mutex{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	lineno := 0
+	for scanner.Scan() {
+		lineno += 1
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry := &DedupeEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			log.Printf("skipping -dedupe-db line %d: %s", lineno, err)
+			continue
+		}
+
+		p.entries[dedupeKey(entry.Checksum, entry.Size)] = entry
+	}
+
+	return p, scanner.Err()
+}
+
+// OpenDedupeDB reads the DedupeDB at name, creating it if it does not exist,
+// and opens it for appending entries with Record.
+func OpenDedupeDB(name string) (*DedupeDB, error) {
+	fh, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ReadDedupeDB(fh)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("error reading -dedupe-db: %s: %w", name, err)
+	}
+
+	p.w = fh
+
+	return p, nil
+}
+
+// Lookup returns the entry for an object with the same checksum and size, or
+// nil if there is none.
+func (p *DedupeDB) Lookup(checksum string, size int64) *DedupeEntry {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.entries[dedupeKey(checksum, size)]
+}
+
+// Record adds entry to the database if there is not already an entry with the
+// same checksum and size.
+func (p *DedupeDB) Record(entry *DedupeEntry) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := dedupeKey(entry.Checksum, entry.Size)
+	if _, ok := p.entries[key]; ok {
+		return nil
+	}
+
+	p.entries[key] = entry
+
+	if p.w == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(append(buf, '\n'))
+
+	return err
+}
+
+// recordUpload adds the object uploaded per res to the database.
+func (p *DedupeDB) recordUpload(res *UploadResults) error {
+	if p == nil || res.Error != nil || res.State == nil || res.State.checksumOnly || res.State.hr == nil {
+		return nil
+	}
+
+	hr := res.State.hr
+
+	return p.Record(&DedupeEntry{
+		Checksum: dedupeChecksum(hr.ChecksumAlgorithm(), hr.Sum()),
+		Size:     hr.Size(),
+		Bucket:   res.Bucket,
+		Key:      res.Key,
+	})
+}
+
+// Close closes the database file.
+func (p *DedupeDB) Close() error {
+	if p == nil || p.w == nil {
+		return nil
+	}
+	return p.w.Close()
+}
+
+// duplicate hashes obj, returning the entry for an object already uploaded
+// with the same content, or nil if there is none, along with the size of obj.
+// Sources that cannot be rewound after being hashed are not checked.
+func (p *DedupeDB) duplicate(obj *uploadObject, algo *ChecksumAlgorithm) (*DedupeEntry, int64, error) {
+	if p == nil {
+		return nil, 0, nil
+	}
+
+	seeker, ok := obj.rc.(io.Seeker)
+	if !ok {
+		return nil, 0, nil
+	}
+
+	h := NewHasher(algo)()
+
+	buf := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(buf)
+
+	size, err := io.CopyBuffer(h, obj.rc, buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	return p.Lookup(dedupeChecksum(algo, h.Sum(nil)), size), size, nil
+}
+
+// copyDuplicate copies the object recorded by entry to Bucket and Key using a
+// server-side CopyObject request, applying objOpt as though the object was
+// uploaded.
+func copyDuplicate(ctx context.Context, entry *DedupeEntry, Bucket, Key string, objOpt *ObjectOptions, opts *Options) (*s3.CopyObjectOutput, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	source := copySource(entry.Bucket, entry.Key)
+
+	params := &s3.CopyObjectInput{
+		Bucket:     &Bucket,
+		Key:        &Key,
+		CopySource: &source,
+	}
+	objOpt.applyCopyObject(params, opts.RunID)
+
+	return s3client.CopyObject(ctx, params)
+}
+
+// dedupe checks obj against Options.dedupe, returning the S3UploadState to
+// report in the manifest if the upload of obj should be skipped because its
+// content was already uploaded, either elsewhere (with DedupeModeSkip) or by
+// copying the existing object to the key of obj (with DedupeModeCopy), or
+// nil if obj should be uploaded.
+func (p *DedupeDB) dedupe(ctx context.Context, obj *uploadObject, opts *Options) *S3UploadState {
+	if p == nil {
+		return nil
+	}
+
+	entry, size, err := p.duplicate(obj, opts.ChecksumAlgorithm)
+	if err != nil {
+		log.Printf("error checking %s/%s against -dedupe-db: %s", obj.bucket, obj.key, err)
+		return nil
+	}
+
+	if entry == nil {
+		return nil
+	}
+
+	st := &S3UploadState{
+		obj:         &s3.PutObjectInput{Bucket: &obj.bucket, Key: &obj.key},
+		duplicateOf: entry,
+		runID:       opts.RunID,
+		source:      obj.source,
+		mu:          &sync.Mutex{},
+	}
+
+	// the same content was already uploaded to this key
+	if entry.Bucket == obj.bucket && entry.Key == obj.key {
+		if opts.Verbose {
+			log.Printf("skipping unchanged object %s/%s", obj.bucket, obj.key)
+		}
+		return st
+	}
+
+	if opts.DedupeMode == DedupeModeSkip {
+		if opts.Verbose {
+			log.Printf("skipping duplicate object %s/%s of %s/%s",
+				obj.bucket, obj.key, entry.Bucket, entry.Key)
+		}
+		return st
+	}
+
+	// objects too large for CopyObject are uploaded
+	if size > maxCopyObjectSize || opts.ChecksumOnly || opts.DryRun {
+		return nil
+	}
+
+	if opts.Verbose {
+		log.Printf("copying duplicate object %s/%s from %s/%s",
+			obj.bucket, obj.key, entry.Bucket, entry.Key)
+	}
+
+	out, err := copyDuplicate(ctx, entry, obj.bucket, obj.key, obj.objOpt.withDefaults(opts.objOpt), opts)
+	if err != nil {
+		log.Printf("error copying %s/%s from %s/%s, uploading instead: %s",
+			obj.bucket, obj.key, entry.Bucket, entry.Key, err)
+		return nil
+	}
+
+	st.copyOutput = out
+
+	return st
+}
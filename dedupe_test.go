@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Validate that entries recorded in a DedupeDB are found by later runs
+func TestDedupeDB(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dedupe.jsonl")
+
+	db, err := OpenDedupeDB(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*DedupeEntry{
+		{Checksum: "SHA256:abc=", Size: 10, Bucket: "bucket", Key: "a"},
+		{Checksum: "SHA256:abc=", Size: 10, Bucket: "bucket", Key: "b"},
+		{Checksum: "SHA256:abc=", Size: 11, Bucket: "bucket", Key: "c"},
+	}
+
+	for _, entry := range entries {
+		if err := db.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first entry with a given checksum and size is retained
+	if db, err = OpenDedupeDB(name); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		checksum string
+		size     int64
+		key      string
+	}{
+		{"SHA256:abc=", 10, "a"},
+		{"SHA256:abc=", 11, "c"},
+		{"SHA256:abc=", 12, ""},
+		{"SHA1:abc=", 10, ""},
+	}
+
+	for i, test := range tests {
+		entry := db.Lookup(test.checksum, test.size)
+		if test.key == "" {
+			if entry != nil {
+				t.Errorf("%d expected no entry got %v", i, entry)
+			}
+		} else if entry == nil || entry.Key != test.key {
+			t.Errorf("%d expected key %s got %v", i, test.key, entry)
+		}
+	}
+}
+
+// Validate that sources already in a DedupeDB are skipped
+func TestDedupeSkip(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"a", "b", "c"} {
+		content := "duplicate"
+		if name == "c" {
+			content = "unique"
+		}
+
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := OpenDedupeDB(filepath.Join(dir, "dedupe.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hr := NewS3HashWriter(ChecksumAlgorithmSHA256, MinPartSize)
+	hr.Write([]byte("duplicate"))
+
+	db.Record(&DedupeEntry{
+		Checksum: dedupeChecksum(ChecksumAlgorithmSHA256, hr.Sum()),
+		Size:     hr.Size(),
+		Bucket:   "bucket",
+		Key:      "a",
+	})
+
+	opts := &Options{ChecksumAlgorithm: ChecksumAlgorithmSHA256}
+
+	tests := []struct {
+		key    string
+		expect bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+	}
+
+	for i, test := range tests {
+		fh, err := os.Open(filepath.Join(dir, test.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj := &uploadObject{bucket: "bucket", key: test.key, rc: fh}
+
+		if skip := db.dedupe(context.Background(), obj, opts) != nil; skip != test.expect {
+			t.Errorf("%d expected skip %v got %v", i, test.expect, skip)
+		}
+
+		// the source is rewound to be uploaded
+		if pos, _ := fh.Seek(0, 1); pos != 0 {
+			t.Errorf("%d expected source to be rewound got offset %d", i, pos)
+		}
+
+		fh.Close()
+	}
+}
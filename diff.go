@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errDiffWithoutGlobs = errors.New(
+	"diff requires one or more <globs> to compare")
+
+// diffStatus represents the outcome of comparing a local source against the
+// remote object at the same key.
+type diffStatus string
+
+const (
+	// The local source and remote object appear to be the same
+	DiffSame diffStatus = "same"
+
+	// There is a local source but no remote object
+	DiffMissingRemote diffStatus = "missing-remote"
+
+	// There is a remote object but no local source
+	DiffMissingLocal diffStatus = "missing-local"
+
+	// The local source and remote object differ in size
+	DiffSizeMismatch diffStatus = "size-mismatch"
+
+	// The local source and remote object are the same size but their
+	// checksums differ
+	DiffChecksumMismatch diffStatus = "checksum-mismatch"
+)
+
+// listRemote lists the objects in Bucket under the prefix Key, or the single
+// object named by a non-prefix Key, returning them by key name.
+func listRemote(ctx context.Context, Bucket, Key string, opts *Options) (map[string]types.Object, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	paginator := s3.NewListObjectsV2Paginator(s3client, &s3.ListObjectsV2Input{
+		Bucket: &Bucket,
+		Prefix: &Key,
+	})
+
+	remote := map[string]types.Object{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			// a non-prefix Key names a single object
+			if Key != "" && !strings.HasSuffix(Key, "/") && *obj.Key != Key {
+				continue
+			}
+
+			remote[*obj.Key] = obj
+		}
+	}
+
+	return remote, nil
+}
+
+// localSize returns the size of a source if it is known, i.e., if the source
+// is a file.
+func localSize(rc io.ReadCloser) (int64, bool) {
+	if fi, ok := localFileInfo(rc); ok {
+		return fi.Size(), true
+	}
+	return 0, false
+}
+
+// localFileInfo returns the os.FileInfo of rc if it is a file.
+func localFileInfo(rc io.ReadCloser) (os.FileInfo, bool) {
+	if fh, ok := rc.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := fh.Stat(); err == nil {
+			return fi, true
+		}
+	}
+	return nil, false
+}
+
+// compareObject compares a local source against the remote object at the same
+// key (which may be nil if there is none).  If the sizes match then the source
+// is read to compare its ETag against the remote ETag (see matchETag).
+func compareObject(obj *uploadObject, remote *types.Object, opts *Options) (diffStatus, error) {
+	if remote == nil {
+		return DiffMissingRemote, nil
+	}
+
+	if size, ok := localSize(obj.rc); ok && remote.Size != nil && size != *remote.Size {
+		return DiffSizeMismatch, nil
+	}
+
+	if remote.ETag == nil {
+		return DiffChecksumMismatch, nil
+	}
+
+	match, err := matchETag(obj.rc, *remote.ETag, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if !match {
+		return DiffChecksumMismatch, nil
+	}
+
+	return DiffSame, nil
+}
+
+// runDiff implements the "s3up diff" command, reporting how the local sources
+// listed by <globs> differ from the remote objects under -key, without
+// transferring anything.  Each difference is written to standard output as
+// the status followed by the bucket/key path.
+func runDiff(ctx context.Context, args []string) error {
+	opts, err := processFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.globs) == 0 {
+		return errDiffWithoutGlobs
+	}
+
+	if !opts.DisableRegionDetect {
+		useBucketRegion(ctx, opts.bucket, opts)
+	}
+
+	if opts.PathStyle == PathStyleAuto {
+		useAddressing(ctx, opts.bucket, opts)
+	}
+
+	remote, err := listRemote(ctx, opts.bucket, opts.key, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list %s/%s: %w", opts.bucket, opts.key, err)
+	}
+
+	local, err := processGlobs(ctx, opts.globs, opts.globOpts, opts.storageRules,
+		opts.snapshot, opts.bucket, opts.key, opts.Recursive, opts.Verbose)
+	if err != nil {
+		return err
+	}
+
+	report := func(status diffStatus, key string) {
+		if status != DiffSame || opts.Verbose {
+			fmt.Printf("%s  %s\n", status, path.Join(opts.bucket, key))
+		}
+	}
+
+	seen := map[string]bool{}
+
+	for obj := range local {
+		obj.key = objectKey(obj, opts)
+		seen[obj.key] = true
+
+		var rp *types.Object
+		if r, ok := remote[obj.key]; ok {
+			rp = &r
+		}
+
+		status, err := compareObject(obj, rp, opts)
+		obj.rc.Close()
+
+		if err != nil {
+			log.Printf("error comparing %s/%s: %s", obj.bucket, obj.key, err)
+			continue
+		}
+
+		report(status, obj.key)
+	}
+
+	var missing []string
+	for key := range remote {
+		if !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	slices.Sort(missing)
+
+	for _, key := range missing {
+		report(DiffMissingLocal, key)
+	}
+
+	return nil
+}
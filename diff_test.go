@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestCompareObject(t *testing.T) {
+	opts := &Options{
+		ChecksumAlgorithm: ChecksumAlgorithmSHA256,
+		PartSize:          MinPartSize,
+	}
+
+	data := []byte("hello world")
+
+	// md5 of "hello world"
+	etag := `"5eb63bbbe01eeed093cb22bb8f5acdc3"`
+
+	for i, tst := range []struct {
+		remote *types.Object
+		expect diffStatus
+	}{
+		{nil, DiffMissingRemote},
+		{&types.Object{Size: aws.Int64(11), ETag: aws.String(etag)}, DiffSame},
+		{&types.Object{Size: aws.Int64(11), ETag: aws.String(`"0"`)}, DiffChecksumMismatch},
+	} {
+		obj := &uploadObject{
+			key: "key",
+			rc:  io.NopCloser(bytes.NewReader(data)),
+		}
+
+		actual, err := compareObject(obj, tst.remote, opts)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if actual != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errDistributeArgs = errors.New(
+	"distribute requires -hosts, a non-prefix -key, and a single <file>")
+
+var errCompleteArgs = errors.New(
+	"complete requires -plan, as written by s3up distribute")
+
+var errRangeWithoutUploadID = errors.New(
+	"-range-offset and -range-length require -upload-id")
+
+var errRangeSource = errors.New(
+	"-range-offset and -range-length require a file source")
+
+var errPlanIncomplete = errors.New(
+	"the parts uploaded do not match the plan")
+
+// DistributedPlan describes a multi-part upload created by s3up distribute,
+// and the ranges of the source assigned to each host to upload.
+type DistributedPlan struct {
+	Bucket            string
+	Key               string
+	UploadId          string
+	PartSize          int64
+	ChecksumAlgorithm string
+	Size              int64
+	Parts             int32
+	Assignments       []*DistributedAssignment
+}
+
+// DistributedAssignment describes the range of parts assigned to a host, and
+// the s3up command line the host runs to upload them.
+type DistributedAssignment struct {
+	Host      int
+	StartPart int32
+	Parts     int32
+	Offset    int64
+	Length    int64
+	Command   []string
+}
+
+// planAssignments splits an object of size bytes, uploaded in parts of
+// partSize, into at most hosts contiguous ranges of whole parts, with the
+// parts shared as evenly as possible.
+func planAssignments(size, partSize int64, hosts int) []*DistributedAssignment {
+	nparts := int32((size + partSize - 1) / partSize)
+	if nparts == 0 {
+		nparts = 1
+	}
+
+	if int32(hosts) > nparts {
+		hosts = int(nparts)
+	}
+
+	base := nparts / int32(hosts)
+	extra := nparts % int32(hosts)
+
+	var assignments []*DistributedAssignment
+
+	startPart := int32(1)
+	for host := 0; host < hosts; host++ {
+		parts := base
+		if int32(host) < extra {
+			parts += 1
+		}
+
+		offset := int64(startPart-1) * partSize
+		length := min(int64(parts)*partSize, size-offset)
+
+		assignments = append(assignments, &DistributedAssignment{
+			Host:      host + 1,
+			StartPart: startPart,
+			Parts:     parts,
+			Offset:    offset,
+			Length:    length,
+		})
+
+		startPart += parts
+	}
+
+	return assignments
+}
+
+// workerCommand returns the s3up command line a host runs to upload the parts
+// in assignment a of plan p from the file name, passing on the options of
+// opts that select the endpoint, the credentials, and the encryption of the
+// upload.  Secrets are never written to the plan, so hosts using -access-key
+// or -secret-key must add them.
+func (p *DistributedPlan) workerCommand(a *DistributedAssignment, name string, opts *Options) []string {
+	cmd := []string{
+		"s3up",
+		"-bucket", p.Bucket,
+		"-key", p.Key,
+		"-upload-id", p.UploadId,
+		"-start-part", strconv.Itoa(int(a.StartPart)),
+		"-part-size", strconv.FormatInt(p.PartSize, 10),
+		"-checksum", p.ChecksumAlgorithm,
+		"-range-offset", strconv.FormatInt(a.Offset, 10),
+		"-range-length", strconv.FormatInt(a.Length, 10),
+	}
+
+	for _, endpoint := range opts.Endpoints {
+		cmd = append(cmd, "-endpoint", endpoint)
+	}
+
+	if opts.Region != "" {
+		cmd = append(cmd, "-region", opts.Region)
+	}
+
+	// the addressing found by distribute is used as is
+	if opts.PathStyle != PathStyleAuto {
+		cmd = append(cmd, "-path-style", PathStyle(opts.PathStyle).String())
+	}
+
+	if opts.UseDualStack {
+		cmd = append(cmd, "-use-dualstack")
+	}
+
+	if opts.UseFIPS {
+		cmd = append(cmd, "-use-fips")
+	}
+
+	if opts.Profile != "" {
+		cmd = append(cmd, "-profile", opts.Profile)
+	}
+
+	for _, role := range opts.RoleARNs {
+		cmd = append(cmd, "-role-arn", role)
+	}
+
+	if opts.NoSignRequest {
+		cmd = append(cmd, "-no-sign-request")
+	}
+
+	if opts.SSE != "" {
+		cmd = append(cmd, "-sse", opts.SSE)
+	}
+
+	if opts.SSEKMSKeyId != "" {
+		cmd = append(cmd, "-sse-kms-key-id", opts.SSEKMSKeyId)
+	}
+
+	if opts.DisableKMSPreflight {
+		cmd = append(cmd, "-disable-kms-preflight")
+	}
+
+	if opts.SSECustomerKey != "" {
+		cmd = append(cmd, "-sse-c-key", opts.SSECustomerKey)
+	}
+
+	return append(cmd, name)
+}
+
+// rangeReadCloser reads a range of a file, closing the file once done.
+type rangeReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// sourceRange returns an io.ReadCloser reading length bytes from offset of
+// rc, which must be an io.ReaderAt (i.e., a file).  A length of 0 reads to the
+// end of rc, which must then also be an io.Seeker.
+func sourceRange(rc io.ReadCloser, offset, length int64) (io.ReadCloser, error) {
+	r, ok := rc.(io.ReaderAt)
+	if !ok {
+		return nil, errRangeSource
+	}
+
+	if length == 0 {
+		s, ok := rc.(io.Seeker)
+		if !ok {
+			return nil, errRangeSource
+		}
+
+		size, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		length = max(size-offset, 0)
+	}
+
+	return &rangeReadCloser{
+		SectionReader: io.NewSectionReader(r, offset, length),
+		Closer:        rc,
+	}, nil
+}
+
+// runDistribute implements "s3up distribute", creating a multi-part upload
+// for a file and writing a DistributedPlan to standard output, assigning a
+// range of the parts to each of -hosts hosts.
+func runDistribute(ctx context.Context, args []string) error {
+	opts, err := processFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.bucket == "" {
+		return errMissingBucket
+	}
+
+	if opts.Hosts < 1 || opts.key == "" || strings.HasSuffix(opts.key, "/") || len(opts.globs) != 1 {
+		return errDistributeArgs
+	}
+
+	name := opts.globs[0]
+
+	fi, err := os.Stat(longPath(name))
+	if err != nil {
+		return err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file: %s", name)
+	}
+
+	if !opts.DisableRegionDetect {
+		useBucketRegion(ctx, opts.bucket, opts)
+	}
+
+	if opts.PathStyle == PathStyleAuto {
+		useAddressing(ctx, opts.bucket, opts)
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:            &opts.bucket,
+		Key:               &opts.key,
+		ChecksumAlgorithm: opts.ChecksumAlgorithm.Type(),
+		Metadata:          runMetadata(opts.RunID),
+	}
+
+	opts.objOpt.applyCreateMultipartUpload(create)
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	createCtx, cancel := withTimeout(ctx, opts.CreateUploadTimeout)
+	out, err := s3client.CreateMultipartUpload(createCtx, create)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	plan := &DistributedPlan{
+		Bucket:            opts.bucket,
+		Key:               opts.key,
+		UploadId:          *out.UploadId,
+		PartSize:          opts.PartSize,
+		ChecksumAlgorithm: opts.ChecksumAlgorithm.String(),
+		Size:              fi.Size(),
+		Assignments:       planAssignments(fi.Size(), opts.PartSize, opts.Hosts),
+	}
+
+	for _, a := range plan.Assignments {
+		plan.Parts += a.Parts
+		a.Command = plan.workerCommand(a, name, opts)
+	}
+
+	log.Printf("created upload of %s/%s (upload-id %s) with %d parts across %d hosts",
+		plan.Bucket, plan.Key, plan.UploadId, plan.Parts, len(plan.Assignments))
+
+	buf, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("%s\n", buf)
+
+	return err
+}
+
+// completePlan returns the CompleteMultipartUploadInput for the upload
+// described by plan, using the parts listed by the server.  An error
+// wrapping errPlanIncomplete is returned if any part is missing, or if the
+// parts do not add up to the size of the source.
+func completePlan(plan *DistributedPlan, parts map[int32]types.Part) (*s3.CompleteMultipartUploadInput, error) {
+	algo, err := parseChecksumAlgorithm(plan.ChecksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          &plan.Bucket,
+		Key:             &plan.Key,
+		UploadId:        &plan.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{},
+	}
+
+	var missing []string
+	var size int64
+
+	for partID := int32(1); partID <= plan.Parts; partID++ {
+		part, ok := parts[partID]
+		if !ok {
+			missing = append(missing, strconv.Itoa(int(partID)))
+			continue
+		}
+
+		if part.Size != nil {
+			size += *part.Size
+		}
+
+		completed := types.CompletedPart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		}
+
+		switch algo {
+		case ChecksumAlgorithmSHA256:
+			completed.ChecksumSHA256 = part.ChecksumSHA256
+		case ChecksumAlgorithmSHA1:
+			completed.ChecksumSHA1 = part.ChecksumSHA1
+		case ChecksumAlgorithmCRC32C:
+			completed.ChecksumCRC32C = part.ChecksumCRC32C
+		case ChecksumAlgorithmCRC32:
+			completed.ChecksumCRC32 = part.ChecksumCRC32
+		}
+
+		complete.MultipartUpload.Parts = append(complete.MultipartUpload.Parts, completed)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing parts %s", errPlanIncomplete, strings.Join(missing, ", "))
+	}
+
+	if size != plan.Size {
+		return nil, fmt.Errorf("%w: %d bytes uploaded, expected %d", errPlanIncomplete, size, plan.Size)
+	}
+
+	return complete, nil
+}
+
+// runComplete implements "s3up complete", completing the multi-part upload
+// described by the DistributedPlan in -plan once every host has uploaded its
+// parts.  The bucket and key are those of the plan.
+func runComplete(ctx context.Context, args []string) error {
+	opts, err := processFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.Plan == "" {
+		return errCompleteArgs
+	}
+
+	buf, err := os.ReadFile(opts.Plan)
+	if err != nil {
+		return err
+	}
+
+	plan := &DistributedPlan{}
+	if err := json.Unmarshal(buf, plan); err != nil {
+		return fmt.Errorf("unable to read -plan: %s: %w", opts.Plan, err)
+	}
+
+	if !opts.DisableRegionDetect {
+		useBucketRegion(ctx, plan.Bucket, opts)
+	}
+
+	if opts.PathStyle == PathStyleAuto {
+		useAddressing(ctx, plan.Bucket, opts)
+	}
+
+	parts, err := listParts(ctx, &ResumeState{
+		Bucket:   plan.Bucket,
+		Key:      plan.Key,
+		UploadId: plan.UploadId,
+	}, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list parts of %s/%s (upload-id %s): %w",
+			plan.Bucket, plan.Key, plan.UploadId, err)
+	}
+
+	complete, err := completePlan(plan, parts)
+	if err != nil {
+		return err
+	}
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	completeCtx, cancel := withTimeout(ctx, opts.CompleteUploadTimeout)
+	defer cancel()
+
+	if _, err := s3client.CompleteMultipartUpload(completeCtx, complete); err != nil {
+		return fmt.Errorf("unable to complete %s/%s (upload-id %s): %w",
+			plan.Bucket, plan.Key, plan.UploadId, err)
+	}
+
+	log.Printf("completed %s/%s from %d parts", plan.Bucket, plan.Key, plan.Parts)
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestPlanAssignments(t *testing.T) {
+	type expect struct {
+		startPart, parts int32
+		offset, length   int64
+	}
+
+	for i, tst := range []struct {
+		size, partSize int64
+		hosts          int
+		expect         []expect
+	}{
+		{0, 10, 2, []expect{{1, 1, 0, 0}}},
+		{25, 10, 1, []expect{{1, 3, 0, 25}}},
+		{25, 10, 2, []expect{{1, 2, 0, 20}, {3, 1, 20, 5}}},
+		{25, 10, 5, []expect{{1, 1, 0, 10}, {2, 1, 10, 10}, {3, 1, 20, 5}}},
+		{100, 10, 3, []expect{{1, 4, 0, 40}, {5, 3, 40, 30}, {8, 3, 70, 30}}},
+	} {
+		assignments := planAssignments(tst.size, tst.partSize, tst.hosts)
+		if len(assignments) != len(tst.expect) {
+			t.Errorf("%d expected %d assignments, got %d", i, len(tst.expect), len(assignments))
+			continue
+		}
+
+		for j, a := range assignments {
+			e := tst.expect[j]
+			if a.Host != j+1 || a.StartPart != e.startPart || a.Parts != e.parts ||
+				a.Offset != e.offset || a.Length != e.length {
+				t.Errorf("%d.%d expected %v, got %+v", i, j, e, a)
+			}
+		}
+	}
+}
+
+// Validate the command of each host passes on the options that select the
+// endpoint, credentials, and encryption of the upload
+func TestWorkerCommand(t *testing.T) {
+	plan := &DistributedPlan{
+		Bucket:            "b",
+		Key:               "k",
+		UploadId:          "u",
+		PartSize:          10,
+		ChecksumAlgorithm: "SHA256",
+	}
+
+	a := &DistributedAssignment{Host: 2, StartPart: 3, Parts: 1, Offset: 20, Length: 5}
+
+	base := []string{"s3up", "-bucket", "b", "-key", "k", "-upload-id", "u", "-start-part", "3",
+		"-part-size", "10", "-checksum", "SHA256", "-range-offset", "20", "-range-length", "5"}
+
+	for i, tst := range []struct {
+		opts   *Options
+		expect []string
+	}{
+		{&Options{}, nil},
+		{
+			&Options{
+				Endpoints:    []string{"https://a", "https://b"},
+				Region:       "us-west-2",
+				PathStyle:    PathStylePath,
+				UseDualStack: true,
+				Profile:      "p",
+				RoleARNs:     []string{"arn:r"},
+				SSE:          "aws:kms",
+				SSEKMSKeyId:  "kms",
+			},
+			[]string{"-endpoint", "https://a", "-endpoint", "https://b", "-region", "us-west-2",
+				"-path-style", "path", "-use-dualstack", "-profile", "p", "-role-arn", "arn:r",
+				"-sse", "aws:kms", "-sse-kms-key-id", "kms"},
+		},
+		{
+			&Options{SSECustomerKey: "sse.key", AccessKey: "id", SecretKey: "secret"},
+			[]string{"-sse-c-key", "sse.key"},
+		},
+	} {
+		expect := append(append(slices.Clone(base), tst.expect...), "big.dat")
+
+		actual := plan.workerCommand(a, "big.dat", tst.opts)
+		if !slices.Equal(actual, expect) {
+			t.Errorf("%d expected %v, got %v", i, expect, actual)
+		}
+	}
+}
+
+func TestSourceRange(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "source")
+	if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := sourceRange(fh, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a ranged file is still uploaded from its positions
+	if _, ok := rc.(io.ReaderAt); !ok {
+		t.Errorf("expected an io.ReaderAt")
+	}
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != "3456" {
+		t.Errorf("expected 3456, got %s", buf)
+	}
+
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err = os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err = sourceRange(fh, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if buf, _ := io.ReadAll(rc); string(buf) != "789" {
+		t.Errorf("expected 789, got %s", buf)
+	}
+
+	if _, err := sourceRange(io.NopCloser(nil), 0, 1); !errors.Is(err, errRangeSource) {
+		t.Errorf("expected %v, got %v", errRangeSource, err)
+	}
+}
+
+func TestCompletePlan(t *testing.T) {
+	plan := &DistributedPlan{
+		Bucket:            "b",
+		Key:               "k",
+		UploadId:          "u",
+		ChecksumAlgorithm: "SHA256",
+		Size:              25,
+		Parts:             3,
+	}
+
+	part := func(partID int32, size int64) types.Part {
+		return types.Part{
+			PartNumber:     aws.Int32(partID),
+			Size:           aws.Int64(size),
+			ETag:           aws.String("etag"),
+			ChecksumSHA256: aws.String("sum"),
+		}
+	}
+
+	for i, tst := range []struct {
+		parts map[int32]types.Part
+		err   error
+	}{
+		{map[int32]types.Part{1: part(1, 10), 2: part(2, 10), 3: part(3, 5)}, nil},
+		{map[int32]types.Part{1: part(1, 10), 3: part(3, 5)}, errPlanIncomplete},
+		{map[int32]types.Part{1: part(1, 10), 2: part(2, 10), 3: part(3, 4)}, errPlanIncomplete},
+	} {
+		complete, err := completePlan(plan, tst.parts)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if len(complete.MultipartUpload.Parts) != 3 {
+			t.Errorf("%d expected 3 parts, got %d", i, len(complete.MultipartUpload.Parts))
+		}
+
+		for _, p := range complete.MultipartUpload.Parts {
+			if p.ChecksumSHA256 == nil || *p.ChecksumSHA256 != "sum" {
+				t.Errorf("%d expected part checksum", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errProbeEndpoints = errors.New(
+	"-probe-endpoints requires more than one -endpoint")
+
+var errBadProbeEndpointsInterval = errors.New(
+	"-probe-endpoints-interval must not be negative")
+
+// endpointProbes is the number of HeadBucket requests made to each endpoint
+// by probeEndpoints, the fastest of which is taken as its latency, so that
+// connection set up is not counted.
+const endpointProbes = 3
+
+// endpointMaxWeight is the weight of the fastest endpoint, the weights of the
+// others are scaled down by how much slower they are.
+const endpointMaxWeight = 100
+
+// endpointWeights selects among the members of an S3ClientPool in proportion
+// to their weights, using smooth weighted round-robin so that the choices of
+// each member are spread out rather than made in runs.
+type endpointWeights struct {
+	mu      *sync.Mutex
+	weights []int
+	current []int
+}
+
+// newEndpointWeights initializes endpointWeights for n members, all with the
+// same weight.
+func newEndpointWeights(n int) *endpointWeights {
+	p := &endpointWeights{
+		mu:      &sync.Mutex{},
+		weights: make([]int, n),
+		current: make([]int, n),
+	}
+
+	for i := range p.weights {
+		p.weights[i] = 1
+	}
+
+	return p
+}
+
+// next returns the index of the member to use next.
+func (p *endpointWeights) next() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best, total := 0, 0
+	for i, w := range p.weights {
+		p.current[i] += w
+		total += w
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+
+	p.current[best] -= total
+
+	return best
+}
+
+// set replaces the weights, which must be as many as the members.
+func (p *endpointWeights) set(weights []int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	copy(p.weights, weights)
+	clear(p.current)
+}
+
+// latencyWeights returns the weight of each endpoint from its latency, in
+// inverse proportion to it and at least 1, or 0 for endpoints that did not
+// respond (latency < 0).  If none responded they are all weighted equally.
+func latencyWeights(latencies []time.Duration) []int {
+	fastest := time.Duration(-1)
+	for _, l := range latencies {
+		if l >= 0 && (fastest < 0 || l < fastest) {
+			fastest = l
+		}
+	}
+
+	weights := make([]int, len(latencies))
+	for i, l := range latencies {
+		switch {
+		case fastest < 0:
+			weights[i] = 1
+		case l < 0:
+			weights[i] = 0
+		case l == 0:
+			weights[i] = endpointMaxWeight
+		default:
+			weights[i] = max(1, int(endpointMaxWeight*fastest/l))
+		}
+	}
+
+	return weights
+}
+
+// probeEndpoint returns the latency of the endpoint served by pool, the
+// fastest of endpointProbes HeadBucket requests for Bucket, or -1 if it did
+// not respond.  Any response, even an error status, is counted.
+func probeEndpoint(ctx context.Context, Bucket string, pool *S3ClientPool) time.Duration {
+	s3client := pool.Get()
+	defer pool.Put(s3client)
+
+	latency := time.Duration(-1)
+	for i := 0; i < endpointProbes; i++ {
+		start := time.Now()
+		_, err := s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: &Bucket,
+		})
+		elapsed := time.Since(start)
+
+		if err != nil && preflightStatusCode(err) == 0 {
+			continue
+		}
+
+		if latency < 0 || elapsed < latency {
+			latency = elapsed
+		}
+	}
+
+	return latency
+}
+
+// probeEndpoints measures the latency of each of the endpoints of pool,
+// concurrently, and weights the choice of endpoint by Get towards the
+// fastest.
+func probeEndpoints(ctx context.Context, Bucket string, pool *S3ClientPool, verbose bool) {
+	latencies := make([]time.Duration, len(pool.members))
+
+	wg := &sync.WaitGroup{}
+	for i, member := range pool.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latencies[i] = probeEndpoint(ctx, Bucket, member)
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	weights := latencyWeights(latencies)
+	pool.weights.set(weights)
+
+	if verbose {
+		var probes []string
+		for i, member := range pool.members {
+			latency := "unreachable"
+			if latencies[i] >= 0 {
+				latency = latencies[i].Round(time.Microsecond).String()
+			}
+			probes = append(probes, member.endpoint+" "+latency)
+		}
+		log.Printf("probed endpoints: %s, weights %v", strings.Join(probes, ", "), weights)
+	}
+}
+
+// startEndpointProbes probes the endpoints of pool (see probeEndpoints), and
+// then again every interval (if > 0) until ctx is done.
+func startEndpointProbes(ctx context.Context, Bucket string, pool *S3ClientPool, interval time.Duration, verbose bool) {
+	if len(pool.members) < 2 {
+		return
+	}
+
+	pool.weights = newEndpointWeights(len(pool.members))
+
+	probeEndpoints(ctx, Bucket, pool, verbose)
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				probeEndpoints(ctx, Bucket, pool, verbose)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Validate endpoints are weighted in inverse proportion to their latency,
+// and unreachable endpoints are not used unless none are reachable
+func TestLatencyWeights(t *testing.T) {
+	for i, tst := range []struct {
+		latencies []time.Duration
+		expect    []int
+	}{
+		{[]time.Duration{time.Millisecond, 2 * time.Millisecond}, []int{100, 50}},
+		{[]time.Duration{time.Millisecond, time.Second}, []int{100, 1}},
+		{[]time.Duration{-1, time.Millisecond}, []int{0, 100}},
+		{[]time.Duration{-1, -1}, []int{1, 1}},
+		{[]time.Duration{0, time.Millisecond}, []int{100, 1}},
+	} {
+		actual := latencyWeights(tst.latencies)
+		if !slices.Equal(actual, tst.expect) {
+			t.Errorf("%d expected weights %v, got %v", i, tst.expect, actual)
+		}
+	}
+}
+
+// Validate probing the endpoints sends most requests to the fastest
+func TestProbeEndpoints(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer fast.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer slow.Close()
+
+	pool := NewS3ClientPool(true, aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, func(o *s3.Options) {
+		o.UsePathStyle = true
+		o.RetryMaxAttempts = 1
+	}).WithEndpoints([]string{slow.URL, fast.URL})
+
+	startEndpointProbes(context.Background(), "bucket", pool, 0, false)
+
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		s3client := pool.Get()
+		counts[aws.ToString(s3client.Options().BaseEndpoint)]++
+		pool.Put(s3client)
+	}
+
+	if counts[fast.URL] < 90 {
+		t.Errorf("expected at least 90 of 100 clients for the fast endpoint, got %d", counts[fast.URL])
+	}
+	if counts[slow.URL] == 0 {
+		t.Errorf("expected some clients for the slow endpoint, got none")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxETagCandidates limits the number of part sizes tried when comparing a
+// local source against a multi-part ETag, as each requires reading the source
+// in full.
+const maxETagCandidates = 8
+
+// commonPartSizes lists part sizes used by commonly used tools, tried in order
+// after the configured PartSize.
+var commonPartSizes = []int64{
+	8 * 1024 * 1024, // aws cli, boto3, rclone
+	MinPartSize,
+	16 * 1024 * 1024,
+	15 * 1024 * 1024,
+	64 * 1024 * 1024,
+	100 * 1024 * 1024,
+	128 * 1024 * 1024,
+	256 * 1024 * 1024,
+	512 * 1024 * 1024,
+	1024 * 1024 * 1024,
+}
+
+// parseETag splits an ETag into the hex MD5 sum and, for multi-part objects,
+// the number of parts.  The number of parts is 0 for objects uploaded in a
+// single request.
+func parseETag(etag string) (string, int) {
+	etag = strings.Trim(etag, `"`)
+
+	sum, count, found := strings.Cut(etag, "-")
+	if !found {
+		return etag, 0
+	}
+
+	parts, err := strconv.Atoi(count)
+	if err != nil || parts < 1 {
+		return etag, 0
+	}
+
+	return sum, parts
+}
+
+// etagPartSizes returns the part sizes that would split size bytes into
+// exactly parts parts, assuming every part but the last is the same size.
+// The preferred part size and commonPartSizes are listed first, followed by
+// multiples of 1 MiB, up to maxETagCandidates in total.
+func etagPartSizes(size int64, parts int, preferred int64) []int64 {
+	const mib = 1024 * 1024
+
+	fits := func(partSize int64) bool {
+		if partSize <= 0 || partSize > MaxPartSize {
+			return false
+		}
+		if parts > 1 && partSize < MinPartSize {
+			return false
+		}
+		if size == 0 {
+			return parts == 1
+		}
+		return (size+partSize-1)/partSize == int64(parts)
+	}
+
+	var sizes []int64
+
+	add := func(partSize int64) {
+		if len(sizes) < maxETagCandidates && fits(partSize) &&
+			!slices.Contains(sizes, partSize) {
+			sizes = append(sizes, partSize)
+		}
+	}
+
+	add(preferred)
+
+	for _, partSize := range commonPartSizes {
+		add(partSize)
+	}
+
+	// the smallest part size that splits size into parts parts
+	lower := (size + int64(parts) - 1) / int64(parts)
+
+	for partSize := (lower + mib - 1) / mib * mib; fits(partSize); partSize += mib {
+		if len(sizes) >= maxETagCandidates {
+			break
+		}
+		add(partSize)
+	}
+
+	if parts == 1 {
+		// a single part upload of the whole source
+		add(max(size, MinPartSize))
+	}
+
+	return sizes
+}
+
+// etagOf reads r and returns the ETag S3 would report for it if uploaded in
+// parts of partSize, or in a single request if parts is 0.
+func etagOf(r io.Reader, partSize int64, parts int) (string, error) {
+	buf := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(buf)
+
+	if parts == 0 {
+		h := NewHasher(ChecksumAlgorithmMD5)()
+		if _, err := io.CopyBuffer(h, r, buf); err != nil {
+			return "", err
+		}
+		return HashSum(h.Sum(nil)).Hex(), nil
+	}
+
+	hp := NewHashParts(ChecksumAlgorithmMD5, partSize)
+	if _, err := io.CopyBuffer(hp, r, buf); err != nil {
+		return "", err
+	}
+
+	return hp.SumOfSums().Hex(), nil
+}
+
+// matchETag compares rc against a remote ETag.  For multi-part ETags each of
+// the candidate part sizes from etagPartSizes is tried in turn, so that
+// objects uploaded by other tools with a different part size still match.
+// Sources that cannot be rewound are only compared using the configured
+// PartSize.
+func matchETag(rc io.ReadCloser, etag string, opts *Options) (bool, error) {
+	sum, parts := parseETag(etag)
+
+	if parts == 0 {
+		actual, err := etagOf(rc, 0, 0)
+		return err == nil && actual == sum, err
+	}
+
+	candidates := []int64{opts.PartSize}
+	if size, ok := localSize(rc); ok {
+		candidates = etagPartSizes(size, parts, opts.PartSize)
+	}
+
+	seeker, seekable := rc.(io.Seeker)
+
+	for i, partSize := range candidates {
+		if i > 0 {
+			if !seekable {
+				break
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return false, err
+			}
+		}
+
+		actual, err := etagOf(rc, partSize, parts)
+		if err != nil {
+			return false, err
+		}
+
+		if actual == sum {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
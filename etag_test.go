@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseETag(t *testing.T) {
+	for i, tst := range []struct {
+		etag  string
+		sum   string
+		parts int
+	}{
+		{`"5eb63bbbe01eeed093cb22bb8f5acdc3"`, "5eb63bbbe01eeed093cb22bb8f5acdc3", 0},
+		{`"d41d8cd98f00b204e9800998ecf8427e-12"`, "d41d8cd98f00b204e9800998ecf8427e", 12},
+		{"d41d8cd98f00b204e9800998ecf8427e-x", "d41d8cd98f00b204e9800998ecf8427e-x", 0},
+	} {
+		sum, parts := parseETag(tst.etag)
+		if sum != tst.sum || parts != tst.parts {
+			t.Errorf("%d expected %s, %d got %s, %d", i, tst.sum, tst.parts, sum, parts)
+		}
+	}
+}
+
+func TestETagPartSizes(t *testing.T) {
+	const mib = 1024 * 1024
+
+	for i, tst := range []struct {
+		size      int64
+		parts     int
+		preferred int64
+		expect    []int64
+	}{
+		// 100 MiB in 13 parts, only 8 MiB fits of the common sizes
+		{100 * mib, 13, MaxPartSize, []int64{8 * mib}},
+		// 100 MiB in 7 parts fits 15 and 16 MiB
+		{100 * mib, 7, 16 * mib, []int64{16 * mib, 15 * mib}},
+		// 20 MiB in 2 parts, the preferred size is tried first
+		{20 * mib, 2, 12 * mib, []int64{12 * mib, 16 * mib, 15 * mib, 10 * mib, 11 * mib, 13 * mib, 14 * mib, 17 * mib}},
+	} {
+		actual := etagPartSizes(tst.size, tst.parts, tst.preferred)
+		if !slices.Equal(actual, tst.expect) {
+			t.Errorf("%d expected %v got %v", i, tst.expect, actual)
+		}
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+
+	// ETag as uploaded with 8 MiB parts, e.g., by the aws cli
+	etag, err := etagOf(bytes.NewReader(data), 8*1024*1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	opts := &Options{PartSize: MinPartSize}
+
+	match, err := matchETag(rc, `"`+etag+`-2"`, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Errorf("expected ETag %s-2 to match", etag)
+	}
+}
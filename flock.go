@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var errFlockUnsupported = errors.New(
+	"-flock is not supported on this platform")
+
+// flockInterval is the time to wait between attempts to take a lock that is
+// held exclusively by another process.
+const flockInterval = 100 * time.Millisecond
+
+// lockSource takes a shared advisory lock on r if it is a regular file,
+// waiting for as long as another process holds an exclusive lock on it or
+// until ctx is canceled.  The returned function releases the lock.  Streams
+// are not locked.
+func lockSource(ctx context.Context, r io.Reader) (func(), error) {
+	fh, ok := r.(interface{ Fd() uintptr })
+	if !ok || statSource(r) == nil {
+		return func() {}, nil
+	}
+
+	return lockFD(ctx, fh.Fd(), false)
+}
+
+// lockFD takes an advisory lock on fd, exclusive or shared, waiting for as
+// long as another process holds a conflicting lock or until ctx is canceled.
+// The returned function releases the lock.
+func lockFD(ctx context.Context, fd uintptr, exclusive bool) (func(), error) {
+	for {
+		var locked bool
+		var err error
+
+		if exclusive {
+			locked, err = tryLockExclusive(fd)
+		} else {
+			locked, err = tryLockShared(fd)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if locked {
+			return func() { unlockFile(fd) }, nil
+		}
+
+		select {
+		case <-time.After(flockInterval):
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+// flockSupported is true if lockSource is able to lock files.
+const flockSupported = false
+
+// tryLockShared returns errFlockUnsupported, file locking is not available on
+// this platform.
+func tryLockShared(fd uintptr) (bool, error) {
+	return false, errFlockUnsupported
+}
+
+// tryLockExclusive returns errFlockUnsupported, file locking is not available
+// on this platform.
+func tryLockExclusive(fd uintptr) (bool, error) {
+	return false, errFlockUnsupported
+}
+
+// unlockFile does nothing, file locking is not available on this platform.
+func unlockFile(fd uintptr) error {
+	return nil
+}
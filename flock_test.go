@@ -0,0 +1,73 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Validate that lockSource waits for an exclusive lock to be released
+func TestLockSource(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "source.dat")
+	if err := os.WriteFile(name, []byte("Hello, World!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a producer holding an exclusive lock while writing
+	producer, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	// the descriptor is captured before the goroutine releasing the
+	// lock below is started
+	fd := int(producer.Fd())
+
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*flockInterval)
+	defer cancel()
+
+	if _, err := lockSource(ctx, fh); err == nil {
+		t.Fatalf("expected lockSource to wait for the exclusive lock")
+	}
+
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(2 * flockInterval)
+		released <- syscall.Flock(fd, syscall.LOCK_UN)
+	}()
+
+	unlock, err := lockSource(context.Background(), fh)
+	if err := <-released; err != nil {
+		t.Fatalf("unable to release the exclusive lock: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("expected lock got %v", err)
+	}
+
+	// the producer cannot lock the file again until it is unlocked
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+		t.Errorf("expected the shared lock to be held")
+	}
+
+	unlock()
+
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Errorf("expected the shared lock to be released got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// flockSupported is true if lockSource is able to lock files.
+const flockSupported = true
+
+// tryLockShared attempts to take a shared lock on fd without blocking, it
+// returns false if another process holds an exclusive lock.
+func tryLockShared(fd uintptr) (bool, error) {
+	err := syscall.Flock(int(fd), syscall.LOCK_SH|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// tryLockExclusive attempts to take an exclusive lock on fd without blocking,
+// it returns false if another process holds a lock.
+func tryLockExclusive(fd uintptr) (bool, error) {
+	err := syscall.Flock(int(fd), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases a lock taken on fd.
+func unlockFile(fd uintptr) error {
+	return syscall.Flock(int(fd), syscall.LOCK_UN)
+}
@@ -6,7 +6,19 @@ const godoc_cmd_pkg string = `NAME
 
 SYNOPSIS
 
-    s3up [ <options> ] [ <globs> ]
+    s3up [ <options> ] [ [ -set name=value ... ] <globs> ... ]
+
+    s3up diff [ <options> ] <globs> ...
+
+    s3up repair [ <options> ] <file>
+
+    s3up compose [ <options> ] -key <key> <chunk keys> ...
+
+    s3up distribute [ <options> ] -hosts <n> -key <key> <file>
+
+    s3up complete [ <options> ] -plan <plan>
+
+    s3up export-manifest [ -run-id <id> ] <file>
 
 DESCRIPTION
 
@@ -35,15 +47,145 @@ DESCRIPTION
     globs are provided then s3up will read from the standard input stream,
     in which case a non-prefix -key name is required.
 
+    On Windows any drive letter or volume prefix, e.g., C: or
+    \\server\share, is removed when generating key names from filepaths,
+    and paths longer than 260 characters may be uploaded.
+
+    A glob may also be an http:// or https:// URL, in which case the URL
+    is fetched and the response streamed into the upload without being
+    stored locally (other than any buffering of parts, see -use-memory and
+    -use-temp-dir).  The last element of the URL path is used in place of
+    the filepath name when generating the object key.  A URI whose scheme
+    has a source backend registered by an application embedding the
+    uploader (see RegisterSource), e.g., s3://bucket/key, is neither
+    fetched nor globbed, the backend reads it.
+
+    Globs may be grouped with settings that apply only to the files they
+    match, by preceding each group of globs with one or more -set options,
+    e.g.,
+
+    	s3up -bucket b -set content-type=text/csv 'data/*.csv' \
+    		-set storage-class=GLACIER 'raw/*'
+
+    The recognized settings are content-type, storage-class, tags
+    (encoded as key1=value1&key2=value2), priority, and source.  The
+    settings of a group take precedence over -content-type and -source.  If no globs are provided
+    then any -set settings apply to the standard input stream or -jobs
+    file.
+
+    A priority (an integer, by default 0) may also be set using
+    "-priority n" in place of "-set priority=n".  Groups of globs with
+    different priorities are processed concurrently, and files from a
+    higher priority group are uploaded ahead of those from lower priority
+    groups, e.g., to upload urgent files ahead of bulk backfill data,
+
+    	s3up -bucket b 'backfill/' -priority 10 'urgent/*'
+
+    The diff command compares the files matched by <globs> against the
+    objects under the -key prefix, without transferring anything, and
+    writes a line for each difference found to standard output, e.g.,
+
+    	missing-remote  bucket/prefix/new.dat
+    	size-mismatch  bucket/prefix/changed.dat
+    	checksum-mismatch  bucket/prefix/edited.dat
+    	missing-local  bucket/prefix/removed.dat
+
+    Files that are the same size as the remote object are read to
+    compare the ETag predicted using -part-size against the remote ETag.
+    If the remote object was uploaded in a different number of parts,
+    e.g., by another tool, the part size it used is inferred from the
+    number of parts in the remote ETag, and the ETag is predicted again
+    using each likely part size (the -part-size, the defaults of common
+    tools such as 8 MiB, then multiples of 1 MiB) before the file is
+    reported as a checksum-mismatch.
+    With -verbose, files that are the same are also listed.
+
+    The repair command completes a multi-part upload left pending by an
+    earlier run (see -leave-parts-on-error) without uploading the whole
+    file again.  The parts held by the server are listed and compared
+    against the parts of <file>, the source of the upload, and only the
+    parts that are missing or whose size, ETag, or checksum does not match
+    are uploaded before the upload is completed (the ETag is not compared
+    with -sse aws:kms or -sse-c-key, as it is then not the MD5 of the
+    part), e.g.,
+
+    	s3up repair -bucket b -state-file state.json big.dat
+
+    The upload is selected from the -state-file by -bucket, and by
+    -upload-id or -key if the file lists more than one upload, and is
+    repaired using the part size and checksum algorithm recorded there.
+    Without a -state-file the upload is named by -bucket, -key, and
+    -upload-id, and the -part-size and -checksum must match those the
+    upload was started with.
+
+    The compose command creates the object named by -key from existing
+    chunk objects in the same bucket, e.g., the pieces of a file that was
+    split before it was uploaded, using UploadPartCopy so that no data is
+    transferred by s3up.  Each chunk becomes a part of the object, in the
+    order listed, so every chunk but the last must be at least 5 MiB and
+    none may be more than 5 GiB.  The chunks must be listed in the json
+    manifest produced when they were uploaded, given by -compose-manifest,
+    e.g.,
+
+    	s3up -bucket b -manifest json chunks/* > chunks.json
+    	s3up compose -bucket b -key big.dat -compose-manifest chunks.json \
+    		chunks/big.dat.000 chunks/big.dat.001 chunks/big.dat.002
+
+    The ETag of each chunk is compared against the manifest before any
+    are copied, the part checksum S3 reports for each copy is compared
+    against the full checksum of the chunk in the manifest (-checksum
+    must match that used to upload the chunks), and the ETag and checksum
+    of the composed object against those predicted from the manifest.
+
+    The distribute and complete commands upload a single large file from
+    several hosts that share it (e.g., over a parallel filesystem).  The
+    distribute command creates a multi-part upload for the object named
+    by -key and writes a json plan to standard output, assigning a range
+    of whole parts of the file to each of -hosts hosts along with the
+    s3up command line each host runs to upload them, e.g.,
+
+    	s3up distribute -bucket b -key big.dat -hosts 4 big.dat > plan.json
+
+    Each host runs its command, which uploads its range of the file
+    with -upload-id, -start-part, -range-offset, and -range-length, and
+    leaves the upload pending.  The command passes on the -endpoint,
+    -region, -path-style, -use-dualstack, -use-fips, -profile, -role-arn,
+    -no-sign-request, -sse, -sse-kms-key-id, -disable-kms-preflight, and
+    -sse-c-key given to distribute, but never -access-key, -secret-key,
+    or -session-token, which a host must add if it needs them.  Once
+    every host has finished,
+
+    	s3up complete -plan plan.json
+
+    takes the bucket and key from the plan, lists the parts held by the
+    server, and completes the upload, failing if any part is missing or
+    the parts do not add up to the size of the file.  An upload that is
+    never completed should be aborted, e.g., with -abort-stale.
+
+    The export-manifest command writes the records appended to a shared
+    file by -manifest-append to standard output as a json manifest,
+    optionally only those of the run named by -run-id, e.g.,
+
+    	s3up export-manifest -run-id nightly-0828 runs.jsonl > nightly.json
+
 OPTIONS
 
     -h | -help | --help
 
     	Print out help and exit
 
+    -version
+
+    	Print out the version of s3up, and the VCS revision it was
+    	built from if known, and exit.  The version is also noted in
+    	the User-Agent of requests (as s3up/<version>, or the
+    	abbreviated revision for development builds) and in the
+    	RunMetadata of the json -manifest.
+
     -bucket string
 
-    	Required name of the bucket to upload objects to.
+    	Required name of the bucket to upload objects to, unless every
+    	row of a -jobs file specifies a bucket.
 
     -key string
 
@@ -52,12 +194,212 @@ OPTIONS
     	files.  If no <globs> are specified then a non-prefix -key is
     	required.
 
+    -key-check string
+
+    	Optionally specify how strictly object key names are validated,
+    	one of:
+
+    	utf8    reject keys that are not valid UTF-8 or that are longer
+    	        than 1024 bytes, which S3 would not accept
+    	warn    also warn about keys containing characters that AWS
+    	        documents as possibly requiring special handling, i.e.,
+    	        non-printable characters, the backtick character, or
+    	        \ { } ^ % [ ] " < > ~ # |
+    	strict  reject keys containing these characters
+
+    	Messages describe the offset and bytes of each offending
+    	character.  Rejected objects are skipped.
+
+    	(default: utf8)
+
+    -key-replace <char>=<replacement>
+
+    	Optionally replace every occurrence of a character in key names,
+    	before -key-encoding and -key-check are applied.  May be
+    	repeated.  Useful for datasets containing characters that S3
+    	accepts but downstream tools cannot handle, e.g.,
+
+    	-key-replace :=_ -key-replace '|=-'
+
+    	An empty replacement removes the character.  The key before
+    	replacement is noted as SourceKey in the json -manifest.
+
+    -key-mapper string
+
+    	Optionally specify a command, run using the shell for the whole
+    	of the run, that maps each source to the key it is uploaded
+    	to.  For each source a line with the source and the key it
+    	would otherwise be uploaded to, separated by a tab, is written
+    	to the standard input of the command, which must print a line
+    	with the key to upload it to, or an empty line to skip it,
+    	e.g.,
+
+    	-key-mapper 'while IFS="$(printf "\t")" read -r src key; do
+    		echo "$(basename "$(dirname "$src")")/$key"; done'
+
+    	Lines are written without waiting for the keys of earlier
+    	lines, up to 256 ahead, and keys must be printed in the same
+    	order, flushing each as it is printed.  Sources or keys
+    	containing a tab or newline are skipped.  -key-replace,
+    	-key-encoding, -shard-prefix and -truncate-keys are applied to
+    	the keys printed, and the key before mapping is noted as
+    	SourceKey in the json -manifest.  If the command exits early
+    	the remaining sources are skipped, as errors that prevent
+    	-delete, while sources skipped with an empty line are not.
+
+    -key-encoding string
+
+    	Optionally specify which characters in key names are
+    	percent-encoded (each byte as '%' followed by two hexadecimal
+    	digits), before -key-check is applied, one of:
+
+    	reject              do not encode keys, keys that are not valid
+    	                    are rejected per -key-check
+    	encode-invalid      encode bytes that are not valid UTF-8 and
+    	                    non-printable characters
+    	encode-all-special  also encode the characters -key-check warns
+    	                    about, and those interpreted by shells, i.e.,
+    	                    space and ! $ & ' ( ) * ; ?
+
+    	Other than with reject, '%' is itself encoded so that the
+    	original name may be recovered.  The key before encoding (and
+    	any -key-replace) is noted as SourceKey in the json -manifest.
+
+    	(default: reject)
+
+    -truncate-keys string
+
+    	Optionally specify how keys longer than 1024 bytes, which S3
+    	does not accept, are handled (a deep directory tree combined
+    	with a long -key prefix may exceed the limit), one of:
+
+    	none    reject keys that are too long, the sources are skipped
+    	hash    truncate keys that are too long, appending a '-' and
+    	        16 hexadecimal characters of a hash of the whole key,
+    	        followed by the extension of the key (if any), so that
+    	        distinct keys remain distinct
+
+    	Use -check-keys to find all of the keys that are too long
+    	before any sources are uploaded.
+
+    	(default: none)
+
+    -shard-prefix int
+
+    	Optionally insert a short hash prefix of this many hexadecimal
+    	characters (1 to 8) into each key after the -key prefix, e.g.,
+    	with -key data/ and -shard-prefix 2 the file a.dat is uploaded
+    	to data/<hh>/a.dat.  This spreads request load across many
+    	prefixes, and so across S3 partitions, when uploading millions
+    	of objects at high request rates.  The hash is derived from the
+    	key, so a file is always uploaded to the same shard (including
+    	with -sync and s3up diff).  Requires -key to be empty or a
+    	prefix ending in '/'.
+
+    	(default: 0, keys are not changed)
+
+    -check-keys
+
+    	Optionally list all of the sources, and check their keys,
+    	before any are uploaded.  If any keys are invalid (per
+    	-key-check and -truncate-keys, e.g., too long), or more than
+    	one source maps to the same key, each is logged and the run
+    	fails without transferring any data.  Sources are opened but
+    	not read during the check (URLs are requested, but their
+    	content is not fetched).  Without -check-keys a source that
+    	maps to the same key as an earlier source is skipped, with an
+    	error logged, rather than overwriting the earlier upload.
+    	-check-keys cannot be combined with -split-size, which reads
+    	standard input as it is split.
+
+    -check-case
+
+    	Optionally warn about sources whose keys differ only by case
+    	(e.g., data/A.dat and data/a.dat), which would collide if the
+    	bucket were later copied to a case-insensitive filesystem.
+    	The warnings are logged as the sources are queued, including
+    	with -dry-run, and by -check-keys, which also reports the
+    	number found, but do not stop the run.
+
+    -jobs string
+
+    	Optionally specify a file listing the sources to upload,
+    	instead of providing <globs>.  Each row lists a source (a file
+    	path or an http:// or https:// URL) and may optionally specify
+    	the bucket and key to upload it to, overriding -bucket and
+    	-key, along with per-object overrides for the storage class,
+    	content type, tags (encoded as key1=value1&key2=value2), and
+    	priority (see -priority).  Rows are uploaded in order of
+    	descending priority, otherwise in the order listed.
+
+    	Files ending in .jsonl, .ndjson, or .json are read as JSON
+    	lines, with one object per line, e.g.,
+
+    	{"source": "a.dat", "key": "x/a.dat", "storage_class": "GLACIER"}
+
+    	Otherwise the file is read as CSV, and must start with a
+    	header row naming the columns used, e.g.,
+
+    	source,bucket,key,storage_class,content_type,tags
+    	a.dat,bucket,x/a.dat,GLACIER,,project=abc
+
+    	The recognized fields and columns are source, bucket, key,
+    	storage_class, content_type, tags, and priority.  Only source is
+    	required, if the key is left blank then the file name is used,
+    	prepended with the -key prefix.  Lines starting with '#' are
+    	treated as comments.
+
     -part-size value
 
     	Optionally specify the size of parts to upload.
 
     	(minimum: 5MiB, maximum: 5GiB, default: 5GiB)
 
+    -multipart-threshold value
+
+    	Optionally specify the size above which a file is uploaded as a
+    	multi-part object.  Files larger than -part-size but no larger
+    	than the threshold are uploaded using a single PutObject, e.g.,
+    	with "-part-size 16MiB -multipart-threshold 64MiB" a 64MiB file
+    	is uploaded in one request while larger files are still split
+    	into 16MiB parts.  Only applies to sources whose size is known
+    	in advance, i.e., files rather than streams.
+
+    	(minimum: -part-size, maximum: 5GiB, default: -part-size, or
+    	the threshold of the -preset)
+
+    -probe-size value
+
+    	Optionally specify the number of bytes read from a stream whose
+    	size is not known in advance (e.g., standard input) to choose
+    	between a single PutObject and a multi-part upload.  Without it
+    	a full part is read, and then the next part read ahead, before
+    	the choice is made, so that with -use-memory and the default
+    	5GiB -part-size a 6GiB stream is buffered in memory in full
+    	before the upload starts.  With it a stream that ends within
+    	the probe is uploaded using PutObject, and a longer stream is
+    	uploaded as a multi-part object as soon as its first part is
+    	read, even if it would have fit in a single part.  Must not
+    	exceed -part-size.
+
+    -preset awscli|boto3|rclone|s3cmd|s3up
+
+    	Optionally use the default part size, multipart threshold, and
+    	concurrency of another tool, so that objects are split into the
+    	same parts, and so have ETags comparable with objects
+    	previously uploaded by that tool.  An explicit -part-size,
+    	-multipart-threshold, or -concurrent-parts takes precedence
+    	over the preset (an explicit -part-size larger than the
+    	threshold of the preset is also used as the threshold).
+
+    	- awscli, boto3: 8MiB parts, 8MiB threshold, 10 concurrent parts
+    	- rclone: 5MiB parts, 200MiB threshold, 4 concurrent parts
+    	- s3cmd: 15MiB parts, 15MiB threshold, 1 concurrent part
+    	- s3up: 5GiB parts, 5GiB threshold, 1 concurrent part
+
+    	Objects no larger than the threshold are uploaded in a single
+    	request, as they are by these tools.
+
     -recursive
 
     	Optionally recursively process directories listed in <globs>
@@ -67,6 +409,109 @@ OPTIONS
 
     	Optionally specify the AWS profile name to use.
 
+    -region string
+
+    	Optionally specify the AWS region to use, instead of the region
+    	from AWS_REGION or the profile, e.g., to sign requests for a
+    	MinIO -endpoint without configuring a region for it in
+    	~/.aws/config.  Unless -disable-region-detect is given the
+    	region of the bucket is still used if it differs.
+
+    -role-arn arn
+
+    	Optionally assume the role with this ARN, using the credentials
+    	found as usual (or specified with -access-key), and use the
+    	role's credentials for every request.  Repeat -role-arn to
+    	assume a sequence of roles in order, each role being assumed
+    	using the credentials of the one before it (role chaining), as
+    	some institutional AWS setups require before the final role
+    	that may write to the bucket, e.g.,
+
+    	-role-arn arn:aws:iam::111111111111:role/gateway \
+    	-role-arn arn:aws:iam::222222222222:role/archive-writer
+
+    	The credentials of each role are refreshed as they expire.
+
+    -access-key string
+    -secret-key string
+    -session-token string
+
+    	Optionally specify static credentials to use, bypassing the
+    	credential chain (environment variables, the AWS configuration
+    	files, and instance metadata) entirely, e.g., in air-gapped
+    	environments where the files in ~/.aws cannot be edited.
+    	-access-key and -secret-key must be specified together, and
+    	-session-token is required for temporary credentials.  The AWS
+    	configuration files are still read for settings such as the
+    	region.
+
+    	Command line arguments may be visible to other users of the
+    	host, so prefer the file based variants below for secrets.
+
+    -access-key-file path
+    -secret-key-file path
+    -session-token-file path
+
+    	Optionally read the corresponding credential from a file, with
+    	any leading and trailing white space removed.  A credential may
+    	be specified by flag or by file, not both.
+
+    	The files are checked for changes every minute, and reloaded
+    	when modified, so that long runs continue to work when the
+    	credentials are rotated by an external agent.  (A web identity
+    	token file, named by AWS_WEB_IDENTITY_TOKEN_FILE, is reloaded by
+    	the AWS SDK each time its credentials are refreshed.)
+
+    -no-sign-request
+
+    	Optionally send requests without signing them, using anonymous
+    	credentials instead of searching the environment and the AWS
+    	configuration files for credentials, for endpoints and buckets
+    	that allow unauthenticated writes (e.g., isolated MinIO
+    	instances used for testing).
+
+    -endpoint url[,url...]
+
+    	Optionally specify the S3 endpoint URL to send requests to,
+    	instead of the endpoint from the AWS configuration.  If more
+    	than one endpoint is specified (by repeating -endpoint, or as a
+    	comma separated list) then requests, including individual part
+    	uploads, are distributed across the endpoints round-robin.  For
+    	example, a distributed MinIO deployment with several front-end
+    	nodes and no load balancer may be specified as:
+
+    	-endpoint http://minio1:9000,http://minio2:9000
+
+    	Combine with -concurrent-parts (or -concurrent-objects) of at
+    	least the number of endpoints to use each of them concurrently.
+
+    	Without -endpoint, an endpoint configured for the AWS tools is
+    	used, by AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, or by the
+    	endpoint_url setting of the -profile (or of its s3 services
+    	section).  Set AWS_IGNORE_CONFIGURED_ENDPOINT_URLS=true to use
+    	the AWS endpoint instead.
+
+    -probe-endpoints
+
+    	Optionally, with more than one -endpoint, measure the latency
+    	of each endpoint before the first object is uploaded, as the
+    	fastest of a few HeadBucket requests, and distribute requests
+    	across the endpoints in inverse proportion to it rather than
+    	round-robin, so that the fastest endpoints receive the most
+    	parts.  An endpoint that does not respond receives no requests
+    	until it responds to a later probe (unless none respond, when
+    	they are used equally).  With -verbose the latencies and the
+    	resulting weights are logged.
+
+    -probe-endpoints-interval duration
+
+    	Optionally specify how often the endpoints are probed again
+    	during the run with -probe-endpoints, so that the distribution
+    	follows endpoints that slow down or recover, or 0 to probe only
+    	at startup.
+
+    	(default: 1m)
+
     -concurrent-objects int
 
     	Optionally specify the number of concurrent objects to upload
@@ -80,6 +525,31 @@ OPTIONS
 
     	(default: 1)
 
+    -concurrent-attributes int
+
+    	Optionally specify the number of concurrent GetObjectAttributes
+    	requests made for completed objects.  The attributes are
+    	fetched separately from the uploads, so that an object waiting
+    	for its attributes does not delay the next object from
+    	starting, which helps runs of many small objects.
+
+    	(default: 4)
+
+    -small-object-size size
+
+    	Optionally specify the size at or below which a file is
+    	uploaded through a separate pool using a single PutObject,
+    	reading the file once into memory and hashing it as it is
+    	read, without queuing behind the part workers of larger
+    	objects.  Must not exceed -part-size.
+
+    -concurrent-small-objects int
+
+    	Optionally specify the number of concurrent small object
+    	uploads when -small-object-size is set.
+
+    	(default: 16)
+
     -manifest value
 
     	Optionally specify a manifest type to produce on standard
@@ -93,6 +563,88 @@ OPTIONS
 
     	See MANIFESTS below for more details.
 
+    -manifest-append path
+
+    	Optionally append each record of a json manifest (including
+    	the RunMetadata and RunEnd records) to the file at path as a
+    	single line of JSON, in addition to any -manifest.  Each line
+    	is written while holding an exclusive lock on the file, so
+    	that concurrent runs (e.g., each job of a batch scheduler) may
+    	safely share one file.  Use s3up export-manifest to extract
+    	the json manifest of a run, by its -run-id.  Requires file
+    	locking, which is not available on all platforms.
+
+    -manifest-upload key
+
+    	Optionally upload the manifest written to standard output by
+    	-manifest (which is required) to key in the bucket once the
+    	run has finished, so that the bucket describes its own
+    	contents.  A key ending in "/" is a prefix, under which the
+    	manifest is named by the -run-id with a .json or .txt
+    	extension, e.g., -manifest-upload _manifests/ uploads to
+    	_manifests/<run id>.json.  The key is not relative to the
+    	key prefix of the uploads.  The manifest is uploaded with a
+    	single PutObject, using the same -sse as the objects, even if
+    	the run was interrupted, but not with -dry-run or
+    	-checksum-only.  Failing to upload the manifest is an error.
+
+    -manifest-checkpoint path
+
+    	Optionally write the manifest records of the objects completed
+    	so far to the file at path during the run, in the format of
+    	-manifest (or json if there is none), so that the objects
+    	uploaded by a run that dies are still recorded.  Each
+    	checkpoint is ended as if the run had finished (e.g., the
+    	json array is closed, without the RunEnd record) and synced
+    	to disk, and once the run finishes the file holds the
+    	complete manifest.  With -manifest-upload each checkpoint is
+    	also uploaded to the bucket, until it is replaced by the
+    	complete manifest.
+
+    -checkpoint-objects int
+
+    	Optionally specify the number of completed objects after which
+    	a -manifest-checkpoint is written, by default 1000, or 0 to
+    	only write checkpoints every -checkpoint-interval.
+
+    -checkpoint-interval duration
+
+    	Optionally specify how often a -manifest-checkpoint is written
+    	while objects complete, by default 5m, or 0 to only write
+    	checkpoints every -checkpoint-objects.
+
+    -summary-out path
+
+    	Optionally write a JSON summary of the run to the file at path
+    	once the run has finished, distinct from the per-object
+    	manifest, for ingestion into transfer dashboards.  The summary
+    	lists the start and finish times, the duration in seconds, the
+    	number of objects that succeeded, failed, or were skipped
+    	(e.g., by -sync or -max-objects), the bytes uploaded and the
+    	average throughput, the number of requests sent to S3 and how
+    	many were retries, and the number of failed objects by class
+    	of error (the error code returned by S3 where there is one).
+
+    -stats-fd int
+    -stats-interval duration
+
+    	Optionally write a snapshot of the progress of the run, as a
+    	line of JSON, to the already open file descriptor every
+    	interval, and a final snapshot (with Final set to true) once
+    	the run has finished, so that a wrapper scheduler can make
+    	live decisions, e.g., to launch additional workers, without
+    	parsing the logs.  For example, with a shell:
+
+    	s3up -bucket b -stats-fd 3 'data/*' 3>stats.jsonl
+
+    	Each snapshot lists the Time, ElapsedSeconds, BytesSent (the
+    	request bodies sent to S3, including any retries),
+    	BytesPerSecond since the previous snapshot, ObjectsQueued,
+    	ObjectsInFlight (the queue depth), ObjectsCompleted, and
+    	ObjectsFailed.
+
+    	(default: 0, no snapshots, and an interval of 10s)
+
     -media-types string
 
     	Optionally specify a path to a tab-separated-value file with
@@ -102,15 +654,146 @@ OPTIONS
     	.pdf  application/pdf
     	.txt  text/plain
 
+    	Lines in the Apache mime.types format, listing a media-type
+    	followed by any number of extensions without a leading period,
+    	are also accepted, so a file such as /etc/mime.types may be
+    	used directly, e.g.,
+
+    	application/pdf  pdf
+    	text/plain       txt text
+
     	Comments may be added by starting the line with '#', and these
     	will be ignored.
 
     	Any mappings loaded will either override any existing mapping
     	or will be added to the mappings.
 
+    -content-type string
+
+    	Optionally specify the content-type to set on every object
+    	uploaded, instead of the media-type derived from the key, which
+    	is useful when the extension of the key is misleading or when
+    	uploading from the standard input stream.  A content_type set
+    	for an individual row of a -jobs file takes precedence.
+
+    -lifecycle-tag key=value
+
+    	Optionally specify a tag to set on every object uploaded, so
+    	that existing bucket lifecycle rules selecting objects by tag
+    	(e.g., expire=90d) take effect.  The tag is added to any tags
+    	set using -set or a -jobs file, replacing any tag with the same
+    	key, and is noted as LifecycleTag in the json -manifest.
+
+    -metadata key=value
+
+    	Optionally specify user-defined metadata to set on every object
+    	uploaded, stored as x-amz-meta-key, e.g., to record the
+    	provenance of archived data.  May be repeated to set several
+    	keys.  Keys are letters, digits, '-', '_', or '.' and are
+    	stored in lower case, values are printable ASCII, and all the
+    	metadata of an object (including the -run-id) must not exceed
+    	2KB.  For example:
+
+    	-metadata project=survey -metadata instrument=scope-2
+
+    -metadata-sidecar suffix
+
+    	Optionally specify a suffix naming, for each file uploaded, a
+    	JSON file of user-defined metadata for its object, e.g., with
+    	-metadata-sidecar .meta.json the metadata of data/run1.tar is
+    	read from data/run1.tar.meta.json if it exists, as an object of
+    	string values:
+
+    	{"project": "survey", "sample": "A-17"}
+
+    	The metadata is added to any set by -metadata, replacing any
+    	value for the same key.  Files with the suffix are not uploaded
+    	themselves, and an object whose sidecar file cannot be read or
+    	is invalid is skipped.
+
+    -run-id string
+
+    	Optionally specify an identifier for the run, of at most 128
+    	printable ASCII characters, stored as the x-amz-meta-s3up-run
+    	metadata of every object uploaded and noted as RunID in the
+    	json -manifest, so that objects may be traced back to the run
+    	that uploaded them.
+
+    	(default: generated from the time and random characters, e.g.,
+    	20240102T030405Z-0a1b2c3d4e5f6a7b)
+
+    -sniff-media-types
+
+    	Optionally specify that when the extension of a key is not
+    	recognized, the first 512 bytes of the object should be
+    	evaluated to determine the media-type, rather than defaulting
+    	to application/octet-stream.
+
+    -storage-rules path
+
+    	Optionally specify a file of rules selecting the storage class
+    	of each file found using <globs>, so that a single pass can
+    	place data into the appropriate tiers.  Each line lists one or
+    	more predicates, all of which must match, followed by a storage
+    	class, optionally separated by "->".  The first rule that
+    	matches applies, and a storage class set with -set takes
+    	precedence.  Blank lines and lines starting with # are ignored.
+
+    	# raw instrument data is rarely read
+    	*.raw -> DEEP_ARCHIVE
+    	# small files cost more to retrieve than to store
+    	<1MiB -> STANDARD
+    	size>=1GiB age>90d -> GLACIER
+    	results/*.csv -> STANDARD_IA
+
+    	Predicates compare the file size (<, <=, >, >= a size, with an
+    	optional "size" prefix), the time since the file was modified
+    	(age followed by a comparison and a duration, with d for days),
+    	or match a glob against the base name of the key (or the whole
+    	key if the glob contains a /).  Sources fetched from URLs only
+    	match glob predicates.
+
+    -sse AES256|aws:kms|aws:kms:dsse
+
+    	Optionally specify the server-side encryption to apply to each
+    	object uploaded.
+
+    -sse-kms-key-id string
+
+    	Optionally specify the id or ARN of the KMS key to encrypt
+    	objects with when using -sse aws:kms (or aws:kms:dsse),
+    	otherwise the AWS managed key for S3 is used.
+
+    	Before any files are processed, permission to use the key is
+    	checked by uploading a small multi-part probe object next to
+    	-key and then deleting it, so that a missing kms:GenerateDataKey
+    	or kms:Decrypt permission is reported immediately, rather than
+    	when completing the first object after a multi-hour transfer.
+
+    -sse-c-key file
+
+    	Optionally specify a file holding a 256-bit key, either as its
+    	32 bytes or base64 encoded, to encrypt each object uploaded with
+    	using a customer-provided key (SSE-C).  The key is sent with
+    	every request for the object, including its parts and
+    	GetObjectAttributes, and so S3 requires the requests be made
+    	over https.  S3 does not store the key, and the object cannot
+    	be read without it.  The ETag of an object encrypted this way
+    	is not an MD5 sum, and so is not compared.  May not be combined
+    	with -sse.
+
+    -disable-kms-preflight
+
+    	Optionally disable the KMS permission check described above,
+    	e.g., when the credentials may not delete objects.
+
     -verbose
 
-    	Optionally enable verbose logging to standard error.
+    	Optionally enable verbose logging to standard error.  The
+    	start and finish of each part upload is logged with the size
+    	of the part, the time taken and throughput once finished, and
+    	the bytes of the object uploaded so far, so that stalled parts
+    	may be diagnosed from the log.
 
     -checksum string
 
@@ -119,17 +802,98 @@ OPTIONS
 
     	(default: SHA256)
 
+    -extra-checksums string
+
+    	Optionally specify a comma separated list of additional
+    	checksum algorithms, one or more of SHA512, BLAKE3, or XXHASH.
+    	S3 does not support these algorithms, they are calculated
+    	locally over the full body of each object and included in the
+    	FullChecksums of the JSON manifest, e.g., for repositories
+    	whose fixity policies require them:
+
+    		$ ./s3up -bucket test -manifest json -extra-checksums sha512,blake3 *.dat
+
     -disable-path-style
 
     	Optionally disable use of older AWS S3 path-style requests (this
     	would be appropriate to set when copying to Amazon S3 instead of
     	to Elm).
 
+    -use-dualstack
+
+    	Optionally use the AWS S3 dual-stack endpoint, reachable over
+    	both IPv4 and IPv6, e.g., for IPv6-only environments.  Cannot
+    	be combined with -endpoint.
+
+    -use-fips
+
+    	Optionally use the AWS S3 FIPS 140-2 validated endpoint, e.g.,
+    	for government environments.  May be combined with
+    	-use-dualstack.  Cannot be combined with -endpoint.
+
+    -resolve host[:port]:addr
+
+    	Optionally connect to host (only on port, if specified) using
+    	the IP address addr instead of resolving the name using DNS, in
+    	the style of curl --resolve.  May be repeated.  Useful for
+    	object stores reachable only via split-horizon DNS, e.g.,
+
+    	-resolve s3.example.org:443:10.0.0.5
+
+    	IPv6 addresses may be enclosed in brackets.  TLS certificates
+    	are still verified against host.
+
+    -dns-cache duration
+
+    	Optionally cache the addresses the S3 endpoint resolves to for
+    	this long, for resolvers that cannot keep up with the rate at
+    	which connections are made, e.g., 5m.  Each cached address is
+    	tried in turn when connecting.
+
+    	(default: 0s, no caching)
+
+    -path-style auto|path|virtual
+
+    	Optionally specify how buckets are addressed in requests, as
+    	part of the path (path, e.g., https://host/bucket/key) or as
+    	part of the host name (virtual, e.g., https://bucket.host/key).
+
+    	With auto a HeadBucket request is sent using path-style
+    	addressing, then using virtual-host style addressing if that
+    	fails, and the first that works (or that is denied access,
+    	showing the bucket was found) is used.  A switch to virtual-host
+    	style is logged, and with -verbose the style used is always
+    	logged.  -disable-path-style is the same as -path-style virtual.
+
+    	(default: auto)
+
     -disable-s3-pool
 
     	Optionally disable use of multiple s3 clients (this would be
     	appropriate to set when copying to Amazon S3 instead of to Elm).
 
+    -warm-up int
+
+    	Optionally specify a number of connections to S3 to open before
+    	the first object is uploaded, using concurrent HeadBucket
+    	requests, so that a short transfer is not slowed while
+    	connections (and their TLS handshakes) are set up for the first
+    	parts, e.g., the product of -concurrent-objects and
+    	-concurrent-parts.  Each client keeps at least this many idle
+    	connections open to each host, and with -endpoints the
+    	connections are spread across the endpoints.  Failing to warm
+    	up is logged but does not stop the run.
+
+    	(default: 0, connections are opened as needed)
+
+    -disable-region-detect
+
+    	Optionally disable detecting the region of the bucket.  By
+    	default the region of the bucket is detected (using HeadBucket,
+    	or GetBucketLocation if needed) and, if it differs from the
+    	region configured for the AWS profile, the bucket's region is
+    	used instead of failing with a PermanentRedirect error.
+
     -max-part-id value
 
     	Optionally limit the number of parts to upload in a multi-part
@@ -142,11 +906,231 @@ OPTIONS
     	Optionally specify a directory to use for temporary files
     	created when buffering a stream.
 
+    -verify-buffers
+
+    	Optionally re-hash each part buffered in a temporary file just
+    	before it is uploaded, and fail the part if it no longer
+    	matches the checksum calculated when it was buffered.  This
+    	catches silent corruption of the local disk while parts are
+    	queued for upload, at the cost of reading each part twice.
+
+    -stream-parts
+
+    	Optionally upload the parts of a stream (e.g., stdin) while
+    	they are read, rather than once each part has been buffered
+    	in full, so that the upload is not held up waiting for each
+    	part to be read.  The first part is still buffered to choose
+    	between a single PutObject and a multi-part upload.  The
+    	following parts are sent with a trailing checksum, which
+    	requires https, and are kept in memory in case the last part
+    	must be sent again at its actual size.
+
+    -reupload-modified int
+
+    	Source files are stat'ed before and after they are uploaded,
+    	and if the size or modification time changed during the upload
+    	the manifest entry records "source modified during transfer" as
+    	its SourceError.  Optionally specify the number of times to
+    	upload such an object again before giving up.
+
+    	(default: 0)
+
+    -strict-verify
+
+    	Optionally fail objects uploaded using PutObject whose ETag or
+    	checksum returned by S3 does not match the value calculated by
+    	s3up, rather than only recording the mismatch in the
+    	Verification field of the manifest.  Mismatches for multi-part
+    	objects are always reported as errors.
+
+    -require-content-md5
+
+    	Every PutObject and UploadPart request is sent with a
+    	Content-MD5 header as well as the -checksum header, but some S3
+    	compatible stores only validate the Content-MD5.  Optionally
+    	require that each request was sent with a Content-MD5 and that
+    	the ETag returned matches it, failing the object or part with
+    	a checksum mismatch otherwise.  -require-content-md5 cannot be
+    	combined with -stream-parts, whose parts are sent before their
+    	MD5 is known, or with -sse aws:kms, whose ETags are not MD5
+    	checksums.
+
+    -compress
+
+    	Optionally compress sources using gzip as they are uploaded,
+    	setting the Content-Encoding of the objects to gzip and their
+    	Content-Type from the uncompressed source.  Sources that are
+    	already compressed, recognized by the extension of the key
+    	(e.g., .gz, .zst, .xz, .bz2, .zip, .jpg, .mp4) or by the magic
+    	number of gzip, zstd, xz, bzip2, lz4, zip or 7z content, are
+    	uploaded as they are.  The decision is recorded in the
+    	manifest as either:
+
+    		"Compression": {
+    			"Encoding": "gzip"
+    		}
+
+    	or:
+
+    		"Compression": {
+    			"Skipped": "zstd"
+    		}
+
+    	The checksums recorded are those of the uploaded (compressed)
+    	content.  -compress cannot be combined with -sync, -dedupe-db,
+    	-range-offset or -range-length, which compare the source as
+    	it is read.
+
+    -sparse upload|skip|holes
+
+    	Optionally specify how sparse files, with less than half of
+    	their size allocated on disk (e.g., virtual machine images),
+    	are uploaded:
+
+    		upload	upload the file as it is read, holes included
+    		skip	skip the file
+    		holes	upload only the data of the file, recording
+    			its holes and size in the object metadata
+
+    	With holes the object contains the data of the file in order,
+    	and the file may be restored by inserting the holes listed in
+    	the metadata as offset+length, e.g.:
+
+    		x-amz-meta-s3up-holes: 4096+1044480,1052672+7335936
+    		x-amz-meta-s3up-size: 8388608
+
+    	Files with too many holes to fit in the metadata are uploaded
+    	as they are read, with a warning.  Sparse files are detected on
+    	Linux and FreeBSD only, empty files are never sparse.
+
+    	(default: upload)
+
+    -delete-source
+
+    	Optionally remove the local file of each object once the
+    	object is completed and the checksum S3 reports for it (using
+    	GetObjectAttributes) matches the checksum calculated while
+    	reading the file, e.g., to drain a staging area.  Files that
+    	changed while they were read, or whose checksum could not be
+    	verified (including when -object-attributes leaves out
+    	checksum), are kept and the reason recorded in the manifest
+    	as a SourceRetentionError.  Deleted files are recorded in the
+    	manifest with:
+
+    		"SourceDeleted": true
+
+    	Standard input and URLs are never deleted, and -delete-source
+    	cannot be combined with -snapshot-cmd, -archive-source-to or
+    	-truncate-source.
+
+    -archive-source-to string
+
+    	Optionally move the local file of each object into the
+    	specified directory once its checksum is verified, as for
+    	-delete-source.  Files are placed under the directory by the
+    	relative path they were given, or by their absolute path if
+    	given one or a path outside of the working directory, and
+    	existing files are never replaced.
+    	Files on a different file system are copied, then removed.
+    	Archived files are recorded in the manifest with:
+
+    		"SourceArchived": "<path>"
+
+    	-archive-source-to cannot be combined with -snapshot-cmd,
+    	-delete-source or -truncate-source.
+
+    -truncate-source
+
+    	Optionally truncate the local file of each object to zero
+    	bytes once its checksum is verified, as for -delete-source,
+    	keeping the file name (and e.g., its ownership) as a record
+    	that it was uploaded.  Truncated files are recorded in the
+    	manifest with:
+
+    		"SourceTruncated": true
+
+    	-truncate-source cannot be combined with -snapshot-cmd,
+    	-delete-source or -archive-source-to.
+
+    -snapshot-cmd string
+
+    	Optionally specify a command, run using the shell before any
+    	globs are processed, that creates a point-in-time snapshot of
+    	the working directory (e.g., a ZFS or LVM snapshot) and prints
+    	the directory the snapshot is mounted on as its last line of
+    	output.  The working directory is passed to the command as
+    	S3UP_SNAPSHOT_ROOT.  Globs within the working directory are
+    	then read from the snapshot, while the object keys are derived
+    	from the paths as given, so that the uploads capture a
+    	consistent view of files that may be changing.  Globs outside
+    	of the working directory are not in the snapshot, and are
+    	reported as errors rather than read from the live files:
+
+    		$ ./s3up -bucket test -key data/ -recursive \
+    			-snapshot-cmd ./make-snapshot.sh \
+    			-snapshot-cleanup-cmd ./remove-snapshot.sh data
+
+    -snapshot-cleanup-cmd string
+
+    	Optionally specify a command, run using the shell once the run
+    	has finished, that removes the snapshot created by
+    	-snapshot-cmd.  The mount directory is passed to the command
+    	as S3UP_SNAPSHOT_MOUNT, along with S3UP_SNAPSHOT_ROOT.
+
+    -flock
+
+    	Optionally take a shared advisory lock (flock with LOCK_SH) on
+    	each source file for the duration of its upload.  Producers
+    	that hold an exclusive lock while writing a file will delay
+    	its upload until they are done, so that partially written
+    	files are not captured.  Not available on Windows.
+
     -use-memory
 
     	Optionally specify that memory buffers should be used instead
     	of temporary files when buffering a stream.
 
+    -source name
+
+    	Optionally select the source backend used to read objects and
+    	split them into parts, either tempfile or memory (equivalent to
+    	-use-memory), or a backend registered by an application
+    	embedding the uploader (see RegisterSource).  A backend may be
+    	selected for some globs using "-set source=<name>", while
+    	URIs always use the backend registered for their scheme, if
+    	there is one, which is given the URI to read rather than a
+    	response body.
+
+    	(default: tempfile)
+
+    -mem-profile-interval duration
+
+    	Optionally write numbered memory (heap) profiles at this
+    	interval during the run, in addition to the -mem-profile
+    	written when the run finishes, to capture the allocations of
+    	long runs, e.g., with "-mem-profile mem.pprof
+    	-mem-profile-interval 10m" the profiles mem.0001.pprof,
+    	mem.0002.pprof, and so on are written every 10 minutes.
+
+    -gomaxprocs int
+
+    	Optionally limit the number of CPUs executing Go code
+    	simultaneously, e.g., when sharing a data mover node with other
+    	jobs.  Equivalent to setting GOMAXPROCS in the environment.
+
+    	(default: 0, the number of CPUs available)
+
+    -memory-limit size
+
+    	Optionally set a soft limit on the memory used by s3up, above
+    	which the garbage collector runs more often to stay within the
+    	limit, e.g., 4GiB.  Equivalent to setting GOMEMLIMIT in the
+    	environment.  Note that -concurrent-objects, -concurrent-parts,
+    	and -part-size with -use-memory determine how much memory is
+    	required.
+
+    	(default: no limit)
+
     -copy-buf string
 
     	Optionally specify the buffer size used to copy chunks
@@ -178,11 +1162,444 @@ OPTIONS
 
     	(default: 0s, no timeout)
 
+    -put-object-timeout duration
+
+    	Optionally set a timeout for any PutObject requests, used for
+    	objects uploaded in a single request, use the same suffixes as
+    	-upload-part-timeout.
+
+    	(default: 0s, no timeout)
+
+    -create-multipart-timeout duration
+
+    	Optionally set a timeout for any CreateMultipartUpload requests,
+    	use the same suffixes as -upload-part-timeout.
+
+    	(default: 0s, no timeout)
+
+    -object-attributes-timeout duration
+
+    	Optionally set a timeout for any GetObjectAttributes requests,
+    	used to verify objects once uploaded, use the same suffixes as
+    	-upload-part-timeout.
+
+    	(default: 0s, no timeout)
+
+    -object-attributes list
+
+    	Optionally specify a comma separated list of the attributes
+    	requested by GetObjectAttributes once an object is uploaded,
+    	any of etag, checksum, object-parts, object-size, or
+    	storage-class.  Attributes that are not requested are left out
+    	of the manifest, use none to skip GetObjectAttributes entirely,
+    	e.g., for backends that do not implement it.
+
+    	(default: etag,checksum,object-parts,object-size)
+
+    -object-attributes-max-parts int
+
+    	Optionally specify the maximum number of parts listed by
+    	GetObjectAttributes, objects with many parts otherwise return
+    	a large response listing every part.
+
+    	(default: 10000)
+
+    -object-attributes-retries int
+
+    	Optionally specify the number of times a failed
+    	GetObjectAttributes request is retried, waiting 1s before the
+    	first retry and doubling the wait before each further retry.
+    	If the attributes remain unavailable the object is still
+    	recorded in the manifest, with AttributesUnavailable set and
+    	the error in GetObjectAttributesError.
+
+    	(default: 3)
+
+    -request-timeout duration
+
+    	Optionally set a timeout for every individual HTTP request sent
+    	to S3, including reading the response.  Each attempt made by the
+    	AWS SDK is timed separately, and attempts that time out are
+    	retried, so that a hung connection does not block an object (or
+    	part) forever.  The timeout must allow for the time taken to
+    	send a full -part-size part.
+
+    	(default: 0s, no timeout)
+
+    -dynamic-parts
+
+    	Optionally derive the number of concurrent parts to upload per
+    	object from the object size, when it is known (i.e., for files
+    	rather than streams).  The parts of all objects being uploaded
+    	share a budget of -concurrent-objects multiplied by
+    	-concurrent-parts uploads, so small multi-part objects use
+    	fewer goroutines while large objects may use more than
+    	-concurrent-parts when other objects leave capacity idle.
+    	Objects whose parts are buffered (streams) are still limited
+    	to -concurrent-parts plus -read-ahead buffered parts.
+
+    	When the budget is fully in use, uploads are granted to each
+    	object in turn rather than in the order parts were queued, so
+    	that objects complete as they go instead of one large object
+    	holding back the rest.
+
+    -read-ahead int
+
+    	Optionally specify the number of parts per object that may be
+    	read and buffered ahead of the parts currently being uploaded.
+    	Increasing this can help keep the network busy on high latency
+    	links, at the cost of additional temporary disk space or
+    	memory (see -use-memory) of -part-size per part.
+
+    	(minimum: 1, default: 1)
+
+    -bwlimit value
+
+    	Optionally limit the upload bandwidth to the specified number
+    	of bytes per second, e.g., 100MB or 1GiB.  When multiple
+    	objects are uploaded concurrently the bandwidth is shared
+    	fairly between them, so that one large object does not starve
+    	smaller ones.
+
+    	(default: no limit)
+
+    -bwlimit-greedy
+
+    	Optionally let concurrent objects compete for -bwlimit in the
+    	order their requests are made, rather than sharing it fairly,
+    	so that objects with more parts in flight receive more of the
+    	bandwidth.
+
+    -bwlimit-per-object value
+
+    	Optionally limit the upload bandwidth of any single object to
+    	this many bytes per second (using the same suffixes as
+    	-bwlimit), in addition to any -bwlimit on the total, so that
+    	one very large file cannot take the whole link from smaller
+    	uploads running alongside it.
+
+    -preflight
+
+    	Optionally check that the bucket exists and that the
+    	credentials and region in use are able to access it (using
+    	HeadBucket) before processing any files, exiting with a
+    	description of the likely problem if not.
+
+    	The default encryption, policy and versioning of the bucket
+    	are also checked, and a warning is logged if they conflict
+    	with the flags in use, e.g., -sse AES256 overriding a default
+    	of aws:kms, a policy statement denying uploads without -sse
+    	aws:kms, or -delete on a versioned bucket.  Settings the
+    	credentials are not permitted to read are not checked.
+
+    -preflight-write
+
+    	Optionally also check write permission by uploading an empty
+    	probe object named .s3up-preflight-<id> under the -key prefix,
+    	which is then deleted.  This implies -preflight.
+
+    -create-bucket
+
+    	Optionally create the bucket, in the region configured for the
+    	AWS profile, if HeadBucket reports that it does not exist.
+    	This implies -preflight.
+
+    -create-bucket-versioning
+
+    	Optionally enable versioning on a bucket created by
+    	-create-bucket.
+
+    -create-bucket-object-lock
+
+    	Optionally enable object lock on a bucket created by
+    	-create-bucket, which also enables versioning.
+
+    -abort-stale duration
+
+    	Optionally, before uploading, list the multi-part uploads
+    	under the destination -key and abort any initiated longer ago
+    	than the specified duration, e.g., 48h for two days.  This
+    	prevents the parts left behind by repeated failed runs from
+    	accumulating storage charges.  Without a -key, uploads in the
+    	whole bucket (including those of other tools) are only aborted
+    	if -abort-stale-bucket is also specified.
+
+    	(default: 0s, no uploads are aborted)
+
+    -abort-stale-bucket
+
+    	Optionally allow -abort-stale to abort the stale uploads in the
+    	whole bucket when no -key is specified.
+
+    -sync
+
+    	Optionally skip uploading files that are the same as the
+    	existing remote object at the same key, as reported by s3up
+    	diff, i.e., that are the same size and whose predicted ETag
+    	matches.  Requires <globs>.
+
+    -sync-mode checksum|quick|head
+
+    	Optionally specify how -sync decides whether a file is the same
+    	as the remote object.
+
+    	checksum: compare the size, and the ETag predicted by hashing
+    	every file.
+
+    	quick: compare the size and modification time, a file that is
+    	the same size and was not modified after the remote object was
+    	last modified is assumed to be the same, only files that were
+    	modified since are hashed.  Suitable for very large trees where
+    	hashing every file is too slow.  Implies -sync.
+
+    	head: instead of listing the -key prefix, fetch the attributes
+    	of the object at the key of each file with GetObjectAttributes,
+    	and compare the size and the -checksum of the object, if it
+    	has one (the file is hashed using the part size of the
+    	object), otherwise the ETag as with checksum.  Suitable when
+    	the prefix holds many more objects than are uploaded.  The
+    	prefix is still listed for -delete.  Implies -sync.
+
+    	(default: checksum)
+
+    -delete
+
+    	Optionally delete remote objects under the -key prefix that
+    	were not found locally, once all uploads have completed, so
+    	that the bucket is kept as an exact mirror.  Only valid with
+    	-sync.  Without -recursive only the objects directly under the
+    	prefix may be deleted, as only the top level of directories is
+    	searched for files.  If any local file is skipped (e.g., it
+    	cannot be read, its key is invalid, or a glob matches nothing)
+    	then nothing is deleted, as its remote object may not be
+    	missing.  See also -max-delete.
+
+    -max-delete int
+
+    	Optionally limit the number of remote objects that -delete may
+    	remove, if more would be removed then none are, protecting
+    	against mistakes such as an incorrect glob.  Specify -1 to
+    	apply no limit.
+
+    	(default: 1000)
+
+    -dedupe-db string
+
+    	Optionally specify a database file of the content checksums of
+    	uploaded objects, which is created if it does not exist.  Each
+    	source file is read and hashed before it is queued, and if an
+    	object with the same size and full-body checksum (using the
+    	-checksum algorithm) is already recorded in the database the
+    	source is handled per -dedupe-mode.  Objects uploaded during
+    	the run are added to the database.  The database is a JSON
+    	lines file, one object per line:
+
+    		{"Checksum":"SHA256:<base64>","Size":1024,"Bucket":"test","Key":"a.dat"}
+
+    -dedupe-mode string
+
+    	Optionally specify how sources already recorded in -dedupe-db
+    	are handled, either "skip" to not upload them, or "copy" to
+    	copy the recorded object to the key of the source using a
+    	server-side CopyObject request (objects larger than 5GiB are
+    	uploaded instead).  The copy is made with the content type,
+    	metadata, tags, storage class, and encryption the object
+    	would be uploaded with, rather than those of the recorded
+    	object.  Records in a json manifest for skipped or copied
+    	sources have DuplicateOf set to the bucket and key of the
+    	recorded object.
+
+    	(default: skip)
+
+    -max-objects int
+    -max-bytes size
+
+    	Optionally limit the number of objects, and their total size,
+    	that are uploaded during the run, protecting against runaway
+    	globs (e.g., accidentally uploading /).  Once an object would
+    	exceed either limit no further sources are read or queued, the
+    	objects already queued are completed, and the number and size
+    	of the objects skipped is reported, exiting with a non-zero
+    	status.  Objects skipped by -sync or -dedupe-db do not count
+    	towards the limits, though the limits are checked before the
+    	sources are compared.  The size of sources fetched from URLs
+    	is not known in advance.
+
+    	(default: 0, no limit)
+
+    -split-size size
+    -split-pad int
+
+    	Optionally split the standard input stream into objects of up
+    	to -split-size bytes, e.g., to keep each object of a large
+    	stream under a size limit.  The -key is then a template that
+    	must use {{.Seq}}, the number of the object counting from 0,
+    	or {{.Offset}}, the offset of the object in the stream, both
+    	zero-padded to -split-pad digits, e.g.,
+
+    	pg_dump db | s3up -bucket b -key 'db/dump.{{.Seq}}' -split-size 1GiB
+
+    	Each object in the json -manifest notes its Split (the Seq,
+    	Offset, and Size of its range of the stream), and the RunEnd
+    	lists the completed objects in order of Seq, so that the
+    	stream may be reassembled by concatenating them in order.
+
+    	(default: 0, no split, -split-pad 6)
+
+    -checksum-only
+
+    	Optionally only read and hash the sources, without uploading
+    	anything, and produce the -manifest with the checksums and
+    	ETag that S3 is predicted to report once each object is
+    	uploaded using the same -part-size and -checksum.  This allows
+    	the checksums to be calculated ahead of a transfer window,
+    	e.g., on a data mover node.  Records in a json manifest have
+    	Predicted set to true.
+
+    -dry-run
+    -price-table path
+
+    	Optionally only list the sources, without uploading anything
+    	(or reading the sources, unless needed by -sync), and estimate the number of PUT requests (PutObject,
+    	or CreateMultipartUpload, UploadPart, and
+    	CompleteMultipartUpload), the bytes stored in each storage
+    	class, and the approximate cost, so that a large run can be
+    	sanity checked first.  Objects skipped by -sync or the
+    	-max-objects and -max-bytes limits are not included, nor is
+    	anything deleted by -delete.
+
+    	The built-in prices are approximate us-east-1 list prices, and
+    	exclude minimum storage durations and object sizes, retrieval,
+    	and transfer charges.  Prices may be overridden by a
+    	-price-table file, where each line lists a storage class, the
+    	price per GiB-month, and the price per 1000 PUT requests, e.g.,
+
+    	# storage-class  per-GiB-month  per-1000-PUTs
+    	DEEP_ARCHIVE     0.00099        0.05
+    	STANDARD         0.023          0.005
+
     -leave-parts-on-error
 
     	Optionally do not abort failed uploads, leaving parts on the
     	server for manual recovery.
 
+    -retries int
+
+    	Optionally specify the number of times a part upload that
+    	failed with a transient error is retried, i.e., when S3
+    	throttles the request (503 SlowDown) or returns another server
+    	error, or the connection fails or is reset.  These retries are
+    	made in addition to those of the AWS SDK, after a wait (see
+    	-retry-backoff), and the number of retries of each part is
+    	recorded in the manifest.  Parts streamed with -stream-parts
+    	are not retried.
+
+    	(default: 3)
+
+    -retry-backoff duration
+
+    	Optionally specify the wait before the first retry of a part
+    	upload (see -retries), which is doubled before each further
+    	retry.  Each wait is jittered to between half and all of it,
+    	so that parts which failed together are not retried together.
+
+    	(default: 1s)
+
+    -retry-budget float
+
+    	Optionally abort the run once this fraction (0.0 to 1.0) of the
+    	most recent 100 requests sent to S3 have failed, e.g., 0.9.
+    	Connection errors, server errors (5xx), and authentication
+    	failures (401, 403) are counted, including requests retried by
+    	the AWS SDK.  This stops s3up from spending hours retrying every
+    	object when the endpoint is down or the credentials have
+    	expired.  The run is aborted with an error naming the most
+    	common failure, and pending uploads are handled as they are for
+    	any other failure.
+
+    	(default: 0, never abort)
+
+    -state-file string
+
+    	Optionally, when -leave-parts-on-error is set, write the state
+    	of any uploads left pending to the specified file as JSON.
+    	Each record lists the bucket, key, UploadId, part size,
+    	checksum algorithm, and the parts uploaded so far (with their
+    	sizes, ETags, and checksums), so that the upload can later be
+    	resumed or cleaned up.  The file is read by s3up repair.
+
+    -resume string
+
+    	Optionally resume the uploads listed in the specified state
+    	file (as written by -state-file) by a previous run that was
+    	interrupted or failed.  When an object is uploaded to the
+    	bucket and key of a listed upload, with the same part size
+    	and checksum algorithm, the parts held by the server are
+    	listed with ListParts, and only those that are missing or
+    	whose size, ETag, or checksum do not match the source are
+    	uploaded before the upload is completed (the ETag is not
+    	compared with -sse aws:kms or -sse-c-key).  A listed upload
+    	that no longer exists is replaced by a new upload.  Implies
+    	-leave-parts-on-error, and once the run has finished the
+    	file is rewritten with the uploads still pending (including
+    	those this run did not reach), or removed if there are none,
+    	so that the same command may be run until it succeeds, e.g.,
+
+    		s3up -resume upload.state -bucket b -key k big.tar
+
+    	Parts whose ETag is not their MD5 (e.g., with -sse aws:kms)
+    	are always uploaded again.  Cannot be combined with
+    	-state-file, -upload-id, or -stream-parts.
+
+    -upload-id string
+
+    	Optionally upload the parts of the object named by -key to a
+    	multi-part upload created by another process (e.g., a
+    	coordinator that creates uploads in advance) rather than
+    	creating one.  The upload is never aborted by s3up, and is
+    	completed only if -start-part is 1 and no -range-length is
+    	given, otherwise it is left for the process that created it
+    	to complete.  The -checksum must
+    	match that the upload was created with, and the source is
+    	always uploaded in parts (a source that is not empty is
+    	required).  With s3up repair, specify the pending upload to
+    	repair.
+
+    -start-part int
+
+    	Optionally specify the part number that the parts uploaded with
+    	-upload-id start at, e.g., 101 if another process uploads parts
+    	1 to 100.  The json -manifest record for an upload left to be
+    	completed notes its UploadId, and the process completing it
+    	may list the parts the server holds to do so.
+
+    	(default: 1)
+
+    -range-offset value
+    -range-length value
+
+    	Optionally upload only the range of the source file starting
+    	at -range-offset, and -range-length bytes long (or to the end
+    	of the file if not given), to the upload given by -upload-id,
+    	as assigned to a host by s3up distribute.  The range should
+    	start at a multiple of the -part-size.
+
+    -hosts int
+
+    	Optionally specify the number of hosts that s3up distribute
+    	assigns parts to.  Fewer hosts are assigned if there are fewer
+    	parts than hosts.
+
+    -plan string
+
+    	Optionally specify the json plan written by s3up distribute,
+    	for s3up complete.
+
+    -compose-manifest string
+
+    	Optionally specify the json manifest listing the chunk objects
+    	an object is composed from, for s3up compose.
+
 MANIFESTS
 
     Manifest types supported are:
@@ -217,16 +1634,58 @@ MANIFESTS
     	481eb555e10d651a84abf64c76e558deab947fae  test-jrobinso/a-a-200MB.dat
     	5698313d0c7e27c16270c08fb250d544a14aa8b4  test-jrobinso/a-a-500MB.dat
 
-    When a json manifest is requested s3up produces a JSON array.  Each
-    record in the array corresponds to an uploaded object and contains
-    metadata calculated by s3up followed by metadata fetched from the S3
-    server (the latter is the ObjectAttributes object). A sample record:
+    When a json manifest is requested s3up produces a JSON array.  The
+    leading record describes the run, for provenance, with the s3up
+    version, the -run-id, the command line, the hostname and user, the
+    time the run started, and the value of every option (the values of
+    -secret-key and -session-token, and passwords in URLs, are redacted):
+
+    	{
+    		"RunMetadata": {
+    			"Version": "v1.2.3",
+    			"RunID": "20240828T191200Z-0a1b2c3d4e5f6a7b",
+    			"CommandLine": ["./s3up", "-bucket", "test-jrobinso", ...],
+    			"Hostname": "dtn01",
+    			"User": "jrobinso",
+    			"StartTime": "2024-08-28T19:12:00Z",
+    			"Options": {"bucket": "test-jrobinso", ...}
+    		}
+    	}
+
+    and the trailing record the time the run ended:
+
+    	{
+    		"RunEnd": {
+    			"RunID": "20240828T191200Z-0a1b2c3d4e5f6a7b",
+    			"EndTime": "2024-08-28T19:12:52Z"
+    		}
+    	}
+
+    If the record of an uploaded object could not be created or written
+    the object is listed in an Errors field of the RunEnd, and s3up exits
+    with a non-zero status once the run is complete (for any manifest
+    format), so that a successful run guarantees the manifest covers
+    every uploaded object:
+
+    		"Errors": [
+    			{
+    				"Bucket": "test-jrobinso",
+    				"Key": "a-a-100MB.dat",
+    				"Error": "<error>"
+    			}
+    		]
+
+    Every other record in the array corresponds to an uploaded object and
+    contains metadata calculated by s3up followed by metadata fetched from
+    the S3 server (the latter is the ObjectAttributes object). A sample
+    record:
 
     	{
     		"Bucket": "test-jrobinso",
     		"Key": "500GB-in-large-files/a/y/a-y-500MB.dat",
     		"Completed": true,
     		"Aborted": false,
+    		"Encryption": "AES256",
     		"FullChecksums": {
     			"ChecksumMD5": {
     				"Hex": "77faeaf43e9e70ec067f7927d3e53424",
@@ -269,6 +1728,45 @@ MANIFESTS
     		}
     	}
 
+    The ETag and checksum returned by S3 when the upload is completed are
+    compared against the values calculated by s3up, and the outcome of
+    each comparison ("match", "mismatch", or "unavailable" if S3 did not
+    return a comparable value) is recorded in a Verification field,
+    along with a Verified flag if either matched and neither was a
+    mismatch:
+
+    	"Verification": {
+    		"ETag": "match",
+    		"Checksum": "match"
+    	},
+    	"Verified": true
+
+    The ETag of an object uploaded using PutObject is its MD5 checksum,
+    except when it is encrypted using KMS keys, in which case it is not
+    compared.  A mismatch is reported as an error for multi-part
+    objects, and for other objects only with -strict-verify.
+
+    The Encryption field records the server-side encryption S3 reports
+    was applied to the object, i.e., AES256, aws:kms, or aws:kms:dsse
+    (see -sse), or SSE-C for objects encrypted with a customer-provided
+    key (see -sse-c-key).  It is left out if S3 did not report any.
+
+    If the object was uploaded but its attributes could not be fetched
+    from S3 (see -object-attributes-retries) the ObjectAttributes field
+    is left out and the record instead includes:
+
+    	"AttributesUnavailable": true
+
+    If any parts were retried (see -retries) the number of retries of each
+    is listed in a PartRetries field:
+
+    	"PartRetries": [
+    		{
+    			"PartNumber": 3,
+    			"Retries": 1
+    		}
+    	]
+
     If errors were encountered they will be listed in an additional Errors
     field.  The outline of an Errors field is:
 
@@ -282,6 +1780,7 @@ MANIFESTS
     		],
     		"CompleteMultipartUploadError": "<error>",
     		"AbortMultipartUploadError": "<error>",
-    		"GetObjectAttributesError": "<error>"
+    		"GetObjectAttributesError": "<error>",
+    		"SourceRetentionError": "<error>"
     	}
 `
@@ -2,6 +2,7 @@ package main
 
 import (
 	"hash"
+	"slices"
 )
 
 // HashPart represents the hash of a single part in a multi-part object.
@@ -46,6 +47,12 @@ func NewHashParts(checksumAlgorithm *ChecksumAlgorithm, partSize int64) *HashPar
 	}
 }
 
+// Grow allocates room for nparts parts, when the number of parts is known in
+// advance.
+func (hp *HashParts) Grow(nparts int) {
+	hp.h = slices.Grow(hp.h, nparts)
+}
+
 // ChecksumAlgorithm returns the checksum algorithm configured for this
 // HashParts.
 func (hp *HashParts) ChecksumAlgorithm() *ChecksumAlgorithm {
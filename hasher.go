@@ -4,11 +4,16 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
 	"hash"
 	"hash/crc32"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
 )
 
 // Hasher defines a generic function that returns hash.Hash, it is used to mask
@@ -69,6 +74,81 @@ var ChecksumAlgorithmSHA256 = &ChecksumAlgorithm{
 	awsType: types.ChecksumAlgorithmSha256,
 }
 
+// SHA512 checksum algorithm, calculated locally for the manifest only.
+var ChecksumAlgorithmSHA512 = &ChecksumAlgorithm{
+	Name: "SHA512",
+}
+
+// BLAKE3 (256-bit) checksum algorithm, calculated locally for the manifest
+// only.
+var ChecksumAlgorithmBLAKE3 = &ChecksumAlgorithm{
+	Name: "BLAKE3",
+}
+
+// XXHASH (XXH64) checksum algorithm, calculated locally for the manifest only.
+var ChecksumAlgorithmXXHASH = &ChecksumAlgorithm{
+	Name: "XXHASH",
+}
+
+// ExtraChecksumAlgorithms lists the checksum algorithms which S3 does not
+// support but which may be calculated locally and added to the manifest.
+var ExtraChecksumAlgorithms = []*ChecksumAlgorithm{
+	ChecksumAlgorithmSHA512,
+	ChecksumAlgorithmBLAKE3,
+	ChecksumAlgorithmXXHASH,
+}
+
+// ChecksumAlgorithms lists the checksum algorithms which S3 supports.
+var ChecksumAlgorithms = []*ChecksumAlgorithm{
+	ChecksumAlgorithmSHA256,
+	ChecksumAlgorithmSHA1,
+	ChecksumAlgorithmCRC32C,
+	ChecksumAlgorithmCRC32,
+}
+
+// parseChecksumAlgorithm returns the algorithm from ChecksumAlgorithms named
+// s (e.g., "sha256").
+func parseChecksumAlgorithm(s string) (*ChecksumAlgorithm, error) {
+	for _, algo := range ChecksumAlgorithms {
+		if strings.EqualFold(algo.Name, s) {
+			return algo, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", errBadChecksum, s)
+}
+
+// ParseExtraChecksums parses a comma separated list of algorithm names from
+// ExtraChecksumAlgorithms (e.g., "sha512,blake3").
+func ParseExtraChecksums(s string) ([]*ChecksumAlgorithm, error) {
+	var algos []*ChecksumAlgorithm
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var found *ChecksumAlgorithm
+		for _, algo := range ExtraChecksumAlgorithms {
+			if strings.EqualFold(algo.Name, name) {
+				found = algo
+				break
+			}
+		}
+
+		if found == nil {
+			return nil, fmt.Errorf("%w: %s", errBadExtraChecksum, name)
+		}
+
+		if !slices.Contains(algos, found) {
+			algos = append(algos, found)
+		}
+	}
+
+	return algos, nil
+}
+
 // NewHasher returns the Hasher generator for the specified ChecksumAlgorithm.
 // It panics if the ChecksumAlgorithm is not recognized.
 func NewHasher(checksumAlgorithm *ChecksumAlgorithm) Hasher {
@@ -87,6 +167,16 @@ func NewHasher(checksumAlgorithm *ChecksumAlgorithm) Hasher {
 		return sha1.New
 	case ChecksumAlgorithmSHA256:
 		return sha256.New
+	case ChecksumAlgorithmSHA512:
+		return sha512.New
+	case ChecksumAlgorithmBLAKE3:
+		return func() hash.Hash {
+			return blake3.New(32, nil)
+		}
+	case ChecksumAlgorithmXXHASH:
+		return func() hash.Hash {
+			return xxhash.New()
+		}
 	default:
 		panic(fmt.Sprintf("unknown ChecksumAlgorithm: %v", checksumAlgorithm))
 	}
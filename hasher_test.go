@@ -44,6 +44,24 @@ func TestHasher(t *testing.T) {
 			Data: "Hello, World!",
 			Hex:  "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f",
 		},
+		{
+			Name: "SHA512",
+			ID:   ChecksumAlgorithmSHA512,
+			Data: "Hello, World!",
+			Hex:  "374d794a95cdcfd8b35993185fef9ba368f160d8daf432d08ba9f1ed1e5abe6cc69291e0fa2fe0006a52570ef18c19def4e617c33ce52ef0a6e5fbe318cb0387",
+		},
+		{
+			Name: "BLAKE3",
+			ID:   ChecksumAlgorithmBLAKE3,
+			Data: "",
+			Hex:  "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		},
+		{
+			Name: "XXHASH",
+			ID:   ChecksumAlgorithmXXHASH,
+			Data: "",
+			Hex:  "ef46db3751d8e999",
+		},
 	}
 
 	for i := 0; i < len(testAlgos); i++ {
@@ -62,3 +80,30 @@ func TestHasher(t *testing.T) {
 		}
 	}
 }
+
+// TestParseExtraChecksums validates parsing of the -extra-checksums list
+func TestParseExtraChecksums(t *testing.T) {
+	tests := []struct {
+		Value  string
+		Expect []*ChecksumAlgorithm
+		Err    bool
+	}{
+		{"", nil, false},
+		{"sha512", []*ChecksumAlgorithm{ChecksumAlgorithmSHA512}, false},
+		{"BLAKE3, xxhash,blake3", []*ChecksumAlgorithm{
+			ChecksumAlgorithmBLAKE3, ChecksumAlgorithmXXHASH}, false},
+		{"sha256", nil, true},
+	}
+
+	for i, test := range tests {
+		algos, err := ParseExtraChecksums(test.Value)
+		if (err != nil) != test.Err {
+			t.Errorf("%d expected error %v got %v", i, test.Err, err)
+			continue
+		}
+
+		if fmt.Sprint(algos) != fmt.Sprint(test.Expect) {
+			t.Errorf("%d expected %v got %v", i, test.Expect, algos)
+		}
+	}
+}
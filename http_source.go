@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// isURL returns true if a source argument is an http or https URL rather than
+// a filepath glob.
+func isURL(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// isURI returns true if a source argument is an http or https URL, or a URI
+// with a scheme registered by RegisterSource, rather than a filepath glob.
+func isURI(s string) bool {
+	return isURL(s) || schemeSource(s) != ""
+}
+
+// openURI returns a reader for the source named by uri, a stand-in for the
+// Source backend registered for its scheme if there is one (which reads the
+// source itself, see newSource), otherwise the response body of a GET request
+// for an http or https URL (see openURL).
+func openURI(ctx context.Context, uri string) (io.ReadCloser, error) {
+	if schemeSource(uri) != "" {
+		return &sourceURI{uri: uri}, nil
+	}
+
+	return openURL(ctx, uri)
+}
+
+// openURL issues a GET request for rawURL, returning the response body to be
+// streamed into an upload.  An error is returned if the server does not
+// respond with 200 OK.
+func openURL(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// urlKeyName returns the name used for the object key when uploading rawURL,
+// which is the last element of the URL path, or the host name if the path is
+// empty.
+func urlKeyName(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = u.Hostname()
+	}
+
+	return name, nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var errJobsWithGlobs = errors.New(
+	"-jobs cannot be combined with globs")
+
+// jobRow represents a single upload listed in a -jobs file.  Only the source
+// is required, the bucket defaults to -bucket and the key defaults to the
+// source file name prepended with the -key prefix.
+type jobRow struct {
+	Source       string `json:"source"`
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	StorageClass string `json:"storage_class"`
+	ContentType  string `json:"content_type"`
+	Tags         string `json:"tags"`
+	Priority     int    `json:"priority"`
+}
+
+// jobColumns lists the recognized CSV header columns, which match the JSON
+// field names of jobRow.
+var jobColumns = []string{
+	"source", "bucket", "key", "storage_class", "content_type", "tags",
+	"priority",
+}
+
+// isJSONLines returns true if the jobs file name indicates JSON lines rather
+// than CSV.
+func isJSONLines(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jsonl", ".ndjson", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// readJobs parses rows from r, either as JSON lines (one jobRow object per
+// line) or as CSV with a header row naming the columns.  Each parsed row, or
+// an error for rows that cannot be parsed, is passed to fn along with the line
+// number it was read from.
+func readJobs(r io.Reader, jsonLines bool, fn func(lineno int, row *jobRow, err error)) error {
+	if jsonLines {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1024*1024)
+
+		lineno := 0
+		for scanner.Scan() {
+			lineno += 1
+
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			row := &jobRow{}
+
+			dec := json.NewDecoder(strings.NewReader(line))
+			dec.DisallowUnknownFields()
+
+			if err := dec.Decode(row); err != nil {
+				fn(lineno, nil, err)
+				continue
+			}
+
+			fn(lineno, row, nil)
+		}
+
+		return scanner.Err()
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read header: %w", err)
+	}
+
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		if !slices.Contains(jobColumns, header[i]) {
+			return fmt.Errorf("unknown column in header: %s", header[i])
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// a malformed row is reported and skipped, any other error
+		// (e.g., reading the file) ends the jobs
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			fn(parseErr.StartLine, nil, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		lineno, _ := cr.FieldPos(0)
+
+		if len(record) > len(header) {
+			fn(lineno, nil, fmt.Errorf(
+				"expected at most %d fields, got %d", len(header), len(record)))
+			continue
+		}
+
+		row := &jobRow{}
+		var rowErr error
+		for i, value := range record {
+			switch header[i] {
+			case "source":
+				row.Source = value
+			case "bucket":
+				row.Bucket = value
+			case "key":
+				row.Key = value
+			case "storage_class":
+				row.StorageClass = value
+			case "content_type":
+				row.ContentType = value
+			case "tags":
+				row.Tags = value
+			case "priority":
+				if value != "" {
+					row.Priority, rowErr = strconv.Atoi(value)
+				}
+			}
+		}
+
+		if rowErr != nil {
+			fn(lineno, nil, fmt.Errorf("invalid priority: %w", rowErr))
+			continue
+		}
+
+		fn(lineno, row, nil)
+	}
+
+	return nil
+}
+
+// objectOptions returns the ObjectOptions for any per-row overrides, or nil if
+// there are none.
+func (p *jobRow) objectOptions() (*ObjectOptions, error) {
+	if p.StorageClass == "" && p.ContentType == "" && p.Tags == "" && p.Priority == 0 {
+		return nil, nil
+	}
+
+	objOpt := &ObjectOptions{
+		ContentType: p.ContentType,
+		Priority:    p.Priority,
+	}
+
+	if p.StorageClass != "" {
+		sc, err := parseStorageClass(p.StorageClass)
+		if err != nil {
+			return nil, err
+		}
+		objOpt.StorageClass = sc
+	}
+
+	if p.Tags != "" {
+		tagging, err := parseTagging(p.Tags)
+		if err != nil {
+			return nil, err
+		}
+		objOpt.Tagging = tagging
+	}
+
+	return objOpt, nil
+}
+
+// processJobs reads the -jobs file at name, returning each source listed via
+// the returned channel.  Bucket and Key provide the defaults for rows that do
+// not specify them.  Rows that cannot be processed are logged and skipped.
+//
+// The rows are read in full before any source is opened, and are returned in
+// order of descending priority, otherwise in the order they were listed.
+func processJobs(ctx context.Context, name, Bucket, Key string, verbose bool) (chan *uploadObject, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	type numberedRow struct {
+		lineno int
+		row    *jobRow
+	}
+
+	var rows []numberedRow
+
+	err = readJobs(fh, isJSONLines(name), func(lineno int, row *jobRow, err error) {
+		if err != nil {
+			log.Printf("skipping -jobs line %d: %s", lineno, err)
+			return
+		}
+
+		rows = append(rows, numberedRow{lineno, row})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error processing -jobs file: %s: %w", name, err)
+	}
+
+	slices.SortStableFunc(rows, func(a, b numberedRow) int {
+		return cmp.Compare(b.row.Priority, a.row.Priority)
+	})
+
+	ch := make(chan *uploadObject)
+
+	go func(ch chan *uploadObject) {
+		defer close(ch)
+
+		for _, r := range rows {
+			obj, err := r.row.uploadObject(ctx, Bucket, Key, verbose)
+			if err != nil {
+				log.Printf("skipping -jobs line %d: %s", r.lineno, err)
+				continue
+			}
+
+			if !sendSource(ctx, ch, obj) {
+				return
+			}
+		}
+	}(ch)
+
+	return ch, nil
+}
+
+// uploadObject opens the source for a jobRow and returns the uploadObject to
+// be submitted to the Uploader.
+func (p *jobRow) uploadObject(ctx context.Context, Bucket, Key string, verbose bool) (*uploadObject, error) {
+	if p.Source == "" {
+		return nil, fmt.Errorf("missing source")
+	}
+
+	if p.Bucket != "" {
+		Bucket = p.Bucket
+	}
+
+	if Bucket == "" {
+		return nil, errMissingBucket
+	}
+
+	objOpt, err := p.objectOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	var rc io.ReadCloser
+
+	if isURI(p.Source) {
+		if name, err = urlKeyName(p.Source); err != nil {
+			return nil, err
+		}
+
+		if verbose {
+			log.Printf("fetching url: %s", p.Source)
+		}
+
+		// the response is read once queued, even if no further
+		// sources are
+		if rc, err = openURI(context.WithoutCancel(ctx), p.Source); err != nil {
+			return nil, err
+		}
+
+		objOpt = objOpt.withSchemeSource(p.Source)
+	} else {
+		fi, err := os.Stat(longPath(p.Source))
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("not a regular file: %s", p.Source)
+		}
+
+		fh, err := os.Open(longPath(p.Source))
+		if err != nil {
+			return nil, err
+		}
+
+		name = keyPath(filepath.Base(p.Source))
+		rc = fh
+	}
+
+	currentKey := p.Key
+	if currentKey == "" {
+		if Key != "" && !strings.HasSuffix(Key, "/") {
+			rc.Close()
+			return nil, fmt.Errorf("missing key (-key is not a prefix)")
+		}
+		currentKey = path.Join(Key, name)
+	}
+
+	return &uploadObject{
+		bucket: Bucket,
+		key:    currentKey,
+		rc:     rc,
+		objOpt: objOpt,
+		source: p.Source,
+	}, nil
+}
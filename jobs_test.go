@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Validate that -jobs files are parsed the same from CSV and JSON lines
+func TestReadJobs(t *testing.T) {
+	csv := strings.Join([]string{
+		"source,bucket,key,storage_class,content_type,tags",
+		"# comment",
+		"a.dat,bucket,x/a.dat,glacier,,project=abc",
+		"b.dat,,,,text/csv,",
+		"c.dat",
+		`"d.dat`,
+	}, "\n")
+
+	jsonl := strings.Join([]string{
+		`{"source": "a.dat", "bucket": "bucket", "key": "x/a.dat", "storage_class": "glacier", "tags": "project=abc"}`,
+		`# comment`,
+		`{"source": "b.dat", "content_type": "text/csv"}`,
+		`{"source": "c.dat"}`,
+		`{"source": "d.dat", "unknown": "field"}`,
+	}, "\n")
+
+	expect := []jobRow{
+		{Source: "a.dat", Bucket: "bucket", Key: "x/a.dat", StorageClass: "glacier", Tags: "project=abc"},
+		{Source: "b.dat", ContentType: "text/csv"},
+		{Source: "c.dat"},
+	}
+
+	for _, tst := range []struct {
+		data      string
+		jsonLines bool
+		nerrors   int
+	}{
+		{data: csv, jsonLines: false, nerrors: 1},
+		{data: jsonl, jsonLines: true, nerrors: 1},
+	} {
+		var rows []jobRow
+		var nerrors int
+
+		err := readJobs(strings.NewReader(tst.data), tst.jsonLines,
+			func(lineno int, row *jobRow, err error) {
+				if err != nil {
+					nerrors += 1
+					return
+				}
+				rows = append(rows, *row)
+			})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if nerrors != tst.nerrors {
+			t.Errorf("expected %d row errors, got %d", tst.nerrors, nerrors)
+		}
+
+		if len(rows) != len(expect) {
+			t.Fatalf("expected %d rows, got %d: %#v", len(expect), len(rows), rows)
+		}
+
+		for i := range expect {
+			if rows[i] != expect[i] {
+				t.Errorf("row %d expected %#v got %#v", i, expect[i], rows[i])
+			}
+		}
+	}
+
+	// overrides are validated and normalized
+	objOpt, err := expect[0].objectOptions()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if objOpt.StorageClass != types.StorageClassGlacier {
+		t.Errorf("expected storage class GLACIER, got %s", objOpt.StorageClass)
+	}
+
+	if objOpt, err = expect[2].objectOptions(); objOpt != nil || err != nil {
+		t.Errorf("expected no overrides, got %#v, %v", objOpt, err)
+	}
+
+	bad := jobRow{Source: "a.dat", StorageClass: "NOT_A_CLASS"}
+	if _, err := bad.objectOptions(); err == nil {
+		t.Errorf("expected error for unknown storage class")
+	}
+}
+
+// Validate that an unknown CSV column is rejected
+func TestReadJobsBadHeader(t *testing.T) {
+	err := readJobs(strings.NewReader("source,colour\na,b\n"), false,
+		func(lineno int, row *jobRow, err error) {})
+	if err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
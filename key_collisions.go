@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// ErrKeyCollision is returned when more than one source maps to the same
+// destination key.
+var ErrKeyCollision = errors.New("multiple sources map to the same key")
+
+// ErrCaseCollision is reported when more than one source maps to keys that
+// differ only by case, which would collide if the bucket were copied to a
+// case-insensitive filesystem.
+var ErrCaseCollision = errors.New("multiple sources map to keys differing only by case")
+
+// keyCollisions records the destination of each source queued for upload, to
+// detect sources that would overwrite each other.  If foldCase is true then
+// destinations that differ only by case are also detected.
+type keyCollisions struct {
+	sources map[string]string
+	folded  map[string]string
+}
+
+// newKeyCollisions initializes a new keyCollisions.
+func newKeyCollisions(foldCase bool) *keyCollisions {
+	p := &keyCollisions{
+		sources: map[string]string{},
+	}
+
+	if foldCase {
+		p.folded = map[string]string{}
+	}
+
+	return p
+}
+
+// add records the destination of obj, returning an error wrapping
+// ErrKeyCollision if an earlier source has the same destination.
+func (p *keyCollisions) add(obj *uploadObject) error {
+	target := path.Join(obj.bucket, obj.key)
+
+	if earlier, ok := p.sources[target]; ok {
+		return fmt.Errorf("%w: %s from %s and %s",
+			ErrKeyCollision, target, earlier, obj.source)
+	}
+
+	p.sources[target] = obj.source
+
+	return nil
+}
+
+// addFolded records the case-folded destination of obj if foldCase was set,
+// returning an error wrapping ErrCaseCollision if an earlier source has a
+// destination that differs only by case.  It should be called after add.
+func (p *keyCollisions) addFolded(obj *uploadObject) error {
+	if p.folded == nil {
+		return nil
+	}
+
+	target := path.Join(obj.bucket, obj.key)
+	folded := path.Join(obj.bucket, strings.ToLower(obj.key))
+
+	if earlier, ok := p.folded[folded]; ok && earlier != target {
+		return fmt.Errorf("%w: %s from %s and %s from %s",
+			ErrCaseCollision, earlier, p.sources[earlier], target, obj.source)
+	}
+
+	p.folded[folded] = target
+
+	return nil
+}
+
+// planKeys lists the sources to be uploaded, closing each without reading
+// it, and logs every source whose destination key is invalid (see S3Key), is
+// the same as that of an earlier source, or with Options.CheckCase differs
+// from it only by case.  An error is returned if any keys were invalid or the
+// same, so that the run may be stopped before any data is transferred.
+func planKeys(ctx context.Context, opts *Options) error {
+	ch, err := processSources(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	check := newKeyCollisions(opts.CheckCase)
+	nsources := 0
+	ncollisions := 0
+	ncase := 0
+	ninvalid := 0
+
+	for obj := range ch {
+		obj.rc.Close()
+
+		obj.key = objectKey(obj, opts)
+		nsources += 1
+
+		if err := checkEncodedKey(obj.key, opts.KeyEncoding, opts.KeyCheck); err != nil {
+			if errors.Is(err, ErrSpecialKey) && opts.KeyCheck == KeyCheckWarn {
+				log.Printf("warning for source %s: %s", obj.source, err)
+			} else {
+				log.Printf("invalid key for source %s: %s", obj.source, err)
+				ninvalid += 1
+				continue
+			}
+		}
+
+		if err := check.add(obj); err != nil {
+			log.Print(err)
+			ncollisions += 1
+			continue
+		}
+
+		if err := check.addFolded(obj); err != nil {
+			log.Printf("warning: %s", err)
+			ncase += 1
+		}
+	}
+
+	if opts.Verbose || ncase > 0 {
+		log.Printf("checked the keys of %d sources, %d differ only by case",
+			nsources, ncase)
+	}
+
+	var errs []error
+
+	if ninvalid > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d sources have invalid keys",
+			ErrBadKey, ninvalid))
+	}
+
+	if ncollisions > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d sources collide with earlier sources",
+			ErrKeyCollision, ncollisions))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Validate that sources mapping to the same destination are detected
+func TestKeyCollisions(t *testing.T) {
+	tests := []struct {
+		bucket string
+		key    string
+		source string
+		err    error
+	}{
+		{"bucket", "a/b.dat", "x/a/b.dat", nil},
+		{"bucket", "a/c.dat", "x/a/c.dat", nil},
+		{"other", "a/b.dat", "x/a/b.dat", nil},
+		{"bucket", "a/b.dat", "y/a/b.dat", ErrKeyCollision},
+		{"bucket", "a/B.dat", "y/a/B.dat", nil},
+	}
+
+	check := newKeyCollisions(false)
+
+	for i, test := range tests {
+		err := check.add(&uploadObject{
+			bucket: test.bucket,
+			key:    test.key,
+			source: test.source,
+		})
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("%d expected %v got %v", i, test.err, err)
+		}
+	}
+}
+
+// Validate that keys differing only by case are detected when requested
+func TestCaseCollisions(t *testing.T) {
+	tests := []struct {
+		key string
+		err error
+	}{
+		{"a/b.dat", nil},
+		{"a/B.dat", ErrCaseCollision},
+		{"A/b.DAT", ErrCaseCollision},
+		{"a/c.dat", nil},
+	}
+
+	check := newKeyCollisions(true)
+
+	for i, test := range tests {
+		obj := &uploadObject{
+			bucket: "bucket",
+			key:    test.key,
+			source: test.key,
+		}
+
+		if err := check.add(obj); err != nil {
+			t.Fatalf("%d unexpected error %v", i, err)
+		}
+
+		if err := check.addFolded(obj); !errors.Is(err, test.err) {
+			t.Errorf("%d expected %v got %v", i, test.err, err)
+		}
+	}
+
+	// without foldCase nothing is reported
+	check = newKeyCollisions(false)
+	for i, test := range tests {
+		obj := &uploadObject{bucket: "bucket", key: test.key}
+		check.add(obj)
+		if err := check.addFolded(obj); err != nil {
+			t.Errorf("%d expected no error got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyShellChars lists the printable ASCII characters, in addition to those in
+// keyAvoidChars, that are interpreted by shells and so are percent-encoded by
+// KeyEncodingSpecial
+const keyShellChars = " !$&'()*;?"
+
+// keyEncoding represents how characters in key names are percent-encoded.
+type keyEncoding int
+
+const (
+	// Keys are not encoded, keys that are not valid are rejected
+	KeyEncodingReject keyEncoding = iota
+
+	// Bytes that are not valid UTF-8, and non-printable characters, are
+	// percent-encoded
+	KeyEncodingInvalid
+
+	// Additionally characters that may require special handling, or that
+	// are interpreted by shells, are percent-encoded
+	KeyEncodingSpecial
+)
+
+// KeyEncoding represents a keyEncoding, with helper functions to parse and
+// produce human readable representations of the identifier for use via the
+// flag module.
+type KeyEncoding keyEncoding
+
+func (p KeyEncoding) String() string {
+	switch keyEncoding(p) {
+	case KeyEncodingInvalid:
+		return "encode-invalid"
+	case KeyEncodingSpecial:
+		return "encode-all-special"
+	default:
+		return "reject"
+	}
+}
+
+func (p *KeyEncoding) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "reject":
+		*p = KeyEncoding(KeyEncodingReject)
+	case "encode-invalid":
+		*p = KeyEncoding(KeyEncodingInvalid)
+	case "encode-all-special":
+		*p = KeyEncoding(KeyEncodingSpecial)
+	default:
+		return fmt.Errorf("valid key encodings: reject, encode-invalid, encode-all-special")
+	}
+
+	return nil
+}
+
+// encodeKey returns key with characters percent-encoded per mode, as "%XX" for
+// each byte of the character.  The '%' character is itself encoded as "%25" by
+// every mode other than KeyEncodingReject, so that the original key may be
+// recovered by url.PathUnescape.
+func encodeKey(key string, mode keyEncoding) string {
+	if mode == KeyEncodingReject {
+		return key
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+
+		encode := false
+		switch {
+		case r == utf8.RuneError && size == 1:
+			encode = true
+		case r == '%' || !unicode.IsPrint(r):
+			encode = true
+		case mode == KeyEncodingSpecial:
+			encode = strings.ContainsRune(keyAvoidChars, r) ||
+				strings.ContainsRune(keyShellChars, r)
+		}
+
+		if encode {
+			for _, c := range []byte(key[i : i+size]) {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		} else {
+			b.WriteString(key[i : i+size])
+		}
+
+		i += size
+	}
+
+	return b.String()
+}
+
+// checkEncodedKey validates a key produced by encodeKey per mode, see S3Key.
+// Unless mode is KeyEncodingReject every '%' in the key introduces a
+// percent-encoded character (as '%' itself is encoded), and so is not
+// reported as a character that may require special handling.
+func checkEncodedKey(key string, mode keyEncoding, check keyCheck) error {
+	if mode == KeyEncodingReject || !strings.Contains(key, "%") {
+		return S3Key(key, check)
+	}
+
+	// '%' is replaced by a character of the same length, so that the
+	// length and offsets of the key are unchanged
+	if err := S3Key(strings.ReplaceAll(key, "%", "_"), check); err != nil {
+		return S3Key(key, check)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestEncodeKey(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		mode   keyEncoding
+		expect string
+	}{
+		{"a/b c%.txt", KeyEncodingReject, "a/b c%.txt"},
+		{"a/\xff.txt", KeyEncodingReject, "a/\xff.txt"},
+		{"a/\xff.txt", KeyEncodingInvalid, "a/%FF.txt"},
+		{"a/b\x07%.txt", KeyEncodingInvalid, "a/b%07%25.txt"},
+		{"a/b c{}.txt", KeyEncodingInvalid, "a/b c{}.txt"},
+		{"a/ünïcødé.txt", KeyEncodingSpecial, "a/ünïcødé.txt"},
+		{"a/b c{}.txt", KeyEncodingSpecial, "a/b%20c%7B%7D.txt"},
+		{"a/$(x);y", KeyEncodingSpecial, "a/%24%28x%29%3By"},
+		{"a/b\u200b.txt", KeyEncodingSpecial, "a/b%E2%80%8B.txt"},
+	} {
+		got := encodeKey(tst.key, tst.mode)
+		if got != tst.expect {
+			t.Errorf("%d expected %q, got %q", i, tst.expect, got)
+		}
+
+		if tst.mode == KeyEncodingReject {
+			continue
+		}
+
+		orig, err := url.PathUnescape(got)
+		if err != nil || orig != tst.key {
+			t.Errorf("%d expected %q to decode to %q, got %q %v", i, got, tst.key, orig, err)
+		}
+	}
+}
+
+// Validate that keys encoded with encode-all-special pass -key-check strict,
+// while the '%' of unencoded keys is still reported
+func TestCheckEncodedKey(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		mode   keyEncoding
+		check  keyCheck
+		expect error
+	}{
+		{"a/b c{}%#.txt", KeyEncodingSpecial, KeyCheckStrict, nil},
+		{"a/b^|~.txt", KeyEncodingSpecial, KeyCheckWarn, nil},
+		{"a/b\x07%.txt", KeyEncodingInvalid, KeyCheckStrict, nil},
+		{"a/b{}.txt", KeyEncodingInvalid, KeyCheckStrict, ErrSpecialKey},
+		{"a/b%.txt", KeyEncodingReject, KeyCheckStrict, ErrSpecialKey},
+	} {
+		err := checkEncodedKey(encodeKey(tst.key, tst.mode), tst.mode, tst.check)
+		if !errors.Is(err, tst.expect) {
+			t.Errorf("%d expected %v, got %v", i, tst.expect, err)
+		}
+	}
+}
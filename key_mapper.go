@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+var errKeyMapperLine = errors.New(
+	"-key-mapper cannot map a source or key containing a tab or newline")
+
+var errKeyMapperExited = errors.New(
+	"-key-mapper exited before mapping the key")
+
+// keyMapperQueue is the number of objects written to a -key-mapper command
+// whose keys have not yet been read back, which also limits the number of
+// sources held open waiting for their keys.
+const keyMapperQueue = 256
+
+// mapKeys runs cmd using the system shell for the whole of the run, returning
+// the objects received on in with their keys replaced by those the command
+// prints.  For each object a line with the source and the key it would
+// otherwise be uploaded to, separated by a tab, is written to the standard
+// input of cmd, which must print a line with the key to upload it to, or an
+// empty line to skip the object.  Lines are written without waiting for the
+// keys of earlier lines to be read back, and keys must be printed in the same
+// order.  The key of an object is recorded as its sourceKey before it is
+// replaced.
+func mapKeys(ctx context.Context, cmd string, in chan *uploadObject, verbose bool) (chan *uploadObject, error) {
+	c := shellCommand(ctx, cmd)
+	c.Stderr = os.Stderr
+
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("-key-mapper failed: %w", err)
+	}
+
+	pending := make(chan *uploadObject, keyMapperQueue)
+	out := make(chan *uploadObject)
+
+	// write the objects to the command, queueing them to be matched with
+	// the keys read back
+	go func() {
+		defer close(pending)
+		defer stdin.Close()
+
+		w := bufio.NewWriter(stdin)
+
+		var werr error
+		for obj := range in {
+			if strings.ContainsAny(obj.source, "\t\n") || strings.ContainsAny(obj.key, "\t\n") {
+				sourceError("skipping object %s/%s: %s", obj.bucket, obj.key, errKeyMapperLine)
+				obj.rc.Close()
+				continue
+			}
+
+			pending <- obj
+
+			// once the command has failed the remaining objects
+			// are still queued, so that they are skipped in order
+			if werr == nil {
+				_, werr = fmt.Fprintf(w, "%s\t%s\n", obj.source, obj.key)
+			}
+			if werr == nil {
+				werr = w.Flush()
+			}
+		}
+	}()
+
+	// read the keys back from the command, in the order the objects were
+	// written
+	go func() {
+		defer close(out)
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 64*1024)
+
+		for obj := range pending {
+			if !scanner.Scan() {
+				err := scanner.Err()
+				if err == nil {
+					err = errKeyMapperExited
+				}
+				sourceError("skipping object %s/%s: %s", obj.bucket, obj.key, err)
+				obj.rc.Close()
+				continue
+			}
+
+			// an empty key skips the object by choice, which is
+			// not a source error, so does not prevent -delete
+			key := strings.TrimRight(scanner.Text(), "\r")
+			if key == "" {
+				if verbose {
+					log.Printf("skipping object %s/%s: no key from -key-mapper", obj.bucket, obj.key)
+				}
+				obj.rc.Close()
+				continue
+			}
+
+			obj.sourceKey = obj.key
+			obj.key = key
+
+			out <- obj
+		}
+
+		// let the command see the end of its input before waiting
+		io.Copy(io.Discard, stdout)
+
+		if err := c.Wait(); err != nil {
+			sourceError("-key-mapper failed: %s", err)
+		}
+	}()
+
+	return out, nil
+}
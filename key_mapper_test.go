@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingCloser counts the sources closed by mapKeys
+type countingCloser struct {
+	io.Reader
+	closed *atomic.Int32
+}
+
+func (c *countingCloser) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+// Validate mapKeys replaces keys in order, skipping objects the command maps
+// to an empty key or does not map before exiting
+func TestMapKeys(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+
+	const n = keyMapperQueue + 10
+
+	mapper := `while IFS="$(printf '\t')" read -r src key; do
+		case "$key" in *5) echo ;; *) echo "mapped/$src/$key" ;; esac
+	done`
+
+	// keys ending in 5 are skipped by the mapper
+	nskipped := 0
+	for j := 0; j < n; j++ {
+		if j%10 == 5 {
+			nskipped += 1
+		}
+	}
+
+	for i, tst := range []struct {
+		cmd      string
+		verbose  bool
+		expect   int
+		errors   int
+		expectFn func(j int) string
+	}{
+		{mapper, false, n - nskipped, 0, func(j int) string { return fmt.Sprintf("mapped/src%d/key%d", j, j) }},
+		{mapper, true, n - nskipped, 0, func(j int) string { return fmt.Sprintf("mapped/src%d/key%d", j, j) }},
+		{`read -r line && echo first`, false, 1, n - 1, func(j int) string { return "first" }},
+	} {
+		sourceErrors.Store(0)
+
+		var closed atomic.Int32
+
+		in := make(chan *uploadObject)
+		go func() {
+			defer close(in)
+			for j := 0; j < n; j++ {
+				in <- &uploadObject{
+					bucket: "bucket",
+					key:    fmt.Sprintf("key%d", j),
+					source: fmt.Sprintf("src%d", j),
+					rc:     &countingCloser{strings.NewReader(""), &closed},
+				}
+			}
+		}()
+
+		out, err := mapKeys(context.Background(), tst.cmd, in, tst.verbose)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nmapped := 0
+		for obj := range out {
+			var j int
+			fmt.Sscanf(obj.sourceKey, "key%d", &j)
+
+			if expect := tst.expectFn(j); obj.key != expect {
+				t.Errorf("%d expected %s, got %s", i, expect, obj.key)
+			}
+			nmapped += 1
+		}
+
+		if nmapped != tst.expect {
+			t.Errorf("%d expected %d mapped, got %d", i, tst.expect, nmapped)
+		}
+
+		if int(closed.Load()) != n-nmapped {
+			t.Errorf("%d expected %d skipped sources closed, got %d", i, n-nmapped, closed.Load())
+		}
+
+		// objects skipped with an empty key are not source errors,
+		// regardless of -verbose, so that -delete is not affected
+		if errors := sourceErrors.Load(); errors != int64(tst.errors) {
+			t.Errorf("%d expected %d source errors, got %d", i, tst.errors, errors)
+		}
+	}
+
+	sourceErrors.Store(0)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var errBadKeyReplace = errors.New(
+	"-key-replace must be a character followed by '=' and its replacement")
+
+// keyReplacer maps characters in key names to their replacements.
+type keyReplacer map[rune]string
+
+// newKeyReplacer parses specs of the form "<char>=<replacement>", e.g., ":=_"
+// replaces ':' with '_' and "|=" removes '|'.  As the character is the first
+// in the spec, '=' itself may be replaced, e.g., "==-".
+func newKeyReplacer(specs []string) (keyReplacer, error) {
+	p := keyReplacer{}
+
+	for _, s := range specs {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError || !strings.HasPrefix(s[size:], "=") {
+			return nil, fmt.Errorf("%w: %s", errBadKeyReplace, s)
+		}
+
+		to := s[size+1:]
+		if !utf8.ValidString(to) {
+			return nil, fmt.Errorf("%w: not valid UTF-8: %s", errBadKeyReplace, s)
+		}
+
+		p[r] = to
+	}
+
+	return p, nil
+}
+
+// replace returns key with each character in p replaced, or key unchanged if
+// p is empty.
+func (p keyReplacer) replace(key string) string {
+	if len(p) == 0 {
+		return key
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+
+		if to, ok := p[r]; ok && !(r == utf8.RuneError && size == 1) {
+			b.WriteString(to)
+		} else {
+			b.WriteString(key[i : i+size])
+		}
+
+		i += size
+	}
+
+	return b.String()
+}
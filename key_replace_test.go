@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyReplacer(t *testing.T) {
+	for i, tst := range []struct {
+		specs  []string
+		key    string
+		expect string
+		err    error
+	}{
+		{nil, "a/b:c|d.txt", "a/b:c|d.txt", nil},
+		{[]string{":=_", "|=-"}, "a/b:c|d.txt", "a/b_c-d.txt", nil},
+		{[]string{"|="}, "a/b|c.txt", "a/bc.txt", nil},
+		{[]string{"==-", ",=+"}, "a/b=c,d.txt", "a/b-c+d.txt", nil},
+		{[]string{"ü=u"}, "a/ünï.txt", "a/unï.txt", nil},
+		{[]string{":_"}, "", "", errBadKeyReplace},
+		{[]string{""}, "", "", errBadKeyReplace},
+		{[]string{":=\xff"}, "", "", errBadKeyReplace},
+	} {
+		p, err := newKeyReplacer(tst.specs)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if got := p.replace(tst.key); got != tst.expect {
+			t.Errorf("%d expected %q, got %q", i, tst.expect, got)
+		}
+	}
+}
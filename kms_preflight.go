@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// kmsPreflight checks that objects may be uploaded to Bucket using the KMS key
+// configured in objOpt, by uploading a small multi-part probe object next to
+// Key and then deleting it.  S3 calls kms:GenerateDataKey when the upload is
+// created and each part is uploaded, and kms:Decrypt when the upload is
+// completed, so a missing permission on the key is found before any files are
+// processed rather than when the first (possibly very large) object
+// completes.  Errors wrap ErrPreflight and name the failing operation.
+func kmsPreflight(ctx context.Context, Bucket, Key string, objOpt *ObjectOptions, opts *Options) error {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	probe := preflightProbeKey(Key)
+
+	key := objOpt.SSEKMSKeyId
+	if key == "" {
+		key = "the AWS managed key"
+	}
+
+	if opts.Verbose {
+		log.Printf("checking KMS permissions for %s using %s", key, probe)
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket: &Bucket,
+		Key:    &probe,
+	}
+	objOpt.applyCreateMultipartUpload(create)
+
+	out, err := s3client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return kmsPreflightError(Bucket, key, "CreateMultipartUpload", err)
+	}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		_, err := s3client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   &Bucket,
+			Key:      &probe,
+			UploadId: out.UploadId,
+		})
+		if err != nil {
+			log.Printf("unable to abort KMS preflight upload: %s/%s (upload-id %s): %s",
+				Bucket, probe, *out.UploadId, err)
+		}
+	}()
+
+	part, err := s3client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     &Bucket,
+		Key:        &probe,
+		UploadId:   out.UploadId,
+		PartNumber: aws.Int32(1),
+		Body:       bytes.NewReader([]byte{0}),
+	})
+	if err != nil {
+		return kmsPreflightError(Bucket, key, "UploadPart", err)
+	}
+
+	_, err = s3client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   &Bucket,
+		Key:      &probe,
+		UploadId: out.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{ETag: part.ETag, PartNumber: aws.Int32(1)},
+			},
+		},
+	})
+	if err != nil {
+		return kmsPreflightError(Bucket, key, "CompleteMultipartUpload", err)
+	}
+
+	completed = true
+
+	_, err = s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &Bucket,
+		Key:    &probe,
+	})
+	if err != nil {
+		return preflightError(Bucket, "DeleteObject", err)
+	}
+
+	return nil
+}
+
+// kmsPreflightError wraps an error returned by the operation op during the KMS
+// preflight, describing the KMS permission likely to be missing when access
+// was denied.
+func kmsPreflightError(Bucket, key, op string, err error) error {
+	if preflightStatusCode(err) != http.StatusForbidden {
+		return preflightError(Bucket, op, err)
+	}
+
+	permission := "kms:GenerateDataKey"
+	if op == "CompleteMultipartUpload" {
+		permission = "kms:Decrypt"
+	}
+
+	return fmt.Errorf("%w: %s: %s access denied, check %s permission on %s: %w",
+		ErrPreflight, Bucket, op, permission, key, err)
+}
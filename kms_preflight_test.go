@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestKMSPreflightError(t *testing.T) {
+	denied := &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{
+				Response: &http.Response{StatusCode: http.StatusForbidden},
+			},
+			Err: errors.New("AccessDenied"),
+		},
+	}
+
+	for i, tst := range []struct {
+		op     string
+		expect string
+	}{
+		{"CreateMultipartUpload", "kms:GenerateDataKey"},
+		{"UploadPart", "kms:GenerateDataKey"},
+		{"CompleteMultipartUpload", "kms:Decrypt"},
+	} {
+		err := kmsPreflightError("bucket", "key-id", tst.op, denied)
+		if !errors.Is(err, ErrPreflight) {
+			t.Errorf("%d expected ErrPreflight got %v", i, err)
+		}
+		if !strings.Contains(err.Error(), tst.expect) {
+			t.Errorf("%d expected %s got %s", i, tst.expect, err)
+		}
+	}
+}
+
+func TestUsesKMS(t *testing.T) {
+	for i, tst := range []struct {
+		sse    string
+		expect bool
+	}{
+		{"AES256", false},
+		{"aws:kms", true},
+		{"AWS:KMS:DSSE", true},
+	} {
+		sse, err := parseServerSideEncryption(tst.sse)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		objOpt := (&ObjectOptions{}).withDefaults(&ObjectOptions{
+			ServerSideEncryption: sse,
+		})
+		if actual := objOpt.usesKMS(); actual != tst.expect {
+			t.Errorf("%d expected %t got %t", i, tst.expect, actual)
+		}
+	}
+
+	if _, err := parseServerSideEncryption("none"); err == nil {
+		t.Errorf("expected error for unknown server-side encryption")
+	}
+
+	if (*ObjectOptions)(nil).usesKMS() || (&ObjectOptions{ServerSideEncryption: types.ServerSideEncryptionAes256}).usesKMS() {
+		t.Errorf("expected usesKMS false")
+	}
+}
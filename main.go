@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -17,6 +19,24 @@ type uploadObject struct {
 	bucket string
 	key    string
 	rc     io.ReadCloser
+	objOpt *ObjectOptions
+
+	// source names the file or URL read, or "-" for standard input
+	source string
+
+	// sourceKey records the key before it was replaced by -key-mapper
+	sourceKey string
+
+	// split records the range of standard input read, if it was split
+	// with -split-size
+	split *SplitRange
+
+	// compression records whether the source was compressed by -compress
+	compression *Compression
+
+	// sparseSize records the size of a sparse file of which only the
+	// data was uploaded by -sparse holes
+	sparseSize int64
 }
 
 func main() {
@@ -31,11 +51,74 @@ func main() {
 		cancel()
 	}(cancel)
 
+	// "s3up diff" compares local sources against remote objects
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := runDiff(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "s3up repair" re-uploads the failed parts of a pending upload
+	if len(os.Args) > 1 && os.Args[1] == "repair" {
+		if err := runRepair(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "s3up compose" creates an object from existing chunk objects
+	if len(os.Args) > 1 && os.Args[1] == "compose" {
+		if err := runCompose(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "s3up distribute" creates an upload for several hosts to share, and
+	// "s3up complete" completes it once they are done
+	if len(os.Args) > 1 && os.Args[1] == "distribute" {
+		if err := runDistribute(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "complete" {
+		if err := runComplete(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// "s3up export-manifest" exports the records of a -manifest-append
+	// file as a json manifest
+	if len(os.Args) > 1 && os.Args[1] == "export-manifest" {
+		if err := runExportManifest(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	opts, err := processFlags(ctx, os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// only s3up complete takes the bucket from -plan
+	if opts.bucket == "" && opts.Jobs == "" {
+		log.Fatal(errMissingBucket)
+	}
+
+	if err := checkUploadID(opts); err != nil {
+		log.Fatal(err)
+	}
+
+	// if -retry-budget was specified, cancel the run once it is exhausted
+	if opts.retryBudget != nil {
+		ctx = opts.retryBudget.Context(ctx)
+	}
+
 	// if profiling or tracing flags were specified, activate them
 	if shutdown, err := profilers(opts); err != nil {
 		log.Printf("unable to initialize profilers: %s", err)
@@ -60,9 +143,100 @@ func main() {
 		}
 	}
 
+	// use the region the bucket is in, unless -disable-region-detect
+	if !opts.DisableRegionDetect && opts.contactsBucket() {
+		useBucketRegion(ctx, opts.bucket, opts)
+	}
+
+	// probe for the addressing style that works, unless -path-style was set
+	if opts.PathStyle == PathStyleAuto && opts.contactsBucket() {
+		useAddressing(ctx, opts.bucket, opts)
+	}
+
+	// if -preflight was specified, fail fast if the bucket is not usable
+	if opts.Preflight && opts.contactsBucket() {
+		err := preflight(ctx, opts.bucket, opts.key, opts.PreflightWrite, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		checkBucketSettings(ctx, opts.bucket, opts)
+	}
+
+	// if -sse uses KMS, fail fast if the key is not usable
+	if opts.objOpt.usesKMS() && !opts.DisableKMSPreflight && opts.contactsBucket() {
+		err := kmsPreflight(ctx, opts.bucket, opts.key, opts.objOpt, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// if -probe-endpoints was specified, bias parts towards the fastest
+	if opts.ProbeEndpoints && opts.contactsBucket() {
+		startEndpointProbes(ctx, opts.bucket, opts.s3, opts.ProbeEndpointsInterval, opts.Verbose)
+	}
+
+	// if -warm-up was specified, open connections before the first part
+	if opts.WarmUp > 0 && opts.contactsBucket() {
+		if err := warmUp(ctx, opts.bucket, opts.WarmUp, opts); err != nil {
+			log.Printf("unable to warm up connections: %s", err)
+		}
+	}
+
+	// if -abort-stale was specified, clean up after any earlier runs
+	if opts.AbortStale > 0 && opts.contactsBucket() {
+		n, err := abortStaleUploads(ctx, opts.bucket, opts.key, opts.AbortStale, opts)
+		if err != nil {
+			log.Printf("unable to abort stale uploads: %s", err)
+		} else if opts.Verbose {
+			log.Printf("aborted %d stale uploads", n)
+		}
+	}
+
+	// if -sync was specified, list the remote objects to compare against
+	// (unless each object is compared using -sync-mode head)
+	var synced *syncState
+	if opts.Sync {
+		synced, err = newSyncState(ctx, opts.bucket, opts.key, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// if -snapshot-cmd was specified, read the globs from the snapshot
+	if opts.SnapshotCmd != "" {
+		opts.snapshot, err = takeSnapshot(ctx, opts.SnapshotCmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.Verbose {
+			log.Printf("reading sources from snapshot: %s", opts.snapshot.mount)
+		}
+	}
+
+	// if -check-keys was specified, fail before uploading anything if
+	// sources would overwrite each other
+	if opts.CheckKeys {
+		if err := planKeys(ctx, opts); err != nil {
+			opts.snapshot.fatal(opts.SnapshotCleanupCmd, err)
+		}
+	}
+
 	// initialize the uploader
 	uploader := NewUploader(ctx, opts)
 
+	// if -stats-fd was specified, write snapshots until the run finishes
+	statsCtx, statsCancel := context.WithCancel(ctx)
+	defer statsCancel()
+
+	if opts.stats != nil {
+		go func() {
+			if err := opts.stats.Run(statsCtx); err != nil {
+				log.Printf("unable to write -stats-fd: %s", err)
+			}
+		}()
+	}
+
 	// setup result handler
 	completed := make(chan *UploadResults)
 	inflight := &sync.WaitGroup{}
@@ -74,14 +248,83 @@ func main() {
 	var ncompleted int
 	var naborted int
 
+	// manifestErr is set once reporting has completed if the manifest is
+	// missing any uploaded objects
+	var manifestErr error
+
+	// if -manifest-upload was specified, the manifest is also written to a
+	// temporary file that is uploaded once the run has finished
+	manifestOut := io.Writer(os.Stdout)
+	var manifestCopy *os.File
+	if opts.ManifestUpload != "" {
+		manifestCopy, err = os.CreateTemp("", "s3up-manifest-*")
+		if err != nil {
+			opts.snapshot.fatal(opts.SnapshotCleanupCmd,
+				"unable to create manifest for -manifest-upload: ", err)
+		}
+		manifestOut = io.MultiWriter(os.Stdout, manifestCopy)
+	}
+
+	// if -manifest-checkpoint was specified, periodically write the
+	// manifest so far, also uploading it with -manifest-upload
+	var checkpoint *manifestCheckpoint
+	if opts.ManifestCheckpoint != "" {
+		t := opts.Manifest
+		if t == NoManifest {
+			t = JsonManifest
+		}
+
+		checkpoint, err = newManifestCheckpoint(opts.ManifestCheckpoint, t, opts.runMetadata,
+			opts.CheckpointObjects, opts.CheckpointInterval)
+		if err != nil {
+			opts.snapshot.fatal(opts.SnapshotCleanupCmd,
+				"unable to create -manifest-checkpoint: ", err)
+		}
+
+		if opts.ManifestUpload != "" && !opts.DryRun && !opts.ChecksumOnly {
+			key := manifestUploadKey(opts.ManifestUpload, opts.RunID, opts.Manifest)
+			checkpoint.upload = func(fh *os.File) error {
+				return uploadManifest(context.WithoutCancel(ctx), fh, opts.bucket, key, opts)
+			}
+		}
+	}
+
 	reporting.Add(1)
 	go func(completed chan *UploadResults, reporting *sync.WaitGroup) {
 		defer reporting.Done()
 
-		manifest := Manifest(opts.Manifest, os.Stdout)
-		defer manifest.End()
+		manifest := Manifest(opts.Manifest, manifestOut)
+		manifest.SetRunMetadata(opts.runMetadata)
+		if opts.ManifestAppend != "" {
+			// records are still appended once the run is interrupted
+			manifest.SetSharedManifest(context.WithoutCancel(ctx), opts.ManifestAppend)
+		}
+		defer func() {
+			if err := checkpoint.Close(); err != nil {
+				log.Printf("unable to write -manifest-checkpoint: %s", err)
+			}
+		}()
+		defer func() {
+			if err := manifest.End(); err != nil {
+				manifestErr = fmt.Errorf("error writing manifest: %w", err)
+			} else {
+				manifestErr = manifest.Err()
+			}
+		}()
 
 		for res := range completed {
+			// objects found in the -dedupe-db were counted as
+			// skipped, and their sources are not retained
+			duplicate := res.State != nil && res.State.duplicateOf != nil
+			if !duplicate {
+				opts.summary.complete(res)
+				opts.stats.complete(res)
+			}
+
+			if err := opts.dedupe.recordUpload(res); err != nil {
+				log.Printf("unable to write -dedupe-db: %s", err)
+			}
+
 			if res.Error != nil {
 				log.Printf("error uploading object %s/%s: %s", res.Bucket, res.Key, res.Error)
 			} else {
@@ -92,11 +335,30 @@ func main() {
 
 				obj, err := NewObjectReporting(res.State)
 				if err != nil {
-					log.Printf("error creating manfiest for object: %s", err)
+					log.Printf("error creating manifest record for object %s/%s: %s",
+						res.Bucket, res.Key, err)
+					manifest.RecordError(res.Bucket, res.Key, err)
 				} else {
+					if (opts.DeleteSource || opts.ArchiveSourceTo != "" || opts.TruncateSource) && !duplicate {
+						if err := retainSource(res.State, obj, opts); err != nil {
+							log.Printf("unable to apply retention to source of object %s/%s: %s",
+								res.Bucket, res.Key, err)
+							if obj.Errors == nil {
+								obj.Errors = &ObjectErrors{}
+							}
+							obj.Errors.SourceRetentionError = errorString(err)
+						}
+					}
+
 					err = manifest.Write(obj)
 					if err != nil {
-						log.Printf("error writing manifest: %s", err)
+						log.Printf("error writing manifest record for object %s/%s: %s",
+							res.Bucket, res.Key, err)
+						manifest.RecordError(res.Bucket, res.Key, err)
+					}
+
+					if err := checkpoint.Write(obj); err != nil {
+						log.Printf("unable to write -manifest-checkpoint: %s", err)
 					}
 
 					if opts.Verbose {
@@ -130,24 +392,173 @@ func main() {
 
 	}(completed, reporting)
 
-	// start processing file globs for objects to upload
-	to_upload, err := processGlobs(
-		opts.globs, opts.bucket, opts.key, opts.Recursive, opts.Verbose)
+	// start processing the -jobs file or file globs for objects to upload,
+	// stopping once the quota is exceeded
+	sourceCtx, stopSources := context.WithCancel(ctx)
+	defer stopSources()
+
+	to_upload, err := processSources(sourceCtx, opts)
 	if err != nil {
-		log.Fatal(err)
+		opts.snapshot.fatal(opts.SnapshotCleanupCmd, err)
+	}
+
+	// sources mapping to the same key as an earlier source are skipped
+	// rather than overwriting it
+	keys := newKeyCollisions(opts.CheckCase)
+
+	// if -max-objects or -max-bytes was specified, stop queueing objects
+	// once either is exceeded
+	limit := newQuota(opts.MaxObjects, int64(opts.MaxBytes))
+
+	// if -dry-run was specified, estimate the cost instead of uploading
+	var estimate *costEstimate
+	if opts.DryRun {
+		estimate = newCostEstimate(int64(opts.PartSize))
+	}
+
+	// skip logs and counts a source that will not be uploaded because of
+	// err, so that -delete does not remove its remote object
+	skip := func(obj *uploadObject, err error) {
+		log.Printf("skipping object %s/%s: %s", obj.bucket, obj.key, err)
+		opts.summary.skip()
+		synced.skip()
+		obj.rc.Close()
 	}
 
 	t0 = time.Now()
 
 	for obj := range to_upload {
+		sourceKey := obj.key
+		if obj.sourceKey != "" {
+			sourceKey = obj.sourceKey
+		}
+		obj.key = objectKey(obj, opts)
+		if obj.key == sourceKey {
+			sourceKey = ""
+		}
+
+		// the remote object of a source that is found is never
+		// deleted by -delete, even if the source is skipped
+		synced.see(obj.key)
+
+		if err := checkEncodedKey(obj.key, opts.KeyEncoding, opts.KeyCheck); err != nil {
+			if errors.Is(err, ErrSpecialKey) && opts.KeyCheck == KeyCheckWarn {
+				log.Printf("warning for object %s/%s: %s", obj.bucket, obj.key, err)
+			} else {
+				skip(obj, err)
+				continue
+			}
+		}
+
+		// a worker of s3up distribute uploads only its range of the
+		// source
+		if opts.RangeOffset > 0 || opts.RangeLength > 0 {
+			rc, err := sourceRange(obj.rc, int64(opts.RangeOffset), int64(opts.RangeLength))
+			if err != nil {
+				skip(obj, err)
+				continue
+			}
+			obj.rc = rc
+		}
+
+		// if -metadata-sidecar was specified, add the metadata of
+		// files from their sidecar files, which are not uploaded
+		if opts.MetadataSidecar != "" {
+			if err := applyMetadataSidecar(obj, opts.MetadataSidecar, opts.RunID, opts.objOpt); err != nil {
+				skip(obj, err)
+				continue
+			}
+		}
+
+		// if -sparse was specified, skip sparse files or upload only
+		// their data
+		if err := applySparse(obj, opts.Sparse, opts.Verbose); err != nil {
+			skip(obj, err)
+			continue
+		}
+
+		// if -compress was specified, compress sources that are not
+		// already compressed
+		if opts.Compress {
+			if err := applyCompress(obj, opts); err != nil {
+				skip(obj, err)
+				continue
+			}
+		}
+
+		if err := keys.add(obj); err != nil {
+			skip(obj, err)
+			continue
+		}
+
+		if err := keys.addFolded(obj); err != nil {
+			log.Printf("warning for object %s/%s: %s", obj.bucket, obj.key, err)
+		}
+
+		// the quota is applied before sources are compared by -sync or
+		// -dedupe-db, which may read them, and once it is exceeded the
+		// remaining sources are skipped without being walked, so that
+		// -delete does not remove their remote objects
+		if !limit.admit(obj) {
+			if opts.Verbose {
+				log.Printf("skipping object over quota %s/%s", obj.bucket, obj.key)
+			}
+			stopSources()
+			opts.summary.skip()
+			synced.skip()
+			obj.rc.Close()
+			continue
+		}
+
+		if synced != nil && synced.unchanged(ctx, obj, opts) {
+			if opts.Verbose {
+				log.Printf("skipping unchanged object %s/%s", obj.bucket, obj.key)
+			}
+			limit.release(obj)
+			opts.summary.skip()
+			obj.rc.Close()
+			continue
+		}
+
+		// objects found in the -dedupe-db are only recorded in the
+		// manifest
+		if st := opts.dedupe.dedupe(ctx, obj, opts); st != nil {
+			limit.release(obj)
+			opts.summary.skip()
+			obj.rc.Close()
+			st.sourceKey = sourceKey
+			completed <- &UploadResults{Bucket: obj.bucket, Key: obj.key, State: st}
+			continue
+		}
+
+		if estimate != nil {
+			if opts.Verbose {
+				log.Printf("would upload object %s/%s", obj.bucket, obj.key)
+			}
+			estimate.addObject(obj, opts.objOpt)
+			obj.rc.Close()
+			continue
+		}
+
 		inflight.Add(1)
-		uploaded := uploader.Upload(ctx, obj.rc, obj.bucket, obj.key)
-		go func(rc io.ReadCloser, uploaded, completed chan *UploadResults) {
+		opts.stats.queue()
+		uploaded := uploader.Upload(ctx, obj.rc, obj.bucket, obj.key, obj.objOpt)
+		go func(rc io.ReadCloser, source, sourceKey string, split *SplitRange, compression *Compression, sparseSize int64, uploaded, completed chan *UploadResults) {
 			defer inflight.Done()
-			defer rc.Close()
 			res := <-uploaded
+
+			// close the source before reporting, which may delete it
+			rc.Close()
+
+			if res.State != nil {
+				res.State.source = source
+				res.State.sourceKey = sourceKey
+				res.State.split = split
+				res.State.compression = compression
+				res.State.sparseSize = sparseSize
+			}
 			completed <- res
-		}(obj.rc, uploaded, completed)
+		}(obj.rc, obj.source, sourceKey, obj.split, obj.compression, obj.sparseSize, uploaded, completed)
 	}
 	go func() {
 		inflight.Wait()
@@ -157,6 +568,26 @@ func main() {
 	// wait until uploader has completed (or been canceled)
 	uploader.Wait(zeroTimeout)
 
+	// the run may have been aborted by -retry-budget
+	budgetErr := context.Cause(ctx)
+	if !errors.Is(budgetErr, ErrRetryBudget) {
+		budgetErr = nil
+	}
+
+	// if -delete was specified, remove remote objects not found locally
+	if synced != nil && opts.Delete && !opts.DryRun && context.Cause(ctx) == nil {
+		n, err := synced.deleteMissing(ctx, opts)
+		if err != nil {
+			log.Printf("unable to delete objects: %s", err)
+		}
+		if opts.Verbose {
+			log.Printf("deleted %d objects", n)
+		}
+	}
+
+	// states records the pending uploads left by -leave-parts-on-error
+	var states []*ResumeState
+
 	if pending := uploader.Pending(); len(pending) != 0 {
 		if opts.LeavePartsOnError {
 			for i := range pending {
@@ -165,6 +596,20 @@ func main() {
 					log.Printf("pending uploads detected: %s (upload-id %s)",
 						target, *pending[i])
 				}
+
+				if st := uploader.PendingState(pending[i]); st != nil {
+					states = append(states, st)
+				}
+			}
+
+			if opts.StateFile != "" {
+				if err := writeStateFile(opts.StateFile, states); err != nil {
+					log.Printf("unable to write -state-file: %s: %s",
+						opts.StateFile, err)
+				} else {
+					log.Printf("wrote state of %d pending uploads to %s",
+						len(states), opts.StateFile)
+				}
 			}
 
 		} else {
@@ -193,6 +638,97 @@ func main() {
 		}
 	}
 
+	// if -resume was specified, rewrite the state file with the uploads
+	// still pending, including any not reached by this run
+	if opts.resume != nil {
+		states = append(states, opts.resume.remaining()...)
+		if err := writeResumeFile(opts.Resume, states); err != nil {
+			log.Printf("unable to write -resume: %s: %s", opts.Resume, err)
+		} else if len(states) != 0 {
+			log.Printf("wrote state of %d pending uploads to %s", len(states), opts.Resume)
+		}
+	}
+
 	// wait until reporting has completed
 	reporting.Wait()
+
+	// if -manifest-upload was specified, upload the manifest even if the
+	// run was interrupted (but not if nothing was uploaded)
+	if manifestCopy != nil {
+		if manifestErr == nil && !opts.DryRun && !opts.ChecksumOnly {
+			key := manifestUploadKey(opts.ManifestUpload, opts.RunID, opts.Manifest)
+			if err := uploadManifest(context.WithoutCancel(ctx), manifestCopy, opts.bucket, key, opts); err != nil {
+				manifestErr = fmt.Errorf("unable to upload manifest to %s/%s: %w", opts.bucket, key, err)
+			}
+		}
+		manifestCopy.Close()
+		os.Remove(manifestCopy.Name())
+	}
+
+	if err := opts.dedupe.Close(); err != nil {
+		log.Printf("unable to write -dedupe-db: %s", err)
+	}
+
+	// if -snapshot-cleanup-cmd was specified, remove the snapshot even if
+	// the run was interrupted
+	if err := opts.snapshot.cleanup(context.Background(), opts.SnapshotCleanupCmd); err != nil {
+		log.Print(err)
+	}
+
+	if opts.stats != nil {
+		statsCancel()
+		if err := opts.stats.write(true); err != nil {
+			log.Printf("unable to write -stats-fd: %s", err)
+		}
+	}
+
+	if opts.summary != nil {
+		opts.summary.finish()
+		if err := writeSummaryFile(opts.SummaryOut, opts.summary); err != nil {
+			log.Printf("unable to write -summary-out: %s: %s", opts.SummaryOut, err)
+		}
+	}
+
+	if estimate != nil {
+		for _, line := range estimate.lines(opts.prices) {
+			log.Printf("dry-run estimate: %s", line)
+		}
+	}
+
+	if budgetErr != nil {
+		log.Fatal(budgetErr)
+	}
+
+	if manifestErr != nil {
+		log.Fatal(manifestErr)
+	}
+
+	if err := limit.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// processSources returns the sources listed by the -jobs file, or otherwise
+// matched by the globs (or standard input, optionally split with -split-size),
+// via the returned channel, with their keys mapped by any -key-mapper.
+func processSources(ctx context.Context, opts *Options) (chan *uploadObject, error) {
+	var ch chan *uploadObject
+	var err error
+
+	switch {
+	case opts.SplitSize > 0:
+		ch, err = processSplitStdin(ctx, opts)
+	case opts.Jobs != "":
+		ch, err = processJobs(ctx, opts.Jobs, opts.bucket, opts.key, opts.Verbose)
+	default:
+		ch, err = processPriorityGlobs(ctx, opts)
+	}
+
+	if err != nil || opts.KeyMapper == "" {
+		return ch, err
+	}
+
+	// the command is not killed when the sources are stopped, it exits
+	// once they are all read
+	return mapKeys(context.WithoutCancel(ctx), opts.KeyMapper, ch, opts.Verbose)
 }
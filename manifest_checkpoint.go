@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var errBadCheckpoint = errors.New(
+	"-checkpoint-objects and -checkpoint-interval must not be negative")
+
+// manifestCheckpoint periodically writes the manifest records received so far
+// to a file, ended as if the run had finished (e.g., closing the JSON array),
+// so that the objects completed by a run that dies are still recorded.  The
+// records are written once, after those of the previous checkpoint, and only
+// the ending is rewritten.  The last checkpoint, written by Close, is the
+// complete manifest.
+type manifestCheckpoint struct {
+	mu *sync.Mutex
+
+	fh  *os.File
+	gen *manifestGenerator
+
+	// pending holds the records written by gen since the last checkpoint
+	pending *bytes.Buffer
+
+	// ending is the text written after the records of a checkpoint
+	ending string
+
+	// end is the offset in fh of the end of the records checkpointed
+	end int64
+
+	// n counts the records since the last checkpoint, which is written
+	// once every records have been received
+	n     int
+	every int
+
+	// upload is called with fh after each checkpoint, if set
+	upload func(fh *os.File) error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newManifestCheckpoint creates (or truncates) the file at name and returns a
+// manifestCheckpoint writing a manifest of type t to it once every records
+// have been received, and once every interval if any records are pending.
+// Either may be zero to disable it.
+func newManifestCheckpoint(name string, t manifestType, md *RunMetadata, every int, interval time.Duration) (*manifestCheckpoint, error) {
+	fh, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &manifestCheckpoint{
+		mu:      &sync.Mutex{},
+		fh:      fh,
+		pending: &bytes.Buffer{},
+		ending:  "\n",
+		every:   every,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if t == JsonManifest {
+		p.ending = "\n]\n"
+	}
+
+	p.gen = Manifest(t, p.pending)
+	p.gen.SetRunMetadata(md)
+
+	go func() {
+		defer close(p.done)
+
+		if interval <= 0 {
+			<-p.stop
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				if p.n > 0 {
+					if err := p.checkpoint(p.ending); err != nil {
+						log.Printf("unable to write -manifest-checkpoint: %s", err)
+					}
+				}
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p, nil
+}
+
+// Write records obj, writing a checkpoint if enough records have been
+// received since the last.
+func (p *manifestCheckpoint) Write(obj *ObjectReporting) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.gen.Write(obj); err != nil {
+		return err
+	}
+
+	p.n += 1
+
+	if p.every > 0 && p.n >= p.every {
+		return p.checkpoint(p.ending)
+	}
+
+	return nil
+}
+
+// checkpoint writes the pending records after those of the last checkpoint,
+// followed by ending, and syncs the file.  The caller must hold p.mu.
+func (p *manifestCheckpoint) checkpoint(ending string) error {
+	if _, err := p.fh.WriteAt(p.pending.Bytes(), p.end); err != nil {
+		return err
+	}
+
+	p.end += int64(p.pending.Len())
+	p.pending.Reset()
+	p.n = 0
+
+	if _, err := p.fh.WriteAt([]byte(ending), p.end); err != nil {
+		return err
+	}
+
+	if err := p.fh.Truncate(p.end + int64(len(ending))); err != nil {
+		return err
+	}
+
+	if err := p.fh.Sync(); err != nil {
+		return err
+	}
+
+	if p.upload != nil {
+		return p.upload(p.fh)
+	}
+
+	return nil
+}
+
+// Close writes the last checkpoint, ending the manifest as the run does, and
+// closes the file.
+func (p *manifestCheckpoint) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the complete manifest is uploaded by -manifest-upload itself
+	p.upload = nil
+
+	err := p.gen.End()
+	if err == nil {
+		err = p.checkpoint("")
+	}
+
+	return errors.Join(err, p.fh.Close())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Validate each checkpoint is a complete JSON manifest of the records so far,
+// and the last is the manifest of the run
+func TestManifestCheckpoint(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	cp, err := newManifestCheckpoint(name, JsonManifest, &RunMetadata{RunID: "run"}, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := func() int {
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) == 0 {
+			return 0
+		}
+
+		var recs []json.RawMessage
+		if err := json.Unmarshal(buf, &recs); err != nil {
+			t.Fatalf("expected a JSON array, got %s: %s", buf, err)
+		}
+		return len(recs)
+	}
+
+	// the RunMetadata is followed by the records checkpointed
+	for i, expect := range []int{0, 3, 3, 5} {
+		if err := cp.Write(&ObjectReporting{Bucket: "bucket", Key: "key"}); err != nil {
+			t.Fatal(err)
+		}
+		if actual := records(); actual != expect {
+			t.Errorf("%d expected %d records, got %d", i, expect, actual)
+		}
+	}
+
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the RunEnd is written by the last checkpoint
+	if actual := records(); actual != 6 {
+		t.Errorf("expected 6 records, got %d", actual)
+	}
+}
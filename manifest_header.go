@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// redacted replaces the values of sensitiveFlags, and passwords in URLs, in
+// the RunMetadata.
+const redacted = "REDACTED"
+
+// sensitiveFlags lists the flags whose values are not recorded in the
+// RunMetadata.
+var sensitiveFlags = []string{
+	"secret-key",
+	"session-token",
+}
+
+// RunMetadata records the provenance of a run, and is written as the leading
+// record of a json manifest.
+type RunMetadata struct {
+	Version     string
+	RunID       string
+	CommandLine []string
+	Hostname    string `json:",omitempty"`
+	User        string `json:",omitempty"`
+	StartTime   time.Time
+	Options     map[string]string
+}
+
+// RunEnd records the end of a run, and is written as the trailing record of a
+// json manifest.  When standard input was split with -split-size, Split lists
+// the objects completed in the order the stream is reassembled from.  Errors
+// lists the uploaded objects that are missing from the manifest.
+type RunEnd struct {
+	RunID   string
+	EndTime time.Time
+	Split   []*SplitObject   `json:",omitempty"`
+	Errors  []*ManifestError `json:",omitempty"`
+}
+
+// manifestHeader and manifestTrailer wrap RunMetadata and RunEnd so that they
+// may be distinguished from ObjectReporting records in a json manifest.
+type manifestHeader struct {
+	RunMetadata *RunMetadata
+}
+
+type manifestTrailer struct {
+	RunEnd *RunEnd
+}
+
+// newRunMetadata returns the RunMetadata for a run started at t with the
+// command line arguments args and the flags parsed from them.  The values of
+// sensitiveFlags are redacted.
+func newRunMetadata(t time.Time, argv0 string, args []string, flags *flag.FlagSet, runID string) *RunMetadata {
+	p := &RunMetadata{
+		Version:     buildVersion(),
+		RunID:       runID,
+		CommandLine: append([]string{argv0}, sanitizeArgs(args)...),
+		StartTime:   t,
+		Options:     map[string]string{},
+	}
+
+	p.Hostname, _ = os.Hostname()
+
+	if u, err := user.Current(); err == nil {
+		p.User = u.Username
+	} else {
+		p.User = os.Getenv("USER")
+	}
+
+	flags.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if isSensitiveFlag(f.Name) && value != "" {
+			value = redacted
+		}
+		p.Options[f.Name] = value
+	})
+
+	// the run ID may have been generated rather than set
+	p.Options["run-id"] = runID
+
+	return p
+}
+
+// isSensitiveFlag returns true if name is listed in sensitiveFlags.
+func isSensitiveFlag(name string) bool {
+	for _, s := range sensitiveFlags {
+		if name == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeArgs returns a copy of args with the values of sensitiveFlags, and
+// any passwords in URLs, redacted.
+func sanitizeArgs(args []string) []string {
+	out := make([]string, len(args))
+
+	sensitive := false
+	for i, arg := range args {
+		switch {
+		case sensitive:
+			arg = redacted
+			sensitive = false
+		case strings.HasPrefix(arg, "-"):
+			name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if isSensitiveFlag(name) {
+				if hasValue {
+					arg = arg[:strings.Index(arg, "=")+1] + redacted
+				} else {
+					sensitive = true
+				}
+			}
+		default:
+			if u, err := url.Parse(arg); err == nil && u.User != nil {
+				if _, ok := u.User.Password(); ok {
+					arg = u.Redacted()
+				}
+			}
+		}
+
+		out[i] = arg
+	}
+
+	return out
+}
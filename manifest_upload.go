@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errManifestUploadOptions = errors.New(
+	"-manifest-upload requires a -manifest and a -bucket")
+
+// manifestUploadKey returns the key a manifest of type t is uploaded to by
+// -manifest-upload.  A key ending in "/" is a prefix, under which the
+// manifest is named by runID, e.g., _manifests/<run id>.json.
+func manifestUploadKey(key, runID string, t manifestType) string {
+	if !strings.HasSuffix(key, "/") {
+		return key
+	}
+
+	if t == JsonManifest {
+		return key + runID + ".json"
+	}
+	return key + runID + ".txt"
+}
+
+// manifestContentType returns the Content-Type of a manifest of type t.
+func manifestContentType(t manifestType) string {
+	if t == JsonManifest {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// uploadManifest uploads the manifest written to fh to Bucket/Key using a
+// single PutObject, with the storage class, tags and encryption of the
+// objects uploaded and the run ID in its metadata.
+func uploadManifest(ctx context.Context, fh *os.File, Bucket, Key string, opts *Options) error {
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	obj := &s3.PutObjectInput{
+		Bucket: &Bucket,
+		Key:    &Key,
+		Body:   fh,
+	}
+	opts.objOpt.applyPutObject(obj)
+	obj.ContentType = aws.String(manifestContentType(opts.Manifest))
+	obj.ContentEncoding = nil
+	obj.Metadata = runMetadata(opts.RunID)
+
+	if opts.Verbose {
+		log.Printf("uploading manifest to %s/%s", Bucket, Key)
+	}
+
+	putCtx, cancel := withTimeout(ctx, opts.PutObjectTimeout)
+	defer cancel()
+
+	_, err := s3client.PutObject(putCtx, obj)
+	return err
+}
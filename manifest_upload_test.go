@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Validate the key a manifest is uploaded to by -manifest-upload
+func TestManifestUploadKey(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		t      manifestType
+		expect string
+	}{
+		{"manifest.json", JsonManifest, "manifest.json"},
+		{"_manifests/", JsonManifest, "_manifests/run.json"},
+		{"_manifests/", FullMD5Manifest, "_manifests/run.txt"},
+		{"/", ETagManifest, "/run.txt"},
+	} {
+		actual := manifestUploadKey(tst.key, "run", tst.t)
+		if actual != tst.expect {
+			t.Errorf("%d expected %s, got %s", i, tst.expect, actual)
+		}
+	}
+}
+
+// Validate the manifest is uploaded with its content type and the run ID
+func TestUploadManifest(t *testing.T) {
+	var path, contentType, runID, body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		runID = r.Header.Get("X-Amz-Meta-" + runIDMetadata)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	fh, err := os.Create(filepath.Join(t.TempDir(), "manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	if _, err := fh.WriteString("[]\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testUploaderOptions(srv.URL, 64)
+	opts.Manifest = JsonManifest
+	opts.RunID = "run"
+
+	if err := uploadManifest(context.Background(), fh, "bucket", "_manifests/run.json", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/bucket/_manifests/run.json" {
+		t.Errorf("expected /bucket/_manifests/run.json, got %s", path)
+	}
+	if contentType != "application/json" {
+		t.Errorf("expected application/json, got %s", contentType)
+	}
+	if runID != "run" {
+		t.Errorf("expected run ID run, got %s", runID)
+	}
+	if body != "[]\n" {
+		t.Errorf("expected the manifest, got %q", body)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"path"
+	"slices"
 	"strings"
+	"time"
 )
 
 // manifestType represents an identifier for a manifest output format.
@@ -88,26 +93,173 @@ type manifestGenerator struct {
 	w    io.Writer
 	t    manifestType
 	nrec int
+
+	// md is written as the leading record of a JSON manifest, if set
+	md *RunMetadata
+
+	// started is set once the opening brace of a JSON array is written
+	started bool
+
+	// split lists the completed objects split from standard input, for
+	// the RunEnd
+	split []*SplitObject
+
+	// errors lists the objects whose records could not be created or
+	// written, for the RunEnd
+	errors []*ManifestError
+
+	// shared is appended a copy of every record, if set, and
+	// sharedStarted is set once the RunMetadata has been appended to it
+	shared        *sharedManifest
+	sharedCtx     context.Context
+	sharedStarted bool
+}
+
+// SetSharedManifest sets the name of a file shared by concurrent runs that a
+// copy of every record, including the RunMetadata and RunEnd, is appended to
+// as a JSON line (see -manifest-append).
+func (p *manifestGenerator) SetSharedManifest(ctx context.Context, name string) {
+	p.shared = &sharedManifest{name: name}
+	p.sharedCtx = ctx
+}
+
+// appendShared appends v to the shared manifest, if one was set, preceded by
+// the RunMetadata if it has not yet been appended.
+func (p *manifestGenerator) appendShared(v any) error {
+	if p.shared == nil {
+		return nil
+	}
+
+	if !p.sharedStarted && p.md != nil {
+		if err := p.shared.Append(p.sharedCtx, &manifestHeader{p.md}); err != nil {
+			return err
+		}
+	}
+
+	p.sharedStarted = true
+
+	return p.shared.Append(p.sharedCtx, v)
+}
+
+// runEnd returns the RunEnd written as the trailing record of the manifest.
+func (p *manifestGenerator) runEnd() *RunEnd {
+	slices.SortFunc(p.split, func(a, b *SplitObject) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+
+	return &RunEnd{
+		RunID:   p.md.RunID,
+		EndTime: time.Now(),
+		Split:   p.split,
+		Errors:  p.errors,
+	}
+}
+
+// errManifestIncomplete is returned by manifestGenerator.Err if the records of
+// any uploaded objects could not be created or written.
+var errManifestIncomplete = errors.New("manifest is missing uploaded objects")
+
+// ManifestError records an uploaded object whose manifest record could not be
+// created or written.
+type ManifestError struct {
+	Bucket string
+	Key    string
+	Error  string
+}
+
+// RecordError records that the manifest record for the object Bucket/Key could
+// not be created or written, to be listed in the RunEnd of a JSON manifest and
+// reported by Err.
+func (p *manifestGenerator) RecordError(Bucket, Key string, err error) {
+	p.errors = append(p.errors, &ManifestError{
+		Bucket: Bucket,
+		Key:    Key,
+		Error:  errorString(err),
+	})
+}
+
+// Err returns an error wrapping errManifestIncomplete if RecordError was called
+// for any object, otherwise it returns nil.
+func (p *manifestGenerator) Err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d missing", errManifestIncomplete, len(p.errors))
+}
+
+// SetRunMetadata sets the RunMetadata written as the leading record of a JSON
+// manifest, which is then followed by a RunEnd as the trailing record.  Other
+// manifest types ignore it.
+func (p *manifestGenerator) SetRunMetadata(md *RunMetadata) {
+	p.md = md
+}
+
+// writeJSON writes v as the next element of a JSON array, writing the opening
+// brace of the array first if needed.
+func (p *manifestGenerator) writeJSON(v any) error {
+	buf, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if !p.started {
+		// start of JSON array
+		sep = "[\n  "
+		p.started = true
+	}
+
+	if _, err := io.WriteString(p.w, sep); err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(buf)
+
+	return err
 }
 
 // End writes trailing text to its io.Writer to indicate the end of the
 // manifest, e.g., with JSON it writes the closing brace for a JSON array.
 func (p *manifestGenerator) End() error {
-	if p.t == NoManifest {
-		return nil
+	if p.md != nil {
+		if err := p.appendShared(&manifestTrailer{p.runEnd()}); err != nil {
+			return err
+		}
 	}
-	if p.nrec == 0 {
+
+	if p.t == NoManifest {
 		return nil
 	}
 
-	var s string
 	if p.t == JsonManifest {
-		s = "\n]\n"
-	} else {
-		s = "\n"
+		if p.md != nil {
+			if !p.started {
+				if err := p.writeJSON(&manifestHeader{p.md}); err != nil {
+					return err
+				}
+			}
+
+			err := p.writeJSON(&manifestTrailer{p.runEnd()})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !p.started {
+			return nil
+		}
+
+		_, err := io.WriteString(p.w, "\n]\n")
+
+		return err
+	}
+
+	if p.nrec == 0 {
+		return nil
 	}
 
-	_, err := io.WriteString(p.w, s)
+	_, err := io.WriteString(p.w, "\n")
 
 	return err
 }
@@ -117,30 +269,31 @@ func (p *manifestGenerator) Write(obj *ObjectReporting) error {
 	// increment record counter
 	p.nrec += 1
 
+	if obj.Split != nil && (obj.Completed || obj.Predicted) {
+		p.split = append(p.split, &SplitObject{
+			Bucket:     obj.Bucket,
+			Key:        obj.Key,
+			SplitRange: *obj.Split,
+		})
+	}
+
+	if err := p.appendShared(obj); err != nil {
+		return err
+	}
+
 	// write the formatted record to p.w
 	switch p.t {
 	case NoManifest:
 		return nil
 	case JsonManifest:
-		buf, err := json.MarshalIndent(obj, "  ", "  ")
-		if err != nil {
-			return err
-		}
-
-		if p.nrec == 1 {
-			// start of JSON array
-			if _, err := io.WriteString(p.w, "[\n  "); err != nil {
-				return err
-			}
-		} else {
-			// end of prior record in JSON array
-			if _, err := io.WriteString(p.w, ",\n  "); err != nil {
+		if !p.started && p.md != nil {
+			if err := p.writeJSON(&manifestHeader{p.md}); err != nil {
 				return err
 			}
 		}
 
 		// write current record in JSON array
-		if _, err := p.w.Write(buf); err != nil {
+		if err := p.writeJSON(obj); err != nil {
 			return err
 		}
 	default:
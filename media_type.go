@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"log"
 	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 )
@@ -45,6 +47,37 @@ func MediaType(name string) string {
 	}
 }
 
+// sniffLen is the maximum number of bytes considered by http.DetectContentType
+const sniffLen = 512
+
+// SniffMediaType returns MediaType(name) if the name has a recognized
+// extension, otherwise the first 512 bytes of r are evaluated using
+// http.DetectContentType, which also returns "application/octet-stream" if the
+// content is not recognized.  The io.ReadSeeker r is rewound to its start
+// before returning.
+func SniffMediaType(name string, r io.ReadSeeker) (string, error) {
+	typ := MediaType(name)
+	if typ != "application/octet-stream" {
+		return typ, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return typ, nil
+	}
+
+	return http.DetectContentType(buf[0:n]), nil
+}
+
 // ExtendMediaTypes extends or replacies entries in the table used by MediaType
 // The provided io.Reader r should return lines with two tab-separated fields:
 //
@@ -56,33 +89,58 @@ func MediaType(name string) string {
 //	.pdf	application/pdf
 //	.txt	text/plain
 //
-// The TSV data may optionally contain lines starting with '#' which will be
-// treated as comments and ignored.
+// Lines may alternatively use the Apache mime.types format, listing a valid
+// IANA Media Type followed by zero or more whitespace-separated extensions
+// (without a leading period), e.g.,
+//
+//	application/pdf		pdf
+//	text/plain		txt text
+//
+// The two formats are distinguished per line by whether the first field starts
+// with a period, so /etc/mime.types may be used as-is.
+//
+// The data may optionally contain lines starting with '#' which will be
+// treated as comments and ignored, blank lines are also ignored.
 func ExtendMediaTypes(r io.Reader) error {
 	scanner := bufio.NewScanner(r)
 	lineno := 0
 	for scanner.Scan() {
 		lineno += 1
 
-		tsv := scanner.Text()
-		if strings.HasPrefix(tsv, "#") {
-			// skipping comments
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			// skipping comments and blank lines
 			continue
 		}
 
-		fields := strings.Split(tsv, "\t")
-		if len(fields) != 2 {
-			log.Printf("skipping line %d, invalid number of fields; %d: %s", lineno, len(fields), tsv)
+		if strings.HasPrefix(line, ".") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 2 {
+				log.Printf("skipping line %d, invalid number of fields; %d: %s", lineno, len(fields), line)
+				continue
+			}
+
+			ext := fields[0]
+			typ := fields[1]
+
+			if err := mime.AddExtensionType(ext, typ); err != nil {
+				log.Printf("skipping line %d, format; %s: %s", lineno, err, line)
+			}
+
 			continue
 		}
 
-		ext := fields[0]
-		typ := fields[1]
+		// mime.types format, a media type followed by extensions
+		fields := strings.Fields(line)
+		typ := fields[0]
 
-		if err := mime.AddExtensionType(ext, typ); err != nil {
-			log.Printf("skipping line %d, format; %s: %s", lineno, err, tsv)
+		for _, ext := range fields[1:] {
+			if err := mime.AddExtensionType("."+ext, typ); err != nil {
+				log.Printf("skipping line %d, format; %s: %s", lineno, err, line)
+				break
+			}
 		}
 	}
 
-	return nil
+	return scanner.Err()
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"testing"
 )
 
@@ -69,3 +70,61 @@ func TestExtendMediaTypesValidTSV(t *testing.T) {
 		}
 	}
 }
+
+// Validate that content is only evaluated for unrecognized extensions
+func TestSniffMediaType(t *testing.T) {
+	for i, tst := range []struct {
+		name    string
+		content string
+		expect  string
+	}{
+		{"README", "plain text\n", "text/plain; charset=utf-8"},
+		{"image", "\x89PNG\x0D\x0A\x1A\x0A", "image/png"},
+		{"page.pdf", "plain text\n", "application/pdf"},
+		{"empty", "", "application/octet-stream"},
+		{"binary", "\x00\x01\x02\x03", "application/octet-stream"},
+	} {
+		r := bytes.NewReader([]byte(tst.content))
+
+		actual, err := SniffMediaType(tst.name, r)
+		if err != nil {
+			t.Errorf("%d unexpected error: %s", i, err)
+			continue
+		}
+
+		if actual != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, actual)
+		}
+
+		if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+			t.Errorf("%d expected reader to be rewound, got offset %d", i, pos)
+		}
+	}
+}
+
+func TestExtendMediaTypesMimeTypes(t *testing.T) {
+	buf := bytes.NewBufferString(`# mime.types style comment
+application/x-xorbz		xorbz xorbzz
+
+application/x-empty
+.xorbt	application/x-xorbt
+`)
+
+	err := ExtendMediaTypes(buf)
+	if err != nil {
+		t.Error("unable to extend media types: ", err)
+	}
+
+	for ext, expect := range map[string]string{
+		".xorbz":  "application/x-xorbz",
+		".xorbzz": "application/x-xorbz",
+		".xorbt":  "application/x-xorbt",
+	} {
+		fpath := fmt.Sprintf("/some/file/path%s", ext)
+		actual := MediaType(fpath)
+		if expect != actual {
+			t.Errorf("expected [%s] to map to [%s] got [%s]",
+				fpath, expect, actual)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errBadMetadata = errors.New(
+	"-metadata must be key=value, with a key of letters, digits, '-', '_', or '.' and a printable ASCII value")
+
+var errMetadataSize = errors.New(
+	"user-defined metadata must not exceed 2KB")
+
+var errMetadataSidecar = errors.New(
+	"invalid metadata sidecar")
+
+var errMetadataSidecarSkipped = errors.New(
+	"metadata sidecar file")
+
+// maxMetadataSize is the maximum size of the user-defined metadata of an
+// object, the sum of the lengths of its keys and values.
+const maxMetadataSize = 2048
+
+// parseMetadata parses a single "key=value" setting, as provided to
+// -metadata, adding it to md.
+func parseMetadata(s string, md map[string]string) error {
+	key, value, found := strings.Cut(s, "=")
+	if !found {
+		return fmt.Errorf("%w: %s", errBadMetadata, s)
+	}
+
+	key = strings.ToLower(strings.TrimSpace(key))
+	if err := checkMetadataEntry(key, value); err != nil {
+		return err
+	}
+
+	md[key] = value
+
+	return nil
+}
+
+// checkMetadataEntry validates a user-defined metadata key and value, which
+// are sent as an x-amz-meta-key header.  S3 stores keys in lower case.
+func checkMetadataEntry(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("%w: %s=%s", errBadMetadata, key, value)
+	}
+
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("%w: %s=%s", errBadMetadata, key, value)
+		}
+	}
+
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("%w: %s=%q", errBadMetadata, key, value)
+		}
+	}
+
+	return nil
+}
+
+// checkMetadataSize returns errMetadataSize if md exceeds the maximum size of
+// the user-defined metadata of an object.
+func checkMetadataSize(md map[string]string) error {
+	size := 0
+	for k, v := range md {
+		size += len(k) + len(v)
+	}
+
+	if size > maxMetadataSize {
+		return fmt.Errorf("%w: %d bytes", errMetadataSize, size)
+	}
+
+	return nil
+}
+
+// readMetadataSidecar reads the user-defined metadata for an object from the
+// named JSON file, an object of string values, e.g.,
+// {"project": "survey", "instrument": "scope-2"}.  A file that does not
+// exist is not an error, and nil is returned.
+func readMetadataSidecar(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sidecar := map[string]string{}
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errMetadataSidecar, name, err)
+	}
+
+	md := make(map[string]string, len(sidecar))
+	for k, v := range sidecar {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if err := checkMetadataEntry(k, v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", errMetadataSidecar, name, err)
+		}
+		md[k] = v
+	}
+
+	return md, nil
+}
+
+// applyMetadataSidecar applies -metadata-sidecar to obj if it is read from a
+// file, adding the metadata read from the file named by the source with
+// suffix appended (if it exists) to the object metadata, replacing any values
+// for the same keys set by -metadata (in defaults).  The sidecar files
+// themselves are not uploaded, errMetadataSidecarSkipped is returned for them.
+func applyMetadataSidecar(obj *uploadObject, suffix string, runID string, defaults *ObjectOptions) error {
+	if _, ok := obj.rc.(*os.File); !ok || obj.source == "-" {
+		return nil
+	}
+
+	if strings.HasSuffix(obj.source, suffix) {
+		return errMetadataSidecarSkipped
+	}
+
+	md, err := readMetadataSidecar(obj.source + suffix)
+	if err != nil || md == nil {
+		return err
+	}
+
+	// the size limit applies to the metadata once merged with -metadata
+	objOpt := obj.objOpt.withMetadata(md)
+	if err := checkMetadataSize(objOpt.withDefaults(defaults).metadata(runID)); err != nil {
+		return err
+	}
+
+	obj.objOpt = objOpt
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Validate -metadata settings are parsed and checked
+func TestParseMetadata(t *testing.T) {
+	for i, tst := range []struct {
+		s      string
+		key    string
+		value  string
+		expect error
+	}{
+		{"project=survey", "project", "survey", nil},
+		{"Instrument=scope-2", "instrument", "scope-2", nil},
+		{"note=a=b", "note", "a=b", nil},
+		{"empty=", "empty", "", nil},
+		{"project", "", "", errBadMetadata},
+		{"=survey", "", "", errBadMetadata},
+		{"pro ject=survey", "", "", errBadMetadata},
+		{"project=café", "", "", errBadMetadata},
+		{"project=a\nb", "", "", errBadMetadata},
+	} {
+		md := map[string]string{}
+
+		err := parseMetadata(tst.s, md)
+		if !errors.Is(err, tst.expect) {
+			t.Errorf("%d expected error %v, got %v", i, tst.expect, err)
+		}
+
+		if err == nil && (len(md) != 1 || md[tst.key] != tst.value) {
+			t.Errorf("%d expected %s=%s, got %v", i, tst.key, tst.value, md)
+		}
+	}
+}
+
+// Validate sidecar metadata is added to the object, replacing -metadata
+// values, and the sidecar files themselves are skipped
+func TestApplyMetadataSidecar(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, data string) string {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	write("a.dat.meta.json", `{"Sample": "A-17", "project": "survey"}`)
+	write("bad.dat.meta.json", `{"sample": 17}`)
+	write("big.dat.meta.json", `{"sample": "`+strings.Repeat("x", maxMetadataSize)+`"}`)
+
+	// the sidecar fits on its own, but not with the -metadata defaults
+	write("merged.dat.meta.json", `{"sample": "`+strings.Repeat("x", maxMetadataSize-20)+`"}`)
+
+	defaults := &ObjectOptions{Metadata: map[string]string{"project": "default", "site": "slac"}}
+
+	for i, tst := range []struct {
+		name   string
+		expect map[string]string
+		err    error
+	}{
+		{"a.dat", map[string]string{"project": "survey", "site": "slac", "sample": "A-17"}, nil},
+		{"b.dat", map[string]string{"project": "default", "site": "slac"}, nil},
+		{"bad.dat", nil, errMetadataSidecar},
+		{"big.dat", nil, errMetadataSize},
+		{"merged.dat", nil, errMetadataSize},
+		{"c.dat.meta.json", nil, errMetadataSidecarSkipped},
+	} {
+		name := write(tst.name, "data")
+
+		fh, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+
+		// no per-glob ObjectOptions, the defaults are set by -metadata
+		obj := &uploadObject{rc: fh, source: name}
+
+		err = applyMetadataSidecar(obj, ".meta.json", "", defaults)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected error %v, got %v", i, tst.err, err)
+		}
+
+		if actual := obj.objOpt.withDefaults(defaults).Metadata; err == nil && !maps.Equal(actual, tst.expect) {
+			t.Errorf("%d expected metadata %v, got %v", i, tst.expect, actual)
+		}
+	}
+}
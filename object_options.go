@@ -0,0 +1,481 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errBadSet = errors.New(
+	"-set must be one of content-type=, storage-class=, tags=, priority=, or source=")
+
+var errBadLifecycleTag = errors.New(
+	"-lifecycle-tag must be a single key=value")
+
+// ObjectOptions captures settings for an individual object that override the
+// defaults otherwise used when uploading it.  A nil *ObjectOptions may be used
+// when there are no overrides.
+type ObjectOptions struct {
+	// Optionally override the Content-Type derived from the key by
+	// MediaType
+	ContentType string
+
+	// Optionally set the Content-Encoding of the object, e.g., gzip for
+	// sources compressed by -compress
+	ContentEncoding string
+
+	// Optionally set the storage class of the object
+	StorageClass types.StorageClass
+
+	// Optionally set tags on the object, encoded as URL query parameters,
+	// e.g., "key1=value1&key2=value2"
+	Tagging string
+
+	// Optionally set a tag, encoded as "key=value", on the object in
+	// addition to (and taking precedence over) any in Tagging, so that
+	// bucket lifecycle rules keyed on the tag apply to the object
+	LifecycleTag string
+
+	// Optionally set the priority of the object, objects with a higher
+	// priority are uploaded ahead of those with a lower priority
+	Priority int
+
+	// Optionally set the server-side encryption of the object, and for
+	// aws:kms the KMS key to encrypt it with (otherwise the AWS managed
+	// key is used)
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyId          string
+
+	// Optionally encrypt the object with a customer-provided 256-bit key
+	// (SSE-C), in place of ServerSideEncryption
+	SSECustomerKey []byte
+
+	// Optionally select the Source backend used to read the object, by
+	// the name it was registered with (see RegisterSource)
+	Source string
+
+	// Optionally set user-defined metadata on the object, in addition to
+	// the run ID (see runMetadata)
+	Metadata map[string]string
+}
+
+// withDefaults returns ObjectOptions where any setting not overridden in p is
+// taken from defaults, and the Metadata of p is added to that of defaults.
+// Either may be nil.
+func (p *ObjectOptions) withDefaults(defaults *ObjectOptions) *ObjectOptions {
+	if defaults == nil {
+		return p
+	}
+
+	if p == nil {
+		return defaults
+	}
+
+	objOpt := *p
+
+	if objOpt.ContentType == "" {
+		objOpt.ContentType = defaults.ContentType
+	}
+
+	if objOpt.ContentEncoding == "" {
+		objOpt.ContentEncoding = defaults.ContentEncoding
+	}
+
+	if objOpt.StorageClass == "" {
+		objOpt.StorageClass = defaults.StorageClass
+	}
+
+	if objOpt.Tagging == "" {
+		objOpt.Tagging = defaults.Tagging
+	}
+
+	if objOpt.LifecycleTag == "" {
+		objOpt.LifecycleTag = defaults.LifecycleTag
+	}
+
+	if objOpt.Priority == 0 {
+		objOpt.Priority = defaults.Priority
+	}
+
+	if objOpt.ServerSideEncryption == "" && objOpt.SSECustomerKey == nil {
+		objOpt.ServerSideEncryption = defaults.ServerSideEncryption
+		objOpt.SSEKMSKeyId = defaults.SSEKMSKeyId
+		objOpt.SSECustomerKey = defaults.SSECustomerKey
+	}
+
+	if objOpt.Source == "" {
+		objOpt.Source = defaults.Source
+	}
+
+	// metadata is merged, with the per-object values taking precedence
+	if objOpt.Metadata == nil {
+		objOpt.Metadata = defaults.Metadata
+	} else if len(defaults.Metadata) > 0 {
+		objOpt.Metadata = defaults.withMetadata(objOpt.Metadata).Metadata
+	}
+
+	return &objOpt
+}
+
+// mediaType returns the Content-Type to use for an object named Key.
+func (p *ObjectOptions) mediaType(Key string) string {
+	if p != nil && p.ContentType != "" {
+		return p.ContentType
+	}
+	return MediaType(Key)
+}
+
+// sniffMediaType returns ObjectOptions with the ContentType set using
+// SniffMediaType, unless a ContentType override was already set.
+func (p *ObjectOptions) sniffMediaType(Key string, r io.ReadSeeker) (*ObjectOptions, error) {
+	if p != nil && p.ContentType != "" {
+		return p, nil
+	}
+
+	typ, err := SniffMediaType(Key, r)
+	if err != nil {
+		return nil, err
+	}
+
+	objOpt := &ObjectOptions{}
+	if p != nil {
+		*objOpt = *p
+	}
+	objOpt.ContentType = typ
+
+	return objOpt, nil
+}
+
+// withMetadata returns ObjectOptions with md added to the Metadata, replacing
+// any existing values for the same keys.
+func (p *ObjectOptions) withMetadata(md map[string]string) *ObjectOptions {
+	objOpt := &ObjectOptions{}
+	if p != nil {
+		*objOpt = *p
+	}
+
+	objOpt.Metadata = make(map[string]string, len(objOpt.Metadata)+len(md))
+	if p != nil {
+		for k, v := range p.Metadata {
+			objOpt.Metadata[k] = v
+		}
+	}
+	for k, v := range md {
+		objOpt.Metadata[k] = v
+	}
+
+	return objOpt
+}
+
+// metadata returns the user-defined metadata of the object, including runID
+// if it is not empty, or nil if there is none.
+func (p *ObjectOptions) metadata(runID string) map[string]string {
+	md := runMetadata(runID)
+
+	if p == nil || len(p.Metadata) == 0 {
+		return md
+	}
+
+	if md == nil {
+		md = make(map[string]string, len(p.Metadata))
+	}
+	for k, v := range p.Metadata {
+		if _, ok := md[k]; !ok {
+			md[k] = v
+		}
+	}
+
+	return md
+}
+
+// applyPutObject sets the fields of an s3.PutObjectInput derived from the
+// ObjectOptions.
+func (p *ObjectOptions) applyPutObject(obj *s3.PutObjectInput) {
+	obj.ContentType = aws.String(p.mediaType(*obj.Key))
+
+	if p == nil {
+		return
+	}
+
+	if p.ContentEncoding != "" {
+		obj.ContentEncoding = &p.ContentEncoding
+	}
+
+	obj.StorageClass = p.StorageClass
+
+	if tagging := p.tagging(); tagging != "" {
+		obj.Tagging = &tagging
+	}
+
+	obj.ServerSideEncryption = p.ServerSideEncryption
+
+	if p.SSEKMSKeyId != "" {
+		obj.SSEKMSKeyId = &p.SSEKMSKeyId
+	}
+
+	obj.SSECustomerAlgorithm, obj.SSECustomerKey, obj.SSECustomerKeyMD5 = p.sseCustomer()
+}
+
+// applyCreateMultipartUpload sets the fields of an
+// s3.CreateMultipartUploadInput derived from the ObjectOptions.
+func (p *ObjectOptions) applyCreateMultipartUpload(create *s3.CreateMultipartUploadInput) {
+	create.ContentType = aws.String(p.mediaType(*create.Key))
+
+	if p == nil {
+		return
+	}
+
+	if p.ContentEncoding != "" {
+		create.ContentEncoding = &p.ContentEncoding
+	}
+
+	create.StorageClass = p.StorageClass
+
+	if tagging := p.tagging(); tagging != "" {
+		create.Tagging = &tagging
+	}
+
+	create.ServerSideEncryption = p.ServerSideEncryption
+
+	if p.SSEKMSKeyId != "" {
+		create.SSEKMSKeyId = &p.SSEKMSKeyId
+	}
+
+	create.SSECustomerAlgorithm, create.SSECustomerKey, create.SSECustomerKeyMD5 = p.sseCustomer()
+}
+
+// applyCopyObject sets the fields of an s3.CopyObjectInput derived from the
+// ObjectOptions, replacing the metadata and tags of the source object with
+// those the object would be uploaded with.  With SSECustomerKey the source
+// object is assumed to be encrypted with the same key.
+func (p *ObjectOptions) applyCopyObject(copy *s3.CopyObjectInput, runID string) {
+	copy.ContentType = aws.String(p.mediaType(*copy.Key))
+	copy.Metadata = p.metadata(runID)
+	copy.MetadataDirective = types.MetadataDirectiveReplace
+	copy.TaggingDirective = types.TaggingDirectiveReplace
+
+	if p == nil {
+		return
+	}
+
+	if p.ContentEncoding != "" {
+		copy.ContentEncoding = &p.ContentEncoding
+	}
+
+	copy.StorageClass = p.StorageClass
+
+	if tagging := p.tagging(); tagging != "" {
+		copy.Tagging = &tagging
+	}
+
+	copy.ServerSideEncryption = p.ServerSideEncryption
+
+	if p.SSEKMSKeyId != "" {
+		copy.SSEKMSKeyId = &p.SSEKMSKeyId
+	}
+
+	copy.SSECustomerAlgorithm, copy.SSECustomerKey, copy.SSECustomerKeyMD5 = p.sseCustomer()
+	copy.CopySourceSSECustomerAlgorithm, copy.CopySourceSSECustomerKey, copy.CopySourceSSECustomerKeyMD5 = p.sseCustomer()
+}
+
+// tagging returns the tags to set on the object, i.e., Tagging with the
+// LifecycleTag added.
+func (p *ObjectOptions) tagging() string {
+	if p == nil {
+		return ""
+	}
+
+	if p.LifecycleTag == "" {
+		return p.Tagging
+	}
+
+	// both were validated by parseTagging or parseLifecycleTag
+	values, _ := url.ParseQuery(p.Tagging)
+	tag, _ := url.ParseQuery(p.LifecycleTag)
+
+	for key := range tag {
+		values.Set(key, tag.Get(key))
+	}
+
+	return values.Encode()
+}
+
+// lifecycleTag returns the LifecycleTag, or an empty string if p is nil.
+func (p *ObjectOptions) lifecycleTag() string {
+	if p == nil {
+		return ""
+	}
+	return p.LifecycleTag
+}
+
+// usesKMS returns true if objects are encrypted using KMS keys.
+func (p *ObjectOptions) usesKMS() bool {
+	if p == nil {
+		return false
+	}
+
+	switch p.ServerSideEncryption {
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+		return true
+	}
+
+	return false
+}
+
+// etagIsMD5 returns true unless objects are encrypted using KMS keys or a
+// customer-provided key, in which case their ETags are not MD5 sums.
+func (p *ObjectOptions) etagIsMD5() bool {
+	return !p.usesKMS() && (p == nil || p.SSECustomerKey == nil)
+}
+
+// set parses a single "name=value" setting, as provided to -set, and applies
+// it to the ObjectOptions.  Recognized names are content-type, storage-class,
+// tags, priority, and source.
+func (p *ObjectOptions) set(s string) error {
+	name, value, found := strings.Cut(s, "=")
+	if !found {
+		return fmt.Errorf("%w: %s", errBadSet, s)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "content-type":
+		p.ContentType = value
+	case "storage-class":
+		sc, err := parseStorageClass(value)
+		if err != nil {
+			return err
+		}
+		p.StorageClass = sc
+	case "tags":
+		tagging, err := parseTagging(value)
+		if err != nil {
+			return err
+		}
+		p.Tagging = tagging
+	case "priority":
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid priority: %s: %w", value, err)
+		}
+		p.Priority = priority
+	case "source":
+		if _, err := lookupSource(value); err != nil {
+			return err
+		}
+		p.Source = strings.ToLower(value)
+	default:
+		return fmt.Errorf("%w: %s", errBadSet, s)
+	}
+
+	return nil
+}
+
+// processGlobArgs processes the trailing command line arguments, which list
+// globs optionally interspersed with "-set name=value" settings (or
+// "-priority n", which is equivalent to "-set priority=n").  Settings
+// apply to the globs that follow them, up until the next setting that follows
+// a glob, which starts a new group.  Settings provided before any glob start
+// from leading, which may be nil.  The returned slices are of equal length,
+// listing each glob and its ObjectOptions (nil if there are no settings).
+func processGlobArgs(args []string, leading *ObjectOptions) ([]string, []*ObjectOptions, error) {
+	globs := []string{}
+	globOpts := []*ObjectOptions{}
+
+	current := leading
+	grouped := false
+
+	for i := 0; i < len(args); i++ {
+		setting := ""
+		switch args[i] {
+		case "-set", "--set":
+		case "-priority", "--priority":
+			setting = "priority="
+		default:
+			globs = append(globs, args[i])
+			globOpts = append(globOpts, current)
+			grouped = false
+			continue
+		}
+
+		if i+1 == len(args) {
+			return nil, nil, fmt.Errorf("%w: missing name=value", errBadSet)
+		}
+
+		// start a new group of settings after any glob, settings
+		// before the first glob extend leading
+		if !grouped {
+			if len(globs) == 0 && leading != nil {
+				copied := *leading
+				current = &copied
+			} else {
+				current = &ObjectOptions{}
+			}
+			grouped = true
+		}
+
+		i += 1
+		if err := current.set(setting + args[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if grouped && len(globs) > 0 {
+		return nil, nil, fmt.Errorf("%w: settings must be followed by globs", errBadSet)
+	}
+
+	return globs, globOpts, nil
+}
+
+// parseStorageClass validates a storage class name, case-insensitively,
+// against the storage classes known to the AWS SDK.
+func parseStorageClass(s string) (types.StorageClass, error) {
+	sc := types.StorageClass(strings.ToUpper(s))
+
+	if !slices.Contains(sc.Values(), sc) {
+		return "", fmt.Errorf("unknown storage class: %s", s)
+	}
+
+	return sc, nil
+}
+
+// parseServerSideEncryption validates a server-side encryption name,
+// case-insensitively, against those known to the AWS SDK.
+func parseServerSideEncryption(s string) (types.ServerSideEncryption, error) {
+	for _, sse := range types.ServerSideEncryption("").Values() {
+		if strings.EqualFold(string(sse), s) {
+			return sse, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown server-side encryption: %s", s)
+}
+
+// parseTagging validates tags encoded as URL query parameters, e.g.,
+// "key1=value1&key2=value2", returning them re-encoded.
+func parseTagging(s string) (string, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid tags: %s: %w", s, err)
+	}
+
+	return values.Encode(), nil
+}
+
+// parseLifecycleTag validates a single tag encoded as "key=value", returning
+// it re-encoded.
+func parseLifecycleTag(s string) (string, error) {
+	key, value, found := strings.Cut(s, "=")
+	if !found || key == "" || strings.Contains(value, "&") {
+		return "", fmt.Errorf("%w: %s", errBadLifecycleTag, s)
+	}
+
+	return url.Values{key: {value}}.Encode(), nil
+}
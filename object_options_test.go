@@ -0,0 +1,159 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Validate that per-object overrides take precedence over defaults, and that
+// defaults take precedence over MediaType
+func TestObjectOptionsWithDefaults(t *testing.T) {
+	defaults := &ObjectOptions{
+		ContentType:  "text/csv",
+		StorageClass: types.StorageClassGlacier,
+	}
+
+	for i, tst := range []struct {
+		objOpt       *ObjectOptions
+		defaults     *ObjectOptions
+		contentType  string
+		storageClass types.StorageClass
+	}{
+		{nil, nil, "application/pdf", ""},
+		{nil, defaults, "text/csv", types.StorageClassGlacier},
+		{&ObjectOptions{ContentType: "text/plain"}, defaults, "text/plain", types.StorageClassGlacier},
+		{&ObjectOptions{StorageClass: types.StorageClassStandardIa}, nil, "application/pdf", types.StorageClassStandardIa},
+	} {
+		obj := &s3.PutObjectInput{Key: aws.String("file.pdf")}
+
+		tst.objOpt.withDefaults(tst.defaults).applyPutObject(obj)
+
+		if *obj.ContentType != tst.contentType {
+			t.Errorf("%d expected %s got %s", i, tst.contentType, *obj.ContentType)
+		}
+
+		if obj.StorageClass != tst.storageClass {
+			t.Errorf("%d expected %s got %s", i, tst.storageClass, obj.StorageClass)
+		}
+	}
+}
+
+// Validate that the -lifecycle-tag is added to any other tags, replacing a tag
+// with the same key
+func TestObjectOptionsLifecycleTag(t *testing.T) {
+	lifecycleTag, err := parseLifecycleTag("expire=90d")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defaults := &ObjectOptions{LifecycleTag: lifecycleTag}
+
+	for i, tst := range []struct {
+		objOpt  *ObjectOptions
+		tagging string
+	}{
+		{nil, "expire=90d"},
+		{&ObjectOptions{Tagging: "a=1"}, "a=1&expire=90d"},
+		{&ObjectOptions{Tagging: "expire=1d&z=2"}, "expire=90d&z=2"},
+	} {
+		obj := &s3.PutObjectInput{Key: aws.String("file.pdf")}
+
+		tst.objOpt.withDefaults(defaults).applyPutObject(obj)
+
+		if obj.Tagging == nil || *obj.Tagging != tst.tagging {
+			t.Errorf("%d expected %s got %v", i, tst.tagging, aws.ToString(obj.Tagging))
+		}
+	}
+
+	for i, s := range []string{"expire", "=90d", "expire=90d&a=1"} {
+		if _, err := parseLifecycleTag(s); err == nil {
+			t.Errorf("%d expected error got nil", i)
+		}
+	}
+}
+
+// Validate that a deduplicating copy replaces the metadata and tags of the
+// source object with the settings the object would be uploaded with
+func TestObjectOptionsCopyObject(t *testing.T) {
+	objOpt := &ObjectOptions{
+		Tagging:      "a=1",
+		StorageClass: types.StorageClassStandardIa,
+		Metadata:     map[string]string{"project": "survey"},
+	}
+
+	copy := &s3.CopyObjectInput{Key: aws.String("file.pdf")}
+	objOpt.applyCopyObject(copy, "")
+
+	if copy.MetadataDirective != types.MetadataDirectiveReplace || copy.TaggingDirective != types.TaggingDirectiveReplace {
+		t.Errorf("expected REPLACE directives, got %s and %s", copy.MetadataDirective, copy.TaggingDirective)
+	}
+
+	if aws.ToString(copy.ContentType) != "application/pdf" {
+		t.Errorf("expected application/pdf got %s", aws.ToString(copy.ContentType))
+	}
+
+	if aws.ToString(copy.Tagging) != "a=1" || copy.StorageClass != types.StorageClassStandardIa {
+		t.Errorf("expected a=1 and %s got %s and %s",
+			types.StorageClassStandardIa, aws.ToString(copy.Tagging), copy.StorageClass)
+	}
+
+	if copy.Metadata["project"] != "survey" {
+		t.Errorf("expected metadata project=survey got %v", copy.Metadata)
+	}
+}
+
+// Validate that -set settings apply to the globs that follow them
+func TestProcessGlobArgs(t *testing.T) {
+	leading := &ObjectOptions{ContentType: "text/plain"}
+
+	args := []string{
+		"a.txt",
+		"-set", "content-type=text/csv", "--set", "tags=b=2&a=1",
+		"data/*.csv", "more/*.csv",
+		"-set", "storage-class=glacier", "-priority", "5",
+		"raw/*",
+	}
+
+	globs, globOpts, err := processGlobArgs(args, leading)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expect := []struct {
+		glob string
+		opt  ObjectOptions
+	}{
+		{"a.txt", ObjectOptions{ContentType: "text/plain"}},
+		{"data/*.csv", ObjectOptions{ContentType: "text/csv", Tagging: "a=1&b=2"}},
+		{"more/*.csv", ObjectOptions{ContentType: "text/csv", Tagging: "a=1&b=2"}},
+		{"raw/*", ObjectOptions{StorageClass: types.StorageClassGlacier, Priority: 5}},
+	}
+
+	if len(globs) != len(expect) || len(globOpts) != len(expect) {
+		t.Fatalf("expected %d globs, got %d, %d", len(expect), len(globs), len(globOpts))
+	}
+
+	for i := range expect {
+		if globs[i] != expect[i].glob {
+			t.Errorf("%d expected %s got %s", i, expect[i].glob, globs[i])
+		}
+		if !reflect.DeepEqual(*globOpts[i], expect[i].opt) {
+			t.Errorf("%d expected %#v got %#v", i, expect[i].opt, *globOpts[i])
+		}
+	}
+
+	for i, bad := range [][]string{
+		{"a.txt", "-set"},
+		{"a.txt", "-set", "content-type=text/csv"},
+		{"-set", "colour=blue", "a.txt"},
+		{"-set", "storage-class=NOT_A_CLASS", "a.txt"},
+	} {
+		if _, _, err := processGlobArgs(bad, nil); err == nil {
+			t.Errorf("%d expected error for %v", i, bad)
+		}
+	}
+}
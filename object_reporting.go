@@ -1,9 +1,12 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
@@ -11,18 +14,40 @@ import (
 // ObjectReporting representins a JSON serializable representation of an
 // S3UploadState record.
 type ObjectReporting struct {
-	Bucket           string
-	Key              string
-	UploadId         string `json:",omitempty"`
-	Completed        bool
-	Aborted          bool
-	FullChecksums    *ObjectChecksums  `json:",omitempty"`
-	ObjectChecksum   *ObjectChecksums  `json:",omitempty"`
-	ObjectAttributes *ObjectAttributes `json:",omitempty"`
-	Errors           *ObjectErrors     `json:",omitempty"`
+	Bucket                string
+	Key                   string
+	SourceKey             string       `json:",omitempty"`
+	Split                 *SplitRange  `json:",omitempty"`
+	Compression           *Compression `json:",omitempty"`
+	UploadId              string       `json:",omitempty"`
+	RunID                 string       `json:",omitempty"`
+	Completed             bool
+	Aborted               bool
+	Predicted             bool                `json:",omitempty"`
+	DuplicateOf           string              `json:",omitempty"`
+	LifecycleTag          string              `json:",omitempty"`
+	Encryption            string              `json:",omitempty"`
+	FullChecksums         *ObjectChecksums    `json:",omitempty"`
+	ObjectChecksum        *ObjectChecksums    `json:",omitempty"`
+	ObjectAttributes      *ObjectAttributes   `json:",omitempty"`
+	AttributesUnavailable bool                `json:",omitempty"`
+	SourceDeleted         bool                `json:",omitempty"`
+	SourceArchived        string              `json:",omitempty"`
+	SourceTruncated       bool                `json:",omitempty"`
+	Verification          *UploadVerification `json:",omitempty"`
+	Verified              bool                `json:",omitempty"`
+	PartRetries           []*PartRetries      `json:",omitempty"`
+	Errors                *ObjectErrors       `json:",omitempty"`
 }
 
 func NewObjectReporting(st *S3UploadState) (*ObjectReporting, error) {
+	if st.checksumOnly {
+		return newPredictedReporting(st)
+	}
+
+	if st.duplicateOf != nil {
+		return newDuplicateReporting(st), nil
+	}
 
 	isPutObject := (st.obj != nil && st.objOutput != nil)
 
@@ -57,6 +82,9 @@ func NewObjectReporting(st *S3UploadState) (*ObjectReporting, error) {
 	var objChecksums *ObjectChecksums
 	var objAttributes *ObjectAttributes
 	var err error
+
+	attributesErr := st.objectAttributesError
+
 	if isCompleted {
 		fullChecksums, err = NewObjectChecksums(st.hr)
 		if err != nil {
@@ -71,11 +99,12 @@ func NewObjectReporting(st *S3UploadState) (*ObjectReporting, error) {
 				st.hr.ChecksumAlgorithm(), st.hr.SumOfSums())
 		}
 
+		// the object was uploaded, so an error fetching or parsing
+		// its attributes is recorded rather than dropping the record
 		objAttributes, err = NewObjectAttributes(st.hr, st.objectAttributesOutput)
-		if err != nil {
-			return nil, err
+		if err != nil && attributesErr == nil {
+			attributesErr = err
 		}
-
 	}
 
 	var partErrors []*UploadPartError
@@ -92,35 +121,157 @@ func NewObjectReporting(st *S3UploadState) (*ObjectReporting, error) {
 		}
 	}
 
+	var partRetries []*PartRetries
+	for i, n := range st.uploadPartRetries {
+		partRetries = append(partRetries, &PartRetries{
+			PartNumber: i,
+			Retries:    n,
+		})
+	}
+	slices.SortFunc(partRetries, func(a, b *PartRetries) int {
+		return cmp.Compare(a.PartNumber, b.PartNumber)
+	})
+
 	errors := &ObjectErrors{
 		PutObjectError:               errorString(st.objError),
 		UploadPartErrors:             partErrors,
 		CompleteMultipartUploadError: errorString(st.completedError),
 		AbortMultipartUploadError:    errorString(st.abortedError),
-		GetObjectAttributesError:     errorString(st.objectAttributesError),
+		GetObjectAttributesError:     errorString(attributesErr),
+		SourceError:                  errorString(st.sourceError),
 	}
 
 	if len(errors.PutObjectError) == 0 &&
 		len(errors.UploadPartErrors) == 0 &&
 		len(errors.CompleteMultipartUploadError) == 0 &&
 		len(errors.AbortMultipartUploadError) == 0 &&
-		len(errors.GetObjectAttributesError) == 0 {
+		len(errors.GetObjectAttributesError) == 0 &&
+		len(errors.SourceError) == 0 {
 		errors = nil
 	}
 
 	return &ObjectReporting{
-		Bucket:           Bucket,
-		Key:              Key,
-		UploadId:         uploadID,
-		Completed:        isCompleted,
-		Aborted:          isAborted,
-		FullChecksums:    fullChecksums,
-		ObjectChecksum:   objChecksums,
-		ObjectAttributes: objAttributes,
-		Errors:           errors,
+		Bucket:                Bucket,
+		Key:                   Key,
+		SourceKey:             st.sourceKey,
+		Split:                 st.split,
+		Compression:           st.compression,
+		UploadId:              uploadID,
+		RunID:                 st.runID,
+		Completed:             isCompleted,
+		Aborted:               isAborted,
+		LifecycleTag:          st.lifecycleTag,
+		Encryption:            objectEncryption(st),
+		FullChecksums:         fullChecksums,
+		ObjectChecksum:        objChecksums,
+		ObjectAttributes:      objAttributes,
+		AttributesUnavailable: isCompleted && attributesErr != nil,
+		Verification:          st.completedVerification,
+		Verified:              isCompleted && st.completedVerification.Verified(),
+		PartRetries:           partRetries,
+		Errors:                errors,
 	}, nil
 }
 
+// newDuplicateReporting returns the record of an object that was not uploaded
+// as its content was found in the -dedupe-db, naming the object with the same
+// content, and completed if that object was copied to the key.
+func newDuplicateReporting(st *S3UploadState) *ObjectReporting {
+	obj := &ObjectReporting{
+		Bucket:      *st.obj.Bucket,
+		Key:         *st.obj.Key,
+		SourceKey:   st.sourceKey,
+		RunID:       st.runID,
+		Completed:   st.copyOutput != nil,
+		DuplicateOf: st.duplicateOf.Bucket + "/" + st.duplicateOf.Key,
+	}
+
+	// the same content was already uploaded to this key
+	if st.duplicateOf.Bucket == obj.Bucket && st.duplicateOf.Key == obj.Key {
+		obj.Completed = true
+	}
+
+	return obj
+}
+
+// newPredictedReporting returns an ObjectReporting for an object that was
+// hashed but not uploaded (see -checksum-only), with the ObjectAttributes set
+// to the values S3 is predicted to report once it is uploaded.
+func newPredictedReporting(st *S3UploadState) (*ObjectReporting, error) {
+	hr := st.hr
+
+	fullChecksums, err := NewObjectChecksums(hr)
+	if err != nil {
+		return nil, err
+	}
+
+	// objects with a single part are uploaded using PutObject, for which
+	// the ETag is the MD5 checksum of the object
+	var objChecksums *ObjectChecksums
+	var etag string
+	var parts *ObjectPartAttributes
+
+	if hr.Count() == 1 {
+		objChecksums = AWSObjectChecksums(hr.ChecksumAlgorithm(), hr.Sum())
+		etag = hr.MD5Sum().Hex()
+	} else {
+		objChecksums = AWSObjectChecksums(hr.ChecksumAlgorithm(), hr.SumOfSums())
+		etag = hr.ETag()
+		parts = newPredictedParts(hr)
+	}
+
+	var errors *ObjectErrors
+	if st.sourceError != nil {
+		errors = &ObjectErrors{
+			SourceError: errorString(st.sourceError),
+		}
+	}
+
+	return &ObjectReporting{
+		Bucket:         *st.obj.Bucket,
+		Key:            *st.obj.Key,
+		SourceKey:      st.sourceKey,
+		Split:          st.split,
+		Compression:    st.compression,
+		RunID:          st.runID,
+		Predicted:      true,
+		FullChecksums:  fullChecksums,
+		ObjectChecksum: objChecksums,
+		ObjectAttributes: &ObjectAttributes{
+			ETag:        &etag,
+			Checksum:    objChecksums,
+			ObjectParts: parts,
+		},
+		Errors: errors,
+	}, nil
+}
+
+// newPredictedParts returns the ObjectPartAttributes S3 is predicted to report
+// for a multi-part object.
+func newPredictedParts(hr *S3Hasher) *ObjectPartAttributes {
+	count := int32(hr.Count())
+
+	p := &ObjectPartAttributes{
+		TotalPartsCount: &count,
+	}
+
+	for partID := int32(1); partID <= count; partID++ {
+		sums := AWSObjectChecksums(hr.ChecksumAlgorithm(), hr.SumPart(partID))
+
+		p.Parts = append(p.Parts, &ObjectPart{
+			PartNumber:     aws.Int32(partID),
+			Size:           aws.Int64(hr.PartSize(partID)),
+			ChecksumCRC32:  sums.ChecksumCRC32,
+			ChecksumCRC32C: sums.ChecksumCRC32C,
+			ChecksumSHA1:   sums.ChecksumSHA1,
+			ChecksumSHA256: sums.ChecksumSHA256,
+			ChecksumMD5:    NewObjectChecksum(hr.MD5SumPart(partID)),
+		})
+	}
+
+	return p
+}
+
 // ObjectChecksum provides human-readable representations of a HashSum checksum.
 type ObjectChecksum struct {
 	Hex    string
@@ -143,6 +294,11 @@ type ObjectChecksums struct {
 	ChecksumCRC32C *ObjectChecksum `json:"ChecksumCRC32C,omitempty"`
 	ChecksumSHA1   *ObjectChecksum `json:"ChecksumSHA1,omitempty"`
 	ChecksumSHA256 *ObjectChecksum `json:"ChecksumSHA256,omitempty"`
+
+	// calculated locally when requested using -extra-checksums
+	ChecksumSHA512 *ObjectChecksum `json:"ChecksumSHA512,omitempty"`
+	ChecksumBLAKE3 *ObjectChecksum `json:"ChecksumBLAKE3,omitempty"`
+	ChecksumXXHASH *ObjectChecksum `json:"ChecksumXXHASH,omitempty"`
 }
 
 // AWSObjectChecksums returns an ObjectChecksums for a specified algorithm and
@@ -170,6 +326,7 @@ func NewObjectChecksums(t interface{}) (*ObjectChecksums, error) {
 	var md5sum []byte
 	var sum HashSum
 	var algo *ChecksumAlgorithm
+	var extra *S3Hasher
 	var err error
 
 	if t == nil {
@@ -178,6 +335,7 @@ func NewObjectChecksums(t interface{}) (*ObjectChecksums, error) {
 		algo = hr.ChecksumAlgorithm()
 		sum = hr.Sum()
 		md5sum = hr.MD5Sum()
+		extra = hr
 	} else if x, ok := t.(*types.Checksum); ok {
 		var b64 HashSumBase64
 		p := &b64
@@ -225,6 +383,18 @@ func NewObjectChecksums(t interface{}) (*ObjectChecksums, error) {
 		p.ChecksumSHA256 = NewObjectChecksum(sum)
 	}
 
+	if extra != nil {
+		if sum := extra.ExtraSum(ChecksumAlgorithmSHA512); sum != nil {
+			p.ChecksumSHA512 = NewObjectChecksum(sum)
+		}
+		if sum := extra.ExtraSum(ChecksumAlgorithmBLAKE3); sum != nil {
+			p.ChecksumBLAKE3 = NewObjectChecksum(sum)
+		}
+		if sum := extra.ExtraSum(ChecksumAlgorithmXXHASH); sum != nil {
+			p.ChecksumXXHASH = NewObjectChecksum(sum)
+		}
+	}
+
 	return p, nil
 }
 
@@ -237,12 +407,20 @@ type ObjectAttributes struct {
 	ETag         *string               `json:",omitempty"`
 	Checksum     *ObjectChecksums      `json:",omitempty"`
 	ObjectParts  *ObjectPartAttributes `json:",omitempty"`
+	StorageClass types.StorageClass    `json:",omitempty"`
 }
 
 func NewObjectAttributes(hr *S3Hasher, p *s3.GetObjectAttributesOutput) (*ObjectAttributes, error) {
-	checksum, err := NewObjectChecksums(p.Checksum)
-	if err != nil {
-		return nil, err
+	if p == nil {
+		return nil, nil
+	}
+
+	var checksum *ObjectChecksums
+	if p.Checksum != nil {
+		var err error
+		if checksum, err = NewObjectChecksums(p.Checksum); err != nil {
+			return nil, err
+		}
 	}
 
 	return &ObjectAttributes{
@@ -252,6 +430,7 @@ func NewObjectAttributes(hr *S3Hasher, p *s3.GetObjectAttributesOutput) (*Object
 		ETag:         p.ETag,
 		Checksum:     checksum,
 		ObjectParts:  NewObjectPartAttributes(hr, p.ObjectParts),
+		StorageClass: p.StorageClass,
 	}, nil
 }
 
@@ -330,6 +509,13 @@ type ObjectPart struct {
 	ChecksumMD5    *ObjectChecksum `json:",omitempty"`
 }
 
+// PartRetries represents an S3UploadState.uploadPartRetries entry, the number
+// of times a part was retried with -retries.
+type PartRetries struct {
+	PartNumber int32
+	Retries    int
+}
+
 // UploadPartError represents an error recorded in an
 // S3UploadState.uploadPartsError entry.
 type UploadPartError struct {
@@ -344,6 +530,8 @@ type ObjectErrors struct {
 	CompleteMultipartUploadError string             `json:",omitempty"`
 	AbortMultipartUploadError    string             `json:",omitempty"`
 	GetObjectAttributesError     string             `json:",omitempty"`
+	SourceError                  string             `json:",omitempty"`
+	SourceRetentionError         string             `json:",omitempty"`
 }
 
 func NewObjectErrors(st *S3UploadState) *ObjectErrors {
@@ -364,6 +552,7 @@ func NewObjectErrors(st *S3UploadState) *ObjectErrors {
 		CompleteMultipartUploadError: errorString(st.completedError),
 		AbortMultipartUploadError:    errorString(st.abortedError),
 		GetObjectAttributesError:     errorString(st.objectAttributesError),
+		SourceError:                  errorString(st.sourceError),
 	}
 }
 
@@ -2,6 +2,8 @@ package main
 
 import (
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // Minimum allowed size of a part in bytes
@@ -19,6 +21,24 @@ const DefaultCopyBufSize int64 = 256 * 1024
 // Default limit on the number of parts in a multi-part upload
 const DefaultMaxPartID int32 = 1e4
 
+// Default number of parts to read ahead of the parts being uploaded
+const DefaultReadAhead int = 1
+
+// Default number of goroutines uploading small objects, see SmallObjectSize
+const DefaultConcurrentSmallObjects int = 16
+
+// Default number of goroutines fetching the attributes of completed objects
+const DefaultConcurrentAttributes int = 4
+
+// Default number of retries of a failed GetObjectAttributes request
+const DefaultObjectAttributesRetries int = 3
+
+// Default number of retries of a part upload that failed transiently
+const DefaultRetries int = 3
+
+// Default wait before the first retry of a part upload, see Options.Retries
+const DefaultRetryBackoff time.Duration = time.Second
+
 // Options captures command line flags to configure the upload process
 type Options struct {
 	// Optionally specify cpu profiling output file
@@ -27,16 +47,114 @@ type Options struct {
 	// Optionally specify memory profiling output file
 	MemProfile string
 
+	// Optionally specify the interval at which to write numbered memory
+	// profiles during the run, in addition to MemProfile at exit
+	MemProfileInterval time.Duration
+
 	// Optionally specify trace output file
 	Trace string
 
+	// Optionally limit the number of operating system threads executing
+	// Go code simultaneously (see runtime.GOMAXPROCS)
+	GoMaxProcs int
+
+	// Optionally set a soft limit on the memory used by the Go runtime
+	// (see debug.SetMemoryLimit)
+	MemoryLimit ByteSize
+
 	// Optionally enable verbose logging
 	Verbose bool
 
-	// Optionally specify a tab-separated file listing filepath extensions
-	// and IANA media types to register in the process
+	// Optionally specify a tab-separated or mime.types file listing
+	// filepath extensions and IANA media types to register in the process
 	MediaTypes string
 
+	// Optionally specify that the content of objects whose key does not
+	// have a recognized extension should be evaluated to find the media
+	// type, rather than defaulting to application/octet-stream
+	SniffMediaTypes bool
+
+	// Optionally specify a Content-Type to use for all objects, instead of
+	// using the media type derived from the key
+	ContentType string
+
+	// Optionally specify a tag, as key=value, to set on all objects so that
+	// bucket lifecycle rules keyed on the tag take effect
+	LifecycleTag string
+
+	// Optionally specify user-defined metadata, as key=value, to set on
+	// all objects (e.g., for provenance)
+	Metadata map[string]string
+
+	// Optionally specify a suffix naming, for each file uploaded, a JSON
+	// file of user-defined metadata to set on its object in addition to
+	// (and taking precedence over) Metadata, e.g., ".meta.json"
+	MetadataSidecar string
+
+	// Optionally specify the identifier of the run, stored in the metadata
+	// of every object and noted in the manifest, by default one is
+	// generated
+	RunID string
+
+	// Optionally specify the server-side encryption to apply to objects,
+	// one of AES256, aws:kms, or aws:kms:dsse, and for KMS the key id or
+	// ARN (otherwise the AWS managed key is used)
+	SSE         string
+	SSEKMSKeyId string
+
+	// Optionally specify a file holding a 256-bit key to encrypt objects
+	// with using a customer-provided key (SSE-C), in place of SSE
+	SSECustomerKey string
+
+	// Optionally specify that KMS permissions should not be checked using
+	// a probe upload before processing any files when SSE uses KMS
+	DisableKMSPreflight bool
+
+	// Optionally specify a file of rules selecting the storage class of
+	// each object from its name, size, and age (see ReadStorageRules)
+	StorageRules string
+
+	// Optionally specify that objects uploaded using PutObject should fail
+	// if the ETag or checksum returned does not match, rather than only
+	// recording the mismatch
+	StrictVerify bool
+
+	// Optionally specify that every PutObject and UploadPart request must
+	// be sent with a Content-MD5 that the returned ETag matches, for S3
+	// compatible stores that ignore the x-amz-checksum headers
+	RequireContentMD5 bool
+
+	// Optionally specify that sources should be compressed using gzip,
+	// unless they are already compressed
+	Compress bool
+
+	// Optionally specify how sparse files are uploaded, by default they
+	// are uploaded as they are read
+	Sparse sparseMode
+
+	// Optionally specify that the local file of each object should be
+	// removed once the object is completed and its checksum verified
+	DeleteSource bool
+
+	// Optionally specify a directory the local file of each object should
+	// be moved to once the object is completed and its checksum verified
+	ArchiveSourceTo string
+
+	// Optionally specify that the local file of each object should be
+	// truncated to zero length once the object is completed and its
+	// checksum verified
+	TruncateSource bool
+
+	// Optionally specify a command to run before the globs are processed,
+	// creating a point-in-time snapshot of the working directory and
+	// printing the directory it is mounted on, from which the globs are
+	// then read
+	SnapshotCmd string
+
+	// Optionally specify a command to run once the run has finished, to
+	// remove the snapshot created by SnapshotCmd
+	SnapshotCleanupCmd string
+
 	// Optionally specify that memory buffers should be used instead of
 	// file buffers when uploading a stream
 	UseMemoryBuffers bool
@@ -44,6 +162,33 @@ type Options struct {
 	// Optionally set the temp directory to use when file buffers are in use
 	UseTempDir string
 
+	// Optionally specify that parts buffered in temporary files should be
+	// re-hashed just before they are uploaded, failing the part if the
+	// buffer no longer matches the checksum calculated when it was written
+	VerifyBuffers bool
+
+	// Optionally specify that the parts of a stream (e.g., stdin) after
+	// the first should be uploaded while they are read, with a trailing
+	// checksum, rather than once they have been buffered in full.  The
+	// parts are buffered in memory regardless of UseMemoryBuffers.
+	StreamParts bool
+
+	// Optionally specify the number of times to re-upload an object whose
+	// source file changed (in size or modification time) while it was
+	// being uploaded, by default the change is only recorded in the
+	// manifest
+	ReuploadModified int
+
+	// Optionally specify that a shared advisory lock (flock LOCK_SH)
+	// should be held on each source file while it is uploaded, waiting for
+	// any exclusive lock held by a producer writing to the file
+	Flock bool
+
+	// Optionally select the Source backend used to read objects, by the
+	// name it was registered with (see RegisterSource), by default the
+	// tempfile or memory backend is used per UseMemoryBuffers
+	Source string
+
 	// Optionally specify the maximum time to wait for an s3 UploadPart
 	// call to complete, if set to the zero value then no timeout will be
 	// triggered
@@ -59,6 +204,41 @@ type Options struct {
 	// triggered
 	AbortUploadTimeout time.Duration
 
+	// Optionally specify the maximum time to wait for an s3 PutObject call
+	// to complete, if set to the zero value then no timeout will be
+	// triggered
+	PutObjectTimeout time.Duration
+
+	// Optionally specify the maximum time to wait for an s3
+	// CreateMultipartUpload call to complete, if set to the zero value then
+	// no timeout will be triggered
+	CreateUploadTimeout time.Duration
+
+	// Optionally specify the maximum time to wait for an s3
+	// GetObjectAttributes call to complete, if set to the zero value then
+	// no timeout will be triggered
+	ObjectAttributesTimeout time.Duration
+
+	// Optionally specify the attributes requested by GetObjectAttributes
+	// once an object is uploaded, if nil then the ETag, checksum, parts and
+	// size are requested, and if empty GetObjectAttributes is not called
+	ObjectAttributes []types.ObjectAttributes
+
+	// Optionally specify the maximum number of parts listed by
+	// GetObjectAttributes, by default DefaultMaxPartID
+	ObjectAttributesMaxParts int32
+
+	// Optionally specify the number of times a failed GetObjectAttributes
+	// request is retried, with exponential backoff, once an object has
+	// been uploaded
+	ObjectAttributesRetries int
+
+	// Optionally specify the maximum time for any single HTTP request
+	// (including reading the response) sent to S3, each attempt made by
+	// the AWS SDK is timed separately, if set to the zero value then no
+	// timeout will be triggered
+	RequestTimeout time.Duration
+
 	// Optionally specify that subdirectories should be walked to find
 	// files to upload.
 	Recursive bool
@@ -67,21 +247,95 @@ type Options struct {
 	// files
 	Profile string
 
+	// Optionally specify the region to use, instead of the region from the
+	// environment or the profile (e.g., for an endpoint that is not AWS)
+	Region string
+
+	// Optionally specify the S3 endpoint URLs to send requests to, instead
+	// of the endpoint from the AWS configuration.  When more than one is
+	// specified requests are distributed across them round-robin
+	Endpoints []string
+
+	// Optionally specify that the latency of each of multiple Endpoints
+	// should be probed at startup, and requests distributed across them in
+	// inverse proportion to it, so that the fastest receive the most parts
+	ProbeEndpoints bool
+
+	// Optionally specify how often the Endpoints should be probed again
+	// during the run with ProbeEndpoints, 0 probes only at startup
+	ProbeEndpointsInterval time.Duration
+
+	// Optionally specify that the AWS dual-stack (IPv4 and IPv6) endpoint
+	// should be used
+	UseDualStack bool
+
+	// Optionally specify that the AWS FIPS 140-2 validated endpoint should
+	// be used
+	UseFIPS bool
+
+	// Optionally specify addresses to connect to instead of resolving host
+	// names using DNS, in the curl --resolve style, i.e., host:port:addr
+	// or host:addr
+	Resolve []string
+
+	// Optionally specify how long DNS results for connections to S3 are
+	// cached, if set to the zero value then they are not cached
+	DNSCache time.Duration
+
+	// Optionally specify that requests should not be signed, using
+	// anonymous credentials instead of searching for credentials
+	NoSignRequest bool
+
+	// Optionally specify static credentials to use instead of searching
+	// the environment, the AWS configuration files, and instance metadata
+	// for credentials.  AccessKey and SecretKey must be specified together,
+	// SessionToken is required for temporary credentials
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// Optionally specify files to read AccessKey, SecretKey, and
+	// SessionToken from, the files are checked for changes (e.g., when
+	// rotated by an external agent) and reloaded as needed
+	AccessKeyFile    string
+	SecretKeyFile    string
+	SessionTokenFile string
+
+	// Optionally specify the ARNs of roles to assume, in order, each using
+	// the credentials of the role before it (role chaining)
+	RoleARNs []string
+
 	// Optionally specify that newer virtual-host style paths should be
 	// used (AWS S3 uses virtual-host style paths, Elm uses the older path
 	// style).
 	DisablePathStyle bool
 
+	// Optionally specify the addressing style, by default the endpoint is
+	// probed to find the style that works, starting with path-style
+	// unless DisablePathStyle is set
+	PathStyle pathStyle
+
 	// Optionally specify that only a single s3 Client shoudl be used (with
 	// AWS S3 the S3 SDK used by s3up is able to open multiple connections,
 	// with Elm that does not appear to be the case and so using multiple
 	// s3 Client is the default)
 	DisableS3ClientPool bool
 
+	// Optionally specify the number of connections to S3 to open, using
+	// concurrent HeadBucket requests, before any object is uploaded, so
+	// that the first parts are not slowed by connection set up.  If set to
+	// the zero value then connections are opened as they are needed.
+	WarmUp int
+
 	// Optionally select the checksum algorithm to validate each part
 	// uploaded, by default SHA256 is used.
 	ChecksumAlgorithm *ChecksumAlgorithm
 
+	// Optionally specify additional full-body checksum algorithms, which
+	// S3 does not support, to calculate locally and include in the
+	// FullChecksums of the manifest.
+	ExtraChecksums []*ChecksumAlgorithm
+
 	// Optionally override the default buffer size (in bytes) to use when
 	// copying source parts to temporary files, by default this will be
 	// 256KiB.
@@ -92,6 +346,18 @@ type Options struct {
 	// the maximum is 5GiB.
 	PartSize int64
 
+	// Optionally specify the size (in bytes) above which an object of
+	// known size is uploaded as a multi-part object, so that objects
+	// larger than PartSize may still be uploaded using a single
+	// PutObject.  If set to the zero value then PartSize is used.  The
+	// maximum allowed threshold is 5GiB.
+	MultipartThreshold int64
+
+	// Optionally specify the name of a Preset providing the default
+	// PartSize and ConcurrentParts, so that objects are split into parts
+	// in the same way as by another tool
+	Preset string
+
 	// Optionally specify the maximum number of parts allowed to be
 	// created, by default this will be DefaultMaxPartID
 	MaxPartID int32
@@ -100,19 +366,265 @@ type Options struct {
 	// objects, the default is 1.
 	ConcurrentObjects int
 
+	// Optionally specify the size of files at or below which they are
+	// uploaded by a separate pool of ConcurrentSmallObjects goroutines,
+	// read into memory and hashed inline, rather than through the Source
+	// and part machinery.  If set to the zero value the fast path is not
+	// used.
+	SmallObjectSize        ByteSize
+	ConcurrentSmallObjects int
+
+	// Optionally specify the number of bytes read from a source of
+	// unknown size (e.g., standard input) to choose between PutObject and
+	// a multi-part upload, sources longer than this are uploaded as
+	// multi-part objects even if they fit in a single part.  If set to the
+	// zero value then a full part is read, and the next part read ahead,
+	// to choose.
+	ProbeSize ByteSize
+
+	// Optionally specify the number of goroutines used to fetch the
+	// attributes of completed objects, so that fetching them does not
+	// delay the next object, the default is DefaultConcurrentAttributes.
+	ConcurrentAttributes int
+
 	// Optionally specify thne number of goroutines to use per part for a
 	// multi-part object upload.  T The pool of goroutines is not shared
 	// between calls to Upload.  The default value is 1.
 	ConcurrentParts int
 
+	// Optionally specify the number of parts that may be read from the
+	// source and buffered ahead of the parts currently being uploaded,
+	// the default is DefaultReadAhead.  The minimum is 1.
+	ReadAhead int
+
+	// Optionally specify that the number of goroutines used per object
+	// should be derived from the object size (when known), sharing a
+	// budget of ConcurrentObjects * ConcurrentParts part uploads across
+	// all objects.
+	DynamicParts bool
+
+	// Optionally limit the rate (in bytes per second) at which data is
+	// uploaded, if set to the zero value then no limit is applied
+	BandwidthLimit int64
+
+	// Optionally specify that objects should compete for BandwidthLimit in
+	// the order their requests arrive, rather than receiving a fair share
+	// each
+	BandwidthGreedy bool
+
+	// Optionally limit the rate (in bytes per second) at which data is
+	// uploaded for any single object, in addition to BandwidthLimit, if set
+	// to the zero value then no limit is applied
+	BandwidthLimitPerObject int64
+
+	// Optionally specify that the region of the bucket should not be
+	// detected, by default if the bucket is in a different region than
+	// configured then the bucket's region is used instead
+	DisableRegionDetect bool
+
+	// Optionally check that the bucket exists and is accessible before
+	// processing any files
+	Preflight bool
+
+	// Optionally check that objects can be written to the bucket, by
+	// uploading and deleting an empty object, before processing any files
+	PreflightWrite bool
+
+	// Optionally create the bucket if it does not exist, this implies
+	// Preflight
+	CreateBucket bool
+
+	// Optionally enable versioning on a bucket created by CreateBucket
+	CreateBucketVersioning bool
+
+	// Optionally enable object lock (and versioning) on a bucket created
+	// by CreateBucket
+	CreateBucketObjectLock bool
+
+	// Optionally abort any multi-part uploads under the destination that
+	// were initiated longer ago than this duration before starting, if set
+	// to the zero value then no uploads will be aborted
+	AbortStale time.Duration
+
+	// Optionally allow AbortStale to abort uploads in the whole bucket
+	// when no -key prefix was specified
+	AbortStaleBucket bool
+
 	// Optionally direct s3up to not abort any failed uploads or any
 	// uploads still pending when an interrupt signal is received.
 	LeavePartsOnError bool
 
+	// Optionally specify the number of times a part upload that failed
+	// with a transient error (e.g., 503 SlowDown, 500, or a connection
+	// reset) is retried, in addition to the retries made by the AWS SDK
+	Retries int
+
+	// Optionally specify the wait before the first retry of a part
+	// upload, which is doubled after each retry and jittered
+	RetryBackoff time.Duration
+
+	// Optionally specify the fraction (0.0 to 1.0) of the most recent
+	// requests that may fail before the run is aborted, if set to the zero
+	// value then the run is never aborted due to failed requests
+	RetryBudget float64
+
+	// Optionally specify a file to write the state of any uploads left
+	// pending due to LeavePartsOnError, so that they may be resumed
+	StateFile string
+
+	// Optionally specify a state file to resume the multi-part uploads
+	// listed in from a previous run, which is rewritten with the uploads
+	// left pending once the run has finished (implies LeavePartsOnError)
+	Resume string
+
+	// Optionally specify the UploadId of a multi-part upload created by
+	// another process to upload parts to, instead of creating one, or of a
+	// pending multi-part upload for s3up repair
+	UploadID string
+
+	// Optionally specify the part number that parts uploaded with UploadID
+	// start at, by default 1
+	StartPart int32
+
+	// Optionally specify the range of the source to upload with UploadID,
+	// e.g., as assigned to a host by s3up distribute
+	RangeOffset ByteSize
+	RangeLength ByteSize
+
+	// Optionally specify the number of hosts to assign parts to, for s3up
+	// distribute
+	Hosts int
+
+	// Optionally specify the plan written by s3up distribute, for s3up
+	// complete
+	Plan string
+
+	// Optionally specify the json manifest listing the chunk objects an
+	// object is composed from, for s3up compose
+	ComposeManifest string
+
+	// Optionally specify that sources whose remote object appears to be the
+	// same should not be uploaded
+	Sync bool
+
+	// Optionally specify how Sync compares sources against remote objects,
+	// by default the size and predicted ETag of every source is compared
+	SyncMode syncMode
+
+	// Optionally specify that remote objects under the destination prefix
+	// that were not found locally should be deleted, only valid with Sync
+	Delete bool
+
+	// Optionally limit the number of remote objects Delete may delete, if
+	// more would be deleted then none are, if negative then no limit is
+	// applied (see DefaultMaxDelete)
+	MaxDelete int
+
+	// Optionally specify a database of the content checksums of uploaded
+	// objects (see OpenDedupeDB), sources whose content was already
+	// uploaded are handled per DedupeMode, and uploaded objects are added
+	DedupeDB string
+
+	// Optionally specify how DedupeDB handles sources whose content was
+	// already uploaded, by default they are skipped
+	DedupeMode dedupeMode
+
+	// Optionally limit the number of objects, and their total size, that
+	// are uploaded, once either is exceeded no further objects are queued,
+	// if set to the zero value then no limit is applied
+	MaxObjects int
+	MaxBytes   ByteSize
+
+	// Optionally split the standard input stream into objects of up to
+	// this size, with the keys generated from a -key template using
+	// {{.Seq}} or {{.Offset}}, zero-padded to SplitPad digits
+	SplitSize ByteSize
+	SplitPad  int
+
+	// Optionally specify that sources should only be hashed, producing the
+	// manifest with the values predicted for each object, without
+	// uploading anything
+	ChecksumOnly bool
+
+	// Optionally specify that nothing should be read or uploaded, instead
+	// the requests, storage, and cost of uploading the sources is estimated
+	// using the prices in the PriceTable file, if set, or the
+	// DefaultPriceTable
+	DryRun     bool
+	PriceTable string
+
 	// Optionally specify a manifest format to produce detailing checksums,
 	// paths, etc. that were uploaded.
 	Manifest manifestType
 
+	// Optionally specify a file shared by concurrent runs that each record
+	// of the manifest is appended to as a JSON line, see s3up
+	// export-manifest
+	ManifestAppend string
+
+	// Optionally specify a key in the bucket that the manifest is uploaded
+	// to once the run has finished, or a prefix ending in "/" under which it
+	// is named by the run ID
+	ManifestUpload string
+
+	// Optionally specify a file to periodically write the manifest
+	// records received so far to, every CheckpointObjects records or
+	// CheckpointInterval, whichever comes first
+	ManifestCheckpoint string
+	CheckpointObjects  int
+	CheckpointInterval time.Duration
+
+	// Optionally specify a file to write a JSON summary of the run to,
+	// with the totals of objects, bytes, requests, and errors
+	SummaryOut string
+
+	// Optionally specify an open file descriptor to write a JSON snapshot
+	// of the progress of the run to every StatsInterval, if set to the
+	// zero value then no snapshots are written
+	StatsFD       int
+	StatsInterval time.Duration
+
+	// Optionally specify the number of hex characters of a hash of each
+	// key to insert as an additional prefix after the -key prefix, to
+	// spread request load across S3 partitions, if set to the zero value
+	// then keys are not changed
+	ShardPrefix int
+
+	// Optionally specify that the sources should be listed, and their keys
+	// checked, before any are uploaded, failing the run if any keys are
+	// invalid or if more than one source maps to the same key
+	CheckKeys bool
+
+	// Optionally specify that keys differing only by case should be
+	// reported, as they would collide if the bucket were copied to a
+	// case-insensitive filesystem
+	CheckCase bool
+
+	// Optionally specify how strictly object key names are validated, by
+	// default only keys that S3 will not accept are rejected
+	KeyCheck keyCheck
+
+	// Optionally specify how keys longer than MaxKeyLength are handled, by
+	// default they are rejected
+	TruncateKeys keyTruncation
+
+	// Optionally specify which characters in key names are percent-encoded,
+	// by default none are
+	KeyEncoding keyEncoding
+
+	// Optionally specify characters to replace in key names, before they
+	// are encoded or validated, as <char>=<replacement>
+	KeyReplace []string
+
+	// Optionally specify a command, run using the shell for the whole of
+	// the run, that maps the source and key of each object to the key it
+	// is uploaded to (see mapKeys)
+	KeyMapper string
+
+	// Optionally specify a CSV or JSON lines file listing the sources to
+	// upload, with optional per-row overrides, instead of using globs
+	Jobs string
+
 	// Required S3 Bucket identifier
 	bucket string
 
@@ -125,6 +637,12 @@ type Options struct {
 	// processGlobs
 	globs []string
 
+	// Optional ObjectOptions for each of the globs, set using -set
+	globOpts []*ObjectOptions
+
+	// resume holds the pending uploads read from the Resume state file
+	resume *resumeUploads
+
 	// s3 manages whether or not a single s3.Client is shared across all
 	// goroutines
 	s3 *S3ClientPool
@@ -132,4 +650,70 @@ type Options struct {
 	// partBuf manages the in-memory PartSize buffer pool, if one was set
 	// up per the UseMemoryBuffers options
 	partBuf BufferPool
+
+	// smallBuf manages the SmallObjectSize buffer pool used by the small
+	// object fast path, if SmallObjectSize was set
+	smallBuf BufferPool
+
+	// probeBuf manages the ProbeSize buffer pool, if ProbeSize was set
+	probeBuf BufferPool
+
+	// bwlimit limits the rate at which request bodies are sent, if one was
+	// set up per the BandwidthLimit option
+	bwlimit *BandwidthLimiter
+
+	// retryBudget aborts the run when too many requests fail, if one was
+	// set up per the RetryBudget option
+	retryBudget *RetryBudget
+
+	// resolver resolves host names for connections to S3, if one was set
+	// up per the Resolve or DNSCache options
+	resolver *Resolver
+
+	// keyReplacer replaces characters in key names per the KeyReplace
+	// option
+	keyReplacer keyReplacer
+
+	// splitKey generates the keys of the objects split from standard
+	// input per the SplitSize option
+	splitKey *splitKeyTemplate
+
+	// storageRules select the storage class of objects, if loaded per the
+	// StorageRules option
+	storageRules StorageRules
+
+	// snapshot of the working directory globs are read from, if one was
+	// taken per the SnapshotCmd option
+	snapshot *snapshot
+
+	// prices used to estimate costs with DryRun
+	prices PriceTable
+
+	// dedupe records the content of uploaded objects, if requested by
+	// DedupeDB
+	dedupe *DedupeDB
+
+	// runMetadata records the provenance of the run for the json Manifest
+	runMetadata *RunMetadata
+
+	// summary of the run, if requested by SummaryOut
+	summary *RunSummary
+
+	// stats written to StatsFD, if requested
+	stats *StatsStream
+
+	// objOpt holds the ObjectOptions applied to every object, unless
+	// overridden for an individual object
+	objOpt *ObjectOptions
+
+	// partBudget limits the number of concurrent UploadPart requests across
+	// all objects, if one was set up per the DynamicParts option
+	partBudget *PartScheduler
+}
+
+// contactsBucket returns true if the run sends requests to the -bucket, i.e.,
+// a bucket was specified and neither ChecksumOnly nor DryRun is set, so that
+// the checks and probes made before the first upload apply.
+func (p *Options) contactsBucket() bool {
+	return !p.ChecksumOnly && !p.DryRun && p.bucket != ""
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+var errBadRetries = errors.New(
+	"-retries and -retry-backoff must not be negative")
+
+// retryablePartError returns true if err, returned when uploading a part,
+// suggests that uploading it again may succeed, i.e., the request was
+// throttled (503 SlowDown), failed with a server error, or the connection
+// failed or was reset.
+func retryablePartError(err error) bool {
+	switch code := preflightStatusCode(err); {
+	case code >= 500, code == http.StatusTooManyRequests:
+		return true
+	case code != 0:
+		return false
+	}
+
+	var rse *smithyhttp.RequestSendError
+	return errors.As(err, &rse) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// rewindPart seeks the body of part back to its start so that it may be sent
+// again, returning false if it cannot be, e.g., a part streamed with
+// -stream-parts.
+func rewindPart(part *s3.UploadPartInput) bool {
+	if _, ok := part.Body.(*streamPart); ok {
+		return false
+	}
+
+	seeker, ok := part.Body.(io.Seeker)
+	if !ok {
+		return false
+	}
+
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+// retryWait returns the time to wait before a retry with the given backoff,
+// jittered to between half and all of it so that parts failed together are
+// not all retried at once.
+func retryWait(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+
+	return backoff/2 + rand.N(backoff/2+1)
+}
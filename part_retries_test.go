@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Validate parts failed transiently are retried up to -retries times, and the
+// retries are recorded for the manifest
+func TestUploadPartRetries(t *testing.T) {
+	const partSize = 64
+
+	data := make([]byte, partSize*3)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	for i, tst := range []struct {
+		status  int
+		fails   int
+		retries int
+		expect  int
+		failed  bool
+	}{
+		{http.StatusServiceUnavailable, 2, 3, 2, false},
+		{http.StatusInternalServerError, 1, 3, 1, false},
+		{http.StatusServiceUnavailable, 2, 1, 1, true},
+		{http.StatusForbidden, 1, 3, 0, true},
+		{http.StatusServiceUnavailable, 0, 3, 0, false},
+	} {
+		var mu sync.Mutex
+		fails := tst.fails
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPut && query.Get("partNumber") == "2":
+				mu.Lock()
+				fail := fails > 0
+				fails -= 1
+				mu.Unlock()
+
+				if fail {
+					w.WriteHeader(tst.status)
+					fmt.Fprint(w, `<Error><Code>SlowDown</Code></Error>`)
+					return
+				}
+				w.Header().Set("ETag", `"etag"`)
+			case r.Method == http.MethodPut:
+				w.Header().Set("ETag", `"etag"`)
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			}
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.Retries = tst.retries
+		opts.RetryBackoff = time.Millisecond
+
+		// leave retrying to s3up
+		opts.s3 = NewS3ClientPool(true, aws.Config{
+			Region:      "us-east-1",
+			Credentials: aws.AnonymousCredentials{},
+		}, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(srv.URL)
+			o.UsePathStyle = true
+			o.RetryMaxAttempts = 1
+		})
+
+		uploader := NewUploader(context.Background(), opts)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if failed := res.Error != nil; failed != tst.failed {
+			t.Errorf("%d expected failed %t, got %v", i, tst.failed, res.Error)
+		}
+
+		obj, err := NewObjectReporting(res.State)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		var actual int
+		for _, pr := range obj.PartRetries {
+			if pr.PartNumber != 2 {
+				t.Errorf("%d expected only part 2 to be retried, got part %d", i, pr.PartNumber)
+			}
+			actual = pr.Retries
+		}
+		if actual != tst.expect {
+			t.Errorf("%d expected %d retries, got %d", i, tst.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// PartScheduler limits the number of UploadPart requests in flight across all
+// objects.  When every slot is in use, slots are granted to objects in turn
+// (round-robin) rather than in the order requests arrive, so that an object
+// with many parts queued cannot hold back the other objects in flight.  This
+// lets smaller objects complete, and become available to downstream
+// consumers, while larger objects are still being uploaded.
+type PartScheduler struct {
+	mu *sync.Mutex
+
+	// size is the number of slots, and inflight the number in use
+	size     int
+	inflight int
+
+	// queues holds the waiting requests per stream, and order holds the
+	// round-robin order of streams with waiting requests
+	queues map[*PartStream][]*partWaiter
+	order  []*PartStream
+}
+
+// partWaiter is a request for a slot, granted is closed once it is granted.
+type partWaiter struct {
+	granted  chan struct{}
+	canceled bool
+}
+
+// NewPartScheduler initializes a new PartScheduler allowing size concurrent
+// UploadPart requests.
+func NewPartScheduler(size int) *PartScheduler {
+	return &PartScheduler{
+		mu:     &sync.Mutex{},
+		size:   size,
+		queues: map[*PartStream][]*partWaiter{},
+	}
+}
+
+// Size returns the number of concurrent UploadPart requests allowed.
+func (p *PartScheduler) Size() int {
+	return p.size
+}
+
+// Stream returns a new PartStream, used to request slots for the parts of a
+// single object.
+func (p *PartScheduler) Stream() *PartStream {
+	return &PartStream{sched: p}
+}
+
+// enqueue returns a partWaiter for stream s, which has already been granted
+// if a slot was free and no other requests were waiting.
+func (p *PartScheduler) enqueue(s *PartStream) *partWaiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := &partWaiter{
+		granted: make(chan struct{}),
+	}
+
+	if p.inflight < p.size && len(p.order) == 0 {
+		p.inflight += 1
+		close(w.granted)
+		return w
+	}
+
+	if _, ok := p.queues[s]; !ok {
+		p.order = append(p.order, s)
+	}
+	p.queues[s] = append(p.queues[s], w)
+
+	return w
+}
+
+// release returns a slot, and grants it to the next waiting request.
+func (p *PartScheduler) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inflight -= 1
+	p.grant()
+}
+
+// grant grants free slots to waiting requests, taking the next request from
+// each stream in turn.  The caller must hold p.mu.
+func (p *PartScheduler) grant() {
+	for p.inflight < p.size && len(p.order) > 0 {
+		s := p.order[0]
+		p.order = p.order[1:]
+
+		q := p.queues[s]
+
+		var w *partWaiter
+		for w == nil && len(q) > 0 {
+			w, q = q[0], q[1:]
+			if w.canceled {
+				w = nil
+			}
+		}
+
+		if len(q) == 0 {
+			delete(p.queues, s)
+		} else {
+			// more waiting requests, go to the back of the line
+			p.queues[s] = q
+			p.order = append(p.order, s)
+		}
+
+		if w != nil {
+			p.inflight += 1
+			close(w.granted)
+		}
+	}
+}
+
+// PartStream requests slots from a PartScheduler for the parts of a single
+// object.
+type PartStream struct {
+	sched *PartScheduler
+}
+
+// Acquire blocks until a slot is granted or the context is canceled.  Each
+// successful call to Acquire must be followed by a call to Release.
+func (s *PartStream) Acquire(ctx context.Context) error {
+	w := s.sched.enqueue(s)
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.sched.mu.Lock()
+	defer s.sched.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		// granted while canceling, return the slot
+		s.sched.inflight -= 1
+		s.sched.grant()
+	default:
+		w.canceled = true
+	}
+
+	return context.Cause(ctx)
+}
+
+// Release returns a slot acquired using Acquire.
+func (s *PartStream) Release() {
+	s.sched.release()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// Validate that slots are granted to streams in turn
+func TestPartSchedulerRoundRobin(t *testing.T) {
+	sched := NewPartScheduler(1)
+
+	a := sched.Stream()
+	b := sched.Stream()
+	c := sched.Stream()
+
+	// the first request is granted immediately
+	first := sched.enqueue(a)
+	select {
+	case <-first.granted:
+	default:
+		t.Fatalf("expected first request to be granted")
+	}
+
+	// a queues three parts before b and c queue one each
+	waiters := []*partWaiter{
+		sched.enqueue(a), sched.enqueue(a), sched.enqueue(a),
+		sched.enqueue(b), sched.enqueue(c),
+	}
+	names := []string{"a1", "a2", "a3", "b1", "c1"}
+
+	var order []string
+	seen := make([]bool, len(waiters))
+
+	for range waiters {
+		sched.release()
+
+		granted := 0
+		for i, w := range waiters {
+			select {
+			case <-w.granted:
+				if !seen[i] {
+					seen[i] = true
+					granted += 1
+					order = append(order, names[i])
+				}
+			default:
+			}
+		}
+
+		if granted != 1 {
+			t.Fatalf("expected 1 request granted per release, got %d", granted)
+		}
+	}
+
+	expect := []string{"a1", "b1", "c1", "a2", "a3"}
+	for i := range expect {
+		if order[i] != expect[i] {
+			t.Errorf("expected grant order %v got %v", expect, order)
+			break
+		}
+	}
+}
+
+// Validate that a canceled request does not hold a slot
+func TestPartSchedulerCancel(t *testing.T) {
+	sched := NewPartScheduler(1)
+
+	a := sched.Stream()
+	b := sched.Stream()
+
+	if err := a.Acquire(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := b.Acquire(ctx); err == nil {
+		t.Fatalf("expected canceled acquire to fail")
+	}
+
+	a.Release()
+
+	if err := b.Acquire(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b.Release()
+
+	if sched.inflight != 0 {
+		t.Errorf("expected 0 in flight, got %d", sched.inflight)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// longPath returns name unchanged, paths are only limited in length on Windows.
+func longPath(name string) string {
+	return name
+}
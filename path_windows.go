@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length limit on paths imposed by the Win32 API, unless the
+// path uses the \\?\ prefix
+const maxPath = 260
+
+// longPath returns name as an absolute path with the \\?\ prefix if it is too
+// long to be opened otherwise, and name unchanged if not.  UNC paths, e.g.,
+// \\server\share\..., use the \\?\UNC\ prefix.
+func longPath(name string) string {
+	if len(name) < maxPath || strings.HasPrefix(name, `\\?\`) {
+		return name
+	}
+
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+
+	return `\\?\` + abs
+}
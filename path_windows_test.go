@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyPathWindows(t *testing.T) {
+	for i, tst := range []struct {
+		name   string
+		expect string
+	}{
+		{`data\x.txt`, "data/x.txt"},
+		{`C:\data\x.txt`, "data/x.txt"},
+		{`C:data\x.txt`, "data/x.txt"},
+		{`\\server\share\data\x.txt`, "data/x.txt"},
+		{`\\?\C:\data\x.txt`, "data/x.txt"},
+	} {
+		if actual := keyPath(tst.name); actual != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, actual)
+		}
+	}
+}
+
+func TestLongPathWindows(t *testing.T) {
+	short := `C:\data\x.txt`
+	if actual := longPath(short); actual != short {
+		t.Errorf("expected %s got %s", short, actual)
+	}
+
+	long := `C:\` + strings.Repeat(`x\`, maxPath)
+	if actual := longPath(long); !strings.HasPrefix(actual, `\\?\C:\`) {
+		t.Errorf("expected \\\\?\\ prefix, got %s", actual)
+	}
+
+	unc := `\\server\share\` + strings.Repeat(`x\`, maxPath)
+	if actual := longPath(unc); !strings.HasPrefix(actual, `\\?\UNC\server\share\`) {
+		t.Errorf("expected \\\\?\\UNC\\ prefix, got %s", actual)
+	}
+}
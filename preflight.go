@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrPreflight is returned when the destination bucket fails a preflight check
+var ErrPreflight = errors.New("preflight check failed")
+
+// preflight checks that the Bucket exists and that the configured credentials
+// and region are able to access it, using HeadBucket.  If the bucket does not
+// exist and Options.CreateBucket is set then it is created.  If write is true then
+// an empty probe object is also uploaded next to Key and then deleted, to
+// validate write permission.  Errors wrap ErrPreflight and describe the likely
+// cause.
+func preflight(ctx context.Context, Bucket, Key string, write bool, opts *Options) error {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	if opts.Verbose {
+		log.Printf("checking access to bucket %s", Bucket)
+	}
+
+	_, err := s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: &Bucket,
+	})
+	if err != nil && opts.CreateBucket && preflightStatusCode(err) == http.StatusNotFound {
+		err = createBucket(ctx, s3client, Bucket, opts)
+		if err != nil {
+			return preflightError(Bucket, "CreateBucket", err)
+		}
+	} else if err != nil {
+		return preflightError(Bucket, "HeadBucket", err)
+	}
+
+	if !write {
+		return nil
+	}
+
+	probe := preflightProbeKey(Key)
+
+	if opts.Verbose {
+		log.Printf("checking write access to bucket %s using %s", Bucket, probe)
+	}
+
+	_, err = s3client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &Bucket,
+		Key:    &probe,
+		Body:   bytes.NewReader([]byte{}),
+	})
+	if err != nil {
+		return preflightError(Bucket, "PutObject", err)
+	}
+
+	_, err = s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &Bucket,
+		Key:    &probe,
+	})
+	if err != nil {
+		return preflightError(Bucket, "DeleteObject", err)
+	}
+
+	return nil
+}
+
+// preflightProbeKey returns the key name to use for a write probe, placed
+// under the Key prefix (or next to a non-prefix Key).
+func preflightProbeKey(Key string) string {
+	prefix := Key
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = path.Dir(prefix)
+	}
+
+	name := ".s3up-preflight-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	if prefix == "." || prefix == "/" {
+		return name
+	}
+
+	return path.Join(prefix, name)
+}
+
+// preflightError wraps an error returned by the operation op with
+// ErrPreflight and a description of its likely cause.
+func preflightError(Bucket, op string, err error) error {
+	var reason string
+
+	switch preflightStatusCode(err) {
+	case http.StatusNotFound:
+		reason = "bucket does not exist"
+	case http.StatusForbidden:
+		reason = "access denied, check the credentials and bucket permissions"
+	case http.StatusMovedPermanently:
+		reason = "bucket is in a different region than configured"
+	case 0:
+		reason = "unable to contact the endpoint"
+	default:
+		reason = "unexpected response"
+	}
+
+	return fmt.Errorf("%w: %s: %s %s: %w", ErrPreflight, Bucket, op, reason, err)
+}
+
+// preflightStatusCode returns the HTTP status code of the response that
+// produced err, or 0 if there was no response.
+func preflightStatusCode(err error) int {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode()
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreflightProbeKey(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		prefix string
+	}{
+		{"", ".s3up-preflight-"},
+		{"a/", "a/.s3up-preflight-"},
+		{"a/b/", "a/b/.s3up-preflight-"},
+		{"a/b/file.dat", "a/b/.s3up-preflight-"},
+		{"file.dat", ".s3up-preflight-"},
+	} {
+		actual := preflightProbeKey(tst.key)
+		if !strings.HasPrefix(actual, tst.prefix) {
+			t.Errorf("%d expected prefix %s got %s", i, tst.prefix, actual)
+		}
+	}
+}
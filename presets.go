@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var errBadPreset = errors.New("unknown -preset")
+
+// Preset records the defaults used by another tool, so that objects uploaded
+// by s3up are split into the same parts (and so have comparable ETags) as
+// objects previously uploaded by that tool.  Objects no larger than
+// MultipartThreshold are uploaded in a single request, as that tool would.
+type Preset struct {
+	// Name used to select the preset with -preset
+	Name string
+
+	// Size of each part of a multi-part upload
+	PartSize int64
+
+	// Size above which objects are uploaded using a multi-part upload
+	MultipartThreshold int64
+
+	// Number of concurrent part uploads per object
+	ConcurrentParts int
+}
+
+// Presets lists the available presets by name.
+var Presets = []*Preset{
+	// multipart_threshold, multipart_chunksize: 8MB,
+	// max_concurrent_requests: 10
+	{Name: "awscli", PartSize: 8 * 1024 * 1024, MultipartThreshold: 8 * 1024 * 1024, ConcurrentParts: 10},
+
+	// boto3 TransferConfig shares the aws cli defaults
+	{Name: "boto3", PartSize: 8 * 1024 * 1024, MultipartThreshold: 8 * 1024 * 1024, ConcurrentParts: 10},
+
+	// --s3-chunk-size: 5MiB, --s3-upload-cutoff: 200MiB,
+	// --s3-upload-concurrency: 4
+	{Name: "rclone", PartSize: 5 * 1024 * 1024, MultipartThreshold: 200 * 1024 * 1024, ConcurrentParts: 4},
+
+	// multipart_chunk_size_mb: 15, parts are uploaded sequentially
+	{Name: "s3cmd", PartSize: 15 * 1024 * 1024, MultipartThreshold: 15 * 1024 * 1024, ConcurrentParts: 1},
+
+	// the s3up defaults
+	{Name: "s3up", PartSize: DefaultPartSize, MultipartThreshold: DefaultPartSize, ConcurrentParts: 1},
+}
+
+// presetNames returns the names of the available Presets.
+func presetNames() []string {
+	var names []string
+	for _, p := range Presets {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// lookupPreset returns the Preset with the given name.
+func lookupPreset(name string) (*Preset, error) {
+	i := slices.IndexFunc(Presets, func(p *Preset) bool {
+		return strings.EqualFold(p.Name, name)
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s (valid presets: %s)",
+			errBadPreset, name, strings.Join(presetNames(), ", "))
+	}
+	return Presets[i], nil
+}
+
+// apply sets the -part-size, -multipart-threshold, and -concurrent-parts
+// flags of flags to the values of the preset, unless they were explicitly set
+// on the command line.  An explicit -part-size larger than the threshold of
+// the preset is also used as the threshold.
+func (p *Preset) apply(flags *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if partSize, ok := flags.Lookup("part-size").Value.(*ByteSize); ok && explicit["part-size"] {
+		explicit["multipart-threshold"] = explicit["multipart-threshold"] ||
+			int64(*partSize) > p.MultipartThreshold
+	}
+
+	for name, value := range map[string]string{
+		"part-size":           fmt.Sprintf("%d", p.PartSize),
+		"multipart-threshold": fmt.Sprintf("%d", p.MultipartThreshold),
+		"concurrent-parts":    fmt.Sprintf("%d", p.ConcurrentParts),
+	} {
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+)
+
+func TestPresetApply(t *testing.T) {
+	const MiB = 1024 * 1024
+
+	for i, tst := range []struct {
+		preset          string
+		args            []string
+		partSize        ByteSize
+		threshold       ByteSize
+		concurrentParts int
+	}{
+		{"AWSCLI", []string{}, 8 * MiB, 8 * MiB, 10},
+		{"AWSCLI", []string{"-part-size", "16MiB"}, 16 * MiB, 0, 10},
+		{"AWSCLI", []string{"-concurrent-parts", "2"}, 8 * MiB, 8 * MiB, 2},
+		{"rclone", []string{}, 5 * MiB, 200 * MiB, 4},
+		{"rclone", []string{"-part-size", "16MiB"}, 16 * MiB, 200 * MiB, 4},
+		{"rclone", []string{"-multipart-threshold", "64MiB"}, 5 * MiB, 64 * MiB, 4},
+	} {
+		var partSize ByteSize
+		var threshold ByteSize
+		var concurrentParts int
+
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Var(&partSize, "part-size", "")
+		flags.Var(&threshold, "multipart-threshold", "")
+		flags.IntVar(&concurrentParts, "concurrent-parts", 1, "")
+
+		if err := flags.Parse(tst.args); err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		preset, err := lookupPreset(tst.preset)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if err := preset.apply(flags); err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if partSize != tst.partSize || threshold != tst.threshold || concurrentParts != tst.concurrentParts {
+			t.Errorf("%d expected %d, %d, %d got %d, %d, %d", i,
+				tst.partSize, tst.threshold, tst.concurrentParts, partSize, threshold, concurrentParts)
+		}
+	}
+
+	if _, err := lookupPreset("unknown"); !errors.Is(err, errBadPreset) {
+		t.Errorf("expected errBadPreset got %v", err)
+	}
+}
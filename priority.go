@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"reflect"
+	"slices"
+)
+
+// processPriorityGlobs processes Options.globs using processGlobs, with the
+// globs grouped by the priority set for them (see -priority).  Each group is
+// processed concurrently, and an object from a higher priority group is
+// returned ahead of those from lower priority groups whenever one is ready.
+func processPriorityGlobs(ctx context.Context, opts *Options) (chan *uploadObject, error) {
+	priorities := []int{}
+	for i := range opts.globs {
+		if p := globPriority(opts.globOpts, i); !slices.Contains(priorities, p) {
+			priorities = append(priorities, p)
+		}
+	}
+
+	// no need to group globs with the same priority
+	if len(priorities) < 2 {
+		return processGlobs(ctx, opts.globs, opts.globOpts, opts.storageRules,
+			opts.snapshot, opts.bucket, opts.key, opts.Recursive, opts.Verbose)
+	}
+
+	slices.SortFunc(priorities, func(a, b int) int {
+		return cmp.Compare(b, a)
+	})
+
+	chs := []chan *uploadObject{}
+
+	for _, priority := range priorities {
+		var globs []string
+		var globOpts []*ObjectOptions
+
+		for i := range opts.globs {
+			if globPriority(opts.globOpts, i) == priority {
+				globs = append(globs, opts.globs[i])
+				globOpts = append(globOpts, opts.globOpts[i])
+			}
+		}
+
+		ch, err := processGlobs(ctx, globs, globOpts, opts.storageRules,
+			opts.snapshot, opts.bucket, opts.key, opts.Recursive, opts.Verbose)
+		if err != nil {
+			return nil, err
+		}
+
+		chs = append(chs, ch)
+	}
+
+	return mergePriority(chs), nil
+}
+
+// globPriority returns the priority set for glob i, or 0 if none was set.
+func globPriority(globOpts []*ObjectOptions, i int) int {
+	if i < len(globOpts) && globOpts[i] != nil {
+		return globOpts[i].Priority
+	}
+	return 0
+}
+
+// mergePriority returns the objects received from chs, which are ordered from
+// highest to lowest priority, via the returned channel.  Whenever objects are
+// ready on more than one channel the object from the highest priority channel
+// is returned first.  The returned channel is closed once all of chs have been
+// closed.
+func mergePriority(chs []chan *uploadObject) chan *uploadObject {
+	out := make(chan *uploadObject)
+
+	go func() {
+		defer close(out)
+
+		for len(chs) > 0 {
+			i, obj, ok := recvPriority(chs)
+			if !ok {
+				chs = slices.Delete(chs, i, i+1)
+				continue
+			}
+
+			out <- obj
+		}
+	}()
+
+	return out
+}
+
+// recvPriority receives from the first of chs that is ready, blocking until
+// one of them is.  It returns the index of the channel received from, and
+// whether a value was received (false if the channel was closed).
+func recvPriority(chs []chan *uploadObject) (int, *uploadObject, bool) {
+	for i, ch := range chs {
+		select {
+		case obj, ok := <-ch:
+			return i, obj, ok
+		default:
+		}
+	}
+
+	cases := make([]reflect.SelectCase, len(chs))
+	for i, ch := range chs {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ch),
+		}
+	}
+
+	i, v, ok := reflect.Select(cases)
+	if !ok {
+		return i, nil, false
+	}
+
+	return i, v.Interface().(*uploadObject), true
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+// Validate that ready objects from higher priority channels are returned first
+func TestMergePriority(t *testing.T) {
+	high := make(chan *uploadObject, 2)
+	low := make(chan *uploadObject, 3)
+
+	for _, key := range []string{"low1", "low2", "low3"} {
+		low <- &uploadObject{key: key}
+	}
+	close(low)
+
+	for _, key := range []string{"high1", "high2"} {
+		high <- &uploadObject{key: key}
+	}
+	close(high)
+
+	var keys []string
+	for obj := range mergePriority([]chan *uploadObject{high, low}) {
+		keys = append(keys, obj.key)
+	}
+
+	expect := []string{"high1", "high2", "low1", "low2", "low3"}
+	if len(keys) != len(expect) {
+		t.Fatalf("expected %v got %v", expect, keys)
+	}
+	for i := range expect {
+		if keys[i] != expect[i] {
+			t.Errorf("%d expected %s got %s", i, expect[i], keys[i])
+		}
+	}
+}
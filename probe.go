@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime/trace"
+)
+
+var errBadProbeSize = errors.New(
+	"-probe-size must not be larger than -part-size")
+
+// probeReader returns the bytes read by probe followed by the rest of the
+// underlying io.Reader, closing it returns the probe buffer to its pool.
+type probeReader struct {
+	io.Reader
+
+	bp  BufferPool
+	buf []byte
+}
+
+func (p *probeReader) Close() error {
+	if p.buf != nil {
+		p.bp.Put(p.buf)
+		p.buf = nil
+	}
+	return nil
+}
+
+// probe reads up to Options.ProbeSize bytes of r, a source of unknown size,
+// to choose between putObject and a multi-part upload without buffering a
+// full part and reading ahead the next.  If r ends within the probe it is
+// hashed by s3hw and uploaded using putObject, returning its state.
+// Otherwise a probeReader is returned in place of r, which the caller must
+// close once the upload is done, and the object is uploaded as a multi-part
+// object.
+func (p *Uploader) probe(ctx context.Context, r io.Reader, Bucket, Key string, objOpt *ObjectOptions, s3hw *S3HashWriter) (*S3UploadState, *probeReader, error) {
+	bp := p.opts.probeBuf
+	buf := bp.Get(int64(p.opts.ProbeSize))
+
+	region := trace.StartRegion(ctx, "probe")
+	n, err := io.ReadFull(r, buf)
+	region.End()
+
+	switch {
+	case err == nil:
+		pr := &probeReader{
+			Reader: io.MultiReader(bytes.NewReader(buf), r),
+			bp:     bp,
+			buf:    buf,
+		}
+		return nil, pr, nil
+	case !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF):
+		bp.Put(buf)
+		return nil, nil, err
+	}
+
+	// r ended within the probe
+	rc := &memBuffer{
+		bp: bp,
+		b:  buf,
+		r:  bytes.NewReader(buf[0:n]),
+	}
+
+	sr := &SourceReader{
+		SectionReader: io.NewSectionReader(rc, 0, int64(n)),
+		closer:        rc.Close,
+	}
+
+	region = trace.StartRegion(ctx, "hash")
+	s3hw.Write(buf[0:n])
+	region.End()
+
+	if p.opts.SniffMediaTypes {
+		if objOpt, err = objOpt.sniffMediaType(Key, sr); err != nil {
+			sr.Close()
+			return nil, nil, err
+		}
+	}
+
+	st, err := putObject(ctx, sr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
+	return st, nil, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Validate streams are uploaded using PutObject if they end within
+// -probe-size or the first part, and as multi-part objects otherwise
+func TestUploadProbe(t *testing.T) {
+	const partSize = 64
+
+	for i, tst := range []struct {
+		size   int
+		probe  ByteSize
+		expect []string
+	}{
+		{partSize, 0, []string{"put"}},
+		{partSize / 2, partSize / 4, []string{"put"}},
+		{partSize / 8, partSize / 4, []string{"put"}},
+		{0, partSize / 4, []string{"put"}},
+		{partSize, partSize / 4, []string{"create", "part 1", "complete"}},
+		{partSize + 1, partSize / 4, []string{"create", "part 1", "part 2", "complete"}},
+	} {
+		var mu sync.Mutex
+		var requests []string
+		var body string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			w.Header().Set("ETag", `"etag"`)
+
+			mu.Lock()
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				requests = append(requests, "create")
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPut && query.Has("partNumber"):
+				requests = append(requests, "part "+query.Get("partNumber"))
+			case r.Method == http.MethodPut:
+				requests = append(requests, "put")
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				requests = append(requests, "complete")
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			}
+			mu.Unlock()
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.ProbeSize = tst.probe
+		if tst.probe > 0 {
+			opts.probeBuf = NewBufferPool(int64(tst.probe))
+		}
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := make([]byte, tst.size)
+		for j := range data {
+			data[j] = byte('a' + j%26)
+		}
+
+		// a stream of unknown size
+		r := io.MultiReader(bytes.NewReader(data))
+
+		res := <-uploader.Upload(context.Background(), r, "bucket", "key", nil)
+		srv.Close()
+
+		if res.Error != nil {
+			t.Errorf("%d unexpected error: %s", i, res.Error)
+		}
+
+		// parts may be uploaded in either order
+		slices.Sort(requests)
+		slices.Sort(tst.expect)
+
+		if !slices.Equal(requests, tst.expect) {
+			t.Errorf("%d expected %v, got %v", i, tst.expect, requests)
+		}
+
+		if slices.Contains(requests, "put") && body != string(data) {
+			t.Errorf("%d expected body %q, got %q", i, data, body)
+		}
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var errMissingBucket = errors.New(
@@ -19,9 +23,70 @@ var errMissingBucket = errors.New(
 var errBadChecksum = errors.New(
 	"-checksum must be one of SHA256, SHA1, CRC32C, or CRC32")
 
+var errBadExtraChecksum = errors.New(
+	"-extra-checksums must be a list of SHA512, BLAKE3, or XXHASH")
+
+var errBadGoMaxProcs = errors.New(
+	"-gomaxprocs must be >= 0")
+
+var errBadMemoryLimit = errors.New(
+	"-memory-limit must be >= 0")
+
 var errBadPartSize = errors.New(
 	"-part-size must be >= 5MiB and <= 5GiB")
 
+var errBadMultipartThreshold = errors.New(
+	"-multipart-threshold must be >= -part-size and <= 5GiB")
+
+var errEndpointOptions = errors.New(
+	"-use-dualstack and -use-fips cannot be combined with -endpoint")
+
+var errConfiguredEndpointOptions = errors.New(
+	"-use-dualstack and -use-fips cannot be combined with an endpoint configured by AWS_ENDPOINT_URL or endpoint_url")
+
+var errKMSKeyWithoutKMS = errors.New(
+	"-sse-kms-key-id requires -sse aws:kms or aws:kms:dsse")
+
+var errBadStartPart = errors.New(
+	"-start-part must be between 1 and 10000")
+
+var errUploadIDKey = errors.New(
+	"-upload-id requires a non-prefix -key and cannot be combined with -jobs")
+
+var errUploadIDEmpty = errors.New(
+	"-upload-id requires a source that is not empty")
+
+var errBadAttributesMaxParts = errors.New(
+	"-object-attributes-max-parts must be between 1 and 10000")
+
+var errBadAttributesRetries = errors.New(
+	"-object-attributes-retries must be >= 0")
+
+var errContentMD5Options = errors.New(
+	"-require-content-md5 cannot be combined with -stream-parts, -sse aws:kms or -sse-c-key")
+
+var errBadRetryBudget = errors.New(
+	"-retry-budget must be between 0 and 1")
+
+// checkUploadID returns errUploadIDKey if Options.UploadID is set but the
+// sources may not all be uploaded to the single object it was created for, or
+// errRangeWithoutUploadID if a range of the source is to be uploaded without
+// it.
+func checkUploadID(opts *Options) error {
+	if opts.UploadID == "" {
+		if opts.RangeOffset > 0 || opts.RangeLength > 0 {
+			return errRangeWithoutUploadID
+		}
+		return nil
+	}
+
+	if opts.key == "" || strings.HasSuffix(opts.key, "/") || opts.Jobs != "" {
+		return errUploadIDKey
+	}
+
+	return nil
+}
+
 // processFlags processes the os.Argv[1:] command line options, parsing flags
 // and trailing arguments.
 func processFlags(ctx context.Context, args []string) (*Options, error) {
@@ -35,19 +100,74 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 		"optionally specify a cpu profile output path")
 	flags.StringVar(&opts.MemProfile, "mem-profile", "",
 		"optionally specify a memory profile output path")
+	flags.DurationVar(&opts.MemProfileInterval, "mem-profile-interval", 0,
+		"optionally write numbered memory profiles at this interval during the run, e.g., 10m")
 	flags.StringVar(&opts.Trace, "trace", "",
 		"optionally specify a trace output file path")
+	flags.IntVar(&opts.GoMaxProcs, "gomaxprocs", 0,
+		"optionally limit the number of CPUs executing simultaneously")
+	flags.Var(&opts.MemoryLimit, "memory-limit",
+		"optionally set a soft memory limit for the Go runtime, e.g., 4GiB")
 
 	flags.BoolVar(&opts.Verbose, "verbose", false,
 		"optionally enable verbose logging to standard error")
 
 	flags.StringVar(&opts.MediaTypes, "media-types", "",
-		"optionally specify a path to a TSV listing extension to media-type mappings")
+		"optionally specify a path to a TSV or mime.types file listing extension to media-type mappings")
+	flags.StringVar(&opts.ContentType, "content-type", "",
+		"optionally specify the content-type to use for all objects")
+	flags.StringVar(&opts.LifecycleTag, "lifecycle-tag", "",
+		"optionally specify a key=value tag to set on all objects for bucket lifecycle rules")
+	var metadata []string
+	flags.Func("metadata",
+		"optionally specify key=value user-defined metadata to set on all objects, may be repeated",
+		func(s string) error {
+			metadata = append(metadata, s)
+			return nil
+		})
+	flags.StringVar(&opts.MetadataSidecar, "metadata-sidecar", "",
+		"optionally read metadata for each file from the JSON file named by the file name with this suffix, e.g., .meta.json")
+	flags.StringVar(&opts.RunID, "run-id", "",
+		"optionally specify an identifier for the run to store in the metadata of every object (default: generated)")
+	flags.BoolVar(&opts.SniffMediaTypes, "sniff-media-types", false,
+		"optionally detect the media-type from the content when the extension is not recognized")
+
+	flags.StringVar(&opts.StorageRules, "storage-rules", "",
+		"optionally specify a file of rules selecting storage classes by name, size, and age")
+
+	flags.StringVar(&opts.SSE, "sse", "",
+		"optionally specify server-side encryption: AES256, aws:kms, aws:kms:dsse")
+	flags.StringVar(&opts.SSEKMSKeyId, "sse-kms-key-id", "",
+		"optionally specify the KMS key id or ARN to use with -sse aws:kms")
+	flags.StringVar(&opts.SSECustomerKey, "sse-c-key", "",
+		"optionally specify a file holding a 256-bit key to encrypt objects with using SSE-C")
+	flags.BoolVar(&opts.DisableKMSPreflight, "disable-kms-preflight", false,
+		"disable checking KMS permissions with a probe upload when using -sse aws:kms")
 
 	flags.BoolVar(&opts.UseMemoryBuffers, "use-memory", false,
 		"optionally specify that memory buffers should be used instead of temporary files")
 	flags.StringVar(&opts.UseTempDir, "use-temp-dir", "",
 		"optionally specify a directory to use when creating temporary files")
+	flags.BoolVar(&opts.StreamParts, "stream-parts", false,
+		"optionally upload the parts of a stream while they are read, with trailing checksums")
+	flags.BoolVar(&opts.VerifyBuffers, "verify-buffers", false,
+		"optionally re-hash parts buffered in temporary files before uploading them")
+	flags.IntVar(&opts.ReuploadModified, "reupload-modified", 0,
+		"optionally re-upload objects whose source file changes during the upload up to this many times")
+	flags.BoolVar(&opts.DeleteSource, "delete-source", false,
+		"optionally remove each local file once its object is completed and the checksum verified")
+	flags.StringVar(&opts.ArchiveSourceTo, "archive-source-to", "",
+		"optionally move each local file under this directory once its object is completed and the checksum verified")
+	flags.BoolVar(&opts.TruncateSource, "truncate-source", false,
+		"optionally truncate each local file to zero length once its object is completed and the checksum verified")
+	flags.StringVar(&opts.SnapshotCmd, "snapshot-cmd", "",
+		"optionally specify a command creating a snapshot of the working directory to read globs from")
+	flags.StringVar(&opts.SnapshotCleanupCmd, "snapshot-cleanup-cmd", "",
+		"optionally specify a command removing the snapshot once the run has finished")
+	flags.BoolVar(&opts.Flock, "flock", false,
+		"optionally hold a shared advisory lock on each source file while it is uploaded")
+	flags.StringVar(&opts.Source, "source", "",
+		"optionally specify the source backend used to read objects (default: tempfile)")
 
 	flags.DurationVar(&opts.UploadPartTimeout, "upload-part-timeout", time.Duration(0),
 		"optionally set a timeout for any UploadPart requests")
@@ -55,23 +175,122 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 		"optionally set a timeout for any CompleteMultipartUpload requests")
 	flags.DurationVar(&opts.AbortUploadTimeout, "abort-multipart-timeout", time.Duration(0),
 		"optionally set a timeout for any AbortMultipartUpload requests")
+	flags.DurationVar(&opts.PutObjectTimeout, "put-object-timeout", time.Duration(0),
+		"optionally set a timeout for any PutObject requests")
+	flags.DurationVar(&opts.CreateUploadTimeout, "create-multipart-timeout", time.Duration(0),
+		"optionally set a timeout for any CreateMultipartUpload requests")
+	flags.DurationVar(&opts.ObjectAttributesTimeout, "object-attributes-timeout", time.Duration(0),
+		"optionally set a timeout for any GetObjectAttributes requests")
+	var objectAttributes string
+	flags.StringVar(&objectAttributes, "object-attributes", "etag,checksum,object-parts,object-size",
+		"optionally specify the attributes requested by GetObjectAttributes, or none")
+	var attributesMaxParts int
+	flags.IntVar(&attributesMaxParts, "object-attributes-max-parts", int(DefaultMaxPartID),
+		"optionally specify the maximum number of parts listed by GetObjectAttributes")
+	flags.IntVar(&opts.ObjectAttributesRetries, "object-attributes-retries", DefaultObjectAttributesRetries,
+		"optionally specify the number of times a failed GetObjectAttributes request is retried")
+	flags.DurationVar(&opts.RequestTimeout, "request-timeout", time.Duration(0),
+		"optionally set a timeout for every individual HTTP request attempt")
+
+	flags.BoolVar(&opts.Preflight, "preflight", false,
+		"optionally check access to the bucket before processing any files")
+	flags.BoolVar(&opts.PreflightWrite, "preflight-write", false,
+		"optionally check write access to the bucket using an empty probe object")
+
+	flags.BoolVar(&opts.CreateBucket, "create-bucket", false,
+		"optionally create the bucket if it does not exist")
+	flags.BoolVar(&opts.CreateBucketVersioning, "create-bucket-versioning", false,
+		"optionally enable versioning on a bucket created by -create-bucket")
+	flags.BoolVar(&opts.CreateBucketObjectLock, "create-bucket-object-lock", false,
+		"optionally enable object lock on a bucket created by -create-bucket")
+
+	flags.DurationVar(&opts.AbortStale, "abort-stale", time.Duration(0),
+		"optionally abort multi-part uploads under the destination older than this")
+	flags.BoolVar(&opts.AbortStaleBucket, "abort-stale-bucket", false,
+		"optionally allow -abort-stale to abort uploads in the whole bucket when no -key is specified")
 
 	flags.StringVar(&opts.Profile, "profile", "",
 		"optional AWS profile name to use")
+	flags.StringVar(&opts.Region, "region", "",
+		"optionally specify the AWS region, instead of the region of the profile")
+	flags.BoolVar(&opts.NoSignRequest, "no-sign-request", false,
+		"optionally send requests without credentials, for buckets allowing anonymous access")
+
+	flags.Func("role-arn",
+		"optionally assume this role, repeat to assume each role in turn (role chaining)",
+		func(s string) error {
+			opts.RoleARNs = append(opts.RoleARNs, s)
+			return nil
+		})
+
+	flags.StringVar(&opts.AccessKey, "access-key", "",
+		"optionally specify the AWS access key id, instead of searching for credentials")
+	flags.StringVar(&opts.SecretKey, "secret-key", "",
+		"optionally specify the AWS secret access key (prefer -secret-key-file)")
+	flags.StringVar(&opts.SessionToken, "session-token", "",
+		"optionally specify the AWS session token for temporary credentials")
+	flags.StringVar(&opts.AccessKeyFile, "access-key-file", "",
+		"optionally read -access-key from this file, reloading it when it changes")
+	flags.StringVar(&opts.SecretKeyFile, "secret-key-file", "",
+		"optionally read -secret-key from this file, reloading it when it changes")
+	flags.StringVar(&opts.SessionTokenFile, "session-token-file", "",
+		"optionally read -session-token from this file, reloading it when it changes")
 
 	flags.BoolVar(&opts.Recursive, "recursive", false,
 		"recursively process directories for files to upload")
 
+	flags.Func("endpoint",
+		"optionally specify the S3 endpoint URL, multiple endpoints (repeated or comma separated) are used in turn",
+		func(s string) error {
+			for _, endpoint := range strings.Split(s, ",") {
+				if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+					opts.Endpoints = append(opts.Endpoints, endpoint)
+				}
+			}
+			return nil
+		})
+	flags.BoolVar(&opts.ProbeEndpoints, "probe-endpoints", false,
+		"optionally probe the latency of each -endpoint and send more parts to the fastest")
+	flags.DurationVar(&opts.ProbeEndpointsInterval, "probe-endpoints-interval", time.Minute,
+		"optionally probe the endpoints again this often with -probe-endpoints, 0 to probe only at startup")
+
+	flags.BoolVar(&opts.UseDualStack, "use-dualstack", false,
+		"optionally use the dual-stack (IPv4 and IPv6) S3 endpoint")
+	flags.BoolVar(&opts.UseFIPS, "use-fips", false,
+		"optionally use the FIPS 140-2 validated S3 endpoint")
+
+	var resolves []string
+	flags.Func("resolve",
+		"optionally connect to host (on port) using addr instead of DNS: host[:port]:addr",
+		func(s string) error {
+			resolves = append(resolves, s)
+			return nil
+		})
+	flags.DurationVar(&opts.DNSCache, "dns-cache", time.Duration(0),
+		"optionally cache DNS results for connections to S3 for this long")
+
 	flags.BoolVar(&opts.DisablePathStyle, "disable-path-style", false,
 		"disable use of older AWS S3 path-style requests")
+	var style PathStyle
+	flags.Var(&style, "path-style",
+		"optionally specify bucket addressing: auto, path, virtual (default: auto)")
 
 	flags.BoolVar(&opts.DisableS3ClientPool, "disable-s3-pool", false,
 		"disable use multiple s3 clients")
+	flags.IntVar(&opts.WarmUp, "warm-up", 0,
+		"optionally open this many connections to S3 before uploading the first object")
+
+	flags.BoolVar(&opts.DisableRegionDetect, "disable-region-detect", false,
+		"disable detecting and using the region of the bucket")
 
 	var checksumAlgo string
 	flags.StringVar(&checksumAlgo, "checksum", "SHA256",
 		"checksum algorithm to use, one of SHA256, SHA1, CRC32, or CRC32C")
 
+	var extraChecksums string
+	flags.StringVar(&extraChecksums, "extra-checksums", "",
+		"comma separated list of additional checksums to include in the manifest, from SHA512, BLAKE3, or XXHASH")
+
 	var copySize ByteSize
 	flags.Var(&copySize, "copy-buf",
 		"I/O buffer size for copy operations (default: 128KiB)")
@@ -80,6 +299,16 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 	flags.Var(&partSize, "part-size",
 		"Size of parts to upload (min: 5MiB, max: 5GiB, default: 5GiB)")
 
+	var multipartThreshold ByteSize
+	flags.Var(&multipartThreshold, "multipart-threshold",
+		"optionally upload files up to this size using a single PutObject (max: 5GiB, default: -part-size or the -preset threshold)")
+	flags.Var(&opts.ProbeSize, "probe-size",
+		"optionally read at most this many bytes of a stream to choose between PutObject and a multi-part upload")
+
+	flags.StringVar(&opts.Preset, "preset", "",
+		"optionally use the part size, multipart threshold, and concurrency of another tool: "+
+			strings.Join(presetNames(), ", "))
+
 	var maxPartID MaxPartID
 	flags.Var(&maxPartID, "max-part-id", fmt.Sprintf(
 		"Maximum number of parts to upload in a multi-part object (default: %d)",
@@ -87,14 +316,167 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 
 	flags.IntVar(&opts.ConcurrentObjects, "concurrent-objects", 1,
 		"number of concurrent objects to upload")
+	flags.Var(&opts.SmallObjectSize, "small-object-size",
+		"optionally upload files of at most this size through a separate PutObject-only pool")
+	flags.IntVar(&opts.ConcurrentSmallObjects, "concurrent-small-objects", DefaultConcurrentSmallObjects,
+		"number of concurrent small objects to upload with -small-object-size")
+	flags.IntVar(&opts.ConcurrentAttributes, "concurrent-attributes", DefaultConcurrentAttributes,
+		"number of concurrent GetObjectAttributes requests for completed objects")
 	flags.IntVar(&opts.ConcurrentParts, "concurrent-parts", 1,
 		"number of concurrent parts to upload per object")
+	flags.BoolVar(&opts.DynamicParts, "dynamic-parts", false,
+		"derive the number of concurrent parts per object from the object size")
+	flags.IntVar(&opts.ReadAhead, "read-ahead", DefaultReadAhead,
+		"number of parts to buffer ahead of the parts being uploaded per object")
 	flags.BoolVar(&opts.LeavePartsOnError, "leave-parts-on-error", false,
 		"do not abort failed uploads, leaving parts for manual recovery")
 
+	var bwlimit ByteSize
+	flags.Var(&bwlimit, "bwlimit",
+		"optionally limit upload bandwidth to this many bytes per second")
+	flags.BoolVar(&opts.BandwidthGreedy, "bwlimit-greedy", false,
+		"let objects compete for -bwlimit instead of sharing it fairly")
+	var bwlimitPerObject ByteSize
+	flags.Var(&bwlimitPerObject, "bwlimit-per-object",
+		"optionally limit the upload bandwidth of any single object to this many bytes per second")
+
+	flags.IntVar(&opts.Retries, "retries", DefaultRetries,
+		"optionally specify the number of times a part upload that failed transiently is retried")
+	flags.DurationVar(&opts.RetryBackoff, "retry-backoff", DefaultRetryBackoff,
+		"optionally specify the wait before the first retry of a part upload, doubled after each retry")
+	flags.Float64Var(&opts.RetryBudget, "retry-budget", 0,
+		"optionally abort the run once this fraction of recent requests have failed")
+
+	flags.StringVar(&opts.StateFile, "state-file", "",
+		"optionally write the state of uploads left by -leave-parts-on-error to this file")
+	flags.StringVar(&opts.Resume, "resume", "",
+		"optionally resume the uploads left pending in this state file, rewriting it with those still pending")
+	flags.StringVar(&opts.UploadID, "upload-id", "",
+		"optionally upload parts to (or repair) a multi-part upload created elsewhere, instead of creating one")
+	var startPart int
+	flags.IntVar(&startPart, "start-part", 1,
+		"optionally specify the part number the parts uploaded with -upload-id start at")
+	flags.Var(&opts.RangeOffset, "range-offset",
+		"optionally upload the source from this offset, with -upload-id")
+	flags.Var(&opts.RangeLength, "range-length",
+		"optionally upload only this many bytes of the source, with -upload-id")
+	flags.IntVar(&opts.Hosts, "hosts", 0,
+		"optionally specify the number of hosts to assign parts to for s3up distribute")
+	flags.StringVar(&opts.Plan, "plan", "",
+		"optionally specify the plan written by s3up distribute for s3up complete")
+	flags.StringVar(&opts.ComposeManifest, "compose-manifest", "",
+		"optionally specify the json manifest of the chunks for s3up compose")
+
+	flags.BoolVar(&opts.Sync, "sync", false,
+		"optionally skip uploading sources that are the same as the remote object")
+	var mode SyncMode
+	flags.Var(&mode, "sync-mode",
+		"optionally specify how -sync compares objects: checksum, quick, head (default: checksum)")
+	flags.BoolVar(&opts.Delete, "delete", false,
+		"optionally delete remote objects not found locally (requires -sync)")
+	flags.IntVar(&opts.MaxDelete, "max-delete", DefaultMaxDelete,
+		"optionally limit the number of remote objects -delete may remove, -1 for no limit")
+
+	flags.StringVar(&opts.DedupeDB, "dedupe-db", "",
+		"optionally skip sources whose content was already uploaded per this database, adding uploaded objects to it")
+	var dedupe DedupeMode
+	flags.Var(&dedupe, "dedupe-mode",
+		"optionally specify how -dedupe-db handles duplicate sources: skip, copy (default: skip)")
+
+	flags.IntVar(&opts.MaxObjects, "max-objects", 0,
+		"optionally limit the number of objects uploaded")
+	flags.Var(&opts.MaxBytes, "max-bytes",
+		"optionally limit the total size of objects uploaded")
+
+	flags.Var(&opts.SplitSize, "split-size",
+		"optionally split standard input into objects of this size, named by a -key template")
+	flags.IntVar(&opts.SplitPad, "split-pad", DefaultSplitPad,
+		"optionally specify the digits {{.Seq}} and {{.Offset}} are zero-padded to in a -key template")
+
+	flags.BoolVar(&opts.ChecksumOnly, "checksum-only", false,
+		"only calculate checksums and produce the -manifest, without uploading")
+	flags.BoolVar(&opts.DryRun, "dry-run", false,
+		"only estimate the requests, storage, and cost of uploading, without uploading")
+	flags.StringVar(&opts.PriceTable, "price-table", "",
+		"optionally specify a file of prices used by -dry-run")
+
 	var manifest ManifestType
 	flags.Var(&manifest, "manifest",
 		"Optionally specify a manifest: json, md5, checksum, aws, etag")
+	flags.StringVar(&opts.ManifestAppend, "manifest-append", "",
+		"optionally append JSON lines records to this file, locked so that concurrent runs may share it")
+	flags.StringVar(&opts.ManifestUpload, "manifest-upload", "",
+		"optionally upload the manifest to this key (or prefix ending in /) in the bucket once the run finishes")
+	flags.StringVar(&opts.ManifestCheckpoint, "manifest-checkpoint", "",
+		"optionally write the manifest so far to this file periodically during the run")
+	flags.IntVar(&opts.CheckpointObjects, "checkpoint-objects", 1000,
+		"write a -manifest-checkpoint once this many objects have completed")
+	flags.DurationVar(&opts.CheckpointInterval, "checkpoint-interval", 5*time.Minute,
+		"write a -manifest-checkpoint at least this often while objects complete")
+	flags.StringVar(&opts.SummaryOut, "summary-out", "",
+		"optionally write a JSON summary of the run to this file")
+	flags.IntVar(&opts.StatsFD, "stats-fd", 0,
+		"optionally write JSON progress snapshots to this open file descriptor")
+	flags.DurationVar(&opts.StatsInterval, "stats-interval", 10*time.Second,
+		"optionally specify the interval between -stats-fd snapshots")
+
+	flags.BoolVar(&opts.StrictVerify, "strict-verify", false,
+		"optionally fail objects whose ETag or checksum does not match, rather than only recording it")
+	flags.BoolVar(&opts.RequireContentMD5, "require-content-md5", false,
+		"optionally fail parts and objects whose ETag does not match the Content-MD5 sent")
+	flags.BoolVar(&opts.Compress, "compress", false,
+		"optionally compress sources using gzip, unless they are already compressed")
+
+	var sparse SparseMode
+	flags.Var(&sparse, "sparse",
+		"optionally specify how sparse files are uploaded: upload, skip, holes (default: upload)")
+
+	var check KeyCheck
+	flags.Var(&check, "key-check",
+		"optionally specify key validation: utf8, warn, strict (default: utf8)")
+	var replaces []string
+	flags.Func("key-replace",
+		"optionally replace a character in key names: <char>=<replacement>",
+		func(s string) error {
+			replaces = append(replaces, s)
+			return nil
+		})
+	flags.StringVar(&opts.KeyMapper, "key-mapper", "",
+		"optionally specify a command reading lines of tab separated source and key, printing the key to upload each to")
+	var encoding KeyEncoding
+	flags.Var(&encoding, "key-encoding",
+		"optionally specify how key names are encoded: reject, encode-invalid, encode-all-special (default: reject)")
+	var truncation KeyTruncation
+	flags.Var(&truncation, "truncate-keys",
+		"optionally specify how keys that are too long are handled: none, hash (default: none)")
+
+	flags.IntVar(&opts.ShardPrefix, "shard-prefix", 0,
+		"optionally insert this many hex characters of a hash of each key after the -key prefix")
+	flags.BoolVar(&opts.CheckKeys, "check-keys", false,
+		"optionally check the keys of all sources for collisions before uploading any")
+	flags.BoolVar(&opts.CheckCase, "check-case", false,
+		"optionally warn about keys that differ only by case")
+
+	flags.StringVar(&opts.Jobs, "jobs", "",
+		"optionally specify a CSV or JSON lines file listing sources to upload")
+
+	var leading *ObjectOptions
+	flags.Func("set",
+		"optionally apply content-type=, storage-class=, or tags= to the globs that follow",
+		func(s string) error {
+			if leading == nil {
+				leading = &ObjectOptions{}
+			}
+			return leading.set(s)
+		})
+	flags.Func("priority",
+		"optionally set the priority of the globs that follow, higher is uploaded first",
+		func(s string) error {
+			if leading == nil {
+				leading = &ObjectOptions{}
+			}
+			return leading.set("priority=" + s)
+		})
 
 	flags.StringVar(&opts.bucket, "bucket", "",
 		"name of the bucket to upload objects to")
@@ -106,6 +488,9 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 	flags.BoolVar(&help, "h", false, "print help and exit")
 	flags.BoolVar(&help, "help", false, "print help and exit")
 
+	var version bool
+	flags.BoolVar(&version, "version", false, "print the version and exit")
+
 	flags.Parse(args)
 
 	if help {
@@ -113,23 +498,144 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 		os.Exit(0)
 	}
 
-	// bucket
-	if opts.bucket == "" {
+	if version {
+		fmt.Print(versionString())
+		os.Exit(0)
+	}
+
+	// Preset (explicit -part-size, -multipart-threshold, and
+	// -concurrent-parts take precedence)
+	if opts.Preset != "" {
+		preset, err := lookupPreset(opts.Preset)
+		if err != nil {
+			return nil, err
+		}
+		if err := preset.apply(flags); err != nil {
+			return nil, err
+		}
+	}
+
+	// bucket (rows in a -jobs file may specify their own bucket, and the
+	// -plan of s3up complete records the bucket of the upload)
+	if opts.bucket == "" && opts.Jobs == "" && opts.Plan == "" {
 		return nil, errMissingBucket
 	}
 
+	// Jobs
+	if opts.Jobs != "" && flags.NArg() != 0 {
+		return nil, errJobsWithGlobs
+	}
+
+	// Sync
+	opts.SyncMode = syncMode(mode)
+
+	opts.DedupeMode = dedupeMode(dedupe)
+	if opts.DedupeMode != DedupeModeSkip && opts.DedupeDB == "" {
+		return nil, errDedupeModeWithoutDB
+	}
+
+	if opts.SyncMode != SyncModeChecksum {
+		opts.Sync = true
+	}
+
+	if opts.Delete && !opts.Sync {
+		return nil, errDeleteWithoutSync
+	}
+
+	if opts.MemProfileInterval > 0 && opts.MemProfile == "" {
+		return nil, errMemProfileInterval
+	}
+
+	if opts.GoMaxProcs < 0 {
+		return nil, errBadGoMaxProcs
+	}
+
+	if opts.MemoryLimit < 0 {
+		return nil, errBadMemoryLimit
+	}
+
+	if opts.Flock && !flockSupported {
+		return nil, errFlockUnsupported
+	}
+
+	if opts.ManifestAppend != "" && !flockSupported {
+		return nil, errManifestAppendUnsupported
+	}
+
+	// Resume
+	if opts.Resume != "" {
+		if opts.StateFile != "" || opts.UploadID != "" || opts.StreamParts {
+			return nil, errResumeOptions
+		}
+
+		opts.resume, err = readResumeUploads(opts.Resume)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read -resume: %s: %w", opts.Resume, err)
+		}
+		opts.LeavePartsOnError = true
+	}
+
+	// DeleteSource, ArchiveSourceTo, TruncateSource
+	nretain := 0
+	for _, set := range []bool{opts.DeleteSource, opts.ArchiveSourceTo != "", opts.TruncateSource} {
+		if set {
+			nretain += 1
+		}
+	}
+
+	if nretain > 1 {
+		return nil, errSourceRetentionOptions
+	}
+
+	if nretain > 0 && opts.SnapshotCmd != "" {
+		return nil, errSourceRetentionSnapshot
+	}
+
+	if opts.Compress && (opts.Sync || opts.DedupeDB != "" || opts.RangeOffset > 0 || opts.RangeLength > 0) {
+		return nil, errCompressOptions
+	}
+
+	if opts.SnapshotCleanupCmd != "" && opts.SnapshotCmd == "" {
+		return nil, errSnapshotCleanupWithoutCmd
+	}
+
+	if opts.AbortStale > 0 && opts.key == "" && !opts.AbortStaleBucket {
+		return nil, errAbortStaleBucket
+	}
+
+	if opts.Sync && (opts.Jobs != "" || flags.NArg() == 0) {
+		return nil, errSyncWithoutGlobs
+	}
+
+	// StartPart
+	if startPart < 1 || startPart > int(DefaultMaxPartID) {
+		return nil, errBadStartPart
+	}
+	opts.StartPart = int32(startPart)
+
+	// ObjectAttributes
+	if opts.ObjectAttributes, err = parseObjectAttributes(objectAttributes); err != nil {
+		return nil, err
+	}
+
+	// ObjectAttributesMaxParts
+	if attributesMaxParts < 1 || attributesMaxParts > int(DefaultMaxPartID) {
+		return nil, errBadAttributesMaxParts
+	}
+	opts.ObjectAttributesMaxParts = int32(attributesMaxParts)
+
+	// ObjectAttributesRetries
+	if opts.ObjectAttributesRetries < 0 {
+		return nil, errBadAttributesRetries
+	}
+
 	// ChecksumAlgorithm
-	switch strings.ToUpper(checksumAlgo) {
-	case "SHA256":
-		opts.ChecksumAlgorithm = ChecksumAlgorithmSHA256
-	case "SHA1":
-		opts.ChecksumAlgorithm = ChecksumAlgorithmSHA1
-	case "CRC32C":
-		opts.ChecksumAlgorithm = ChecksumAlgorithmCRC32C
-	case "CRC32":
-		opts.ChecksumAlgorithm = ChecksumAlgorithmCRC32
-	default:
-		err = fmt.Errorf("%w: %s", errBadChecksum, checksumAlgo)
+	if opts.ChecksumAlgorithm, err = parseChecksumAlgorithm(checksumAlgo); err != nil {
+		return nil, err
+	}
+
+	// ExtraChecksums
+	if opts.ExtraChecksums, err = ParseExtraChecksums(extraChecksums); err != nil {
 		return nil, err
 	}
 
@@ -138,11 +644,21 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 		opts.ConcurrentObjects = 1
 	}
 
+	// ConcurrentAttributes
+	if opts.ConcurrentAttributes < 1 {
+		opts.ConcurrentAttributes = 1
+	}
+
 	// ConcurrentParts
 	if opts.ConcurrentParts < 0 {
 		opts.ConcurrentParts = 1
 	}
 
+	// ReadAhead
+	if opts.ReadAhead < 1 {
+		opts.ReadAhead = 1
+	}
+
 	// CopySize
 	if i64 := int64(copySize); i64 <= 0 {
 		opts.CopySize = DefaultCopyBufSize
@@ -162,43 +678,422 @@ func processFlags(ctx context.Context, args []string) (*Options, error) {
 		opts.PartSize = i64
 	}
 
+	// MultipartThreshold
+	if i64 := int64(multipartThreshold); i64 == 0 {
+		opts.MultipartThreshold = opts.PartSize
+	} else if i64 < opts.PartSize || i64 > MaxPartSize {
+		return nil, fmt.Errorf("%w: %s", errBadMultipartThreshold, multipartThreshold)
+	} else {
+		opts.MultipartThreshold = i64
+	}
+
+	// ProbeSize
+	if int64(opts.ProbeSize) > opts.PartSize || opts.ProbeSize < 0 {
+		return nil, fmt.Errorf("%w: %s", errBadProbeSize, opts.ProbeSize)
+	}
+
+	// SmallObjectSize, ConcurrentSmallObjects
+	if int64(opts.SmallObjectSize) > opts.PartSize || opts.SmallObjectSize < 0 {
+		return nil, fmt.Errorf("%w: %s", errBadSmallObjectSize, opts.SmallObjectSize)
+	}
+	if opts.ConcurrentSmallObjects < 1 {
+		opts.ConcurrentSmallObjects = 1
+	}
+
 	// MaxPartID
 	opts.MaxPartID = int32(maxPartID)
 	if opts.MaxPartID <= 0 {
 		opts.MaxPartID = DefaultMaxPartID
 	}
 
+	// MaxObjects and MaxBytes
+	if opts.MaxObjects < 0 || opts.MaxBytes < 0 {
+		return nil, errBadQuota
+	}
+
+	// DryRun and PriceTable
+	if opts.DryRun && opts.ChecksumOnly {
+		return nil, errDryRunChecksumOnly
+	}
+
+	opts.prices = DefaultPriceTable
+	if opts.PriceTable != "" {
+		opts.prices, err = readPriceTableFile(opts.PriceTable)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load -price-table: %s: %w",
+				opts.PriceTable, err)
+		}
+	}
+
 	// Manifest
 	opts.Manifest = manifestType(manifest)
 
+	// CheckpointObjects, CheckpointInterval
+	if opts.CheckpointObjects < 0 || opts.CheckpointInterval < 0 {
+		return nil, errBadCheckpoint
+	}
+
+	// ManifestUpload
+	if opts.ManifestUpload != "" && (opts.Manifest == NoManifest || opts.bucket == "") {
+		return nil, errManifestUploadOptions
+	}
+
+	// Preflight
+	if opts.PreflightWrite || opts.CreateBucket {
+		opts.Preflight = true
+	}
+
+	// ShardPrefix
+	if opts.ShardPrefix < 0 || opts.ShardPrefix > MaxShardPrefix {
+		return nil, errBadShardPrefix
+	}
+
+	if opts.ShardPrefix > 0 && opts.key != "" && !strings.HasSuffix(opts.key, "/") {
+		return nil, errShardPrefixKey
+	}
+
+	// PathStyle (-disable-path-style is the same as -path-style virtual)
+	opts.PathStyle = pathStyle(style)
+
+	if opts.DisablePathStyle {
+		opts.PathStyle = PathStyleVirtual
+	}
+
+	if opts.PathStyle == PathStyleVirtual {
+		opts.DisablePathStyle = true
+	}
+
+	// KeyCheck
+	opts.KeyCheck = keyCheck(check)
+
+	// Sparse
+	opts.Sparse = sparseMode(sparse)
+
+	// KeyReplace
+	if len(replaces) > 0 {
+		if opts.keyReplacer, err = newKeyReplacer(replaces); err != nil {
+			return nil, err
+		}
+		opts.KeyReplace = replaces
+	}
+
+	// KeyEncoding
+	opts.KeyEncoding = keyEncoding(encoding)
+
+	// TruncateKeys
+	opts.TruncateKeys = keyTruncation(truncation)
+
+	// BandwidthLimit
+	if i64 := int64(bwlimit); i64 > 0 {
+		opts.BandwidthLimit = i64
+	}
+
+	// BandwidthLimitPerObject
+	if i64 := int64(bwlimitPerObject); i64 > 0 {
+		opts.BandwidthLimitPerObject = i64
+	}
+
+	if opts.BandwidthLimit > 0 || opts.BandwidthLimitPerObject > 0 {
+		opts.bwlimit = NewBandwidthLimiter(opts.BandwidthLimit, !opts.BandwidthGreedy)
+		opts.bwlimit.SetStreamRate(opts.BandwidthLimitPerObject)
+	}
+
+	// AccessKey, SecretKey, SessionToken (optionally read from files)
+	for _, cred := range opts.credentialFiles() {
+		if *cred.value, err = readCredential(*cred.value, cred.name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkCredentials(opts); err != nil {
+		return nil, err
+	}
+
+	// UseDualStack and UseFIPS select AWS endpoints
+	if (opts.UseDualStack || opts.UseFIPS) && len(opts.Endpoints) > 0 {
+		return nil, errEndpointOptions
+	}
+
+	// Resolve and DNSCache
+	if len(resolves) > 0 || opts.DNSCache > 0 {
+		opts.resolver = NewResolver(opts.DNSCache)
+		for _, s := range resolves {
+			if err := opts.resolver.Set(s); err != nil {
+				return nil, err
+			}
+		}
+		opts.Resolve = resolves
+	}
+
+	// Retries, RetryBackoff
+	if opts.Retries < 0 || opts.RetryBackoff < 0 {
+		return nil, errBadRetries
+	}
+
+	// WarmUp
+	if opts.WarmUp < 0 {
+		return nil, errBadWarmUp
+	}
+
+	// RetryBudget
+	if opts.RetryBudget < 0 || opts.RetryBudget > 1 {
+		return nil, errBadRetryBudget
+	}
+
+	if opts.RetryBudget > 0 {
+		opts.retryBudget = NewRetryBudget(opts.RetryBudget)
+	}
+
+	// StorageRules
+	if opts.StorageRules != "" {
+		opts.storageRules, err = readStorageRulesFile(opts.StorageRules)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load -storage-rules: %s: %w",
+				opts.StorageRules, err)
+		}
+	}
+
+	// ServerSideEncryption
+	var sse types.ServerSideEncryption
+	if opts.SSE != "" {
+		if sse, err = parseServerSideEncryption(opts.SSE); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.SSEKMSKeyId != "" && sse != types.ServerSideEncryptionAwsKms &&
+		sse != types.ServerSideEncryptionAwsKmsDsse {
+		return nil, errKMSKeyWithoutKMS
+	}
+
+	// SSECustomerKey
+	var sseCustomerKey []byte
+	if opts.SSECustomerKey != "" {
+		if sse != "" || opts.SSEKMSKeyId != "" {
+			return nil, errSSECustomerKeyOptions
+		}
+		if sseCustomerKey, err = readSSECustomerKey(opts.SSECustomerKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// LifecycleTag
+	var lifecycleTag string
+	if opts.LifecycleTag != "" {
+		if lifecycleTag, err = parseLifecycleTag(opts.LifecycleTag); err != nil {
+			return nil, err
+		}
+	}
+
+	// RunID
+	if opts.RunID == "" {
+		opts.RunID = newRunID(time.Now())
+	} else if err := validRunID(opts.RunID); err != nil {
+		return nil, err
+	}
+
+	// provenance of the run, for the json manifest
+	opts.runMetadata = newRunMetadata(time.Now(), flags.Name(), args, flags, opts.RunID)
+
+	// Source
+	if opts.Source != "" {
+		if _, err := lookupSource(opts.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	// Metadata
+	for _, s := range metadata {
+		if opts.Metadata == nil {
+			opts.Metadata = map[string]string{}
+		}
+		if err := parseMetadata(s, opts.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkMetadataSize((&ObjectOptions{Metadata: opts.Metadata}).metadata(opts.RunID)); err != nil {
+		return nil, err
+	}
+
+	// ObjectOptions defaults
+	if opts.ContentType != "" || sse != "" || sseCustomerKey != nil || lifecycleTag != "" || opts.Source != "" || len(opts.Metadata) > 0 {
+		opts.objOpt = &ObjectOptions{
+			ContentType:          opts.ContentType,
+			LifecycleTag:         lifecycleTag,
+			Source:               opts.Source,
+			ServerSideEncryption: sse,
+			SSEKMSKeyId:          opts.SSEKMSKeyId,
+			SSECustomerKey:       sseCustomerKey,
+			Metadata:             opts.Metadata,
+		}
+	}
+
+	// RequireContentMD5
+	if opts.RequireContentMD5 && (opts.StreamParts || !opts.objOpt.etagIsMD5()) {
+		return nil, errContentMD5Options
+	}
+
+	// DedupeDB
+	if opts.DedupeDB != "" {
+		if opts.dedupe, err = OpenDedupeDB(opts.DedupeDB); err != nil {
+			return nil, err
+		}
+	}
+
+	// SummaryOut
+	if opts.SummaryOut != "" {
+		opts.summary = NewRunSummary()
+	}
+
+	// StatsFD
+	if opts.StatsFD != 0 {
+		if opts.StatsInterval <= 0 {
+			return nil, errBadStatsInterval
+		}
+
+		fh, err := openStatsFD(opts.StatsFD)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.stats = NewStatsStream(fh, opts.StatsInterval)
+	}
+
 	// s3
-	awsCfg, err := config.LoadDefaultConfig(
-		ctx, config.WithSharedConfigProfile(opts.Profile))
+	awsCfg, err := config.LoadDefaultConfig(ctx, configLoadOptions(opts)...)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(opts.RoleARNs) > 0 {
+		awsCfg = assumeRoles(awsCfg, opts.RoleARNs)
+	}
+
+	// an endpoint configured for the AWS tools is used as though it was
+	// given with -endpoint, which takes precedence over it
+	if len(opts.Endpoints) == 0 {
+		if endpoint := configuredEndpoint(awsCfg); endpoint != "" {
+			if opts.UseDualStack || opts.UseFIPS {
+				return nil, errConfiguredEndpointOptions
+			}
+
+			opts.Endpoints = []string{endpoint}
+		}
+	}
+
+	// ProbeEndpoints, ProbeEndpointsInterval
+	if opts.ProbeEndpoints && len(opts.Endpoints) < 2 {
+		return nil, errProbeEndpoints
+	}
+	if opts.ProbeEndpointsInterval < 0 {
+		return nil, errBadProbeEndpointsInterval
+	}
+
+	// StreamParts
+	if err := checkStreamParts(opts); err != nil {
+		return nil, err
+	}
+
 	opts.s3 = NewS3ClientPool(
 		!opts.DisableS3ClientPool,
 		awsCfg,
 		func(o *s3.Options) {
+			addUserAgent(o)
+			if opts.WarmUp > 0 {
+				o.HTTPClient = idleConnsHTTPClient(o.HTTPClient, opts.WarmUp)
+			}
 			o.UsePathStyle = !opts.DisablePathStyle
+			if opts.UseDualStack {
+				o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+			}
+			if opts.UseFIPS {
+				o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+			}
+			if opts.resolver != nil {
+				o.HTTPClient = opts.resolver.HTTPClient(o.HTTPClient)
+			}
+			if opts.RequestTimeout > 0 {
+				o.HTTPClient = requestTimeoutHTTPClient(o.HTTPClient, opts.RequestTimeout)
+			}
+			if opts.bwlimit != nil {
+				o.HTTPClient = opts.bwlimit.HTTPClient(o.HTTPClient)
+			}
+			if opts.retryBudget != nil {
+				o.HTTPClient = opts.retryBudget.HTTPClient(o.HTTPClient)
+			}
+			if opts.summary != nil {
+				opts.summary.countAttempts(o)
+			}
+			if opts.stats != nil {
+				o.HTTPClient = opts.stats.HTTPClient(o.HTTPClient)
+			}
 		},
 	)
 
+	if len(opts.Endpoints) > 0 {
+		opts.s3 = opts.s3.WithEndpoints(opts.Endpoints)
+	}
+
 	// Buffer for io.CopyBuffer
 	if opts.CopySize != copyBufSize {
 		copyBufSize = opts.CopySize
 		copyBuf = NewBufferPool(opts.CopySize)
 	}
 
-	// Buffer for streaming parts
-	if opts.UseMemoryBuffers {
-		opts.partBuf = NewBufferPool(opts.PartSize)
+	// Runtime resource limits
+	if opts.GoMaxProcs > 0 {
+		runtime.GOMAXPROCS(opts.GoMaxProcs)
+	}
+
+	if opts.MemoryLimit > 0 {
+		debug.SetMemoryLimit(int64(opts.MemoryLimit))
 	}
 
-	// optional globs (files / directories to upload)
-	opts.globs = flags.Args()
+	// Shared budget for concurrent part uploads
+	if opts.DynamicParts {
+		opts.partBudget = NewPartScheduler(
+			max(1, opts.ConcurrentObjects*opts.ConcurrentParts))
+	}
+
+	// Buffer for streaming parts, used by the memory source (which may be
+	// selected for individual objects), buffers are only allocated on use
+	opts.partBuf = NewBufferPool(opts.PartSize)
+
+	// Buffer for the small object fast path
+	if opts.SmallObjectSize > 0 {
+		opts.smallBuf = NewBufferPool(int64(opts.SmallObjectSize))
+	}
+
+	// Buffer for -probe-size
+	if opts.ProbeSize > 0 {
+		opts.probeBuf = NewBufferPool(int64(opts.ProbeSize))
+	}
+
+	// optional globs (files / directories to upload), with any settings
+	opts.globs, opts.globOpts, err = processGlobArgs(flags.Args(), leading)
+	if err != nil {
+		return nil, err
+	}
+
+	// settings without globs apply to the standard input stream or -jobs
+	if len(opts.globs) == 0 && leading != nil {
+		opts.objOpt = leading.withDefaults(opts.objOpt)
+	}
+
+	// SplitSize and SplitPad
+	if opts.SplitSize > 0 {
+		if len(opts.globs) > 0 || opts.Jobs != "" {
+			return nil, errSplitSources
+		}
+
+		if opts.CheckKeys {
+			return nil, errSplitCheckKeys
+		}
+
+		if opts.splitKey, err = newSplitKeyTemplate(opts.key, max(opts.SplitPad, 0)); err != nil {
+			return nil, err
+		}
+	}
 
 	return opts, nil
 }
@@ -35,6 +35,179 @@ func TestProcessFlags(t *testing.T) {
 				}
 			},
 		},
+		{
+			optional: []string{"-gomaxprocs", "-1"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadGoMaxProcs) {
+					t.Errorf("expected errBadGoMaxProcs, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-object-attributes-max-parts", "0"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadAttributesMaxParts) {
+					t.Errorf("expected errBadAttributesMaxParts, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-object-attributes", "etag,size"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadObjectAttributes) {
+					t.Errorf("expected errBadObjectAttributes, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-compress", "-sync"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errCompressOptions) {
+					t.Errorf("expected errCompressOptions, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-resume", "a.state", "-stream-parts"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errResumeOptions) {
+					t.Errorf("expected errResumeOptions, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-part-size", "16MiB", "-multipart-threshold", "8MiB"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadMultipartThreshold) {
+					t.Errorf("expected errBadMultipartThreshold, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-part-size", "16MiB", "-probe-size", "32MiB"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadProbeSize) {
+					t.Errorf("expected errBadProbeSize, got %v", err)
+				}
+			},
+		},
+		{
+			// s3up complete takes the bucket from the -plan
+			optional: []string{"-plan", "plan.json"},
+			expect: func(opts *Options, err error) {
+				if err != nil {
+					t.Errorf("expected no error with -plan, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-sse", "AES256", "-sse-c-key", "sse.key"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errSSECustomerKeyOptions) {
+					t.Errorf("expected errSSECustomerKeyOptions, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-warm-up", "-1"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadWarmUp) {
+					t.Errorf("expected errBadWarmUp, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-probe-endpoints", "-endpoint", "http://localhost:9000"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errProbeEndpoints) {
+					t.Errorf("expected errProbeEndpoints, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-metadata", "project=survey", "-metadata", "Sample=A-17"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				} else if opts.objOpt.Metadata["project"] != "survey" || opts.objOpt.Metadata["sample"] != "A-17" {
+					t.Errorf("expected metadata project=survey and sample=A-17, got %v", opts.objOpt.Metadata)
+				}
+			},
+		},
+		{
+			optional: []string{"-metadata", "project"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadMetadata) {
+					t.Errorf("expected errBadMetadata, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-retry-backoff", "-1s"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errBadRetries) {
+					t.Errorf("expected errBadRetries, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-manifest-upload", "_manifests/"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errManifestUploadOptions) {
+					t.Errorf("expected errManifestUploadOptions, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-require-content-md5", "-sse", "aws:kms"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errContentMD5Options) {
+					t.Errorf("expected errContentMD5Options, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-abort-stale", "48h"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errAbortStaleBucket) {
+					t.Errorf("expected errAbortStaleBucket, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-abort-stale", "48h", "-abort-stale-bucket"},
+			required: required_ok,
+			expect: func(opts *Options, err error) {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			},
+		},
+		{
+			optional: []string{"-split-size", "1GiB", "-check-keys", "-key", "part-{{.Seq}}"},
+			required: []string{"-bucket", "bucket"},
+			expect: func(opts *Options, err error) {
+				if !errors.Is(err, errSplitCheckKeys) {
+					t.Errorf("expected errSplitCheckKeys, got %v", err)
+				}
+			},
+		},
 		{
 			optional: []string{"-part-size", "1MiB"},
 			required: required_ok,
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,14 +11,44 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
 var ErrMultiUploadKey = errors.New(
 	"to upload multiple files, specify a blank -key or a -key ending in slash ('/')")
 
+// sourceErrors counts the local sources that could not be read, and the globs
+// that could not be processed, so that -delete can tell when not every local
+// file was seen.
+var sourceErrors atomic.Int64
+
+// sourceError logs an error processing a source, counting it in sourceErrors.
+func sourceError(format string, v ...any) {
+	sourceErrors.Add(1)
+	log.Printf(format, v...)
+}
+
+// sendSource sends obj on ch, unless ctx is done first (e.g., once the quota
+// is exceeded), in which case its source is closed and false is returned.
+func sendSource(ctx context.Context, ch chan *uploadObject, obj *uploadObject) bool {
+	select {
+	case ch <- obj:
+		return true
+	case <-ctx.Done():
+		obj.rc.Close()
+		return false
+	}
+}
+
 // processGlobs processes Options.globs, returning each source file via the
-// returned channel.
-func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (chan *uploadObject, error) {
+// returned channel.  Globs that are http or https URLs are fetched and their
+// response bodies returned as sources.  If globOpts is not nil it lists the
+// ObjectOptions (see -set) to use for the source files of each glob.  Any
+// rules are evaluated for each source file to select its storage class.  If
+// snap is not nil source files are read from the snapshot, with the keys
+// derived from their paths in the working directory.  No further sources are
+// returned once ctx is done.
+func processGlobs(ctx context.Context, globs []string, globOpts []*ObjectOptions, rules StorageRules, snap *snapshot, Bucket, Key string, recursive, verbose bool) (chan *uploadObject, error) {
 	ch := make(chan *uploadObject)
 
 	// if globs is empty then assume we want to read from standard input
@@ -43,6 +74,7 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 				bucket: Bucket,
 				key:    Key,
 				rc:     io.NopCloser(os.Stdin),
+				source: "-",
 			}
 		}(ch)
 
@@ -60,48 +92,110 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 		// value.
 		nqueued := 0
 
-		for _, pattern := range globs {
+		for i, pattern := range globs {
+			var objOpt *ObjectOptions
+			if i < len(globOpts) {
+				objOpt = globOpts[i]
+			}
+
+			// http and https URLs are fetched and streamed, and
+			// URIs with a registered scheme read by their Source
+			// backend, rather than matched against the filesystem
+			if isURI(pattern) {
+				if nqueued > 0 && Key != "" && !strings.HasSuffix(Key, "/") {
+					sourceError("%s", ErrMultiUploadKey)
+					return
+				}
+
+				currentKey := Key
+				if Key == "" || strings.HasSuffix(Key, "/") {
+					name, err := urlKeyName(pattern)
+					if err != nil {
+						sourceError("error processing url: %s: %s", pattern, err)
+						continue
+					}
+					currentKey = path.Join(Key, name)
+				}
+
+				if verbose {
+					log.Printf("fetching url: %s", pattern)
+				}
+
+				// the response is read once queued, even if
+				// no further sources are
+				rc, err := openURI(context.WithoutCancel(ctx), pattern)
+				if err != nil {
+					sourceError("cannot fetch url: %s: %s", pattern, err)
+					continue
+				}
+
+				nqueued += 1
+
+				if !sendSource(ctx, ch, &uploadObject{
+					bucket: Bucket,
+					key:    currentKey,
+					rc:     rc,
+					objOpt: rules.apply(objOpt, currentKey, nil).withSchemeSource(pattern),
+					source: pattern,
+				}) {
+					return
+				}
+
+				continue
+			}
+
 			// check for one or more filesystem matches for this
 			// glob pattern
-			matches, err := filepath.Glob(pattern)
+			snapPattern, err := snap.path(pattern)
 			if err != nil {
-				log.Printf("error processing glob: %s: %s", pattern, err)
+				sourceError("error processing glob: %s", err)
+				continue
+			}
+
+			matches, err := filepath.Glob(snapPattern)
+			if err != nil {
+				sourceError("error processing glob: %s: %s", pattern, err)
 				continue
 			}
 
 			// if no matches were found log an error and continue
 			if len(matches) == 0 {
-				log.Printf("no matches for glob: %s", pattern)
+				sourceError("no matches for glob: %s", pattern)
 				continue
 			}
 
 			// process each matched file or directory
-			for _, match := range matches {
+			for _, found := range matches {
+				// keys are derived from the path in the
+				// working directory, which differs from the
+				// path found when reading from a snapshot
+				match := snap.live(found, filepath.IsAbs(pattern))
+
 				// if a key value was specified and isn't a
 				// prefix then we need to log an error if we
 				// encounter more than one upload,  to prevent
 				// uploading multiple sources to the same
 				// target.
 				if nqueued > 1 && Key != "" && !strings.HasSuffix(Key, "/") {
-					log.Println(ErrMultiUploadKey)
+					sourceError("%s", ErrMultiUploadKey)
 					return
 				}
 
 				// stat the source to see what it is, if we
 				// encounter an error just log the issue and
 				// continue
-				fi, err := os.Stat(match)
+				fi, err := os.Stat(longPath(found))
 				if err != nil {
-					log.Printf("cannot stat path: %s: %s", match, err)
+					sourceError("cannot stat path: %s: %s", match, err)
 					continue
 				}
 
 				if fi.Mode().IsRegular() {
 					// open the file and calculate the
 					// bucket / key target name
-					fh, err := os.Open(match)
+					fh, err := os.Open(longPath(found))
 					if err != nil {
-						log.Printf("cannot open path: %s: %s", match, err)
+						sourceError("cannot open path: %s: %s", match, err)
 						continue
 					}
 
@@ -109,22 +203,30 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 					if Key != "" && !strings.HasSuffix(Key, "/") {
 						currentKey = Key
 					} else {
-						currentKey = filepath.ToSlash(filepath.Base(match))
+						currentKey = keyPath(filepath.Base(match))
 						currentKey = path.Join(Key, currentKey)
 					}
 
 					nqueued += 1
 
-					ch <- &uploadObject{
+					if !sendSource(ctx, ch, &uploadObject{
 						bucket: Bucket,
 						key:    currentKey,
 						rc:     fh,
+						objOpt: rules.apply(objOpt, currentKey, fi),
+						source: match,
+					}) {
+						return
 					}
 				} else if fi.Mode().IsDir() {
 					// directories specified in the globs
 					// will be walked to find files to
-					// upload
-					err = filepath.WalkDir(match, func(name string, d fs.DirEntry, err error) error {
+					// upload, root may differ from match
+					// where long paths need a prefix to
+					// be opened
+					root := longPath(match)
+					walkRoot := longPath(found)
+					err = filepath.WalkDir(walkRoot, func(name string, d fs.DirEntry, err error) error {
 						if err != nil {
 							return err
 						}
@@ -132,7 +234,7 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 						// process top-level directories; process
 						// sub-directories if recursive was set.
 						if d.IsDir() {
-							if recursive || name == match {
+							if recursive || name == walkRoot {
 								return nil
 							}
 							return filepath.SkipDir
@@ -156,18 +258,40 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 						// submit sub-directory file for upload
 						fh, err := os.Open(name)
 						if err != nil {
-							log.Printf("cannot open path: %s: %s", name, err)
+							sourceError("cannot open path: %s: %s", name, err)
 							return nil
 						}
 
+						// map a snapshot path back to the path in
+						// the working directory
+						if walkRoot != root {
+							rel, err := filepath.Rel(walkRoot, name)
+							if err != nil {
+								fh.Close()
+								sourceError("error processing currentKey: %s, %s: %s",
+									walkRoot, name, err)
+								return nil
+							}
+							name = filepath.Join(root, rel)
+						}
+
 						// strip directory prefixes when a trailing slash
 						// was specified in the glob, similar to how rsync
 						// operates on directory paths
 						currentKey := name
-						if strings.HasSuffix(match, "/") {
-							currentKey, err = filepath.Rel(match, name)
+						if root != match {
+							rel, err := filepath.Rel(root, name)
+							if err != nil {
+								sourceError("error processing currentKey: %s, %s: %s",
+									root, name, err)
+								return nil
+							}
+							currentKey = filepath.Join(match, rel)
+						}
+						if hasTrailingSeparator(match) {
+							currentKey, err = filepath.Rel(match, currentKey)
 							if err != nil {
-								log.Printf("error processing currentKey: %s, %s: %s",
+								sourceError("error processing currentKey: %s, %s: %s",
 									match, name, err)
 								return nil
 							}
@@ -177,7 +301,7 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 						}
 
 						// prepend specified Key prefix to currentKey
-						currentKey = path.Join(Key, filepath.ToSlash(currentKey))
+						currentKey = path.Join(Key, keyPath(currentKey))
 
 						// prior to submission increment nqueued and confirm
 						// that Key was either blank or was a prefix if
@@ -189,22 +313,28 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 						}
 
 						// submit upload source
-						ch <- &uploadObject{
+						if !sendSource(ctx, ch, &uploadObject{
 							bucket: Bucket,
 							key:    currentKey,
 							rc:     fh,
+							objOpt: rules.apply(objOpt, currentKey, dFi),
+							source: name,
+						}) {
+							return ctx.Err()
 						}
 
 						return nil
 					})
 
 					// log any errors encountered walking the directory
-					if err != nil {
+					if ctx.Err() != nil {
+						return
+					} else if err != nil {
 						if errors.Is(err, ErrMultiUploadKey) {
-							log.Println(err)
+							sourceError("%s", err)
 							return
 						}
-						log.Printf("error processing directory: %s: %s", match, err)
+						sourceError("error processing directory: %s: %s", match, err)
 					}
 				}
 			}
@@ -214,3 +344,19 @@ func processGlobs(globs []string, Bucket, Key string, recursive, verbose bool) (
 
 	return ch, nil
 }
+
+// keyPath converts a local filepath into a slash-separated key name, removing
+// any volume name (e.g., a drive letter "C:" or a "\\server\share" prefix on
+// Windows) along with any separators that follow it.
+func keyPath(name string) string {
+	if vol := filepath.VolumeName(name); vol != "" {
+		name = strings.TrimLeft(name[len(vol):], `\/`)
+	}
+
+	return filepath.ToSlash(name)
+}
+
+// hasTrailingSeparator returns true if name ends with a path separator.
+func hasTrailingSeparator(name string) bool {
+	return name != "" && os.IsPathSeparator(name[len(name)-1])
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
@@ -286,7 +290,70 @@ func TestProcessGlobs(t *testing.T) {
 			}
 		}
 
-		ch, err := processGlobs(tst.globs, tst.bucket, tst.key, tst.recursive, false)
+		ch, err := processGlobs(context.Background(),
+			tst.globs, nil, nil, nil, tst.bucket, tst.key, tst.recursive, false)
 		tst.expect(tstDir, ch, err)
 	}
 }
+
+func TestProcessGlobsURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		// respond with the name of the requested file, matching the
+		// content of the files used in TestProcessGlobs
+		io.WriteString(w, path.Base(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	globs := []string{
+		fmt.Sprintf("%s/data/a.csv", srv.URL),
+		fmt.Sprintf("%s/missing", srv.URL),
+		fmt.Sprintf("%s/b.csv?version=1", srv.URL),
+	}
+
+	ch, err := processGlobs(context.Background(), globs, nil, nil, nil, "bucket", "z/", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	x := test_globs_gather(ch)
+
+	defer test_globs_close(t, x)
+
+	test_globs_expect(t, "", x, "bucket", []string{"z/a.csv", "z/b.csv"})
+}
+
+// Validate that no further sources are returned once the context is canceled
+func TestProcessGlobsCancel(t *testing.T) {
+	dir := t.TempDir()
+
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%d.csv", i))
+		if err := os.WriteFile(name, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := processGlobs(ctx, []string{dir}, nil, nil, nil, "bucket", "z/", true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj := <-ch
+	obj.rc.Close()
+	cancel()
+
+	// an object may already have been sent before the cancel was seen
+	x := test_globs_gather(ch)
+	defer test_globs_close(t, x)
+
+	if len(x) > 1 {
+		t.Errorf("expected at most 1 more object once canceled, got %d", len(x))
+	}
+}
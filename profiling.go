@@ -1,13 +1,65 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
 )
 
+var errMemProfileInterval = errors.New(
+	"-mem-profile-interval requires -mem-profile")
+
+// memProfileName returns the name of the n-th periodic memory profile, which is
+// numbered ahead of any extension in name, e.g., mem.0001.pprof for
+// mem.pprof.
+func memProfileName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.%04d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// writeMemProfile writes a heap profile to a new file at name.
+func writeMemProfile(name string) error {
+	fh, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	runtime.GC()
+
+	if err := pprof.WriteHeapProfile(fh); err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
+
+// periodicMemProfiles writes numbered memory profiles derived from name every
+// interval until stop is closed.
+func periodicMemProfiles(name string, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for n := 1; ; n++ {
+		select {
+		case <-ticker.C:
+			if err := writeMemProfile(memProfileName(name, n)); err != nil {
+				log.Printf("unable to write memory profile: %s", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 // profilers enables any optional cpu, memory, or trace profiling outputs, and
 // returns a shutdown function to be called when the program exits.
 func profilers(opts *Options) (shutdown func(), err error) {
@@ -15,7 +67,14 @@ func profilers(opts *Options) (shutdown func(), err error) {
 	var memProfileOut *os.File
 	var traceOut *os.File
 
+	var memProfileStop chan struct{}
+	memProfiles := &sync.WaitGroup{}
+
 	shutdown = func() {
+		if memProfileStop != nil {
+			close(memProfileStop)
+			memProfiles.Wait()
+		}
 		if cpuProfileOut != nil {
 			pprof.StopCPUProfile()
 			cpuProfileOut.Close()
@@ -54,6 +113,17 @@ func profilers(opts *Options) (shutdown func(), err error) {
 			shutdown()
 			return nil, err
 		}
+
+		// in addition to the profile written at exit, optionally
+		// write numbered profiles during the run
+		if opts.MemProfileInterval > 0 {
+			memProfileStop = make(chan struct{})
+			memProfiles.Add(1)
+			go func() {
+				defer memProfiles.Done()
+				periodicMemProfiles(opts.MemProfile, opts.MemProfileInterval, memProfileStop)
+			}()
+		}
 	}
 
 	if opts.Trace != "" {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+// Validate the names of periodic memory profiles
+func TestMemProfileName(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		expect string
+	}{
+		{"mem.pprof", 1, "mem.0001.pprof"},
+		{"mem", 12, "mem.0012"},
+		{"out/run.1/mem.prof", 3, "out/run.1/mem.0003.prof"},
+	}
+
+	for i, test := range tests {
+		if name := memProfileName(test.name, test.n); name != test.expect {
+			t.Errorf("%d expected %s got %s", i, test.expect, name)
+		}
+	}
+}
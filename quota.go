@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrQuota is returned when objects were skipped because Options.MaxObjects
+// or Options.MaxBytes was exceeded
+var ErrQuota = errors.New("quota exceeded")
+
+var errBadQuota = errors.New(
+	"-max-objects and -max-bytes must not be negative")
+
+// quota limits the number of objects, and their total size, queued for upload
+// during a run.  Once an object would exceed either limit no further objects
+// are queued, protecting against runaway globs, and the objects skipped are
+// counted so that they may be reported.
+type quota struct {
+	maxObjects int
+	maxBytes   int64
+
+	nobjects int
+	nbytes   int64
+
+	// exceeded is set once the first object is skipped, after which all
+	// objects are skipped
+	exceeded bool
+
+	nskipped     int
+	skippedBytes int64
+}
+
+// newQuota returns a quota applying the limits, or nil if neither is set.
+func newQuota(maxObjects int, maxBytes int64) *quota {
+	if maxObjects == 0 && maxBytes == 0 {
+		return nil
+	}
+
+	return &quota{
+		maxObjects: maxObjects,
+		maxBytes:   maxBytes,
+	}
+}
+
+// admit returns true if obj may be queued for upload.  Sources with an unknown
+// size (e.g., URLs) count towards the object limit only.
+func (p *quota) admit(obj *uploadObject) bool {
+	if p == nil {
+		return true
+	}
+
+	var size int64
+	if fi, ok := localFileInfo(obj.rc); ok {
+		size = fi.Size()
+	}
+
+	if !p.exceeded {
+		overObjects := p.maxObjects > 0 && p.nobjects+1 > p.maxObjects
+		overBytes := p.maxBytes > 0 && p.nbytes+size > p.maxBytes
+
+		if !overObjects && !overBytes {
+			p.nobjects += 1
+			p.nbytes += size
+			return true
+		}
+
+		p.exceeded = true
+
+		log.Printf("quota exceeded at object %s/%s, no further objects will be uploaded",
+			obj.bucket, obj.key)
+	}
+
+	p.nskipped += 1
+	p.skippedBytes += size
+
+	return false
+}
+
+// release returns the share of the quota taken by obj, once admitted, if it
+// is not uploaded after all (e.g., it is skipped by -sync).
+func (p *quota) release(obj *uploadObject) {
+	if p == nil {
+		return
+	}
+
+	var size int64
+	if fi, ok := localFileInfo(obj.rc); ok {
+		size = fi.Size()
+	}
+
+	p.nobjects -= 1
+	p.nbytes -= size
+}
+
+// Err returns an error wrapping ErrQuota describing the objects skipped, or
+// nil if none were.
+func (p *quota) Err() error {
+	if p == nil || !p.exceeded {
+		return nil
+	}
+
+	return fmt.Errorf("%w: skipped %d objects (%s) after queueing %d objects (%s)",
+		ErrQuota, p.nskipped, ByteSize(p.skippedBytes), p.nobjects, ByteSize(p.nbytes))
+}
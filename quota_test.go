@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Validate that once an object exceeds the quota all later objects are
+// skipped, and released objects do not count
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+
+	open := func(size int) *uploadObject {
+		fh, err := os.CreateTemp(dir, "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fh.Close() })
+
+		if _, err := fh.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+
+		return &uploadObject{bucket: "bucket", key: "key", rc: fh}
+	}
+
+	url := func() *uploadObject {
+		return &uploadObject{bucket: "bucket", key: "key",
+			rc: io.NopCloser(strings.NewReader("url"))}
+	}
+
+	for i, tst := range []struct {
+		maxObjects int
+		maxBytes   int64
+		objs       []*uploadObject
+		admitted   []bool
+	}{
+		{0, 0, []*uploadObject{open(10), open(10)}, []bool{true, true}},
+		{2, 0, []*uploadObject{open(10), url(), open(1), open(1)},
+			[]bool{true, true, false, false}},
+		{0, 15, []*uploadObject{open(10), url(), open(10), open(1)},
+			[]bool{true, true, false, false}},
+		{0, 15, []*uploadObject{open(10), open(5), open(0)},
+			[]bool{true, true, true}},
+	} {
+		limit := newQuota(tst.maxObjects, tst.maxBytes)
+
+		for j, obj := range tst.objs {
+			if admitted := limit.admit(obj); admitted != tst.admitted[j] {
+				t.Errorf("%d.%d expected %t got %t", i, j, tst.admitted[j], admitted)
+			}
+		}
+
+		exceeded := !tst.admitted[len(tst.admitted)-1]
+		if err := limit.Err(); errors.Is(err, ErrQuota) != exceeded {
+			t.Errorf("%d expected exceeded %t got %v", i, exceeded, err)
+		}
+	}
+
+	limit := newQuota(1, 0)
+	for i, obj := range []*uploadObject{open(10), open(10)} {
+		if !limit.admit(obj) {
+			t.Errorf("%d expected released objects to not count", i)
+		}
+		limit.release(obj)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errRepairArgs = errors.New(
+	"repair requires a single <file>, the source of the upload")
+
+var errRepairTarget = errors.New(
+	"repair requires -state-file or -upload-id with a non-prefix -key")
+
+var errRepairState = errors.New(
+	"repair requires -state-file to list exactly one matching upload")
+
+// repairTarget returns the ResumeState describing the pending upload to
+// repair.  With -state-file the upload is selected from those listed by
+// bucket, and by -upload-id or -key if set, otherwise -key and -upload-id
+// name the upload and the part size and checksum algorithm are taken from
+// -part-size and -checksum.
+func repairTarget(opts *Options) (*ResumeState, error) {
+	if opts.StateFile == "" {
+		if opts.UploadID == "" || opts.key == "" || strings.HasSuffix(opts.key, "/") {
+			return nil, errRepairTarget
+		}
+
+		return &ResumeState{
+			Bucket:            opts.bucket,
+			Key:               opts.key,
+			UploadId:          opts.UploadID,
+			PartSize:          int64(opts.PartSize),
+			ChecksumAlgorithm: opts.ChecksumAlgorithm.String(),
+		}, nil
+	}
+
+	fh, err := os.Open(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	states, err := ReadResumeStates(fh)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read -state-file: %s: %w", opts.StateFile, err)
+	}
+
+	var found []*ResumeState
+	for _, st := range states {
+		switch {
+		case st.Bucket != opts.bucket:
+		case opts.UploadID != "" && st.UploadId != opts.UploadID:
+		case opts.key != "" && st.Key != opts.key:
+		default:
+			found = append(found, st)
+		}
+	}
+
+	if len(found) != 1 {
+		return nil, fmt.Errorf("%w: %d found", errRepairState, len(found))
+	}
+
+	return found[0], nil
+}
+
+// listParts returns the parts the server holds for a pending upload, by part
+// number.
+func listParts(ctx context.Context, st *ResumeState, opts *Options) (map[int32]types.Part, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	params := &s3.ListPartsInput{
+		Bucket:   &st.Bucket,
+		Key:      &st.Key,
+		UploadId: &st.UploadId,
+	}
+	params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5 = opts.objOpt.sseCustomer()
+
+	paginator := s3.NewListPartsPaginator(s3client, params)
+
+	parts := map[int32]types.Part{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range page.Parts {
+			if part.PartNumber != nil {
+				parts[*part.PartNumber] = part
+			}
+		}
+	}
+
+	return parts, nil
+}
+
+// partChecksum returns the Checksum<algo> field of a types.Part.
+func partChecksum(algo *ChecksumAlgorithm, part types.Part) *string {
+	switch algo {
+	case ChecksumAlgorithmSHA256:
+		return part.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		return part.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		return part.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		return part.ChecksumCRC32
+	}
+	return nil
+}
+
+// partMatches returns true if part, as held by the server, has the size,
+// ETag, and checksum calculated by hr for part partID.  The ETag is only
+// compared if compareETag is true, as it is not the MD5 of the part when it
+// is encrypted using a KMS key or SSE-C (see etagIsMD5).
+func partMatches(hr *S3Hasher, partID int32, part types.Part, compareETag bool) bool {
+	switch {
+	case part.Size == nil || *part.Size != hr.PartSize(partID):
+	case compareETag && (part.ETag == nil || strings.Trim(*part.ETag, `"`) != hr.MD5SumPart(partID).Hex()):
+	case partChecksum(hr.ChecksumAlgorithm(), part) != nil &&
+		*partChecksum(hr.ChecksumAlgorithm(), part) != hr.SumPart(partID).Base64():
+	default:
+		return true
+	}
+
+	return false
+}
+
+// repairPlan compares the parts held by the server against those calculated
+// for the source by hr, returning the part numbers that are missing or whose
+// size, ETag (if compareETag is true), or checksum does not match, and so must
+// be uploaded again.
+func repairPlan(hr *S3Hasher, parts map[int32]types.Part, compareETag bool) []int32 {
+	var repair []int32
+
+	for partID := int32(1); partID <= int32(hr.Count()); partID++ {
+		if part, ok := parts[partID]; ok && partMatches(hr, partID, part, compareETag) {
+			continue
+		}
+
+		repair = append(repair, partID)
+	}
+
+	return repair
+}
+
+// repairPart uploads the byte range of part partID from r.
+func repairPart(ctx context.Context, r io.ReaderAt, st *ResumeState, hr *S3Hasher, partID int32, opts *Options) (*s3.UploadPartOutput, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	part := &s3.UploadPartInput{
+		Bucket:     &st.Bucket,
+		Key:        &st.Key,
+		UploadId:   &st.UploadId,
+		PartNumber: &partID,
+		Body: io.NewSectionReader(r,
+			int64(partID-1)*st.PartSize, hr.PartSize(partID)),
+	}
+
+	hr.SetUploadPartChecksums(partID, part)
+
+	if opts.Verbose {
+		log.Printf("uploading part %d of %s/%s using UploadId %s",
+			partID, st.Bucket, st.Key, st.UploadId)
+	}
+
+	partCtx, cancel := withTimeout(ctx, opts.UploadPartTimeout)
+	defer cancel()
+
+	out, err := s3client.UploadPart(partCtx, part)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := hr.CheckUploadPartChecksums(part, out); err != nil {
+		return nil, err
+	}
+
+	if opts.RequireContentMD5 {
+		if err := hr.CheckUploadPartContentMD5(part, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// repairUpload hashes the source file name using the part size and checksum
+// algorithm of the pending upload st, uploads only the parts the server is
+// missing or holds with the wrong content, and completes the upload.
+func repairUpload(ctx context.Context, name string, st *ResumeState, opts *Options) error {
+	algo, err := parseChecksumAlgorithm(st.ChecksumAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	if st.PartSize < MinPartSize || st.PartSize > MaxPartSize {
+		return fmt.Errorf("%w: %d", errBadPartSize, st.PartSize)
+	}
+
+	fh, err := os.Open(longPath(name))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	s3hw := NewS3HashWriter(algo, st.PartSize)
+	if _, err := io.Copy(s3hw, fh); err != nil {
+		return err
+	}
+
+	if s3hw.Count() == 0 {
+		return fmt.Errorf("empty source: %s", name)
+	}
+
+	parts, err := listParts(ctx, st, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list parts of %s/%s (upload-id %s): %w",
+			st.Bucket, st.Key, st.UploadId, err)
+	}
+
+	repair := repairPlan(s3hw.S3Hasher, parts, opts.objOpt.etagIsMD5())
+
+	log.Printf("repairing %d of %d parts of %s/%s (upload-id %s)",
+		len(repair), s3hw.Count(), st.Bucket, st.Key, st.UploadId)
+
+	for _, partID := range repair {
+		out, err := repairPart(ctx, fh, st, s3hw.S3Hasher, partID, opts)
+		if err != nil {
+			return fmt.Errorf("unable to upload part %d: %w", partID, err)
+		}
+
+		parts[partID] = types.Part{
+			PartNumber: &partID,
+			ETag:       out.ETag,
+		}
+	}
+
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          &st.Bucket,
+		Key:             &st.Key,
+		UploadId:        &st.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{},
+	}
+
+	for partID := int32(1); partID <= int32(s3hw.Count()); partID++ {
+		completed := types.CompletedPart{
+			PartNumber: &partID,
+			ETag:       parts[partID].ETag,
+		}
+
+		s3hw.SetCompletedPartChecksum(partID, &completed)
+
+		complete.MultipartUpload.Parts = append(
+			complete.MultipartUpload.Parts, completed)
+	}
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	if opts.Verbose {
+		log.Printf("completing upload for multi-part object %s/%s using UploadId %s",
+			st.Bucket, st.Key, st.UploadId)
+	}
+
+	completeCtx, cancel := withTimeout(ctx, opts.CompleteUploadTimeout)
+	defer cancel()
+
+	out, err := s3client.CompleteMultipartUpload(completeCtx, complete)
+	if err != nil {
+		return fmt.Errorf("unable to complete %s/%s (upload-id %s): %w",
+			st.Bucket, st.Key, st.UploadId, err)
+	}
+
+	verification := NewMultipartVerification(
+		s3hw.S3Hasher, out.ETag, map[*ChecksumAlgorithm]*string{
+			ChecksumAlgorithmCRC32:  out.ChecksumCRC32,
+			ChecksumAlgorithmCRC32C: out.ChecksumCRC32C,
+			ChecksumAlgorithmSHA1:   out.ChecksumSHA1,
+			ChecksumAlgorithmSHA256: out.ChecksumSHA256,
+		}, opts.objOpt.etagIsMD5())
+
+	return verification.Err()
+}
+
+// runRepair implements "s3up repair", re-uploading the missing or mismatched
+// parts of a pending multi-part upload from its source file, and completing
+// the upload.
+func runRepair(ctx context.Context, args []string) error {
+	opts, err := processFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.globs) != 1 {
+		return errRepairArgs
+	}
+
+	st, err := repairTarget(opts)
+	if err != nil {
+		return err
+	}
+
+	if !opts.DisableRegionDetect {
+		useBucketRegion(ctx, st.Bucket, opts)
+	}
+
+	if opts.PathStyle == PathStyleAuto {
+		useAddressing(ctx, st.Bucket, opts)
+	}
+
+	if err := repairUpload(ctx, opts.globs[0], st, opts); err != nil {
+		return err
+	}
+
+	log.Printf("repaired %s/%s", st.Bucket, st.Key)
+
+	return nil
+}
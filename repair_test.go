@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestRepairPlan(t *testing.T) {
+	partSize := MinPartSize
+	data := bytes.Repeat([]byte("0123456789"), int(partSize*3/10+5))
+
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, partSize)
+	s3hw.Write(data)
+	hr := s3hw.S3Hasher
+
+	good := func(partID int32) types.Part {
+		return types.Part{
+			PartNumber:     aws.Int32(partID),
+			Size:           aws.Int64(hr.PartSize(partID)),
+			ETag:           aws.String(`"` + hr.MD5SumPart(partID).Hex() + `"`),
+			ChecksumSHA256: aws.String(hr.SumPart(partID).Base64()),
+		}
+	}
+
+	if hr.Count() != 4 {
+		t.Fatalf("expected 4 parts, got %d", hr.Count())
+	}
+
+	badSize := good(2)
+	badSize.Size = aws.Int64(1)
+
+	badETag := good(3)
+	badETag.ETag = aws.String(`"00000000000000000000000000000000"`)
+
+	badChecksum := good(4)
+	badChecksum.ChecksumSHA256 = aws.String("AAAA")
+
+	// with SSE-KMS the part ETags are not the MD5 of the part
+	kmsETag := func(partID int32) types.Part {
+		part := good(partID)
+		part.ETag = aws.String(`"kms-etag"`)
+		return part
+	}
+
+	kms := (&ObjectOptions{ServerSideEncryption: types.ServerSideEncryptionAwsKms}).etagIsMD5()
+
+	for i, tst := range []struct {
+		parts       map[int32]types.Part
+		compareETag bool
+		expect      []int32
+	}{
+		{map[int32]types.Part{1: good(1), 2: good(2), 3: good(3), 4: good(4)}, true, nil},
+		{map[int32]types.Part{}, true, []int32{1, 2, 3, 4}},
+		{map[int32]types.Part{1: good(1), 3: good(3)}, true, []int32{2, 4}},
+		{map[int32]types.Part{1: good(1), 2: badSize, 3: badETag, 4: badChecksum}, true, []int32{2, 3, 4}},
+		{map[int32]types.Part{1: kmsETag(1), 2: kmsETag(2), 3: kmsETag(3), 4: kmsETag(4)}, kms, nil},
+		{map[int32]types.Part{1: kmsETag(1), 2: badSize, 3: badETag, 4: badChecksum}, kms, []int32{2, 4}},
+	} {
+		got := repairPlan(hr, tst.parts, tst.compareETag)
+		if !slices.Equal(got, tst.expect) {
+			t.Errorf("%d expected %v, got %v", i, tst.expect, got)
+		}
+	}
+}
+
+func TestRepairTarget(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+
+	states := []*ResumeState{
+		{Bucket: "b", Key: "a.dat", UploadId: "1", PartSize: MinPartSize, ChecksumAlgorithm: "SHA256"},
+		{Bucket: "b", Key: "b.dat", UploadId: "2", PartSize: MinPartSize, ChecksumAlgorithm: "SHA256"},
+	}
+
+	if err := writeStateFile(name, states); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tst := range []struct {
+		opts   *Options
+		expect string
+		err    error
+	}{
+		{&Options{bucket: "b", StateFile: name, UploadID: "2"}, "2", nil},
+		{&Options{bucket: "b", StateFile: name, key: "a.dat"}, "1", nil},
+		{&Options{bucket: "b", StateFile: name}, "", errRepairState},
+		{&Options{bucket: "c", StateFile: name, UploadID: "2"}, "", errRepairState},
+		{&Options{bucket: "b", key: "a.dat", UploadID: "3", ChecksumAlgorithm: ChecksumAlgorithmSHA256}, "3", nil},
+		{&Options{bucket: "b", key: "a/", UploadID: "3"}, "", errRepairTarget},
+		{&Options{bucket: "b", key: "a.dat"}, "", errRepairTarget},
+	} {
+		st, err := repairTarget(tst.opts)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+			continue
+		}
+
+		if err == nil && st.UploadId != tst.expect {
+			t.Errorf("%d expected upload %s, got %s", i, tst.expect, st.UploadId)
+		}
+	}
+}
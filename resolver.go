@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errBadResolve = errors.New(
+	"-resolve must be host:addr or host:port:addr")
+
+// Resolver resolves the host names of connections made to S3, using any
+// addresses provided with -resolve in place of DNS, and optionally caching
+// DNS results.
+type Resolver struct {
+	// overrides maps "host:port" or "host" to an address
+	overrides map[string]string
+
+	// ttl is how long DNS results are cached, if 0 they are not
+	ttl time.Duration
+
+	mu    *sync.Mutex
+	cache map[string]*resolverEntry
+
+	dialer *net.Dialer
+}
+
+// resolverEntry holds the cached addresses for a host.
+type resolverEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewResolver initializes a new Resolver, caching DNS results for ttl.
+func NewResolver(ttl time.Duration) *Resolver {
+	return &Resolver{
+		overrides: map[string]string{},
+		ttl:       ttl,
+		mu:        &sync.Mutex{},
+		cache:     map[string]*resolverEntry{},
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+	}
+}
+
+// Set adds an override in the curl --resolve style, "host:port:addr" applies
+// to connections to host on port, and "host:addr" to host on any port.  IPv6
+// addresses may be enclosed in brackets.
+func (p *Resolver) Set(s string) error {
+	host, rest, found := strings.Cut(s, ":")
+	if !found || host == "" || rest == "" {
+		return fmt.Errorf("%w: %s", errBadResolve, s)
+	}
+
+	target := host
+	if port, addr, found := strings.Cut(rest, ":"); found && addr != "" {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			target = net.JoinHostPort(host, port)
+			rest = addr
+		}
+	}
+
+	addr := strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+	if net.ParseIP(addr) == nil {
+		return fmt.Errorf("%w: not an IP address: %s", errBadResolve, rest)
+	}
+
+	p.overrides[strings.ToLower(target)] = addr
+
+	return nil
+}
+
+// lookup returns the addresses to connect to for host and port.
+func (p *Resolver) lookup(ctx context.Context, host, port string) ([]string, error) {
+	host = strings.ToLower(host)
+
+	if addr, ok := p.overrides[net.JoinHostPort(host, port)]; ok {
+		return []string{addr}, nil
+	}
+
+	if addr, ok := p.overrides[host]; ok {
+		return []string{addr}, nil
+	}
+
+	if p.ttl <= 0 || net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	p.mu.Lock()
+	entry, ok := p.cache[host]
+	p.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[host] = &resolverEntry{
+		addrs:   addrs,
+		expires: time.Now().Add(p.ttl),
+	}
+	p.mu.Unlock()
+
+	return addrs, nil
+}
+
+// DialContext connects to address, trying each address it resolves to in
+// turn until one succeeds.
+func (p *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := p.lookup(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := p.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// HTTPClient returns client configured to connect using the Resolver.  Only
+// the AWS SDK default client may be configured, any other client is returned
+// unchanged.
+func (p *Resolver) HTTPClient(client s3.HTTPClient) s3.HTTPClient {
+	if bc, ok := client.(*awshttp.BuildableClient); ok {
+		return bc.WithTransportOptions(func(tr *http.Transport) {
+			tr.DialContext = p.DialContext
+		})
+	}
+	return client
+}
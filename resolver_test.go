@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	p := NewResolver(0)
+
+	for i, s := range []string{
+		"s3.example.org:443:10.0.0.5",
+		"minio.example.org:10.0.0.6",
+		"ipv6.example.org:9000:[::1]",
+	} {
+		if err := p.Set(s); err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+	}
+
+	for i, s := range []string{"s3.example.org", "s3.example.org:443:host", ":10.0.0.1"} {
+		if err := p.Set(s); !errors.Is(err, errBadResolve) {
+			t.Errorf("%d expected errBadResolve got %v", i, err)
+		}
+	}
+
+	for i, tst := range []struct {
+		host   string
+		port   string
+		expect []string
+	}{
+		{"s3.example.org", "443", []string{"10.0.0.5"}},
+		{"S3.Example.Org", "443", []string{"10.0.0.5"}},
+		{"s3.example.org", "80", []string{"s3.example.org"}},
+		{"minio.example.org", "9000", []string{"10.0.0.6"}},
+		{"ipv6.example.org", "9000", []string{"::1"}},
+		{"10.0.0.9", "443", []string{"10.0.0.9"}},
+	} {
+		actual, err := p.lookup(context.Background(), tst.host, tst.port)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+		if !slices.Equal(actual, tst.expect) {
+			t.Errorf("%d expected %v got %v", i, tst.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errResumeOptions = errors.New(
+	"-resume cannot be combined with -state-file, -upload-id or -stream-parts")
+
+// resumeUploads holds the pending multi-part uploads read from a -resume
+// state file, by bucket and key, that have not yet been resumed.
+type resumeUploads struct {
+	mu     *sync.Mutex
+	states map[string]*ResumeState
+}
+
+// readResumeUploads reads the pending uploads from the state file at name,
+// as written by writeStateFile.  A missing file lists no uploads, e.g., on
+// the first run.
+func readResumeUploads(name string) (*resumeUploads, error) {
+	p := &resumeUploads{
+		mu:     &sync.Mutex{},
+		states: map[string]*ResumeState{},
+	}
+
+	fh, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	states, err := ReadResumeStates(fh)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, st := range states {
+		p.states[st.Bucket+"/"+st.Key] = st
+	}
+
+	return p, nil
+}
+
+// take returns the pending upload to Bucket/Key, removing it so that it is
+// only resumed once, or nil if there is none.  An upload whose part size or
+// checksum algorithm differs from those the object is hashed with cannot be
+// resumed, and is left pending on the server.
+func (p *resumeUploads) take(Bucket, Key string, partSize int64, algo *ChecksumAlgorithm) *ResumeState {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	st, ok := p.states[Bucket+"/"+Key]
+	delete(p.states, Bucket+"/"+Key)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if st.PartSize != partSize || st.ChecksumAlgorithm != algo.String() {
+		log.Printf("unable to resume %s/%s (upload-id %s): part size %d and checksum %s do not match, starting a new upload",
+			Bucket, Key, st.UploadId, st.PartSize, st.ChecksumAlgorithm)
+		return nil
+	}
+
+	return st
+}
+
+// remaining returns the pending uploads that were not resumed.
+func (p *resumeUploads) remaining() []*ResumeState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states := make([]*ResumeState, 0, len(p.states))
+	for _, st := range p.states {
+		states = append(states, st)
+	}
+
+	return states
+}
+
+// resumedPart returns the results of uploading part partID of a resumed
+// upload if the server already holds it with the size, ETag (if compareETag
+// is true), and checksum calculated by hr, or nil if the part must be
+// uploaded.
+func resumedPart(hr *S3Hasher, partID int32, parts map[int32]types.Part, compareETag bool) *s3.UploadPartOutput {
+	part, ok := parts[partID]
+	if !ok || !partMatches(hr, partID, part, compareETag) {
+		return nil
+	}
+
+	return &s3.UploadPartOutput{
+		ETag:           part.ETag,
+		ChecksumCRC32:  part.ChecksumCRC32,
+		ChecksumCRC32C: part.ChecksumCRC32C,
+		ChecksumSHA1:   part.ChecksumSHA1,
+		ChecksumSHA256: part.ChecksumSHA256,
+	}
+}
+
+// writeResumeFile rewrites the -resume state file at name with the uploads
+// still pending, removing it once there are none.
+func writeResumeFile(name string, states []*ResumeState) error {
+	if len(states) == 0 {
+		err := os.Remove(name)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+
+	return writeStateFile(name, states)
+}
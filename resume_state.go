@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ResumeState records a pending multi-part upload, and the parts uploaded to it
+// so far, in enough detail for a later invocation to resume the upload.
+type ResumeState struct {
+	Bucket            string
+	Key               string
+	UploadId          string
+	PartSize          int64
+	ChecksumAlgorithm string
+	Parts             []*ResumePart
+}
+
+// ResumePart records a part successfully uploaded to a pending multi-part
+// upload.  The Checksum is the base64 encoded checksum of the part using the
+// ResumeState ChecksumAlgorithm.
+type ResumePart struct {
+	PartNumber int32
+	Size       int64
+	ETag       string `json:",omitempty"`
+	Checksum   string `json:",omitempty"`
+}
+
+// resumeState returns a ResumeState for a multi-part upload, listing the parts
+// that were successfully uploaded.
+func (p *S3UploadState) resumeState(partSize int64) *ResumeState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	algo := p.hr.ChecksumAlgorithm()
+
+	rs := &ResumeState{
+		Bucket:            *p.create.Bucket,
+		Key:               *p.create.Key,
+		UploadId:          *p.createOutput.UploadId,
+		PartSize:          partSize,
+		ChecksumAlgorithm: algo.String(),
+	}
+
+	for partID, out := range p.uploadPartOutputs {
+		if out == nil || p.uploadPartErrors[partID] != nil {
+			continue
+		}
+
+		part := &ResumePart{
+			PartNumber: partID + p.partOffset,
+		}
+
+		if out.ETag != nil {
+			part.ETag = *out.ETag
+		}
+
+		if in := p.uploadPartInputs[partID]; in != nil {
+			if sized, ok := in.Body.(interface{ Size() int64 }); ok {
+				part.Size = sized.Size()
+			}
+
+			if sum := uploadPartChecksum(algo, in); sum != nil {
+				part.Checksum = *sum
+			}
+		}
+
+		rs.Parts = append(rs.Parts, part)
+	}
+
+	slices.SortFunc(rs.Parts, func(a, b *ResumePart) int {
+		return cmp.Compare(a.PartNumber, b.PartNumber)
+	})
+
+	return rs
+}
+
+// uploadPartChecksum returns the Checksum<algo> field set on an
+// s3.UploadPartInput for the specified algorithm.
+func uploadPartChecksum(algo *ChecksumAlgorithm, part *s3.UploadPartInput) *string {
+	switch algo {
+	case ChecksumAlgorithmSHA256:
+		return part.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		return part.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		return part.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		return part.ChecksumCRC32
+	}
+	return nil
+}
+
+// WriteResumeStates writes states to w as a JSON array.
+func WriteResumeStates(w io.Writer, states []*ResumeState) error {
+	buf, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	_, err = w.Write(buf)
+
+	return err
+}
+
+// writeStateFile creates (or truncates) the file at name and writes states to
+// it using WriteResumeStates.
+func writeStateFile(name string, states []*ResumeState) error {
+	fh, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteResumeStates(fh, states); err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
+
+// ReadResumeStates reads a JSON array of ResumeState from r, as written by
+// WriteResumeStates.
+func ReadResumeStates(r io.Reader) ([]*ResumeState, error) {
+	var states []*ResumeState
+
+	if err := json.NewDecoder(r).Decode(&states); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
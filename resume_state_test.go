@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Validate that ResumeState records survive a round-trip through
+// WriteResumeStates and ReadResumeStates
+func TestResumeStatesRoundTrip(t *testing.T) {
+	expect := []*ResumeState{
+		{
+			Bucket:            "bucket",
+			Key:               "prefix/key",
+			UploadId:          "upload-id",
+			PartSize:          MinPartSize,
+			ChecksumAlgorithm: ChecksumAlgorithmSHA256.String(),
+			Parts: []*ResumePart{
+				{
+					PartNumber: 1,
+					Size:       MinPartSize,
+					ETag:       `"etag"`,
+					Checksum:   "checksum",
+				},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteResumeStates(buf, expect); err != nil {
+		t.Fatalf("unable to write resume states: %s", err)
+	}
+
+	actual, err := ReadResumeStates(buf)
+	if err != nil {
+		t.Fatalf("unable to read resume states: %s", err)
+	}
+
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("expected %#v got %#v", expect, actual)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Validate pending uploads are taken from a -resume state file once, and
+// only if they were hashed the same way
+func TestResumeUploads(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+
+	ru, err := readResumeUploads(name)
+	if err != nil || len(ru.remaining()) != 0 {
+		t.Fatalf("expected no uploads from a missing file, got %v", err)
+	}
+
+	if err := writeStateFile(name, []*ResumeState{
+		{Bucket: "b", Key: "a.dat", UploadId: "1", PartSize: 64, ChecksumAlgorithm: "SHA256"},
+		{Bucket: "b", Key: "b.dat", UploadId: "2", PartSize: 128, ChecksumAlgorithm: "SHA256"},
+		{Bucket: "b", Key: "c.dat", UploadId: "3", PartSize: 64, ChecksumAlgorithm: "SHA256"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ru, err = readResumeUploads(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tst := range []struct {
+		key    string
+		expect string
+	}{
+		{"a.dat", "1"},
+		{"a.dat", ""},
+		{"b.dat", ""},
+		{"d.dat", ""},
+	} {
+		var actual string
+		if st := ru.take("b", tst.key, 64, ChecksumAlgorithmSHA256); st != nil {
+			actual = st.UploadId
+		}
+		if actual != tst.expect {
+			t.Errorf("%d expected upload %q, got %q", i, tst.expect, actual)
+		}
+	}
+
+	remaining := ru.remaining()
+	if len(remaining) != 1 || remaining[0].UploadId != "3" {
+		t.Errorf("expected upload 3 to remain, got %+v", remaining)
+	}
+
+	if err := writeResumeFile(name, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected the state file to be removed, got %v", err)
+	}
+}
+
+// Validate a resumed upload only uploads the parts the server does not
+// already hold with the expected content
+func TestUploadResume(t *testing.T) {
+	const partSize = 64
+
+	data := make([]byte, partSize*3)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, partSize)
+	s3hw.Write(data)
+	hr := s3hw.S3Hasher
+
+	var mu sync.Mutex
+	var requests []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && query.Has("uploadId"):
+			requests = append(requests, "list")
+
+			// part 1 is held, part 2 is held with the wrong content
+			fmt.Fprintf(w, `<ListPartsResult>`+
+				`<Part><PartNumber>1</PartNumber><ETag>"%s"</ETag><Size>%d</Size><ChecksumSHA256>%s</ChecksumSHA256></Part>`+
+				`<Part><PartNumber>2</PartNumber><ETag>"%s"</ETag><Size>%d</Size></Part>`+
+				`</ListPartsResult>`,
+				hr.MD5SumPart(1).Hex(), partSize, hr.SumPart(1).Base64(),
+				hr.MD5SumPart(1).Hex(), partSize)
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			requests = append(requests, "create")
+		case r.Method == http.MethodPut && query.Has("partNumber"):
+			requests = append(requests, "part "+query.Get("partNumber")+" "+query.Get("uploadId"))
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			requests = append(requests, "complete")
+			fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.ConcurrentParts = 1
+	opts.resume = &resumeUploads{
+		mu: &sync.Mutex{},
+		states: map[string]*ResumeState{
+			"bucket/key": {Bucket: "bucket", Key: "key", UploadId: "old", PartSize: partSize, ChecksumAlgorithm: "SHA256"},
+		},
+	}
+
+	uploader := NewUploader(context.Background(), opts)
+
+	res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+	if res.Error != nil {
+		t.Fatalf("expected no error, got %s", res.Error)
+	}
+
+	expect := []string{"list", "part 2 old", "part 3 old", "complete"}
+	if !slices.Equal(requests, expect) {
+		t.Errorf("expected %v, got %v", expect, requests)
+	}
+
+	if pending := uploader.Pending(); len(pending) != 0 {
+		t.Errorf("expected the resumed upload to be completed, got %d pending", len(pending))
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrRetryBudget is the cause of the context being canceled when too many of
+// the recent requests sent to S3 have failed
+var ErrRetryBudget = errors.New("retry budget exhausted")
+
+// retryBudgetWindow is the number of most recent requests considered by a
+// RetryBudget
+const retryBudgetWindow = 100
+
+// RetryBudget tracks the outcome of the most recent requests sent to S3 across
+// the whole run, and cancels the run once the fraction of those requests that
+// failed reaches a threshold, so that s3up stops retrying every object when
+// the endpoint is down or the credentials have expired.
+type RetryBudget struct {
+	// threshold is the fraction of failed requests that cancels the run
+	threshold float64
+
+	mu *sync.Mutex
+
+	// reasons holds the failure reason for each of the most recent
+	// requests, or "" for requests that succeeded
+	reasons  []string
+	next     int
+	failures int
+
+	cancel  context.CancelCauseFunc
+	tripped bool
+}
+
+// NewRetryBudget initializes a new RetryBudget, which cancels the run once
+// threshold (0.0 to 1.0) of the most recent requests have failed.
+func NewRetryBudget(threshold float64) *RetryBudget {
+	return &RetryBudget{
+		threshold: threshold,
+		mu:        &sync.Mutex{},
+	}
+}
+
+// Context returns a context which is canceled with a cause wrapping
+// ErrRetryBudget once the budget is exhausted.
+func (p *RetryBudget) Context(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	p.mu.Lock()
+	p.cancel = cancel
+	p.mu.Unlock()
+
+	return ctx
+}
+
+// record adds the outcome of a request, reason is "" if the request succeeded.
+func (p *RetryBudget) record(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.reasons) < retryBudgetWindow {
+		p.reasons = append(p.reasons, reason)
+	} else {
+		if p.reasons[p.next] != "" {
+			p.failures -= 1
+		}
+		p.reasons[p.next] = reason
+		p.next = (p.next + 1) % retryBudgetWindow
+	}
+
+	if reason != "" {
+		p.failures += 1
+	}
+
+	if p.tripped || len(p.reasons) < retryBudgetWindow ||
+		float64(p.failures) < p.threshold*float64(len(p.reasons)) {
+		return
+	}
+
+	p.tripped = true
+
+	err := fmt.Errorf("%w: %d of the last %d requests failed, most often with: %s",
+		ErrRetryBudget, p.failures, len(p.reasons), p.diagnosis())
+
+	log.Printf("aborting run: %s", err)
+
+	if p.cancel != nil {
+		p.cancel(err)
+	}
+}
+
+// diagnosis returns the most common failure reason of the recent requests.
+func (p *RetryBudget) diagnosis() string {
+	counts := map[string]int{}
+
+	var common string
+	for _, reason := range p.reasons {
+		if reason == "" {
+			continue
+		}
+		counts[reason] += 1
+		if counts[reason] > counts[common] {
+			common = reason
+		}
+	}
+
+	return common
+}
+
+// failureReason classifies the outcome of a request, returning "" for requests
+// that did not fail in a way that suggests the run cannot succeed, i.e.,
+// connection errors, server errors, and authentication failures are counted.
+func failureReason(req *http.Request, resp *http.Response, err error) string {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return ""
+		}
+
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+
+		return fmt.Sprintf("connection error: %s", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusUnauthorized,
+		resp.StatusCode == http.StatusForbidden:
+		return fmt.Sprintf("HTTP %s", resp.Status)
+	}
+
+	return ""
+}
+
+// HTTPClient wraps an s3.HTTPClient so that the outcome of every request is
+// recorded against the budget.
+func (p *RetryBudget) HTTPClient(client s3.HTTPClient) s3.HTTPClient {
+	return &retryBudgetHTTPClient{
+		client: client,
+		budget: p,
+	}
+}
+
+// retryBudgetHTTPClient implements s3.HTTPClient, recording the outcome of
+// each request sent by the underlying client.
+type retryBudgetHTTPClient struct {
+	client s3.HTTPClient
+	budget *RetryBudget
+}
+
+func (c *retryBudgetHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	c.budget.record(failureReason(req, resp, err))
+	return resp, err
+}
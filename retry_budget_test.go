@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRetryBudget(t *testing.T) {
+	for i, tst := range []struct {
+		failEvery int
+		tripped   bool
+	}{
+		{0, false},
+		{4, false},
+		{2, true},
+		{1, true},
+	} {
+		p := NewRetryBudget(0.5)
+		ctx := p.Context(context.Background())
+
+		for n := 0; n < 2*retryBudgetWindow; n++ {
+			if tst.failEvery > 0 && n%tst.failEvery == 0 {
+				p.record("HTTP 503 Service Unavailable")
+			} else {
+				p.record("")
+			}
+		}
+
+		err := context.Cause(ctx)
+		if tripped := errors.Is(err, ErrRetryBudget); tripped != tst.tripped {
+			t.Errorf("%d expected tripped %t got %v", i, tst.tripped, err)
+		}
+
+		if tst.tripped && !strings.Contains(err.Error(), "HTTP 503") {
+			t.Errorf("%d expected diagnosis HTTP 503 got %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// runIDMetadata is the user-defined metadata key (x-amz-meta-s3up-run) the
+// run ID is stored as on each object.
+const runIDMetadata = "s3up-run"
+
+// maxRunIDLength is the maximum length of a run ID in bytes.
+const maxRunIDLength = 128
+
+var errBadRunID = errors.New(
+	"-run-id must be at most 128 printable ASCII characters")
+
+// newRunID returns a unique identifier for the run, comprising the time the
+// run started and random hexadecimal characters, e.g.,
+// 20240102T030405Z-0a1b2c3d4e5f6a7b.
+func newRunID(t time.Time) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(buf)
+}
+
+// validRunID returns an error wrapping errBadRunID if s could not be stored
+// as user-defined metadata, which S3 returns in HTTP headers.
+func validRunID(s string) error {
+	if s == "" || len(s) > maxRunIDLength {
+		return fmt.Errorf("%w: %q", errBadRunID, s)
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return fmt.Errorf("%w: %q", errBadRunID, s)
+		}
+	}
+
+	return nil
+}
+
+// runMetadata returns the user-defined metadata recording runID, or nil if
+// runID is empty.
+func runMetadata(runID string) map[string]string {
+	if runID == "" {
+		return nil
+	}
+
+	return map[string]string{runIDMetadata: runID}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunID(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	a := newRunID(t0)
+	if !regexp.MustCompile(`^20240102T030405Z-[0-9a-f]{16}$`).MatchString(a) {
+		t.Errorf("expected time and random characters, got %s", a)
+	}
+
+	if b := newRunID(t0); a == b {
+		t.Errorf("expected unique run IDs, got %s twice", a)
+	}
+
+	if err := validRunID(a); err != nil {
+		t.Errorf("expected generated run ID to be valid, got %s", err)
+	}
+
+	for i, s := range []string{"", "ingest\n1", "ünïcødé", strings.Repeat("a", maxRunIDLength+1)} {
+		if err := validRunID(s); !errors.Is(err, errBadRunID) {
+			t.Errorf("%d expected %v, got %v", i, errBadRunID, err)
+		}
+	}
+
+	if md := runMetadata(""); md != nil {
+		t.Errorf("expected no metadata, got %v", md)
+	}
+
+	if md := runMetadata("run-1"); md[runIDMetadata] != "run-1" {
+		t.Errorf("expected run-1, got %v", md)
+	}
+}
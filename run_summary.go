@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// RunSummary records the totals for a run, written as JSON by -summary-out
+// for ingestion into transfer dashboards.  Unlike the manifest it has a single
+// record for the whole run.
+type RunSummary struct {
+	Started         time.Time
+	Finished        time.Time
+	DurationSeconds float64
+
+	// objects uploaded, that failed to upload, and that were skipped
+	// (e.g., by -sync or -max-objects)
+	Succeeded int
+	Failed    int
+	Skipped   int
+
+	// bytes uploaded by the objects that succeeded, and the average
+	// throughput over the run
+	Bytes          int64
+	BytesPerSecond float64
+
+	// requests sent to S3, and the attempts that were retries
+	Requests int64
+	Retries  int64
+
+	// Errors counts the failed objects by the class of error (see
+	// errorClass)
+	Errors map[string]int `json:",omitempty"`
+
+	mu *sync.Mutex
+}
+
+// NewRunSummary initializes a new RunSummary for a run starting now.
+func NewRunSummary() *RunSummary {
+	return &RunSummary{
+		Started: time.Now(),
+		Errors:  map[string]int{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+// skip records an object that was skipped.
+func (p *RunSummary) skip() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Skipped += 1
+}
+
+// complete records the results of uploading an object.
+func (p *RunSummary) complete(res *UploadResults) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if res.Error != nil {
+		p.Failed += 1
+		p.Errors[errorClass(res.Error)] += 1
+		return
+	}
+
+	p.Succeeded += 1
+
+	if res.State != nil && res.State.hr != nil {
+		p.Bytes += res.State.hr.Size()
+	}
+}
+
+// attempts records the number of attempts made to send a request.
+func (p *RunSummary) attempts(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Requests += int64(n)
+	if n > 1 {
+		p.Retries += int64(n - 1)
+	}
+}
+
+// finish records the end of the run.
+func (p *RunSummary) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Finished = time.Now()
+
+	duration := p.Finished.Sub(p.Started)
+	p.DurationSeconds = duration.Seconds()
+
+	if duration > 0 {
+		p.BytesPerSecond = float64(p.Bytes) / duration.Seconds()
+	}
+}
+
+// countAttempts adds middleware to the s3.Client counting the attempts made
+// for each operation, using the attempt results recorded by the retryer.
+func (p *RunSummary) countAttempts(opt *s3.Options) {
+	opt.APIOptions = append(opt.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"countAttempts",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				out middleware.InitializeOutput, metadata middleware.Metadata, err error,
+			) {
+				out, metadata, err = next.HandleInitialize(ctx, in)
+
+				n := 1
+				if results, ok := retry.GetAttemptResults(metadata); ok && len(results.Results) > 0 {
+					n = len(results.Results)
+				}
+				p.attempts(n)
+
+				return out, metadata, err
+			},
+		), middleware.Before)
+	})
+}
+
+// errorClass classifies an error for reporting, using the error code returned
+// by S3 when there is one.
+func errorClass(err error) string {
+	var ae smithy.APIError
+	var ne net.Error
+
+	switch {
+	case errors.Is(err, ErrChecksumMismatch):
+		return "ChecksumMismatch"
+	case errors.Is(err, ErrRetryBudget):
+		return "RetryBudget"
+	case errors.As(err, &ae):
+		return ae.ErrorCode()
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timeout"
+	case errors.As(err, &ne):
+		return "NetworkError"
+	}
+
+	return "Other"
+}
+
+// writeSummaryFile creates (or truncates) the file at name and writes the
+// RunSummary to it as JSON.
+func writeSummaryFile(name string, p *RunSummary) error {
+	p.mu.Lock()
+	buf, err := json.MarshalIndent(p, "", "  ")
+	p.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	return os.WriteFile(name, buf, 0o644)
+}
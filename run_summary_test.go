@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// Validate that retried attempts are counted, using a server that fails the
+// first attempt
+func TestRunSummaryCountAttempts(t *testing.T) {
+	var nrequests atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nrequests.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	summary := NewRunSummary()
+
+	client := s3.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.UsePathStyle = true
+		summary.countAttempts(o)
+	})
+
+	_, err := client.HeadBucket(context.Background(), &s3.HeadBucketInput{
+		Bucket: aws.String("bucket"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if summary.Requests != 2 || summary.Retries != 1 {
+		t.Errorf("expected 2 requests and 1 retry got %d and %d",
+			summary.Requests, summary.Retries)
+	}
+}
+
+func TestRunSummaryComplete(t *testing.T) {
+	summary := NewRunSummary()
+
+	summary.complete(&UploadResults{})
+	summary.complete(&UploadResults{Error: fmt.Errorf("upload: %w", ErrChecksumMismatch)})
+	summary.complete(&UploadResults{Error: &smithy.GenericAPIError{Code: "AccessDenied"}})
+	summary.complete(&UploadResults{Error: &smithy.GenericAPIError{Code: "AccessDenied"}})
+	summary.complete(&UploadResults{Error: context.Canceled})
+	summary.complete(&UploadResults{Error: errors.New("other")})
+	summary.skip()
+	summary.finish()
+
+	if summary.Succeeded != 1 || summary.Failed != 5 || summary.Skipped != 1 {
+		t.Errorf("expected 1, 5, 1 got %d, %d, %d",
+			summary.Succeeded, summary.Failed, summary.Skipped)
+	}
+
+	for class, n := range map[string]int{
+		"ChecksumMismatch": 1,
+		"AccessDenied":     2,
+		"Canceled":         1,
+		"Other":            1,
+	} {
+		if summary.Errors[class] != n {
+			t.Errorf("expected %d %s got %d", n, class, summary.Errors[class])
+		}
+	}
+
+	var nilSummary *RunSummary
+	nilSummary.skip()
+	nilSummary.complete(&UploadResults{})
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -11,6 +15,21 @@ import (
 type S3ClientPool struct {
 	shared *s3.Client
 	pool   *sync.Pool
+
+	// share, cfg and opts are retained for WithRegion
+	share bool
+	cfg   aws.Config
+	opts  []func(*s3.Options)
+
+	// endpoints are retained for WithRegion, members are the per-endpoint
+	// pools used in turn by Get when multiple endpoints are configured,
+	// see WithEndpoints, and weights bias the choice of member towards the
+	// fastest endpoints if set, see startEndpointProbes
+	endpoints []string
+	endpoint  string
+	members   []*S3ClientPool
+	next      *atomic.Uint64
+	weights   *endpointWeights
 }
 
 // NewS3ClientPool initializes a new S3ClientPool which will return *s3.Client
@@ -39,12 +58,99 @@ func NewS3ClientPool(share bool, cfg aws.Config, opts ...func(*s3.Options)) *S3C
 				return s3.NewFromConfig(cfg, opts...)
 			},
 		},
+		share: share,
+		cfg:   cfg,
+		opts:  opts,
 	}
 }
 
+// WithRegion returns a new S3ClientPool, configured the same as this one but
+// for the specified region.
+func (p *S3ClientPool) WithRegion(region string) *S3ClientPool {
+	cfg := p.cfg.Copy()
+	cfg.Region = region
+
+	return p.with(cfg)
+}
+
+// WithPathStyle returns a new S3ClientPool, configured the same as this one but
+// using path-style (if usePathStyle is true) or virtual-host style addressing.
+func (p *S3ClientPool) WithPathStyle(usePathStyle bool) *S3ClientPool {
+	return p.with(p.cfg, func(o *s3.Options) {
+		o.UsePathStyle = usePathStyle
+	})
+}
+
+// with returns a new S3ClientPool using cfg, and the options of this pool
+// followed by opts, retaining any endpoints.
+func (p *S3ClientPool) with(cfg aws.Config, opts ...func(*s3.Options)) *S3ClientPool {
+	pool := NewS3ClientPool(p.share, cfg, slices.Concat(p.opts, opts)...)
+
+	if len(p.endpoints) > 0 {
+		pool = pool.WithEndpoints(p.endpoints)
+	}
+
+	return pool
+}
+
+// configuredEndpoint returns the S3 endpoint URL configured for the AWS tools,
+// by the AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL environment variables, or by
+// the endpoint_url setting of the shared config profile (including an s3
+// services section), or the empty string if none was.  As with the other AWS
+// tools AWS_IGNORE_CONFIGURED_ENDPOINT_URLS (or the ignore_configured_endpoint_urls
+// setting) disables them.
+func configuredEndpoint(cfg aws.Config) string {
+	return aws.ToString(s3.NewFromConfig(cfg).Options().BaseEndpoint)
+}
+
+// WithEndpoints returns a new S3ClientPool, configured the same as this one
+// but sending requests to the specified endpoint URLs.  When more than one
+// endpoint is specified Get returns clients for each endpoint in turn, so that
+// requests (e.g., part uploads) are distributed across them round-robin, as
+// may be useful for distributed MinIO servers with no load balancer.
+func (p *S3ClientPool) WithEndpoints(endpoints []string) *S3ClientPool {
+	withEndpoint := func(endpoint string) *S3ClientPool {
+		opts := slices.Concat(p.opts, []func(*s3.Options){
+			func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(endpoint)
+			},
+		})
+
+		pool := NewS3ClientPool(p.share, p.cfg, opts...)
+		pool.endpoint = endpoint
+
+		return pool
+	}
+
+	if len(endpoints) == 1 {
+		pool := withEndpoint(endpoints[0])
+		pool.opts = p.opts
+		pool.endpoints = endpoints
+		return pool
+	}
+
+	pool := NewS3ClientPool(p.share, p.cfg, p.opts...)
+	pool.endpoints = endpoints
+	pool.next = &atomic.Uint64{}
+
+	for _, endpoint := range endpoints {
+		pool.members = append(pool.members, withEndpoint(endpoint))
+	}
+
+	return pool
+}
+
 // Get returns an *s3.Client. The client must be returned via Put when the
 // caller has finished with it.
 func (p *S3ClientPool) Get() *s3.Client {
+	if len(p.members) > 0 {
+		if p.weights != nil {
+			return p.members[p.weights.next()].Get()
+		}
+		i := (p.next.Add(1) - 1) % uint64(len(p.members))
+		return p.members[i].Get()
+	}
+
 	if p.shared != nil {
 		return p.shared
 	}
@@ -54,7 +160,29 @@ func (p *S3ClientPool) Get() *s3.Client {
 // Put returns an *s3.Client to be added back to the cache pool to become
 // available for the next call to Get.
 func (p *S3ClientPool) Put(s3client *s3.Client) {
+	if len(p.members) > 0 {
+		endpoint := aws.ToString(s3client.Options().BaseEndpoint)
+		for _, m := range p.members {
+			if m.endpoint == endpoint {
+				m.Put(s3client)
+				return
+			}
+		}
+		return
+	}
+
 	if p.shared == nil {
 		p.pool.Put(s3client)
 	}
 }
+
+// requestTimeoutHTTPClient returns client configured so that each individual
+// HTTP request, including reading the response body, times out after timeout.
+// Only the AWS SDK default client may be configured, any other client is
+// returned unchanged.
+func requestTimeoutHTTPClient(client s3.HTTPClient, timeout time.Duration) s3.HTTPClient {
+	if bc, ok := client.(*awshttp.BuildableClient); ok {
+		return bc.WithTimeout(timeout)
+	}
+	return client
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+func TestS3ClientPoolEndpoints(t *testing.T) {
+	endpoints := []string{"http://a:9000", "http://b:9000", "http://c:9000"}
+
+	for _, share := range []bool{true, false} {
+		pool := NewS3ClientPool(share, aws.Config{Region: "us-east-1"}).
+			WithEndpoints(endpoints).
+			WithRegion("us-west-2")
+
+		for i := 0; i < 2*len(endpoints); i++ {
+			s3client := pool.Get()
+
+			actual := aws.ToString(s3client.Options().BaseEndpoint)
+			if expect := endpoints[i%len(endpoints)]; actual != expect {
+				t.Errorf("%d expected %s got %s", i, expect, actual)
+			}
+			if region := s3client.Options().Region; region != "us-west-2" {
+				t.Errorf("%d expected us-west-2 got %s", i, region)
+			}
+
+			pool.Put(s3client)
+		}
+	}
+
+	pool := NewS3ClientPool(true, aws.Config{}).
+		WithEndpoints(endpoints[:1]).
+		WithRegion("us-west-2")
+
+	s3client := pool.Get()
+	if actual := aws.ToString(s3client.Options().BaseEndpoint); actual != endpoints[0] {
+		t.Errorf("expected %s got %s", endpoints[0], actual)
+	}
+	pool.Put(s3client)
+}
+
+func TestRequestTimeoutHTTPClient(t *testing.T) {
+	client := requestTimeoutHTTPClient(awshttp.NewBuildableClient(), time.Minute)
+
+	bc, ok := client.(*awshttp.BuildableClient)
+	if !ok {
+		t.Fatalf("expected *awshttp.BuildableClient got %T", client)
+	}
+
+	if timeout := bc.GetTimeout(); timeout != time.Minute {
+		t.Errorf("expected timeout %s got %s", time.Minute, timeout)
+	}
+}
+
+func TestConfiguredEndpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte(`[default]
+region = us-east-1
+
+[profile shared]
+region = us-east-1
+endpoint_url = https://shared.example.com
+
+[profile service]
+region = us-east-1
+services = service-s3
+
+[services service-s3]
+s3 =
+  endpoint_url = https://service.example.com
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+
+	for i, tst := range []struct {
+		profile string
+		env     map[string]string
+		expect  string
+	}{
+		{"default", nil, ""},
+		{"default", map[string]string{"AWS_ENDPOINT_URL": "https://all.example.com"}, "https://all.example.com"},
+		{"default", map[string]string{
+			"AWS_ENDPOINT_URL":    "https://all.example.com",
+			"AWS_ENDPOINT_URL_S3": "https://s3.example.com",
+		}, "https://s3.example.com"},
+		{"shared", nil, "https://shared.example.com"},
+		{"service", nil, "https://service.example.com"},
+		{"shared", map[string]string{"AWS_IGNORE_CONFIGURED_ENDPOINT_URLS": "true"}, ""},
+	} {
+		for _, name := range []string{"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3", "AWS_IGNORE_CONFIGURED_ENDPOINT_URLS"} {
+			t.Setenv(name, tst.env[name])
+			if _, ok := tst.env[name]; !ok {
+				os.Unsetenv(name)
+			}
+		}
+
+		cfg, err := config.LoadDefaultConfig(context.Background(),
+			config.WithSharedConfigProfile(tst.profile))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := configuredEndpoint(cfg); actual != tst.expect {
+			t.Errorf("%d expected %q got %q", i, tst.expect, actual)
+		}
+	}
+}
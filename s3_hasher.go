@@ -1,14 +1,26 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ErrChecksumMismatch is returned when a checksum reported by S3 does not match
+// the checksum calculated locally.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// errMissingContentMD5 is returned with -require-content-md5 when a request
+// was sent without a Content-MD5 header, or S3 did not return an ETag.
+var errMissingContentMD5 = errors.New("content-md5 not verified")
+
 // S3Hasher can be used to compute the various per-part and full-body HashSum
 // for objects uploaded to S3.
 type S3Hasher struct {
@@ -20,6 +32,9 @@ type S3Hasher struct {
 
 	full_md5  hash.Hash
 	md5_parts *HashParts
+
+	// full-body hashes calculated for the manifest only
+	extra map[*ChecksumAlgorithm]hash.Hash
 }
 
 // NewS3Hasher initializes a new S3Hasher using the specified algorithm and
@@ -35,15 +50,52 @@ func NewS3Hasher(algo *ChecksumAlgorithm, partSize int64) *S3Hasher {
 	}
 }
 
+// Grow allocates room for the parts of an object of size bytes, when the size
+// is known in advance.
+func (hr *S3Hasher) Grow(size int64) {
+	nparts := int(max(1, (size+hr.size-1)/hr.size))
+	hr.algo_parts.Grow(nparts)
+	hr.md5_parts.Grow(nparts)
+}
+
 // write adds b to the hash signatures for the S3Hasher
 func (hr *S3Hasher) write(b []byte) (int, error) {
 	hr.full_algo.Write(b)
 	hr.algo_parts.Write(b)
 	hr.full_md5.Write(b)
 	hr.md5_parts.Write(b)
+	for _, h := range hr.extra {
+		h.Write(b)
+	}
 	return len(b), nil
 }
 
+// AddExtraChecksums adds full-body hashes using algos (see
+// ExtraChecksumAlgorithms), it must be called before any bytes are written.
+func (hr *S3Hasher) AddExtraChecksums(algos ...*ChecksumAlgorithm) {
+	if len(algos) == 0 {
+		return
+	}
+
+	if hr.extra == nil {
+		hr.extra = make(map[*ChecksumAlgorithm]hash.Hash, len(algos))
+	}
+
+	for _, algo := range algos {
+		hr.extra[algo] = NewHasher(algo)()
+	}
+}
+
+// ExtraSum returns the full-body HashSum for an algorithm added using
+// AddExtraChecksums, or nil if it was not added.
+func (hr *S3Hasher) ExtraSum(algo *ChecksumAlgorithm) HashSum {
+	h, ok := hr.extra[algo]
+	if !ok {
+		return nil
+	}
+	return h.Sum(nil)
+}
+
 // SetPutObjectChecksums sets the ContentMD5 and Checksum<algo> fields on an
 // s3.PutObjectInput using the full body checksums
 func (hr *S3Hasher) SetPutObjectChecksums(obj *s3.PutObjectInput) {
@@ -66,11 +118,18 @@ func (hr *S3Hasher) SetPutObjectChecksums(obj *s3.PutObjectInput) {
 // SetUploadPartChecksum sets the ContentMD5 and Checksum<algo> fields on an
 // s3.UploadPartInput using the checksums for the specified partID.
 func (hr *S3Hasher) SetUploadPartChecksums(partID int32, part *s3.UploadPartInput) {
-	md5Sum := hr.MD5SumPart(partID).Base64()
+	setUploadPartChecksums(
+		hr.ChecksumAlgorithm(), hr.MD5SumPart(partID), hr.SumPart(partID), part)
+}
+
+// setUploadPartChecksums sets the ContentMD5 and Checksum<algo> fields on an
+// s3.UploadPartInput to the MD5 and algo checksums of the part.
+func setUploadPartChecksums(algo *ChecksumAlgorithm, md5, sum HashSum, part *s3.UploadPartInput) {
+	md5Sum := md5.Base64()
 	part.ContentMD5 = &md5Sum
 
-	algoSum := hr.SumPart(partID).Base64()
-	switch hr.ChecksumAlgorithm() {
+	algoSum := sum.Base64()
+	switch algo {
 	case ChecksumAlgorithmSHA256:
 		part.ChecksumSHA256 = &algoSum
 	case ChecksumAlgorithmSHA1:
@@ -82,6 +141,78 @@ func (hr *S3Hasher) SetUploadPartChecksums(partID int32, part *s3.UploadPartInpu
 	}
 }
 
+// CheckUploadPartChecksums compares the Checksum<algo> field set on an
+// s3.UploadPartInput (see SetUploadPartChecksums) against the value echoed
+// back by S3 in the s3.UploadPartOutput.  ErrChecksumMismatch is returned if
+// they differ.  If S3 did not return a checksum then no comparison is made.
+func (hr *S3Hasher) CheckUploadPartChecksums(part *s3.UploadPartInput, out *s3.UploadPartOutput) error {
+	var expect, actual *string
+	switch hr.ChecksumAlgorithm() {
+	case ChecksumAlgorithmSHA256:
+		expect, actual = part.ChecksumSHA256, out.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		expect, actual = part.ChecksumSHA1, out.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		expect, actual = part.ChecksumCRC32C, out.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		expect, actual = part.ChecksumCRC32, out.ChecksumCRC32
+	}
+
+	if expect == nil || actual == nil {
+		return nil
+	}
+
+	if *expect != *actual {
+		return fmt.Errorf("%w: part %d %s expected %s got %s",
+			ErrChecksumMismatch, *part.PartNumber, hr.ChecksumAlgorithm(),
+			*expect, *actual)
+	}
+
+	return nil
+}
+
+// CheckUploadPartContentMD5 confirms that the ContentMD5 field was set on an
+// s3.UploadPartInput and that the ETag returned by S3 in the
+// s3.UploadPartOutput is the same MD5 checksum, for S3 compatible stores that
+// only validate Content-MD5.  ErrChecksumMismatch is returned if they differ,
+// and errMissingContentMD5 if either is missing.
+func (hr *S3Hasher) CheckUploadPartContentMD5(part *s3.UploadPartInput, out *s3.UploadPartOutput) error {
+	return checkContentMD5(fmt.Sprintf("part %d", *part.PartNumber), part.ContentMD5, out.ETag)
+}
+
+// CheckPutObjectContentMD5 confirms that the ContentMD5 field was set on an
+// s3.PutObjectInput and that the ETag returned by S3 in the
+// s3.PutObjectOutput is the same MD5 checksum, see CheckUploadPartContentMD5.
+func (hr *S3Hasher) CheckPutObjectContentMD5(obj *s3.PutObjectInput, out *s3.PutObjectOutput) error {
+	return checkContentMD5("object", obj.ContentMD5, out.ETag)
+}
+
+// checkContentMD5 compares a base64 encoded Content-MD5 against an ETag.
+func checkContentMD5(what string, contentMD5, etag *string) error {
+	if contentMD5 == nil {
+		return fmt.Errorf("%w: %s sent without Content-MD5", errMissingContentMD5, what)
+	}
+
+	if etag == nil {
+		return fmt.Errorf("%w: no ETag returned for %s", errMissingContentMD5, what)
+	}
+
+	md5sum, err := base64.StdEncoding.DecodeString(*contentMD5)
+	if err != nil {
+		return err
+	}
+
+	expect := hex.EncodeToString(md5sum)
+	actual := strings.Trim(*etag, `"`)
+
+	if !strings.EqualFold(expect, actual) {
+		return fmt.Errorf("%w: %s Content-MD5 expected %s got ETag %s",
+			ErrChecksumMismatch, what, expect, actual)
+	}
+
+	return nil
+}
+
 // SetCompletedPartChecksum sets the Checksum<algo> fields on an
 // s3.CompletedPart using the checksum for the specified partID.
 func (hr *S3Hasher) SetCompletedPartChecksum(partID int32, completed *types.CompletedPart) {
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // Validate that S3Hasher produce the correct hash values
@@ -234,3 +237,68 @@ Proin vitae tempus massa, ac fermentum neque. Vivamus rhoncus, felis sed feugiat
 Pellentesque at viverra justo, a pharetra nibh. Sed egestas felis ut nunc feugiat commodo. Phasellus eu nisl a risus auctor lobortis. Pellentesque placerat tempus cursus. Nulla convallis tortor augue, eu rutrum erat blandit eu. Fusce dui dui, elementum pellentesque dictum at, semper at turpis. Phasellus et felis at felis pharetra iaculis vel sed tellus. Nunc id iaculis ligula. Morbi tortor neque, egestas sit amet pellentesque ut, pharetra et lacus. Maecenas ipsum dolor, feugiat dapibus placerat a, vehicula vel neque. Etiam mollis facilisis vestibulum.
 
 Duis eu aliquet risus. Sed vehicula libero eu neque ultrices, eu elementum leo sodales. Duis in varius dolor, id aliquet eros. Sed porttitor orci eu nunc ultricies, quis efficitur odio volutpat. Etiam ut malesuada tellus. Pellentesque non molestie sapien, eu tincidunt enim. Donec vel magna at nulla dapibus volutpat a vel augue. Donec rhoncus nisl non fringilla bibendum. Sed blandit sem lacus, sed posuere nibh tincidunt eu. Duis sagittis dui nunc, pulvinar porta velit placerat eu.`)
+
+// Validate that S3Hasher detects checksum mismatches reported by UploadPart
+func TestS3HasherCheckUploadPartChecksums(t *testing.T) {
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, 10)
+	s3hw.Write([]byte(lorum[0:20]))
+
+	for partID := int32(1); partID <= 2; partID++ {
+		part := &s3.UploadPartInput{PartNumber: &partID}
+		s3hw.SetUploadPartChecksums(partID, part)
+
+		// matching checksum
+		out := &s3.UploadPartOutput{ChecksumSHA256: part.ChecksumSHA256}
+		if err := s3hw.CheckUploadPartChecksums(part, out); err != nil {
+			t.Errorf("part %d unexpected error: %s", partID, err)
+		}
+
+		// checksum not returned by server
+		out = &s3.UploadPartOutput{}
+		if err := s3hw.CheckUploadPartChecksums(part, out); err != nil {
+			t.Errorf("part %d unexpected error: %s", partID, err)
+		}
+
+		// mismatched checksum
+		other := s3hw.SumPart(3 - partID).Base64()
+		out = &s3.UploadPartOutput{ChecksumSHA256: &other}
+		if err := s3hw.CheckUploadPartChecksums(part, out); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("part %d expected ErrChecksumMismatch, got %v", partID, err)
+		}
+	}
+}
+
+func TestS3HasherCheckUploadPartContentMD5(t *testing.T) {
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, 10)
+	s3hw.Write([]byte(lorum[0:20]))
+
+	for partID := int32(1); partID <= 2; partID++ {
+		part := &s3.UploadPartInput{PartNumber: &partID}
+
+		// sent without Content-MD5
+		etag := `"` + s3hw.MD5SumPart(partID).Hex() + `"`
+		out := &s3.UploadPartOutput{ETag: &etag}
+		if err := s3hw.CheckUploadPartContentMD5(part, out); !errors.Is(err, errMissingContentMD5) {
+			t.Errorf("part %d expected errMissingContentMD5, got %v", partID, err)
+		}
+
+		// matching ETag
+		s3hw.SetUploadPartChecksums(partID, part)
+		if err := s3hw.CheckUploadPartContentMD5(part, out); err != nil {
+			t.Errorf("part %d unexpected error: %s", partID, err)
+		}
+
+		// ETag not returned by server
+		out = &s3.UploadPartOutput{}
+		if err := s3hw.CheckUploadPartContentMD5(part, out); !errors.Is(err, errMissingContentMD5) {
+			t.Errorf("part %d expected errMissingContentMD5, got %v", partID, err)
+		}
+
+		// mismatched ETag
+		other := s3hw.MD5SumPart(3 - partID).Hex()
+		out = &s3.UploadPartOutput{ETag: &other}
+		if err := s3hw.CheckUploadPartContentMD5(part, out); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("part %d expected ErrChecksumMismatch, got %v", partID, err)
+		}
+	}
+}
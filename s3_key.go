@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum length of an object key name in bytes
+const MaxKeyLength = 1024
+
+// ErrBadKey is returned for key names that S3 will not accept
+var ErrBadKey = errors.New("invalid key")
+
+// ErrSpecialKey is returned for key names that S3 will accept but that
+// contain characters AWS documents as best avoided, as they may require
+// special handling by other tools and applications
+var ErrSpecialKey = errors.New("key contains characters that may require special handling")
+
+// keyCheck represents how strictly object key names are validated.
+type keyCheck int
+
+const (
+	// Reject keys that are not valid UTF-8 or that are too long
+	KeyCheckUTF8 keyCheck = iota
+
+	// Additionally warn about characters that may require special handling
+	KeyCheckWarn
+
+	// Additionally reject characters that may require special handling
+	KeyCheckStrict
+)
+
+// KeyCheck represents a keyCheck, with helper functions to parse and produce
+// human readable representations of the identifier for use via the flag
+// module.
+type KeyCheck keyCheck
+
+func (p KeyCheck) String() string {
+	switch keyCheck(p) {
+	case KeyCheckWarn:
+		return "warn"
+	case KeyCheckStrict:
+		return "strict"
+	default:
+		return "utf8"
+	}
+}
+
+func (p *KeyCheck) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "utf8":
+		*p = KeyCheck(KeyCheckUTF8)
+	case "warn":
+		*p = KeyCheck(KeyCheckWarn)
+	case "strict":
+		*p = KeyCheck(KeyCheckStrict)
+	default:
+		return fmt.Errorf("valid key checks: utf8, warn, strict")
+	}
+
+	return nil
+}
+
+// keyAvoidChars lists the printable ASCII characters that AWS documents as
+// best avoided in key names
+const keyAvoidChars = "\\{}^%`[]\"<>~#|"
+
+// S3Key validates an object key name.  An error wrapping ErrBadKey is returned
+// if the key is empty, is longer than MaxKeyLength bytes, or is not valid
+// UTF-8.  Unless check is KeyCheckUTF8, an error wrapping ErrSpecialKey is
+// returned if the key contains characters that may require special handling,
+// i.e., non-printable characters or any of \ { } ^ % ` [ ] " < > ~ # |.  The
+// errors describe the offset and bytes of each offending character.
+func S3Key(key string, check keyCheck) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrBadKey)
+	}
+
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes exceeds the maximum of %d: %q",
+			ErrBadKey, len(key), MaxKeyLength, key)
+	}
+
+	var invalid []string
+	var special []string
+
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid = append(invalid,
+				fmt.Sprintf("byte 0x%02x at offset %d", key[i], i))
+		case !unicode.IsPrint(r) || strings.ContainsRune(keyAvoidChars, r):
+			special = append(special,
+				fmt.Sprintf("%q (% x) at offset %d", r, key[i:i+size], i))
+		}
+
+		i += size
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%w: not valid UTF-8, %s: %q",
+			ErrBadKey, strings.Join(invalid, ", "), key)
+	}
+
+	if len(special) > 0 && check != KeyCheckUTF8 {
+		return fmt.Errorf("%w: %s: %q",
+			ErrSpecialKey, strings.Join(special, ", "), key)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestS3Key(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		check  keyCheck
+		expect error
+	}{
+		{"a/b/c.txt", KeyCheckStrict, nil},
+		{"a/b c/ünïcødé.txt", KeyCheckStrict, nil},
+		{"", KeyCheckUTF8, ErrBadKey},
+		{strings.Repeat("a", MaxKeyLength), KeyCheckUTF8, nil},
+		{strings.Repeat("a", MaxKeyLength+1), KeyCheckUTF8, ErrBadKey},
+		{"a/\xff.txt", KeyCheckUTF8, ErrBadKey},
+		{"a/\\b.txt", KeyCheckUTF8, nil},
+		{"a/\\b.txt", KeyCheckWarn, ErrSpecialKey},
+		{"a/{b}.txt", KeyCheckStrict, ErrSpecialKey},
+		{"a/b^.txt", KeyCheckStrict, ErrSpecialKey},
+		{"a/b\x07.txt", KeyCheckStrict, ErrSpecialKey},
+		{"a/b\u200b.txt", KeyCheckStrict, ErrSpecialKey},
+	} {
+		err := S3Key(tst.key, tst.check)
+
+		if tst.expect == nil && err != nil {
+			t.Errorf("%d expected no error, got %s", i, err)
+		} else if !errors.Is(err, tst.expect) {
+			t.Errorf("%d expected %v, got %v", i, tst.expect, err)
+		}
+	}
+
+	// the offending bytes and offset are described
+	err := S3Key("ab\\c", KeyCheckStrict)
+	if err == nil || !strings.Contains(err.Error(), `'\\' (5c) at offset 2`) {
+		t.Errorf("expected error describing offending bytes, got %v", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"runtime/trace"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -35,6 +37,9 @@ type S3UploadParts struct {
 	// created
 	opts *Options
 
+	// budget requests slots from Options.partBudget, if one was set up
+	budget *PartStream
+
 	// mu is a shared lock for any operations that might need to be gated
 	// for concurrency safety
 	mu *sync.Mutex
@@ -43,25 +48,33 @@ type S3UploadParts struct {
 	// their uploaded parts, and this counter tracks the next available
 	// PartID.
 	lastPartID int32
+
+	// uploadedBytes counts the bytes of the parts uploaded successfully,
+	// for verbose logging
+	uploadedBytes int64
 }
 
 // NewS3UploadParts initializes a new S3UploadPart.  The context may be used to
 // cancel any in-flight uploads.  The S3Hasher hr should be used to provide the
 // hashed signatures of parts submitted via UploadPart (see S3HashReader and
-// S3HashWriter).
+// S3HashWriter).  Up to concurrency parts will be uploaded in parallel.
 func NewS3UploadParts(
 	ctx context.Context,
 	hr *S3Hasher,
 	create *s3.CreateMultipartUploadInput,
+	concurrency int,
 	opts *Options) (*S3UploadParts, error) {
 
 	ctx, cancel := context.WithCancelCause(ctx)
 
+	createCtx, cancelCreate := withTimeout(ctx, opts.CreateUploadTimeout)
 	s3client := opts.s3.Get()
-	out, err := s3client.CreateMultipartUpload(ctx, create)
+	out, err := s3client.CreateMultipartUpload(createCtx, create)
 	opts.s3.Put(s3client)
+	cancelCreate()
 
 	if err != nil {
+		cancel(err)
 		return nil, err
 	}
 
@@ -70,12 +83,59 @@ func NewS3UploadParts(
 			*create.Bucket, *create.Key, *out.UploadId)
 	}
 
+	return newS3UploadParts(ctx, cancel, hr, create, out, 0, concurrency, opts), nil
+}
+
+// AttachS3UploadParts initializes a new S3UploadParts for a multi-part upload
+// that was created by another process, identified by uploadID, instead of
+// creating one.  The parts are numbered on the server starting at startPart,
+// e.g., so that several processes may each upload a range of the parts.  The
+// create input names the Bucket and Key of the upload.
+func AttachS3UploadParts(
+	ctx context.Context,
+	hr *S3Hasher,
+	create *s3.CreateMultipartUploadInput,
+	uploadID string,
+	startPart int32,
+	concurrency int,
+	opts *Options) *S3UploadParts {
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	if opts.Verbose {
+		log.Printf("attached to upload of multi-part object %s/%s using UploadId %s at part %d",
+			*create.Bucket, *create.Key, uploadID, startPart)
+	}
+
+	out := &s3.CreateMultipartUploadOutput{
+		Bucket:   create.Bucket,
+		Key:      create.Key,
+		UploadId: &uploadID,
+	}
+
+	return newS3UploadParts(ctx, cancel, hr, create, out, startPart-1, concurrency, opts)
+}
+
+// newS3UploadParts initializes a new S3UploadParts for the upload created by
+// out, starting the workers that upload its parts.
+func newS3UploadParts(
+	ctx context.Context,
+	cancel context.CancelCauseFunc,
+	hr *S3Hasher,
+	create *s3.CreateMultipartUploadInput,
+	out *s3.CreateMultipartUploadOutput,
+	partOffset int32,
+	concurrency int,
+	opts *Options) *S3UploadParts {
+
 	p := &S3UploadParts{
 		st: &S3UploadState{
 			hr:           hr,
 			create:       create,
 			createOutput: out,
+			partOffset:   partOffset,
 
+			uploadPartInputs:  make(map[int32]*s3.UploadPartInput),
 			uploadPartOutputs: make(map[int32]*s3.UploadPartOutput),
 			uploadPartErrors:  make(map[int32]error),
 
@@ -94,7 +154,11 @@ func NewS3UploadParts(
 		mu: &sync.Mutex{},
 	}
 
-	for i := 0; i < p.opts.ConcurrentParts; i++ {
+	if opts.partBudget != nil {
+		p.budget = opts.partBudget.Stream()
+	}
+
+	for i := 0; i < concurrency; i++ {
 		go func() {
 			for {
 				select {
@@ -115,7 +179,7 @@ func NewS3UploadParts(
 		}()
 	}
 
-	return p, nil
+	return p
 }
 
 var ErrMaxPartID = errors.New("partID limit reached")
@@ -145,13 +209,14 @@ func (p *S3UploadParts) Key() *string {
 }
 
 // NextPartID is a convenience method to return a sequence of PartID starting
-// at 1 and ending at Options.MaxPartID.  If MaxPartID has been reached then
-// (0, ErrMaxPartID) is returned.
+// at 1 and ending at Options.MaxPartID (less any parts numbered before the
+// start part of an attached upload).  If MaxPartID has been reached then (0,
+// ErrMaxPartID) is returned.
 func (p *S3UploadParts) NextPartID() (int32, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.lastPartID == p.opts.MaxPartID {
+	if p.lastPartID+p.st.partOffset >= p.opts.MaxPartID {
 		return 0, ErrMaxPartID
 	}
 
@@ -218,7 +283,7 @@ func (p *S3UploadParts) UploadPart(part *s3.UploadPartInput) chan error {
 
 			// for this part number record the cancelation error a
 			// the results
-			p.st.setPartResults(q.part.PartNumber, nil, err)
+			p.st.setPartResults(q.part, nil, err)
 
 			// and return the cancelation error back to the caller
 			// if they are waiting for it
@@ -234,27 +299,132 @@ func (p *S3UploadParts) UploadPart(part *s3.UploadPartInput) chan error {
 func (p *S3UploadParts) uploadPart(part *s3.UploadPartInput) error {
 	defer p.pending.Done()
 
+	// with -trace each part is a task within the object task
+	ctx, task := trace.NewTask(p.ctx, "part")
+	defer task.End()
+	trace.Logf(ctx, "part", "%d", *part.PartNumber)
+
+	// when a part budget is shared across objects wait for a slot, slots
+	// are granted to each object in turn
+	if p.budget != nil {
+		region := trace.StartRegion(ctx, "wait")
+		err := p.budget.Acquire(ctx)
+		region.End()
+		if err != nil {
+			p.st.setPartResults(part, nil, err)
+			return err
+		}
+		defer p.budget.Release()
+	}
+
 	s3client := p.opts.s3.Get()
 	defer p.opts.s3.Put(s3client)
 
 	if p.opts.Verbose {
-		log.Printf("starting upload of %s/%s part %d using UploadId %s",
-			*part.Bucket, *part.Key, *part.PartNumber, *part.UploadId)
+		p.mu.Lock()
+		uploaded := p.uploadedBytes
+		p.mu.Unlock()
+
+		log.Printf("starting upload of %s/%s part %d (%s, %s of object uploaded) using UploadId %s",
+			*part.Bucket, *part.Key, *part.PartNumber,
+			partSizeString(partBodySize(part)), ByteSize(uploaded), *part.UploadId)
+	}
+
+	start := time.Now()
+
+	// optionally confirm that a part buffered in a temporary file was not
+	// corrupted while it was queued
+	if p.opts.VerifyBuffers {
+		if sr, ok := part.Body.(*SourceReader); ok && sr.tempfile {
+			region := trace.StartRegion(ctx, "verify")
+			err := sr.Verify(p.st.hr.MD5SumPart(*part.PartNumber))
+			region.End()
+			if err != nil {
+				err = fmt.Errorf("part %d: %w", *part.PartNumber, err)
+				p.st.setPartResults(part, nil, err)
+				return err
+			}
+		}
+	}
+
+	// parts of an attached upload are numbered from its start part on the
+	// server, but from 1 by the S3Hasher and S3UploadState
+	in := part
+	if p.st.partOffset > 0 {
+		copied := *part
+		copied.PartNumber = aws.Int32(*part.PartNumber + p.st.partOffset)
+		in = &copied
+	}
+
+	// transient failures are retried up to -retries times, with a jittered
+	// wait that doubles after each attempt
+	var out *s3.UploadPartOutput
+	var err error
+	backoff := p.opts.RetryBackoff
+	for retries := 0; ; retries++ {
+		region := trace.StartRegion(ctx, "upload")
+		if sp, ok := part.Body.(*streamPart); ok {
+			out, err = sp.upload(ctx, s3client, part, in)
+		} else {
+			out, err = s3client.UploadPart(ctx, in)
+		}
+		region.End()
+
+		if err == nil || retries >= p.opts.Retries || ctx.Err() != nil ||
+			!retryablePartError(err) || !rewindPart(part) {
+			p.st.setPartRetries(*part.PartNumber, retries)
+			break
+		}
+
+		wait := retryWait(backoff)
+		if p.opts.Verbose {
+			log.Printf("retrying upload of %s/%s part %d in %s: %s",
+				*part.Bucket, *part.Key, *part.PartNumber, wait.Round(time.Millisecond), err)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+
+		backoff *= 2
 	}
 
-	out, err := s3client.UploadPart(p.ctx, part)
+	// confirm that the checksum computed by S3 matches the checksum
+	// computed locally, failing the part if it does not
+	if err == nil {
+		err = p.st.hr.CheckUploadPartChecksums(part, out)
+	}
+
+	// with -require-content-md5 also confirm the part was sent with the
+	// Content-MD5 the ETag echoes
+	if err == nil && p.opts.RequireContentMD5 {
+		err = p.st.hr.CheckUploadPartContentMD5(in, out)
+	}
 
 	if p.opts.Verbose {
+		elapsed := time.Since(start)
+		size := partBodySize(part)
+
 		outcome := "completed"
 		if err != nil {
 			outcome = "failed"
 		}
 
-		log.Printf("%s upload of %s/%s part %d using UploadId %s",
-			outcome, *part.Bucket, *part.Key, *part.PartNumber, *part.UploadId)
+		p.mu.Lock()
+		if err == nil && size > 0 {
+			p.uploadedBytes += size
+		}
+		uploaded := p.uploadedBytes
+		p.mu.Unlock()
+
+		log.Printf("%s upload of %s/%s part %d (%s in %s, %s, %s of object uploaded) using UploadId %s",
+			outcome, *part.Bucket, *part.Key, *part.PartNumber,
+			partSizeString(size), elapsed.Round(time.Millisecond),
+			throughputString(size, elapsed), ByteSize(uploaded), *part.UploadId)
 	}
 
-	p.st.setPartResults(part.PartNumber, out, err)
+	p.st.setPartResults(part, out, err)
 
 	return err
 }
@@ -295,22 +465,18 @@ func (p *S3UploadParts) PartResults(partID int32) (*s3.UploadPartOutput, error)
 // CompleteUpload attempts to complete an upload of parts.  It should only be
 // called once all the parts have been submitted via p.UploadPart and p.Wait
 // has unblocked.  If timeout is > 0 then the complete upload process will try
-// to cancel the process if it takes longer than the specified timeout.
-func (p *S3UploadParts) CompleteUpload(timeout time.Duration) error {
+// to cancel the process if it takes longer than the specified timeout.  If ctx
+// is canceled then completing the upload is interrupted.  The ETag of the
+// object is only verified if compareETag is true (see etagIsMD5).
+func (p *S3UploadParts) CompleteUpload(ctx context.Context, timeout time.Duration, compareETag bool) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	s3client := p.opts.s3.Get()
 	defer p.opts.s3.Put(s3client)
 
-	var ctx context.Context
-	var cancelTimeout context.CancelFunc
-	if timeout > 0 {
-		ctx, cancelTimeout = context.WithTimeout(context.Background(), timeout)
-		defer cancelTimeout()
-	} else {
-		ctx = context.Background()
-	}
+	completeCtx, cancelTimeout := withTimeout(ctx, timeout)
+	defer cancelTimeout()
 
 	params, err := p.st.completeParts()
 	if err != nil {
@@ -321,14 +487,24 @@ func (p *S3UploadParts) CompleteUpload(timeout time.Duration) error {
 				*params.Bucket, *params.Key, *params.UploadId)
 		}
 
-		out, err := s3client.CompleteMultipartUpload(ctx, params)
+		region := trace.StartRegion(ctx, "complete")
+		out, err := s3client.CompleteMultipartUpload(completeCtx, params)
+		region.End()
 		p.st.completedOutput = out
 		p.st.completedError = err
 		if err == nil {
-			attr, err := getObjectAttributes(
-				ctx, *params.Bucket, *params.Key, p.opts)
-			p.st.objectAttributesOutput = attr
-			p.st.objectAttributesError = err
+			p.st.completedVerification = NewMultipartVerification(
+				p.st.hr, out.ETag, map[*ChecksumAlgorithm]*string{
+					ChecksumAlgorithmCRC32:  out.ChecksumCRC32,
+					ChecksumAlgorithmCRC32C: out.ChecksumCRC32C,
+					ChecksumAlgorithmSHA1:   out.ChecksumSHA1,
+					ChecksumAlgorithmSHA256: out.ChecksumSHA256,
+				}, compareETag)
+
+			if err := p.st.completedVerification.Err(); err != nil {
+				log.Printf("verification failed for multi-part object %s/%s: %s",
+					*params.Bucket, *params.Key, err)
+			}
 		}
 	}
 
@@ -381,3 +557,37 @@ type queuedPart struct {
 	part *s3.UploadPartInput
 	ch   chan error
 }
+
+// partBodySize returns the size of the body of an UploadPartInput, or -1 if it
+// is not known.  The size of a part read from a stream is known once it has
+// been read in full, until then its ContentLength is used.
+func partBodySize(part *s3.UploadPartInput) int64 {
+	if sized, ok := part.Body.(interface{ Size() int64 }); ok {
+		if size := sized.Size(); size > 0 || part.ContentLength == nil {
+			return size
+		}
+	}
+
+	if part.ContentLength != nil {
+		return *part.ContentLength
+	}
+
+	return -1
+}
+
+// partSizeString returns a human readable size for verbose logging.
+func partSizeString(size int64) string {
+	if size < 0 {
+		return "unknown size"
+	}
+	return ByteSize(size).String()
+}
+
+// throughputString returns the rate at which size bytes were sent in elapsed
+// time for verbose logging.
+func throughputString(size int64, elapsed time.Duration) string {
+	if size < 0 || elapsed <= 0 {
+		return "unknown rate"
+	}
+	return ByteSize(float64(size)/elapsed.Seconds()).String() + "/s"
+}
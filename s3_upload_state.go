@@ -23,18 +23,76 @@ type S3UploadState struct {
 	create       *s3.CreateMultipartUploadInput
 	createOutput *s3.CreateMultipartUploadOutput
 
+	uploadPartInputs  map[int32]*s3.UploadPartInput
 	uploadPartOutputs map[int32]*s3.UploadPartOutput
 	uploadPartErrors  map[int32]error
 
+	// uploadPartRetries records the number of times each part was retried
+	// with -retries, for parts retried at least once
+	uploadPartRetries map[int32]int
+
 	completedOutput *s3.CompleteMultipartUploadOutput
 	completedError  error
 
+	// completedVerification records the comparison of the ETag and
+	// checksum returned once the object was completed, by either
+	// CompleteMultipartUpload or PutObject
+	completedVerification *UploadVerification
+
 	abortedOutput *s3.AbortMultipartUploadOutput
 	abortedError  error
 
 	objectAttributesOutput *s3.GetObjectAttributesOutput
 	objectAttributesError  error
 
+	// checksumOnly is set when the object was hashed but not uploaded, in
+	// which case obj records the Bucket and Key it would be uploaded to
+	checksumOnly bool
+
+	// duplicateOf is set when the object was not uploaded as its content
+	// was found in the -dedupe-db, in which case obj records the Bucket and
+	// Key, and copyOutput is set if the duplicate was copied to them
+	duplicateOf *DedupeEntry
+	copyOutput  *s3.CopyObjectOutput
+
+	// lifecycleTag records the ObjectOptions.LifecycleTag set on the
+	// object, for reporting in the manifest
+	lifecycleTag string
+
+	// partOffset is added to the part numbers of an upload attached to
+	// with -upload-id and -start-part to give the part numbers on the
+	// server
+	partOffset int32
+
+	// runID records the Options.RunID stored in the metadata of the
+	// object, for reporting in the manifest
+	runID string
+
+	// sourceKey records the key before -key-encoding, -shard-prefix or
+	// -truncate-keys were applied, if it differs, for reporting in the
+	// manifest
+	sourceKey string
+
+	// split records the range of standard input uploaded, if it was split
+	// with -split-size, for reporting in the manifest
+	split *SplitRange
+
+	// compression records whether the source was compressed by
+	// -compress, for reporting in the manifest
+	compression *Compression
+
+	// sparseSize records the size of a sparse file of which only the
+	// data was uploaded by -sparse holes
+	sparseSize int64
+
+	// source names the file or URL the object was read from, or "-" for
+	// standard input
+	source string
+
+	// sourceError records ErrSourceModified if the source changed while
+	// it was being uploaded
+	sourceError error
+
 	mu *sync.Mutex
 }
 
@@ -66,17 +124,43 @@ func (p *S3UploadState) Errors() []error {
 	return err
 }
 
+// completed returns true if the object was created, by either PutObject or
+// CompleteMultipartUpload.
+func (p *S3UploadState) completed() bool {
+	return (p.obj != nil && p.objOutput != nil && p.objError == nil) ||
+		(p.completedOutput != nil && p.completedError == nil)
+}
+
 // setPartResults records the results of processing an S3UploadParts.UploadPart
 // request.  It may be called either as part of processing the upload and
 // recording the results from the s3.Client or recording any errors encountered
 // before the the part could be passed off to the s3.Client (e.g., if the
 // context was canceled)
-func (p *S3UploadState) setPartResults(partID *int32, out *s3.UploadPartOutput, err error) {
+func (p *S3UploadState) setPartResults(part *s3.UploadPartInput, out *s3.UploadPartOutput, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	partID := *part.PartNumber
+
+	p.uploadPartInputs[partID] = part
+	p.uploadPartOutputs[partID] = out
+	p.uploadPartErrors[partID] = err
+}
+
+// setPartRetries records the number of times a part was retried before it
+// was uploaded or failed.
+func (p *S3UploadState) setPartRetries(partID int32, retries int) {
+	if retries == 0 {
+		return
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.uploadPartOutputs[*partID] = out
-	p.uploadPartErrors[*partID] = err
+	if p.uploadPartRetries == nil {
+		p.uploadPartRetries = make(map[int32]int)
+	}
+	p.uploadPartRetries[partID] = retries
 }
 
 // completeParts returns a *s3.CompleteMultipartUploadInput for the parts
@@ -142,5 +226,8 @@ func (p *S3UploadState) completeParts() (*s3.CompleteMultipartUploadInput, error
 		MultipartUpload: &types.CompletedMultipartUpload{
 			Parts: completedParts,
 		},
+		SSECustomerAlgorithm: p.create.SSECustomerAlgorithm,
+		SSECustomerKey:       p.create.SSECustomerKey,
+		SSECustomerKeyMD5:    p.create.SSECustomerKeyMD5,
 	}, nil
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// VerificationStatus represents the outcome of comparing a value returned by
+// S3 against the value calculated locally.
+type VerificationStatus string
+
+const (
+	// S3 returned a value that matches the locally calculated value
+	VerificationMatch VerificationStatus = "match"
+
+	// S3 returned a value that does not match the locally calculated value
+	VerificationMismatch VerificationStatus = "mismatch"
+
+	// S3 did not return a value that could be compared
+	VerificationUnavailable VerificationStatus = "unavailable"
+)
+
+// UploadVerification records the outcome of comparing the ETag and checksum
+// returned by S3 for an object against those calculated by the S3Hasher.
+type UploadVerification struct {
+	ETag     VerificationStatus
+	Checksum VerificationStatus
+
+	// expected and actual values, retained for error reporting
+	expectETag     string
+	actualETag     string
+	expectChecksum string
+	actualChecksum string
+}
+
+// Err returns an error wrapping ErrChecksumMismatch if either the ETag or the
+// checksum did not match, otherwise it returns nil.
+func (p *UploadVerification) Err() error {
+	if p == nil {
+		return nil
+	}
+
+	var errs []error
+
+	if p.ETag == VerificationMismatch {
+		errs = append(errs, fmt.Errorf("%w: ETag expected %s got %s",
+			ErrChecksumMismatch, p.expectETag, p.actualETag))
+	}
+
+	if p.Checksum == VerificationMismatch {
+		errs = append(errs, fmt.Errorf("%w: checksum expected %s got %s",
+			ErrChecksumMismatch, p.expectChecksum, p.actualChecksum))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Verified returns true if the ETag or the checksum matched, and neither was
+// a mismatch.
+func (p *UploadVerification) Verified() bool {
+	if p == nil || p.ETag == VerificationMismatch || p.Checksum == VerificationMismatch {
+		return false
+	}
+
+	return p.ETag == VerificationMatch || p.Checksum == VerificationMatch
+}
+
+// verifyETag compares an ETag returned by S3 for an object uploaded using
+// PutObject against the MD5 checksum calculated by the S3Hasher.
+func verifyETag(hr *S3Hasher, etag *string) (VerificationStatus, string, string) {
+	expect := hr.MD5Sum().Hex()
+
+	if etag == nil || *etag == "" {
+		return VerificationUnavailable, expect, ""
+	}
+
+	actual := strings.Trim(*etag, `"`)
+	if !strings.EqualFold(actual, expect) {
+		return VerificationMismatch, expect, actual
+	}
+
+	return VerificationMatch, expect, actual
+}
+
+// verifyMultipartETag compares an ETag returned by S3 for a multi-part object
+// against the hash-of-hashes ETag calculated by the S3Hasher.
+func verifyMultipartETag(hr *S3Hasher, etag *string) (VerificationStatus, string, string) {
+	expect := hr.ETag()
+
+	if etag == nil || *etag == "" {
+		return VerificationUnavailable, expect, ""
+	}
+
+	actual := strings.Trim(*etag, `"`)
+	if actual != expect {
+		return VerificationMismatch, expect, actual
+	}
+
+	return VerificationMatch, expect, actual
+}
+
+// verifyMultipartChecksum compares a Checksum<algo> value returned by S3 for
+// a multi-part object against the base64 hash-of-hashes calculated by the
+// S3Hasher.  S3 returns these values with a "-<count>" suffix, which is also
+// compared when present.
+func verifyMultipartChecksum(hr *S3Hasher, checksum *string) (VerificationStatus, string, string) {
+	expect := fmt.Sprintf("%s-%d", hr.SumOfSums().Base64(), hr.Count())
+
+	if checksum == nil || *checksum == "" {
+		return VerificationUnavailable, expect, ""
+	}
+
+	actual := *checksum
+
+	sum, count, found := strings.Cut(actual, "-")
+	if found {
+		n, err := strconv.Atoi(count)
+		if err != nil || n != hr.Count() {
+			return VerificationMismatch, expect, actual
+		}
+	}
+
+	if sum != hr.SumOfSums().Base64() {
+		return VerificationMismatch, expect, actual
+	}
+
+	return VerificationMatch, expect, actual
+}
+
+// NewMultipartVerification compares the ETag and Checksum<algo> returned by a
+// CompleteMultipartUpload request against the values calculated by the
+// S3Hasher.  The ETag is only compared if compareETag is true, as it is not
+// derived from MD5 sums for objects encrypted using KMS or customer-provided
+// keys.
+func NewMultipartVerification(hr *S3Hasher, etag *string, checksums map[*ChecksumAlgorithm]*string, compareETag bool) *UploadVerification {
+	p := &UploadVerification{ETag: VerificationUnavailable}
+
+	if compareETag {
+		p.ETag, p.expectETag, p.actualETag = verifyMultipartETag(hr, etag)
+	}
+
+	p.Checksum, p.expectChecksum, p.actualChecksum = verifyMultipartChecksum(
+		hr, checksums[hr.ChecksumAlgorithm()])
+
+	return p
+}
+
+// verifyChecksum compares a Checksum<algo> value returned by S3 for an object
+// uploaded using PutObject against the base64 checksum calculated by the
+// S3Hasher.
+func verifyChecksum(hr *S3Hasher, checksum *string) (VerificationStatus, string, string) {
+	expect := hr.Sum().Base64()
+
+	if checksum == nil || *checksum == "" {
+		return VerificationUnavailable, expect, ""
+	}
+
+	if *checksum != expect {
+		return VerificationMismatch, expect, *checksum
+	}
+
+	return VerificationMatch, expect, *checksum
+}
+
+// NewPutObjectVerification compares the ETag and Checksum<algo> returned by a
+// PutObject request against the values calculated by the S3Hasher.  The ETag
+// is only compared if compareETag is true, as it is not an MD5 sum for objects
+// encrypted using KMS keys.
+func NewPutObjectVerification(hr *S3Hasher, out *s3.PutObjectOutput, compareETag bool) *UploadVerification {
+	p := &UploadVerification{ETag: VerificationUnavailable}
+
+	if compareETag {
+		p.ETag, p.expectETag, p.actualETag = verifyETag(hr, out.ETag)
+	}
+
+	p.Checksum, p.expectChecksum, p.actualChecksum = verifyChecksum(
+		hr, map[*ChecksumAlgorithm]*string{
+			ChecksumAlgorithmCRC32:  out.ChecksumCRC32,
+			ChecksumAlgorithmCRC32C: out.ChecksumCRC32C,
+			ChecksumAlgorithmSHA1:   out.ChecksumSHA1,
+			ChecksumAlgorithmSHA256: out.ChecksumSHA256,
+		}[hr.ChecksumAlgorithm()])
+
+	return p
+}
+
+// NewAttributesChecksumVerification compares the Checksum<algo> returned by
+// GetObjectAttributes for a completed object against the value calculated by
+// the S3Hasher, as a hash-of-hashes if the object was uploaded in parts.  The
+// ETag is not compared, as it is not an MD5 sum for objects encrypted using
+// KMS keys.
+func NewAttributesChecksumVerification(hr *S3Hasher, out *s3.GetObjectAttributesOutput, multipart bool) *UploadVerification {
+	var checksum *string
+
+	if out != nil && out.Checksum != nil {
+		checksum = map[*ChecksumAlgorithm]*string{
+			ChecksumAlgorithmCRC32:  out.Checksum.ChecksumCRC32,
+			ChecksumAlgorithmCRC32C: out.Checksum.ChecksumCRC32C,
+			ChecksumAlgorithmSHA1:   out.Checksum.ChecksumSHA1,
+			ChecksumAlgorithmSHA256: out.Checksum.ChecksumSHA256,
+		}[hr.ChecksumAlgorithm()]
+	}
+
+	p := &UploadVerification{ETag: VerificationUnavailable}
+
+	if multipart {
+		p.Checksum, p.expectChecksum, p.actualChecksum = verifyMultipartChecksum(hr, checksum)
+	} else {
+		p.Checksum, p.expectChecksum, p.actualChecksum = verifyChecksum(hr, checksum)
+	}
+
+	return p
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Validate that NewMultipartVerification compares ETag and checksum values
+func TestMultipartVerification(t *testing.T) {
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, 10)
+	s3hw.Write([]byte(lorum[0:25]))
+
+	etag := fmt.Sprintf(`"%s"`, s3hw.ETag())
+	checksum := fmt.Sprintf("%s-%d", s3hw.SumOfSums().Base64(), s3hw.Count())
+	unsuffixed := s3hw.SumOfSums().Base64()
+	badCount := fmt.Sprintf("%s-%d", s3hw.SumOfSums().Base64(), s3hw.Count()+1)
+	badSum := fmt.Sprintf("%s-%d", s3hw.SumPart(1).Base64(), s3hw.Count())
+	badETag := `"0123456789abcdef0123456789abcdef-3"`
+
+	tests := []struct {
+		etag     *string
+		checksum *string
+		expectE  VerificationStatus
+		expectC  VerificationStatus
+	}{
+		{&etag, &checksum, VerificationMatch, VerificationMatch},
+		{&etag, &unsuffixed, VerificationMatch, VerificationMatch},
+		{nil, nil, VerificationUnavailable, VerificationUnavailable},
+		{&badETag, &checksum, VerificationMismatch, VerificationMatch},
+		{&etag, &badCount, VerificationMatch, VerificationMismatch},
+		{&etag, &badSum, VerificationMatch, VerificationMismatch},
+	}
+
+	for i, tst := range tests {
+		v := NewMultipartVerification(s3hw.S3Hasher, tst.etag,
+			map[*ChecksumAlgorithm]*string{
+				ChecksumAlgorithmSHA256: tst.checksum,
+			}, true)
+
+		if v.ETag != tst.expectE {
+			t.Errorf("%d expected ETag %s got %s", i, tst.expectE, v.ETag)
+		}
+
+		if v.Checksum != tst.expectC {
+			t.Errorf("%d expected Checksum %s got %s", i, tst.expectC, v.Checksum)
+		}
+
+		mismatch := tst.expectE == VerificationMismatch ||
+			tst.expectC == VerificationMismatch
+
+		if err := v.Err(); mismatch != errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%d unexpected error result: %v", i, err)
+		}
+	}
+
+	// the ETag of an object encrypted using KMS is not compared
+	v := NewMultipartVerification(s3hw.S3Hasher, &badETag,
+		map[*ChecksumAlgorithm]*string{
+			ChecksumAlgorithmSHA256: &checksum,
+		}, false)
+
+	if v.ETag != VerificationUnavailable || v.Err() != nil {
+		t.Errorf("expected ETag %s without error, got %s: %v", VerificationUnavailable, v.ETag, v.Err())
+	}
+}
+
+// Validate that NewPutObjectVerification compares the ETag against the MD5
+// checksum, unless it is not comparable
+func TestPutObjectVerification(t *testing.T) {
+	s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, 100)
+	s3hw.Write([]byte(lorum[0:25]))
+
+	etag := fmt.Sprintf(`"%s"`, s3hw.MD5Sum().Hex())
+	checksum := s3hw.Sum().Base64()
+	badETag := `"0123456789abcdef0123456789abcdef"`
+
+	tests := []struct {
+		etag        *string
+		checksum    *string
+		compareETag bool
+		expectE     VerificationStatus
+		expectC     VerificationStatus
+		verified    bool
+	}{
+		{&etag, &checksum, true, VerificationMatch, VerificationMatch, true},
+		{&etag, nil, true, VerificationMatch, VerificationUnavailable, true},
+		{&badETag, nil, true, VerificationMismatch, VerificationUnavailable, false},
+		{&badETag, &checksum, false, VerificationUnavailable, VerificationMatch, true},
+		{&badETag, nil, false, VerificationUnavailable, VerificationUnavailable, false},
+	}
+
+	for i, tst := range tests {
+		v := NewPutObjectVerification(s3hw.S3Hasher, &s3.PutObjectOutput{
+			ETag:           tst.etag,
+			ChecksumSHA256: tst.checksum,
+		}, tst.compareETag)
+
+		if v.ETag != tst.expectE || v.Checksum != tst.expectC {
+			t.Errorf("%d expected %s %s got %s %s", i, tst.expectE, tst.expectC, v.ETag, v.Checksum)
+		}
+
+		if v.Verified() != tst.verified {
+			t.Errorf("%d expected verified %t", i, tst.verified)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"io"
 	"log"
 	"path"
+	"runtime/trace"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +21,15 @@ import (
 
 var ErrTimeout error = errors.New("timeout")
 
+// withTimeout returns a context derived from ctx which is canceled after
+// timeout, if timeout is > 0, otherwise ctx is returned unchanged.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
 // queueUpload represents an in-flight upload with a channel to return the
 // results of processing
 type queueUpload struct {
@@ -25,6 +37,7 @@ type queueUpload struct {
 	r      io.Reader
 	bucket string
 	key    string
+	objOpt *ObjectOptions
 	res    chan *UploadResults
 }
 
@@ -45,7 +58,23 @@ type Uploader struct {
 	queued    chan *queueUpload
 	cancel    context.CancelFunc
 	abortable map[*string]*S3UploadParts
+	hooks     *UploadHooks
 	mu        *sync.Mutex
+
+	// attributes receives the completed objects whose attributes are to
+	// be fetched before their results are returned
+	attributes chan *queuedAttributes
+
+	// small receives the objects uploaded by the small object fast path,
+	// if Options.SmallObjectSize is set
+	small chan *queueUpload
+}
+
+// queuedAttributes is a completed object waiting for its attributes to be
+// fetched.
+type queuedAttributes struct {
+	q   *queueUpload
+	res *UploadResults
 }
 
 func NewUploader(ctx context.Context, opts *Options) *Uploader {
@@ -59,6 +88,8 @@ func NewUploader(ctx context.Context, opts *Options) *Uploader {
 		cancel:    cancel,
 		abortable: map[*string]*S3UploadParts{},
 		mu:        &sync.Mutex{},
+
+		attributes: make(chan *queuedAttributes),
 	}
 
 	for i := 0; i < opts.ConcurrentObjects; i++ {
@@ -66,13 +97,52 @@ func NewUploader(ctx context.Context, opts *Options) *Uploader {
 			for {
 				select {
 				case q := <-p.queued:
-					state, err := p.upload(q.ctx, q.r, q.bucket, q.key)
-					q.res <- &UploadResults{
-						Bucket: q.bucket,
-						Key:    q.key,
-						State:  state,
-						Error:  err,
+					p.hooks.objectStart(q.bucket, q.key)
+
+					state, err := p.upload(q.ctx, q.r, q.bucket, q.key, q.objOpt)
+
+					p.finish(q, state, err)
+					p.pending.Done()
+				case <-p.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if opts.SmallObjectSize > 0 {
+		p.small = make(chan *queueUpload)
+
+		for i := 0; i < max(1, opts.ConcurrentSmallObjects); i++ {
+			go func() {
+				for {
+					select {
+					case q := <-p.small:
+						p.hooks.objectStart(q.bucket, q.key)
+
+						state, err := p.uploadSmall(q.ctx, q.r, q.bucket, q.key, q.objOpt)
+
+						p.finish(q, state, err)
+						p.pending.Done()
+					case <-p.ctx.Done():
+						return
 					}
+				}
+			}()
+		}
+	}
+
+	for i := 0; i < max(1, opts.ConcurrentAttributes); i++ {
+		go func() {
+			for {
+				select {
+				case a := <-p.attributes:
+					st := a.res.State
+					st.objectAttributesOutput, st.objectAttributesError = getObjectAttributes(
+						a.q.ctx, a.res.Bucket, a.res.Key, p.opts)
+
+					p.done(a.q, a.res)
+					p.pending.Done()
 				case <-p.ctx.Done():
 					return
 				}
@@ -83,6 +153,51 @@ func NewUploader(ctx context.Context, opts *Options) *Uploader {
 	return p
 }
 
+// finish records the results of an upload, handing a completed object off to
+// have its attributes fetched by another goroutine, so that the next object
+// may start uploading.  It must be called before the upload is marked done in
+// p.pending, so that the hand-off is counted before the upload is not.
+func (p *Uploader) finish(q *queueUpload, state *S3UploadState, err error) {
+	if err == nil && state != nil && state.obj != nil && !state.checksumOnly {
+		p.hooks.partComplete(q.bucket, q.key, 1, state.hr.Size())
+	}
+
+	res := &UploadResults{
+		Bucket: q.bucket,
+		Key:    q.key,
+		State:  state,
+		Error:  err,
+	}
+
+	if err == nil && state != nil && state.completed() {
+		p.pending.Add(1)
+
+		select {
+		case p.attributes <- &queuedAttributes{q: q, res: res}:
+			return
+		case <-p.ctx.Done():
+			p.pending.Done()
+			state.objectAttributesError = context.Cause(p.ctx)
+		}
+	}
+
+	p.done(q, res)
+}
+
+// done returns the results of an upload, once the attributes of a completed
+// object have been fetched.
+func (p *Uploader) done(q *queueUpload, res *UploadResults) {
+	p.hooks.objectDone(res)
+
+	q.res <- res
+}
+
+// SetHooks sets the UploadHooks called as uploads progress, it should be
+// called before any objects are passed to Upload.
+func (p *Uploader) SetHooks(hooks *UploadHooks) {
+	p.hooks = hooks
+}
+
 func (p *Uploader) registerAbortable(s3multi *S3UploadParts) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -127,6 +242,19 @@ func (p *Uploader) PendingTarget(uploadID *string) string {
 	return ""
 }
 
+// PendingState returns a ResumeState for a pending upload, or nil if the
+// upload is no longer pending.
+func (p *Uploader) PendingState(uploadID *string) *ResumeState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s3multi, ok := p.abortable[uploadID]; ok {
+		return s3multi.st.resumeState(p.opts.PartSize)
+	}
+
+	return nil
+}
+
 // AbortPending attempts to abort any pending uploads.
 func (p *Uploader) AbortPending(ctx context.Context) {
 	p.mu.Lock()
@@ -183,8 +311,9 @@ func (p *Uploader) Close() {
 
 // Upload processes queues an upload process, and returns a channel that may
 // optionally be read to check the results.  If the context provided is
-// canceled then the upload will be canceled.
-func (p *Uploader) Upload(ctx context.Context, r io.Reader, Bucket, Key string) chan *UploadResults {
+// canceled then the upload will be canceled.  The ObjectOptions may be nil if
+// there are no per-object overrides.
+func (p *Uploader) Upload(ctx context.Context, r io.Reader, Bucket, Key string, objOpt *ObjectOptions) chan *UploadResults {
 	p.pending.Add(1)
 
 	q := &queueUpload{
@@ -192,13 +321,20 @@ func (p *Uploader) Upload(ctx context.Context, r io.Reader, Bucket, Key string)
 		r:      r,
 		bucket: Bucket,
 		key:    Key,
+		objOpt: objOpt,
 		res:    make(chan *UploadResults, 1),
 	}
 
+	// small files are uploaded by a separate pool of goroutines
+	queued := p.queued
+	if p.smallObject(r, objOpt) {
+		queued = p.small
+	}
+
 	select {
-	case p.queued <- q:
-		// submitted, it is now the reponsibility of p.upload
-		// to call p.pending.Done()
+	case queued <- q:
+		// submitted, it is now the reponsibility of the worker
+		// to call p.pending.Done() once it has called p.finish
 	case <-p.ctx.Done():
 		// failed to submit, call p.pending.Done() to clear the
 		// pending state for this upload
@@ -228,33 +364,154 @@ func (p *Uploader) Upload(ctx context.Context, r io.Reader, Bucket, Key string)
 // whether or not Options.UseMemoryBuffers was set to true.
 //
 // The Options.ConcurrentParts objects will control how many parts are uploaded
-// in parallel per individual call to Upload.  To estimate the amount of extra
-// free disk space or free memory required to process the io.Reader, the caller
-// needs to multiply Options.ConcurrentObjects, Options.ConcurrentParts, and
-// Options.PartSize together.
+// in parallel per individual call to Upload, and Options.ReadAhead controls how
+// many additional parts may be buffered while waiting to be uploaded.  To
+// estimate the amount of extra free disk space or free memory required to
+// process the io.Reader, the caller needs to multiply Options.ConcurrentObjects,
+// Options.ConcurrentParts plus Options.ReadAhead, and Options.PartSize
+// together.
 //
-// If the io.Reader input size is equal to or less than Options.PartSize then
-// S3 PutObject will be used to create the object, otherwise a multi-part
+// If the io.Reader input size is equal to or less than Options.PartSize, or
+// is known in advance and is equal to or less than Options.MultipartThreshold,
+// then S3 PutObject will be used to create the object, otherwise a multi-part
 // object will be created.
-func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string) (*S3UploadState, error) {
-	defer p.pending.Done()
+//
+// Any per-object overrides in the ObjectOptions, followed by any defaults set
+// for all objects in the Options, are applied to the PutObject or
+// CreateMultipartUpload request.
+//
+// If Options.Flock is set and the io.Reader is a file, a shared advisory lock
+// is held on it for the duration of the upload.
+//
+// If the io.Reader is a file it is stat'ed again once the upload completes,
+// and if it changed during the upload the object is uploaded again up to
+// Options.ReuploadModified times.  If it is still changing then the returned
+// S3UploadState records ErrSourceModified for the manifest.
+func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string, objOpt *ObjectOptions) (*S3UploadState, error) {
+	// with -trace each object is a task, with regions for each stage
+	ctx, task := trace.NewTask(ctx, "object")
+	defer task.End()
+	trace.Log(ctx, "object", Bucket+"/"+Key)
+
+	// with -flock hold a shared lock on the source file while it is read
+	if p.opts.Flock {
+		unlock, err := lockSource(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	for attempt := 0; ; attempt++ {
+		before := statSource(r)
+
+		st, err := p.transfer(ctx, r, Bucket, Key, objOpt)
+		if err != nil || st == nil {
+			return st, err
+		}
+
+		modErr := before.changed(r)
+		if modErr == nil {
+			return st, nil
+		}
+
+		seeker, ok := r.(io.Seeker)
+		if attempt < p.opts.ReuploadModified && ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+				log.Printf("re-uploading object %s/%s: %s", Bucket, Key, modErr)
+				continue
+			}
+		}
 
-	var src Source
-	var err error
+		log.Printf("warning for object %s/%s: %s", Bucket, Key, modErr)
 
-	if p.opts.UseMemoryBuffers {
-		src, err = MemorySource(r, p.opts.PartSize, p.opts.partBuf)
-	} else {
-		src, err = TempfileSource(r, p.opts.PartSize, p.opts.UseTempDir)
+		st.sourceError = modErr
+
+		return st, nil
 	}
+}
 
+// transfer performs a single upload of r, see upload.
+func (p *Uploader) transfer(ctx context.Context, r io.Reader, Bucket, Key string, objOpt *ObjectOptions) (*S3UploadState, error) {
+	// apply any options set for all objects
+	objOpt = objOpt.withDefaults(p.opts.objOpt)
+
+	var source string
+	if objOpt != nil {
+		source = objOpt.Source
+	}
+
+	src, err := newSource(source, r, p.opts)
 	if err != nil {
 		return nil, err
 	}
 
+	// the size of a file is known before it is read, so the parts can be
+	// allocated up front and the choice between putObject and a multi-part
+	// upload made without reading ahead
+	size := int64(-1)
+	if sized, ok := src.(SizedSource); ok {
+		size = sized.Size()
+	}
+
+	// with -multipart-threshold an object larger than a part but within
+	// the threshold is read as a single part, so that it is uploaded
+	// using putObject
+	partSize := p.opts.PartSize
+	if size > partSize && size <= p.opts.MultipartThreshold && p.opts.UploadID == "" {
+		partSize = size
+
+		objOpts := *p.opts
+		objOpts.PartSize = partSize
+		if src, err = newSource(source, r, &objOpts); err != nil {
+			return nil, err
+		}
+	}
+
 	// S3HashWriter will track the hash signature of the parts and of the
 	// whole body
-	s3hw := NewS3HashWriter(p.opts.ChecksumAlgorithm, p.opts.PartSize)
+	s3hw := NewS3HashWriter(p.opts.ChecksumAlgorithm, partSize)
+	s3hw.AddExtraChecksums(p.opts.ExtraChecksums...)
+	if size >= 0 {
+		s3hw.Grow(size)
+	}
+
+	// with -checksum-only the source is hashed but not uploaded
+	if p.opts.ChecksumOnly {
+		st, err := checksumOnly(ctx, src, Bucket, Key, s3hw)
+		if st != nil {
+			st.runID = p.opts.RunID
+		}
+		return st, err
+	}
+
+	// register with the bandwidth limiter so that this object receives
+	// its share of the bandwidth
+	if p.opts.bwlimit != nil {
+		stream := p.opts.bwlimit.Stream()
+		defer stream.Close()
+		ctx = WithBandwidthStream(ctx, stream)
+	}
+
+	// with -probe-size the choice for a source of unknown size is made by
+	// reading at most ProbeSize bytes, and a source longer than that is
+	// uploaded as a multi-part object (a source read by the backend for its
+	// URI scheme is not probed)
+	var probed bool
+	_, uri := r.(*sourceURI)
+	if size < 0 && p.opts.ProbeSize > 0 && p.opts.UploadID == "" && !uri {
+		st, pr, err := p.probe(ctx, r, Bucket, Key, objOpt, s3hw)
+		if err != nil || st != nil {
+			return st, err
+		}
+		defer pr.Close()
+
+		r = pr
+		probed = true
+		if src, err = newSource(source, r, p.opts); err != nil {
+			return nil, err
+		}
+	}
 
 	// s3multi will be initialized once we have a SourceReader derived from
 	// the Source and know we want to upload a multi-part object instead of
@@ -267,19 +524,121 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 	var pUploadID *string
 	var pPartID *int32
 
+	// resumed holds the parts the server already holds for an upload
+	// resumed with -resume, by part number
+	var resumed map[int32]types.Part
+
 	// peeked may be set to store the read-ahead value of the next
 	// SourceReader and/or error
 	var peeked func() (*SourceReader, error)
 
+	// buffered limits the number of SourceReader read from src that have
+	// not yet finished uploading, a slot must be acquired before calling
+	// src.Next and is released once the part has been uploaded.  Sources
+	// whose parts are held in memory or temporary files are limited to
+	// Options.ConcurrentParts, even with Options.DynamicParts, so that
+	// the space they use does not grow with the shared budget.
+	concurrency := p.partConcurrency(src)
+	slots := concurrency
+	if streamSource(src) {
+		slots = min(slots, p.opts.ConcurrentParts)
+	}
+	buffered := make(chan struct{}, slots+p.opts.ReadAhead)
+
+	acquire := func() error {
+		select {
+		case buffered <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+
+	release := func() {
+		<-buffered
+	}
+
+	// parts tracks the goroutines waiting on the results of each part, so
+	// that the hooks for every part are called before the object is done
+	parts := &sync.WaitGroup{}
+
+	// with -stream-parts the parts after the first of a source that would
+	// otherwise be buffered are uploaded while they are read from r
+	streaming := p.opts.StreamParts && size < 0 && streamSource(src)
+
 	for {
 		var sr *SourceReader
 		var err error
 
+		if s3multi != nil && streaming {
+			if err := acquire(); err != nil {
+				return nil, err
+			}
+
+			algo := s3hw.S3Hasher.ChecksumAlgorithm()
+			sp := newStreamPart(p.opts.partBuf, p.opts.PartSize, algo)
+
+			// wait for the first byte of the part, so that no
+			// request is sent if the source has ended
+			if err := sp.fill(r, s3hw, 1); err != nil {
+				sp.free()
+				release()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+
+			partID, err := s3multi.NextPartID()
+			if err != nil {
+				sp.free()
+				release()
+				return nil, err
+			}
+
+			part := sp.uploadPartInput(&s3.UploadPartInput{
+				Bucket:     pBucket,
+				Key:        pKey,
+				UploadId:   pUploadID,
+				PartNumber: aws.Int32(partID),
+			})
+			objOpt.applyUploadPart(part)
+
+			errch := s3multi.UploadPart(part)
+			parts.Add(1)
+			go func(errch chan error, sp *streamPart, partID int32) {
+				defer parts.Done()
+				if err := <-errch; err == nil {
+					p.hooks.partComplete(Bucket, Key, partID, sp.Size())
+				}
+				sp.wait()
+				sp.free()
+				release()
+			}(errch, sp, partID)
+
+			err = sp.fill(r, s3hw, int(p.opts.PartSize))
+			if err != nil && !errors.Is(err, io.EOF) {
+				sp.fail(err)
+				return nil, err
+			}
+
+			sp.seal(s3hw.S3Hasher.MD5SumPart(partID), s3hw.S3Hasher.SumPart(partID))
+
+			// a short part is the last
+			if err != nil {
+				break
+			}
+
+			continue
+		}
+
 		if peeked != nil {
 			sr, err = peeked()
 			peeked = nil
-		} else {
+		} else if err = acquire(); err == nil {
+			region := trace.StartRegion(ctx, "buffer")
 			sr, err = src.Next()
+			region.End()
 		}
 
 		if err != nil {
@@ -288,6 +647,12 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 				return nil, err
 			}
 
+			// an attached upload cannot be converted to a
+			// putObject request
+			if s3multi == nil && p.opts.UploadID != "" {
+				return nil, errUploadIDEmpty
+			}
+
 			// if we hit an io.EOF before we initialized s3multi
 			// then this was a zero length input
 			if s3multi == nil {
@@ -296,7 +661,7 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 
 				// call putObject with a zeroReadCloser
 				zr := ZeroReadCloser()
-				return putObject(ctx, zr, Bucket, Key, p.opts, s3hw.S3Hasher)
+				return putObject(ctx, zr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
 			}
 
 			break
@@ -305,7 +670,10 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 		// copy SourceReader into the S3Hasher
 		buf := copyBuf.Get(copyBufSize)
 		defer copyBuf.Put(buf)
-		if _, err := io.CopyBuffer(s3hw, sr, buf); err != nil {
+		region := trace.StartRegion(ctx, "hash")
+		_, err = io.CopyBuffer(s3hw, sr, buf)
+		region.End()
+		if err != nil {
 			return nil, err
 		}
 
@@ -314,18 +682,44 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 			return nil, err
 		}
 
+		// optionally evaluate the content of the first part to find
+		// the Content-Type when the Key extension is not recognized
+		if s3multi == nil && p.opts.SniffMediaTypes {
+			if objOpt, err = objOpt.sniffMediaType(Key, sr); err != nil {
+				return nil, err
+			}
+		}
+
 		// check for the special case of a single part upload, which we
-		// will convert into a putObject request.
-		if s3multi == nil {
-			if size := s3hw.S3Hasher.PartSize(1); size < p.opts.PartSize {
+		// will convert into a putObject request (unless attaching to an
+		// existing upload).  When the size is not known the next part
+		// is read ahead to find out, unless streaming.
+		if s3multi == nil && p.opts.UploadID == "" {
+			switch {
+			case size >= 0 && size <= partSize:
+				return putObject(
+					ctx, sr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
+			case size >= 0:
+				// more than one part, upload as multi-part
+			case s3hw.S3Hasher.PartSize(1) < p.opts.PartSize:
 				return putObject(
-					ctx, sr, Bucket, Key, p.opts, s3hw.S3Hasher)
-			} else {
+					ctx, sr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
+			case probed:
+				// longer than -probe-size, upload as multi-part
+			case streaming:
+				// a full first part is uploaded as multi-part,
+				// so that the next part is streamed rather
+				// than read ahead
+			default:
+				if err := acquire(); err != nil {
+					return nil, err
+				}
+
 				next_sr, next_err := src.Next()
 
 				if next_sr == nil && errors.Is(next_err, io.EOF) {
 					return putObject(
-						ctx, sr, Bucket, Key, p.opts, s3hw.S3Hasher)
+						ctx, sr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
 				}
 
 				peeked = func() (*SourceReader, error) {
@@ -335,29 +729,71 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 		}
 
 		if s3multi == nil {
+			algo := s3hw.S3Hasher.ChecksumAlgorithm()
 
-			pMediaType := aws.String(MediaType(Key))
+			create := &s3.CreateMultipartUploadInput{
+				Bucket:            pBucket,
+				Key:               pKey,
+				ChecksumAlgorithm: algo.Type(),
+			}
 
-			algo := s3hw.S3Hasher.ChecksumAlgorithm()
+			objOpt.applyCreateMultipartUpload(create)
+			create.Metadata = objOpt.metadata(p.opts.RunID)
+
+			// with -resume a pending upload to the same key is
+			// attached to, unless it no longer exists
+			if st := p.opts.resume.take(Bucket, Key, p.opts.PartSize, algo); st != nil {
+				resumed, err = listParts(ctx, st, p.opts)
+				if err != nil {
+					log.Printf("unable to resume %s/%s (upload-id %s), starting a new upload: %s",
+						Bucket, Key, st.UploadId, err)
+				} else {
+					s3multi = AttachS3UploadParts(
+						ctx,
+						s3hw.S3Hasher,
+						create,
+						st.UploadId,
+						1,
+						concurrency,
+						p.opts)
+
+					p.registerAbortable(s3multi)
+				}
+			}
 
-			s3multi, err = NewS3UploadParts(
-				ctx,
-				s3hw.S3Hasher,
-				&s3.CreateMultipartUploadInput{
-					Bucket:            pBucket,
-					Key:               pKey,
-					ContentType:       pMediaType,
-					ChecksumAlgorithm: algo.Type(),
-				},
-				p.opts)
+			switch {
+			case s3multi != nil:
+				// resumed with -resume
+			case p.opts.UploadID != "":
+				// an upload created by another process is
+				// never aborted by s3up
+				s3multi = AttachS3UploadParts(
+					ctx,
+					s3hw.S3Hasher,
+					create,
+					p.opts.UploadID,
+					p.opts.StartPart,
+					concurrency,
+					p.opts)
+			default:
+				s3multi, err = NewS3UploadParts(
+					ctx,
+					s3hw.S3Hasher,
+					create,
+					concurrency,
+					p.opts)
+
+				if err != nil {
+					return nil, err
+				}
 
-			if err != nil {
-				return nil, err
+				p.registerAbortable(s3multi)
 			}
 
 			pUploadID = s3multi.UploadID()
 
-			p.registerAbortable(s3multi)
+			s3multi.st.lifecycleTag = objOpt.lifecycleTag()
+			s3multi.st.runID = p.opts.RunID
 		}
 
 		partID, err := s3multi.NextPartID()
@@ -374,14 +810,30 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 			PartNumber: pPartID,
 			Body:       sr,
 		}
+		objOpt.applyUploadPart(part)
 
 		s3hw.S3Hasher.SetUploadPartChecksums(*pPartID, part)
 
+		// parts of a resumed upload already held by the server are
+		// not uploaded again
+		if out := resumedPart(s3hw.S3Hasher, partID, resumed, objOpt.etagIsMD5()); out != nil {
+			s3multi.st.setPartResults(part, out, nil)
+			p.hooks.partComplete(Bucket, Key, partID, s3hw.S3Hasher.PartSize(partID))
+			sr.Close()
+			release()
+			continue
+		}
+
 		errch := s3multi.UploadPart(part)
-		go func(errch chan error, sr *SourceReader) {
-			<-errch
+		parts.Add(1)
+		go func(errch chan error, sr *SourceReader, partID int32, size int64) {
+			defer parts.Done()
+			if err := <-errch; err == nil {
+				p.hooks.partComplete(Bucket, Key, partID, size)
+			}
 			sr.Close()
-		}(errch, sr)
+			release()
+		}(errch, sr, partID, s3hw.S3Hasher.PartSize(partID))
 	}
 
 	err = s3multi.Wait(p.opts.UploadPartTimeout)
@@ -389,33 +841,121 @@ func (p *Uploader) upload(ctx context.Context, r io.Reader, Bucket, Key string)
 		return s3multi.st, err
 	}
 
+	parts.Wait()
+
+	// an attached upload is only completed if its parts start at 1 and
+	// the whole source was uploaded, otherwise the other parts are
+	// uploaded elsewhere and the process that created the upload completes
+	// it
+	if p.opts.UploadID != "" && (p.opts.StartPart > 1 || p.opts.RangeLength > 0) {
+		if p.opts.Verbose {
+			log.Printf("uploaded parts %d-%d of %s/%s using UploadId %s, leaving the upload to be completed",
+				p.opts.StartPart, p.opts.StartPart+s3multi.lastPartID-1,
+				Bucket, Key, p.opts.UploadID)
+		}
+		return s3multi.st, errors.Join(s3multi.st.Errors()...)
+	}
+
 	if len(s3multi.st.Errors()) == 0 {
-		s3multi.CompleteUpload(p.opts.CompleteUploadTimeout)
+		s3multi.CompleteUpload(ctx, p.opts.CompleteUploadTimeout, objOpt.etagIsMD5())
 		if len(s3multi.st.Errors()) == 0 {
 			p.unregisterAbortable(s3multi)
 		}
 	}
 
-	return s3multi.st, errors.Join(s3multi.st.Errors()...)
+	return s3multi.st, errors.Join(append(
+		s3multi.st.Errors(), s3multi.st.completedVerification.Err())...)
+}
+
+// partConcurrency returns the number of parts of src to upload in parallel.
+// Unless Options.DynamicParts is set this is Options.ConcurrentParts.
+func (p *Uploader) partConcurrency(src Source) int {
+	if !p.opts.DynamicParts {
+		return p.opts.ConcurrentParts
+	}
+
+	size := int64(-1)
+	if sized, ok := src.(SizedSource); ok {
+		size = sized.Size()
+	}
+
+	return partConcurrency(
+		size, p.opts.PartSize, p.opts.ConcurrentParts, p.opts.partBudget.Size())
+}
+
+// partConcurrency returns the number of parts to upload in parallel for an
+// object of size bytes split into partSize parts, limited to budget.  If the
+// size is unknown (< 0) then concurrentParts is used.
+func partConcurrency(size, partSize int64, concurrentParts, budget int) int {
+	if size < 0 {
+		return max(1, min(concurrentParts, budget))
+	}
+
+	nparts := (size + partSize - 1) / partSize
+
+	return int(max(1, min(nparts, int64(budget))))
+}
+
+// checksumOnly reads every part of src into the S3HashWriter without uploading
+// anything, returning an S3UploadState from which the checksums and ETag that
+// S3 would report for the object can be predicted.
+func checksumOnly(ctx context.Context, src Source, Bucket, Key string, s3hw *S3HashWriter) (*S3UploadState, error) {
+	buf := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(buf)
+
+	for {
+		region := trace.StartRegion(ctx, "buffer")
+		sr, err := src.Next()
+		region.End()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		region = trace.StartRegion(ctx, "hash")
+		_, err = io.CopyBuffer(s3hw, sr, buf)
+		region.End()
+		sr.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// register a zero length part for a zero length input
+	if s3hw.S3Hasher.Count() == 0 {
+		s3hw.Write([]byte{})
+	}
+
+	return &S3UploadState{
+		hr: s3hw.S3Hasher,
+		obj: &s3.PutObjectInput{
+			Bucket: &Bucket,
+			Key:    &Key,
+		},
+		checksumOnly: true,
+		mu:           &sync.Mutex{},
+	}, nil
 }
 
 // putObject uploads an io.ReadCloser as a stand-alone object
-func putObject(ctx context.Context, rc io.ReadCloser, Bucket, Key string, opts *Options, hr *S3Hasher) (*S3UploadState, error) {
+func putObject(ctx context.Context, rc io.ReadCloser, Bucket, Key string, objOpt *ObjectOptions, opts *Options, hr *S3Hasher) (*S3UploadState, error) {
 	defer rc.Close()
 
 	// AWS api wants pointers
 	pBucket := &Bucket
 	pKey := &Key
 
-	pMediaType := aws.String(MediaType(Key))
-
 	obj := &s3.PutObjectInput{
-		Bucket:      pBucket,
-		Key:         pKey,
-		Body:        rc,
-		ContentType: pMediaType,
+		Bucket: pBucket,
+		Key:    pKey,
+		Body:   rc,
 	}
 
+	objOpt.applyPutObject(obj)
+	obj.Metadata = objOpt.metadata(opts.RunID)
+
 	hr.SetPutObjectChecksums(obj)
 
 	s3client := opts.s3.Get()
@@ -425,7 +965,32 @@ func putObject(ctx context.Context, rc io.ReadCloser, Bucket, Key string, opts *
 		log.Printf("started upload for object %s/%s", Bucket, Key)
 	}
 
-	out, err := s3client.PutObject(ctx, obj)
+	region := trace.StartRegion(ctx, "upload")
+	putCtx, cancel := withTimeout(ctx, opts.PutObjectTimeout)
+	out, err := s3client.PutObject(putCtx, obj)
+	cancel()
+	region.End()
+
+	// compare the ETag and checksum returned against those calculated,
+	// failing the object on a mismatch only with -strict-verify
+	var verification *UploadVerification
+	if err == nil {
+		verification = NewPutObjectVerification(hr, out, objOpt.etagIsMD5())
+		if verr := verification.Err(); verr != nil {
+			log.Printf("verification failed for object %s/%s: %s", Bucket, Key, verr)
+			if opts.StrictVerify {
+				err = verr
+			}
+		}
+	}
+
+	// with -require-content-md5 confirm the object was sent with the
+	// Content-MD5 the ETag echoes
+	if err == nil && opts.RequireContentMD5 {
+		if err = hr.CheckPutObjectContentMD5(obj, out); err != nil {
+			log.Printf("verification failed for object %s/%s: %s", Bucket, Key, err)
+		}
+	}
 
 	p := &S3UploadState{
 		hr:        hr,
@@ -433,19 +998,111 @@ func putObject(ctx context.Context, rc io.ReadCloser, Bucket, Key string, opts *
 		objOutput: out,
 		objError:  err,
 		mu:        &sync.Mutex{},
-	}
 
-	if err == nil {
-		attr, err := getObjectAttributes(ctx, Bucket, Key, opts)
-		p.objectAttributesOutput = attr
-		p.objectAttributesError = err
+		completedVerification: verification,
+
+		lifecycleTag: objOpt.lifecycleTag(),
+		runID:        opts.RunID,
 	}
 
 	return p, err
 }
 
-// getObjectAttributes gets the current state of an object
+var errBadObjectAttributes = errors.New(
+	"-object-attributes must be a list of etag, checksum, object-parts, object-size, or storage-class, or none")
+
+// objectAttributesBackoff is the time waited before the first retry of a failed
+// GetObjectAttributes request.
+var objectAttributesBackoff = time.Second
+
+// defaultObjectAttributes are requested by getObjectAttributes unless
+// Options.ObjectAttributes is set.
+var defaultObjectAttributes = []types.ObjectAttributes{
+	types.ObjectAttributesEtag,
+	types.ObjectAttributesChecksum,
+	types.ObjectAttributesObjectParts,
+	types.ObjectAttributesObjectSize,
+}
+
+// parseObjectAttributes parses a comma separated list of attributes for
+// GetObjectAttributes, the value "none" returns an empty (non-nil) list.
+func parseObjectAttributes(s string) ([]types.ObjectAttributes, error) {
+	attrs := []types.ObjectAttributes{}
+
+	if strings.ToLower(strings.TrimSpace(s)) == "none" {
+		return attrs, nil
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		var attr types.ObjectAttributes
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "etag":
+			attr = types.ObjectAttributesEtag
+		case "checksum":
+			attr = types.ObjectAttributesChecksum
+		case "object-parts":
+			attr = types.ObjectAttributesObjectParts
+		case "object-size":
+			attr = types.ObjectAttributesObjectSize
+		case "storage-class":
+			attr = types.ObjectAttributesStorageClass
+		default:
+			return nil, fmt.Errorf("%w: %s", errBadObjectAttributes, name)
+		}
+
+		if !slices.Contains(attrs, attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return attrs, nil
+}
+
+// getObjectAttributes gets the current state of an object, returning nil if
+// Options.ObjectAttributes is empty.  Failed requests are retried up to
+// Options.ObjectAttributesRetries times, waiting objectAttributesBackoff
+// (doubled after each attempt) in between, as the object itself has already
+// been uploaded successfully.
 func getObjectAttributes(ctx context.Context, Bucket, Key string, opts *Options) (*s3.GetObjectAttributesOutput, error) {
+	backoff := objectAttributesBackoff
+
+	for attempt := 0; ; attempt++ {
+		out, err := fetchObjectAttributes(ctx, Bucket, Key, opts)
+		if err == nil || attempt >= opts.ObjectAttributesRetries || ctx.Err() != nil {
+			return out, err
+		}
+
+		if opts.Verbose {
+			log.Printf("retrying attributes for object %s/%s in %s: %s",
+				Bucket, Key, backoff, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+
+		backoff *= 2
+	}
+}
+
+// fetchObjectAttributes makes a single GetObjectAttributes request for an
+// object.
+func fetchObjectAttributes(ctx context.Context, Bucket, Key string, opts *Options) (*s3.GetObjectAttributesOutput, error) {
+	attrs := opts.ObjectAttributes
+	if attrs == nil {
+		attrs = defaultObjectAttributes
+	} else if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	maxParts := opts.ObjectAttributesMaxParts
+	if maxParts == 0 {
+		maxParts = DefaultMaxPartID
+	}
+
 	s3client := opts.s3.Get()
 	defer opts.s3.Put(s3client)
 
@@ -458,16 +1115,15 @@ func getObjectAttributes(ctx context.Context, Bucket, Key string, opts *Options)
 	pKey := &Key
 
 	params := &s3.GetObjectAttributesInput{
-		Bucket:   pBucket,
-		Key:      pKey,
-		MaxParts: aws.Int32(DefaultMaxPartID),
-		ObjectAttributes: []types.ObjectAttributes{
-			types.ObjectAttributesEtag,
-			types.ObjectAttributesChecksum,
-			types.ObjectAttributesObjectParts,
-			types.ObjectAttributesObjectSize,
-		},
+		Bucket:           pBucket,
+		Key:              pKey,
+		MaxParts:         aws.Int32(maxParts),
+		ObjectAttributes: attrs,
 	}
+	params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5 = opts.objOpt.sseCustomer()
+
+	ctx, cancel := withTimeout(ctx, opts.ObjectAttributesTimeout)
+	defer cancel()
 
 	return s3client.GetObjectAttributes(ctx, params)
 }
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// testUploaderOptions returns Options for uploading parts of partSize to a
+// test server at url.
+func testUploaderOptions(url string, partSize int64) *Options {
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}
+
+	return &Options{
+		PartSize:          partSize,
+		ConcurrentObjects: 1,
+		ConcurrentParts:   2,
+		MaxPartID:         10000,
+		ChecksumAlgorithm: ChecksumAlgorithmSHA256,
+		UseMemoryBuffers:  true,
+		partBuf:           NewBufferPool(partSize),
+		s3: NewS3ClientPool(true, cfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(url)
+			o.UsePathStyle = true
+		}),
+	}
+}
+
+// Validate the number of concurrent parts derived from an object size
+func TestPartConcurrency(t *testing.T) {
+	tests := []struct {
+		size            int64
+		partSize        int64
+		concurrentParts int
+		budget          int
+		expect          int
+	}{
+		// unknown size uses concurrentParts
+		{size: -1, partSize: 10, concurrentParts: 4, budget: 16, expect: 4},
+		// unknown size limited by the budget
+		{size: -1, partSize: 10, concurrentParts: 4, budget: 2, expect: 2},
+		// zero length object still has a worker
+		{size: 0, partSize: 10, concurrentParts: 4, budget: 16, expect: 1},
+		// two parts
+		{size: 11, partSize: 10, concurrentParts: 4, budget: 16, expect: 2},
+		// more parts than concurrentParts, within budget
+		{size: 100, partSize: 10, concurrentParts: 4, budget: 16, expect: 10},
+		// more parts than the budget
+		{size: 1000, partSize: 10, concurrentParts: 4, budget: 16, expect: 16},
+	}
+
+	for i, tst := range tests {
+		actual := partConcurrency(
+			tst.size, tst.partSize, tst.concurrentParts, tst.budget)
+		if actual != tst.expect {
+			t.Errorf("%d expected %d got %d", i, tst.expect, actual)
+		}
+	}
+}
+
+// Validate the values predicted by -checksum-only for single and multi-part
+// objects
+func TestChecksumOnly(t *testing.T) {
+	const partSize = 64
+
+	for i, tst := range []struct {
+		size   int
+		nparts int
+	}{
+		{size: 0, nparts: 1},
+		{size: 10, nparts: 1},
+		{size: partSize, nparts: 1},
+		{size: partSize*2 + 10, nparts: 3},
+	} {
+		data := bytes.Repeat([]byte("x"), tst.size)
+
+		src, err := MemorySource(bytes.NewReader(data), partSize, NewBufferPool(partSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s3hw := NewS3HashWriter(ChecksumAlgorithmSHA256, partSize)
+
+		st, err := checksumOnly(context.Background(), src, "bucket", "key", s3hw)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		obj, err := NewObjectReporting(st)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if !obj.Predicted || obj.Completed {
+			t.Errorf("%d expected predicted and not completed, got %v %v",
+				i, obj.Predicted, obj.Completed)
+		}
+
+		md5sum := md5.Sum(data)
+
+		expectETag := hex.EncodeToString(md5sum[:])
+		if tst.nparts > 1 {
+			expectETag = s3hw.ETag()
+		}
+
+		if *obj.ObjectAttributes.ETag != expectETag {
+			t.Errorf("%d expected ETag %s got %s",
+				i, expectETag, *obj.ObjectAttributes.ETag)
+		}
+
+		if obj.FullChecksums.ChecksumMD5.Hex != hex.EncodeToString(md5sum[:]) {
+			t.Errorf("%d unexpected MD5 %s", i, obj.FullChecksums.ChecksumMD5.Hex)
+		}
+
+		if tst.nparts > 1 {
+			parts := obj.ObjectAttributes.ObjectParts
+			if parts == nil || len(parts.Parts) != tst.nparts {
+				t.Errorf("%d expected %d parts, got %#v", i, tst.nparts, parts)
+			}
+		}
+	}
+}
+
+// Validate that canceling the context of an upload interrupts fetching the
+// attributes of the completed object, using a server that never responds to
+// GetObjectAttributes
+func TestUploadCancelAttributes(t *testing.T) {
+	const partSize = 64
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		w.Header().Set("ETag", `"etag"`)
+
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodGet:
+			cancel()
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	uploader := NewUploader(context.Background(), testUploaderOptions(srv.URL, partSize))
+
+	data := bytes.Repeat([]byte("x"), partSize*2)
+
+	select {
+	case res := <-uploader.Upload(ctx, bytes.NewReader(data), "bucket", "key", nil):
+		if res.State == nil || res.State.objectAttributesError == nil {
+			t.Errorf("expected attributes error, got %v", res.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("upload was not interrupted")
+	}
+}
+
+func TestUploadAttached(t *testing.T) {
+	const partSize = 64
+
+	var mu sync.Mutex
+	var requests []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		mu.Lock()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			requests = append(requests, "create")
+		case r.Method == http.MethodPut && query.Has("partNumber"):
+			requests = append(requests, "part "+query.Get("partNumber")+" "+query.Get("uploadId"))
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			requests = append(requests, "complete")
+		}
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.ConcurrentParts = 1
+	opts.UploadID = "ext"
+	opts.StartPart = 3
+
+	uploader := NewUploader(context.Background(), opts)
+
+	data := bytes.Repeat([]byte("x"), partSize*2)
+
+	res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+	if res.Error != nil {
+		t.Fatalf("expected no error, got %s", res.Error)
+	}
+
+	expect := []string{"part 3 ext", "part 4 ext"}
+	if !slices.Equal(requests, expect) {
+		t.Errorf("expected %v, got %v", expect, requests)
+	}
+
+	if pending := uploader.Pending(); len(pending) != 0 {
+		t.Errorf("expected attached upload not to be abortable, got %d", len(pending))
+	}
+
+	rs := res.State.resumeState(partSize)
+	if len(rs.Parts) != 2 || rs.Parts[0].PartNumber != 3 {
+		t.Errorf("expected parts numbered from 3, got %+v", rs.Parts)
+	}
+}
+
+// Validate that a source of known size chooses between PutObject and a
+// multi-part upload from its size
+func TestUploadKnownSize(t *testing.T) {
+	const partSize = 64
+
+	for i, tst := range []struct {
+		size      int
+		threshold int64
+		expect    []string
+	}{
+		{partSize - 1, 0, []string{"put"}},
+		{partSize, 0, []string{"put"}},
+		{partSize + 1, 0, []string{"create", "part 1", "part 2", "complete"}},
+		{partSize * 3, partSize * 3, []string{"put"}},
+		{partSize*3 + 1, partSize * 3, []string{"create", "part 1", "part 2", "part 3", "part 4", "complete"}},
+	} {
+		var mu sync.Mutex
+		var requests []string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			w.Header().Set("ETag", `"etag"`)
+
+			mu.Lock()
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				requests = append(requests, "create")
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPut && query.Has("partNumber"):
+				requests = append(requests, "part "+query.Get("partNumber"))
+			case r.Method == http.MethodPut:
+				requests = append(requests, "put")
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				requests = append(requests, "complete")
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			}
+			mu.Unlock()
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.ConcurrentParts = 1
+		opts.MultipartThreshold = tst.threshold
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := bytes.Repeat([]byte("x"), tst.size)
+
+		<-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if !slices.Equal(requests, tst.expect) {
+			t.Errorf("%d expected %v, got %v", i, tst.expect, requests)
+		}
+	}
+}
+
+// Validate the attributes and MaxParts requested by GetObjectAttributes once
+// an object is uploaded, and that GetObjectAttributes is not called when no
+// attributes are requested
+func TestUploadObjectAttributes(t *testing.T) {
+	const partSize = 64
+
+	tests := []struct {
+		attrs    []types.ObjectAttributes
+		maxParts int32
+		expect   string
+	}{
+		{nil, 0, "ETag,Checksum,ObjectParts,ObjectSize 10000"},
+		{[]types.ObjectAttributes{types.ObjectAttributesStorageClass}, 5, "StorageClass 5"},
+		{[]types.ObjectAttributes{}, 0, ""},
+	}
+
+	for i, tst := range tests {
+		var mu sync.Mutex
+		var requested string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			w.Header().Set("ETag", `"etag"`)
+
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			case r.Method == http.MethodGet && query.Has("attributes"):
+				mu.Lock()
+				requested = strings.Join(r.Header.Values("X-Amz-Object-Attributes"), ",") + " " +
+					r.Header.Get("X-Amz-Max-Parts")
+				mu.Unlock()
+				fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+			}
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.ObjectAttributes = tst.attrs
+		opts.ObjectAttributesMaxParts = tst.maxParts
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := bytes.Repeat([]byte("x"), partSize*2)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if res.Error != nil {
+			t.Errorf("%d unexpected error: %s", i, res.Error)
+			continue
+		}
+
+		if _, err := NewObjectReporting(res.State); err != nil {
+			t.Errorf("%d unexpected reporting error: %s", i, err)
+		}
+
+		mu.Lock()
+		if requested != tst.expect {
+			t.Errorf("%d expected %q, got %q", i, tst.expect, requested)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestParseObjectAttributes(t *testing.T) {
+	tests := []struct {
+		Value  string
+		Expect []types.ObjectAttributes
+		Err    bool
+	}{
+		{"none", []types.ObjectAttributes{}, false},
+		{"etag, Storage-Class,etag", []types.ObjectAttributes{
+			types.ObjectAttributesEtag, types.ObjectAttributesStorageClass}, false},
+		{"etag,size", nil, true},
+		{"", nil, true},
+	}
+
+	for i, test := range tests {
+		attrs, err := parseObjectAttributes(test.Value)
+		if (err != nil) != test.Err {
+			t.Errorf("%d expected error %v got %v", i, test.Err, err)
+			continue
+		}
+
+		if fmt.Sprint(attrs) != fmt.Sprint(test.Expect) {
+			t.Errorf("%d expected %v got %v", i, test.Expect, attrs)
+		}
+	}
+}
+
+// Validate the part sizes and throughput reported by verbose logging
+func TestPartProgressStrings(t *testing.T) {
+	sp := &streamPart{mu: &sync.Mutex{}}
+
+	for i, tst := range []struct {
+		part   *s3.UploadPartInput
+		expect string
+	}{
+		{&s3.UploadPartInput{Body: io.LimitReader(bytes.NewReader(nil), 0)}, "unknown size"},
+		{&s3.UploadPartInput{Body: &SourceReader{SectionReader: io.NewSectionReader(bytes.NewReader(make([]byte, 2048)), 0, 2048)}}, "2KiB"},
+		{&s3.UploadPartInput{Body: sp, ContentLength: aws.Int64(1024)}, "1KiB"},
+	} {
+		if actual := partSizeString(partBodySize(tst.part)); actual != tst.expect {
+			t.Errorf("%d expected %s, got %s", i, tst.expect, actual)
+		}
+	}
+
+	if actual := throughputString(2048, 2*time.Second); actual != "1KiB/s" {
+		t.Errorf("expected 1KiB/s, got %s", actual)
+	}
+}
+
+// Validate that failed GetObjectAttributes requests are retried, and that an
+// object whose attributes remain unavailable is still reported
+func TestUploadRetryAttributes(t *testing.T) {
+	const partSize = 64
+
+	defer func(d time.Duration) { objectAttributesBackoff = d }(objectAttributesBackoff)
+	objectAttributesBackoff = time.Millisecond
+
+	tests := []struct {
+		failures    int
+		retries     int
+		unavailable bool
+	}{
+		{failures: 0, retries: 0, unavailable: false},
+		{failures: 2, retries: 3, unavailable: false},
+		{failures: 2, retries: 1, unavailable: true},
+	}
+
+	for i, tst := range tests {
+		var mu sync.Mutex
+		var attempts int
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			w.Header().Set("ETag", `"etag"`)
+
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			case r.Method == http.MethodGet && query.Has("attributes"):
+				mu.Lock()
+				attempts += 1
+				fail := attempts <= tst.failures
+				mu.Unlock()
+
+				if fail {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+					return
+				}
+				fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+			}
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.ObjectAttributesRetries = tst.retries
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := bytes.Repeat([]byte("x"), partSize*2)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if res.Error != nil {
+			t.Errorf("%d unexpected error: %s", i, res.Error)
+			continue
+		}
+
+		obj, err := NewObjectReporting(res.State)
+		if err != nil {
+			t.Errorf("%d unexpected reporting error: %s", i, err)
+			continue
+		}
+
+		if !obj.Completed || obj.AttributesUnavailable != tst.unavailable {
+			t.Errorf("%d expected completed with attributes unavailable %t, got %t %t",
+				i, tst.unavailable, obj.Completed, obj.AttributesUnavailable)
+		}
+
+		if tst.unavailable && (obj.Errors == nil || obj.Errors.GetObjectAttributesError == "") {
+			t.Errorf("%d expected GetObjectAttributesError, got %#v", i, obj.Errors)
+		}
+	}
+}
+
+// Validate that fetching the attributes of a completed object does not delay
+// the upload of the next object
+func TestUploadConcurrentAttributes(t *testing.T) {
+	const partSize = 64
+
+	// the attributes of the first object are only returned once the
+	// second object has been uploaded
+	second := make(chan struct{})
+	var once sync.Once
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case r.Method == http.MethodPut:
+			if strings.HasSuffix(r.URL.Path, "/second") {
+				once.Do(func() { close(second) })
+			}
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodGet && query.Has("attributes"):
+			if strings.HasSuffix(r.URL.Path, "/first") {
+				select {
+				case <-second:
+				case <-time.After(5 * time.Second):
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+		}
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.ConcurrentAttributes = 2
+
+	uploader := NewUploader(context.Background(), opts)
+
+	first := uploader.Upload(context.Background(), bytes.NewReader([]byte("first")), "bucket", "first", nil)
+	next := uploader.Upload(context.Background(), bytes.NewReader([]byte("second")), "bucket", "second", nil)
+
+	for i, res := range []*UploadResults{<-first, <-next} {
+		if res.Error != nil || res.State.objectAttributesError != nil {
+			t.Errorf("%d expected no errors, got %v %v", i, res.Error, res.State.objectAttributesError)
+		}
+	}
+}
+
+// Validate that Wait does not return until the attributes of every completed
+// object have been fetched
+func TestUploadWaitAttributes(t *testing.T) {
+	const partSize = 64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodGet && r.URL.Query().Has("attributes"):
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+		}
+	}))
+	defer srv.Close()
+
+	uploader := NewUploader(context.Background(), testUploaderOptions(srv.URL, partSize))
+
+	res := uploader.Upload(context.Background(), bytes.NewReader([]byte("data")), "bucket", "key", nil)
+
+	if err := uploader.Wait(10 * time.Second); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	select {
+	case <-res:
+	default:
+		t.Errorf("expected the results before Wait returned")
+	}
+}
+
+// Validate -require-content-md5 fails objects and parts whose ETag does not
+// match the Content-MD5 sent
+func TestUploadRequireContentMD5(t *testing.T) {
+	const partSize = 64
+
+	tests := []struct {
+		size     int
+		badETag  bool
+		mismatch bool
+	}{
+		{size: partSize / 2, badETag: false, mismatch: false},
+		{size: partSize / 2, badETag: true, mismatch: true},
+		{size: partSize * 2, badETag: false, mismatch: false},
+		{size: partSize * 2, badETag: true, mismatch: true},
+	}
+
+	for i, tst := range tests {
+		var mu sync.Mutex
+		var missing int
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			switch {
+			case r.Method == http.MethodPut:
+				body, _ := io.ReadAll(r.Body)
+				sum := md5.Sum(body)
+
+				mu.Lock()
+				if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+					missing += 1
+				}
+				mu.Unlock()
+
+				etag := hex.EncodeToString(sum[:])
+				if tst.badETag {
+					etag = strings.Repeat("0", len(etag))
+				}
+				w.Header().Set("ETag", `"`+etag+`"`)
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+			case r.Method == http.MethodPost && query.Has("uploadId"):
+				fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+			case r.Method == http.MethodGet && query.Has("attributes"):
+				fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+			}
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.RequireContentMD5 = true
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := bytes.Repeat([]byte("x"), tst.size)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if missing != 0 {
+			t.Errorf("%d expected Content-MD5 on every request, %d missing", i, missing)
+		}
+
+		if mismatch := errors.Is(res.Error, ErrChecksumMismatch); mismatch != tst.mismatch {
+			t.Errorf("%d expected mismatch %t, got %v", i, tst.mismatch, res.Error)
+		}
+	}
+}
+
+// Validate objects uploaded using PutObject are recorded as Verified if the
+// ETag matches, and fail on a mismatch only with -strict-verify
+func TestUploadStrictVerify(t *testing.T) {
+	const partSize = 64
+
+	tests := []struct {
+		badETag  bool
+		strict   bool
+		failed   bool
+		verified bool
+	}{
+		{badETag: false, strict: true, failed: false, verified: true},
+		{badETag: true, strict: false, failed: false, verified: false},
+		{badETag: true, strict: true, failed: true, verified: false},
+	}
+
+	for i, tst := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPut:
+				body, _ := io.ReadAll(r.Body)
+				sum := md5.Sum(body)
+
+				etag := hex.EncodeToString(sum[:])
+				if tst.badETag {
+					etag = strings.Repeat("0", len(etag))
+				}
+				w.Header().Set("ETag", `"`+etag+`"`)
+			case r.Method == http.MethodGet && r.URL.Query().Has("attributes"):
+				fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+			}
+		}))
+
+		opts := testUploaderOptions(srv.URL, partSize)
+		opts.StrictVerify = tst.strict
+
+		uploader := NewUploader(context.Background(), opts)
+
+		data := bytes.Repeat([]byte("x"), partSize/2)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if failed := errors.Is(res.Error, ErrChecksumMismatch); failed != tst.failed {
+			t.Errorf("%d expected failed %t, got %v", i, tst.failed, res.Error)
+		}
+
+		if res.State == nil {
+			t.Errorf("%d expected an upload state", i)
+			continue
+		}
+
+		obj, err := NewObjectReporting(res.State)
+		if err != nil {
+			t.Errorf("%d unexpected reporting error: %s", i, err)
+			continue
+		}
+
+		if obj.Verified != tst.verified || obj.Verification == nil {
+			t.Errorf("%d expected verified %t, got %t %#v", i, tst.verified, obj.Verified, obj.Verification)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// MaxShardPrefix is the maximum number of hex characters in a shard prefix
+const MaxShardPrefix = 8
+
+var errBadShardPrefix = errors.New(
+	"-shard-prefix must be between 0 and 8")
+
+var errShardPrefixKey = errors.New(
+	"-shard-prefix requires -key to be empty or a prefix ending in '/'")
+
+// shardKey inserts a short hash prefix of n hex characters (followed by a '/')
+// into key after prefix, so that keys sharing a single prefix are spread
+// across many prefixes, and so across S3 partitions.  The hash is derived
+// from the remainder of the key, so the same source always maps to the same
+// shard.  Keys that do not start with prefix are returned unchanged.
+//
+// e.g., shardKey("data/file.dat", "data/", 2) returns "data/3f/file.dat"
+func shardKey(key, prefix string, n int) string {
+	if n <= 0 || !strings.HasPrefix(key, prefix) {
+		return key
+	}
+
+	rest := key[len(prefix):]
+	sum := md5.Sum([]byte(rest))
+
+	return prefix + hex.EncodeToString(sum[:])[:n] + "/" + rest
+}
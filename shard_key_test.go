@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShardKey(t *testing.T) {
+	for i, tst := range []struct {
+		key    string
+		prefix string
+		n      int
+		expect string
+	}{
+		// md5("file.dat") = 24132770615d6d79e8ba7123b86c1995
+		{"data/file.dat", "data/", 0, "data/file.dat"},
+		{"data/file.dat", "data/", 2, "data/24/file.dat"},
+		{"file.dat", "", 4, "2413/file.dat"},
+		{"other/file.dat", "data/", 2, "other/file.dat"},
+	} {
+		actual := shardKey(tst.key, tst.prefix, tst.n)
+		if actual != tst.expect {
+			t.Errorf("%d expected %s got %s", i, tst.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errManifestAppendUnsupported = errors.New(
+	"-manifest-append is not supported on this platform, it requires file locking")
+
+var errExportManifestArgs = errors.New(
+	"s3up export-manifest requires the name of a -manifest-append file")
+
+// sharedManifest appends JSON lines records to a file shared by concurrent
+// runs (see -manifest-append).  Each record is written while holding an
+// exclusive lock on the file, so that records from different runs are never
+// interleaved, including on file systems where O_APPEND is not atomic.
+type sharedManifest struct {
+	name string
+}
+
+// Append writes v as a single JSON line at the end of the shared manifest,
+// creating the file if needed.
+func (p *sharedManifest) Append(ctx context.Context, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	fh, err := os.OpenFile(p.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFD(ctx, fh.Fd(), true)
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	_, err = fh.Write(buf)
+	unlock()
+
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// sharedRecordRunID returns the RunID of a record in a shared manifest, which
+// may be a RunMetadata header, an object, or a RunEnd trailer.
+func sharedRecordRunID(line []byte) (string, error) {
+	var rec struct {
+		RunID       string
+		RunMetadata *RunMetadata
+		RunEnd      *RunEnd
+	}
+
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return "", err
+	}
+
+	switch {
+	case rec.RunMetadata != nil:
+		return rec.RunMetadata.RunID, nil
+	case rec.RunEnd != nil:
+		return rec.RunEnd.RunID, nil
+	}
+
+	return rec.RunID, nil
+}
+
+// exportSharedManifest reads the records of a shared manifest from r and
+// writes those of the run runID (or of every run, if runID is empty) to w as
+// a JSON array, in the format of -manifest json.
+func exportSharedManifest(r io.Reader, w io.Writer, runID string) error {
+	manifest := Manifest(JsonManifest, w)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+
+	lineno := 0
+	for scanner.Scan() {
+		lineno += 1
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		id, err := sharedRecordRunID(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+
+		if runID != "" && id != runID {
+			continue
+		}
+
+		if err := manifest.writeJSON(json.RawMessage(line)); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !manifest.started {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n]\n")
+
+	return err
+}
+
+// runExportManifest implements "s3up export-manifest", writing the records of
+// a -manifest-append file to standard output as a JSON manifest, optionally
+// only those of the run named by -run-id.
+func runExportManifest(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("s3up export-manifest", flag.ExitOnError)
+
+	var runID string
+	flags.StringVar(&runID, "run-id", "",
+		"optionally export only the records of this run")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errExportManifestArgs
+	}
+
+	if !flockSupported {
+		return errManifestAppendUnsupported
+	}
+
+	fh, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	// wait for any record being appended to be written in full
+	unlock, err := lockFD(ctx, fh.Fd(), false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return exportSharedManifest(fh, os.Stdout, runID)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Validate that concurrent runs appending to a shared manifest produce whole
+// lines, and that the records of each run may be exported
+func TestSharedManifest(t *testing.T) {
+	if !flockSupported {
+		t.Skip("file locking is not supported on this platform")
+	}
+
+	name := filepath.Join(t.TempDir(), "runs.jsonl")
+
+	const nruns = 4
+	const nobjects = 50
+
+	wg := &sync.WaitGroup{}
+	for run := 0; run < nruns; run++ {
+		wg.Add(1)
+		go func(runID string) {
+			defer wg.Done()
+
+			manifest := Manifest(NoManifest, nil)
+			manifest.SetRunMetadata(&RunMetadata{RunID: runID})
+			manifest.SetSharedManifest(context.Background(), name)
+
+			for i := 0; i < nobjects; i++ {
+				err := manifest.Write(&ObjectReporting{
+					Bucket: "bucket",
+					Key:    fmt.Sprintf("%s/%d", runID, i),
+					RunID:  runID,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+
+			if err := manifest.End(); err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("run-%d", run))
+	}
+	wg.Wait()
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) != nruns*(nobjects+2) {
+		t.Errorf("expected %d lines, got %d", nruns*(nobjects+2), len(lines))
+	}
+
+	out := &bytes.Buffer{}
+	if err := exportSharedManifest(bytes.NewReader(buf), out, "run-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []map[string]json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatalf("expected a JSON array, got %s: %s", err, out)
+	}
+
+	if len(records) != nobjects+2 {
+		t.Fatalf("expected %d records, got %d", nobjects+2, len(records))
+	}
+
+	if _, ok := records[0]["RunMetadata"]; !ok {
+		t.Errorf("expected leading RunMetadata, got %s", records[0])
+	}
+
+	if _, ok := records[len(records)-1]["RunEnd"]; !ok {
+		t.Errorf("expected trailing RunEnd, got %s", records[len(records)-1])
+	}
+
+	// an unknown run exports an empty manifest
+	out.Reset()
+	if err := exportSharedManifest(bytes.NewReader(buf), out, "run-9"); err != nil || out.String() != "[]\n" {
+		t.Errorf("expected empty manifest, got %q %v", out, err)
+	}
+}
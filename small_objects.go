@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"runtime/trace"
+)
+
+var errBadSmallObjectSize = errors.New(
+	"-small-object-size must not be larger than -part-size")
+
+// smallObject returns true if r should be uploaded by the small object fast
+// path, i.e., Options.SmallObjectSize is set, r is a regular file of at most
+// that size, and the object needs none of the processing of the Source and
+// part machinery (e.g., -bwlimit or -flock).
+func (p *Uploader) smallObject(r io.Reader, objOpt *ObjectOptions) bool {
+	if p.small == nil || p.opts.ChecksumOnly || p.opts.bwlimit != nil ||
+		p.opts.Flock || p.opts.UploadID != "" {
+		return false
+	}
+
+	if objOpt != nil && objOpt.Source != "" {
+		return false
+	}
+
+	fh, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := fh.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	return fi.Size() <= int64(p.opts.SmallObjectSize)
+}
+
+// uploadSmall uploads a small file, see smallObject, using a single PutObject
+// request.  The file is read once into a buffer from Options.smallBuf and
+// hashed inline, rather than hashed and then read again for the upload.  As
+// with upload, the file is uploaded again if it changed during the upload, up
+// to Options.ReuploadModified times.
+func (p *Uploader) uploadSmall(ctx context.Context, r io.Reader, Bucket, Key string, objOpt *ObjectOptions) (*S3UploadState, error) {
+	ctx, task := trace.NewTask(ctx, "object")
+	defer task.End()
+	trace.Log(ctx, "object", Bucket+"/"+Key)
+
+	fh := r.(*os.File)
+
+	for attempt := 0; ; attempt++ {
+		before := statSource(fh)
+
+		st, err := p.putSmall(ctx, fh, Bucket, Key, objOpt)
+		if err != nil || st == nil {
+			return st, err
+		}
+
+		modErr := before.changed(fh)
+		if modErr == nil {
+			return st, nil
+		}
+
+		if attempt < p.opts.ReuploadModified {
+			log.Printf("re-uploading object %s/%s: %s", Bucket, Key, modErr)
+			continue
+		}
+
+		log.Printf("warning for object %s/%s: %s", Bucket, Key, modErr)
+
+		st.sourceError = modErr
+
+		return st, nil
+	}
+}
+
+// putSmall reads fh into a pooled buffer, hashing it, and uploads it using
+// putObject.
+func (p *Uploader) putSmall(ctx context.Context, fh *os.File, Bucket, Key string, objOpt *ObjectOptions) (*S3UploadState, error) {
+	// apply any options set for all objects
+	objOpt = objOpt.withDefaults(p.opts.objOpt)
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := p.opts.smallBuf.Get(fi.Size())
+
+	region := trace.StartRegion(ctx, "buffer")
+	n, err := fh.ReadAt(buf, 0)
+	region.End()
+	if err != nil && !errors.Is(err, io.EOF) {
+		p.opts.smallBuf.Put(buf)
+		return nil, err
+	}
+
+	rc := &memBuffer{
+		bp: p.opts.smallBuf,
+		b:  buf,
+		r:  bytes.NewReader(buf[0:n]),
+	}
+
+	sr := &SourceReader{
+		SectionReader: io.NewSectionReader(rc, 0, int64(n)),
+		closer:        rc.Close,
+	}
+
+	s3hw := NewS3HashWriter(p.opts.ChecksumAlgorithm, p.opts.PartSize)
+	s3hw.AddExtraChecksums(p.opts.ExtraChecksums...)
+
+	region = trace.StartRegion(ctx, "hash")
+	s3hw.Write(buf[0:n])
+	region.End()
+
+	if p.opts.SniffMediaTypes {
+		if objOpt, err = objOpt.sniffMediaType(Key, sr); err != nil {
+			sr.Close()
+			return nil, err
+		}
+	}
+
+	return putObject(ctx, sr, Bucket, Key, objOpt, p.opts, s3hw.S3Hasher)
+}
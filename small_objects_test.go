@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Validate that small files are uploaded by the fast path with a single
+// PutObject, and other sources are not
+func TestUploadSmall(t *testing.T) {
+	const partSize = 64
+
+	var mu sync.Mutex
+	bodies := map[string]string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies[filepath.Base(r.URL.Path)] = string(body)
+			mu.Unlock()
+		}
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.SmallObjectSize = partSize / 2
+	opts.ConcurrentSmallObjects = 2
+	opts.smallBuf = NewBufferPool(partSize / 2)
+	opts.ObjectAttributes = []types.ObjectAttributes{}
+
+	uploader := NewUploader(context.Background(), opts)
+
+	dir := t.TempDir()
+
+	for i, tst := range []struct {
+		size  int
+		file  bool
+		small bool
+	}{
+		{0, true, true},
+		{partSize / 2, true, true},
+		{partSize/2 + 1, true, false},
+		{partSize / 4, false, false},
+	} {
+		data := bytes.Repeat([]byte{byte('a' + i)}, tst.size)
+
+		var r io.Reader = bytes.NewReader(data)
+		if tst.file {
+			name := filepath.Join(dir, string(rune('a'+i)))
+			if err := os.WriteFile(name, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			fh, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fh.Close()
+
+			r = fh
+		}
+
+		if small := uploader.smallObject(r, nil); small != tst.small {
+			t.Errorf("%d expected small %t, got %t", i, tst.small, small)
+		}
+
+		key := string(rune('a' + i))
+
+		res := <-uploader.Upload(context.Background(), r, "bucket", key, nil)
+		if res.Error != nil {
+			t.Errorf("%d unexpected error: %s", i, res.Error)
+			continue
+		}
+
+		if res.State.obj == nil || bodies[key] != string(data) {
+			t.Errorf("%d expected PutObject of %d bytes, got %d", i, tst.size, len(bodies[key]))
+		}
+	}
+}
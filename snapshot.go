@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var errSnapshotCleanupWithoutCmd = errors.New(
+	"-snapshot-cleanup-cmd requires -snapshot-cmd")
+
+var errSnapshotMount = errors.New(
+	"-snapshot-cmd must print the snapshot mount directory")
+
+var errSnapshotOutside = errors.New(
+	"glob is outside of the -snapshot-cmd working directory")
+
+// snapshot maps paths in the working directory (the root) to the same paths
+// in a point-in-time snapshot of it, mounted elsewhere (see -snapshot-cmd).
+// Paths outside of the root are not in the snapshot.
+type snapshot struct {
+	root  string
+	mount string
+}
+
+// shellCommand returns an exec.Cmd running cmd using the system shell.
+func shellCommand(ctx context.Context, cmd string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", cmd)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+}
+
+// takeSnapshot runs cmd to create a snapshot of the working directory, which
+// is passed to it as S3UP_SNAPSHOT_ROOT.  The last line printed by cmd names
+// the directory the snapshot is mounted on.
+func takeSnapshot(ctx context.Context, cmd string) (*snapshot, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	c := shellCommand(ctx, cmd)
+	c.Env = append(os.Environ(), "S3UP_SNAPSHOT_ROOT="+root)
+	c.Stderr = os.Stderr
+
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("-snapshot-cmd failed: %w", err)
+	}
+
+	var mount string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			mount = line
+		}
+	}
+
+	if mount == "" {
+		return nil, errSnapshotMount
+	}
+
+	if mount, err = filepath.Abs(mount); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(mount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSnapshotMount, err)
+	}
+
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%w: not a directory: %s", errSnapshotMount, mount)
+	}
+
+	return &snapshot{
+		root:  root,
+		mount: mount,
+	}, nil
+}
+
+// cleanup runs cmd to remove the snapshot, which is passed to it as
+// S3UP_SNAPSHOT_ROOT and S3UP_SNAPSHOT_MOUNT.
+func (p *snapshot) cleanup(ctx context.Context, cmd string) error {
+	if p == nil || cmd == "" {
+		return nil
+	}
+
+	c := shellCommand(ctx, cmd)
+	c.Env = append(os.Environ(),
+		"S3UP_SNAPSHOT_ROOT="+p.root,
+		"S3UP_SNAPSHOT_MOUNT="+p.mount)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("-snapshot-cleanup-cmd failed: %w", err)
+	}
+
+	return nil
+}
+
+// fatal runs cmd to remove the snapshot (see cleanup) before exiting with
+// log.Fatal, so that the snapshot is not left behind when the run fails.
+func (p *snapshot) fatal(cmd string, v ...any) {
+	if err := p.cleanup(context.Background(), cmd); err != nil {
+		log.Print(err)
+	}
+
+	log.Fatal(v...)
+}
+
+// path returns the path in the snapshot for name, a path (or glob pattern) in
+// the working directory.  Names outside of the working directory, which would
+// be read from the live file system rather than the snapshot, return
+// errSnapshotOutside.
+func (p *snapshot) path(name string) (string, error) {
+	if p == nil {
+		return name, nil
+	}
+
+	rel := name
+	if filepath.IsAbs(name) {
+		var err error
+		if rel, err = filepath.Rel(p.root, name); err != nil {
+			return "", fmt.Errorf("%w: %s", errSnapshotOutside, name)
+		}
+	}
+
+	if !filepath.IsLocal(rel) && filepath.Clean(rel) != "." {
+		return "", fmt.Errorf("%w: %s", errSnapshotOutside, name)
+	}
+
+	return withTrailingSeparator(filepath.Join(p.mount, rel), name), nil
+}
+
+// live returns the path in the working directory for name, a path in the
+// snapshot returned by path.  The path is made absolute if abs is true,
+// otherwise it is relative to the working directory.
+func (p *snapshot) live(name string, abs bool) string {
+	if p == nil {
+		return name
+	}
+
+	rel, err := filepath.Rel(p.mount, name)
+	if err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return name
+	}
+
+	if abs {
+		rel = filepath.Join(p.root, rel)
+	}
+
+	return withTrailingSeparator(rel, name)
+}
+
+// withTrailingSeparator returns name with a trailing path separator added if
+// like has one, so that directories named with a trailing separator keep it.
+func withTrailingSeparator(name, like string) string {
+	if hasTrailingSeparator(like) && !hasTrailingSeparator(name) {
+		return name + string(filepath.Separator)
+	}
+	return name
+}
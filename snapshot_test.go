@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Validate the mapping of paths into and out of a snapshot
+func TestSnapshotPath(t *testing.T) {
+	root := filepath.FromSlash("/home/user")
+	mount := filepath.FromSlash("/mnt/snap")
+	snap := &snapshot{root: root, mount: mount}
+
+	sep := string(filepath.Separator)
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+	}{
+		{"data", filepath.Join(mount, "data"), nil},
+		{"data" + sep, filepath.Join(mount, "data") + sep, nil},
+		{filepath.Join(root, "data", "*.csv"), filepath.Join(mount, "data", "*.csv"), nil},
+		{filepath.Join(root, "..", "other"), "", errSnapshotOutside},
+		{filepath.Join("..", "other"), "", errSnapshotOutside},
+		{filepath.Join("data", "..", "..", "*"), "", errSnapshotOutside},
+	}
+
+	for i, test := range tests {
+		path, err := snap.path(test.name)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%d expected error %v got %v", i, test.err, err)
+		}
+
+		if path != test.path {
+			t.Errorf("%d expected path %s got %s", i, test.path, path)
+		}
+
+		if err == nil {
+			if live := snap.live(path, filepath.IsAbs(test.name)); live != test.name {
+				t.Errorf("%d expected live %s got %s", i, test.name, live)
+			}
+		}
+	}
+
+	var none *snapshot
+	if path, _ := none.path("data"); path != "data" {
+		t.Errorf("expected nil snapshot to return data got %s", path)
+	}
+}
+
+// Validate that globs are read from the snapshot using the working directory
+// paths for the keys
+func TestSnapshotGlobs(t *testing.T) {
+	root := t.TempDir()
+	mount := t.TempDir()
+
+	for _, dir := range []string{root, mount} {
+		if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		err := os.WriteFile(filepath.Join(dir, "data", "a.csv"), []byte(dir), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	globs := []string{filepath.Join(root, "data") + string(filepath.Separator)}
+	snap := &snapshot{root: root, mount: mount}
+
+	ch, err := processGlobs(context.Background(), globs, nil, nil, snap, "bucket", "z/", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := test_globs_gather(ch)
+	defer test_globs_close(t, x)
+
+	if len(x) != 1 {
+		t.Fatalf("expected 1 object got %d", len(x))
+	}
+
+	if x[0].key != "z/a.csv" {
+		t.Errorf("expected key z/a.csv got %s", x[0].key)
+	}
+
+	buf, err := io.ReadAll(x[0].rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != mount {
+		t.Errorf("expected content from snapshot %s got %s", mount, buf)
+	}
+}
+
+// Validate that the snapshot commands are run with the expected environment
+func TestTakeSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+
+	// the snapshot is of the working directory, which must exist
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	mount := t.TempDir()
+	out := filepath.Join(t.TempDir(), "cleanup")
+
+	snap, err := takeSnapshot(context.Background(),
+		"echo creating >&2; echo; echo "+mount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snap.mount != mount {
+		t.Errorf("expected mount %s got %s", mount, snap.mount)
+	}
+
+	err = snap.cleanup(context.Background(),
+		`echo "$S3UP_SNAPSHOT_MOUNT" > `+out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != mount+"\n" {
+		t.Errorf("expected S3UP_SNAPSHOT_MOUNT %s got %s", mount, buf)
+	}
+
+	if _, err := takeSnapshot(context.Background(), "true"); err == nil {
+		t.Errorf("expected error when no mount is printed")
+	}
+
+	if _, err := takeSnapshot(context.Background(), "echo "+out); err == nil {
+		t.Errorf("expected error when the mount is not a directory")
+	}
+}
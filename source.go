@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 )
 
+// ErrBufferCorrupt is returned when a buffered part no longer matches the
+// checksum calculated when it was buffered.
+var ErrBufferCorrupt = errors.New("buffered part is corrupt")
+
 // copyBufSize sets the size of the buffer used to copy between an underlying
 // io.Reader and a temp file or memory buffer
 var copyBufSize int64 = DefaultCopyBufSize
@@ -21,17 +26,49 @@ type Source interface {
 	Next() (*SourceReader, error)
 }
 
+// SizedSource is implemented by a Source when the total size of the underlying
+// data is known in advance.
+type SizedSource interface {
+	Source
+	Size() int64
+}
+
 // SourceReader extends io.SectionReader with a Close method compatible with
 // io.Closer.
 type SourceReader struct {
 	*io.SectionReader
 	closer func() error
+
+	// tempfile is true if the part is buffered in a temporary file
+	tempfile bool
 }
 
 func (p *SourceReader) Close() error {
 	return p.closer()
 }
 
+// Verify re-reads the part and compares its MD5 checksum against expect,
+// returning an error wrapping ErrBufferCorrupt if they differ.  The read
+// position of the SourceReader is not changed.
+func (p *SourceReader) Verify(expect HashSum) error {
+	h := NewHasher(ChecksumAlgorithmMD5)()
+
+	buf := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(buf)
+
+	r := io.NewSectionReader(p.SectionReader, 0, p.Size())
+	if _, err := io.CopyBuffer(h, r, buf); err != nil {
+		return err
+	}
+
+	if actual := HashSum(h.Sum(nil)); !bytes.Equal(actual, expect) {
+		return fmt.Errorf("%w: MD5 expected %s got %s",
+			ErrBufferCorrupt, expect.Hex(), actual.Hex())
+	}
+
+	return nil
+}
+
 // seekLimit returns the length of an io.Seeker
 func seekLimit(seeker io.Seeker) (int64, error) {
 	pos, err := seeker.Seek(0, io.SeekCurrent)
@@ -143,6 +180,11 @@ type readerAtSource struct {
 	partSize int64
 }
 
+// Size returns the total number of bytes available from the io.ReaderAt.
+func (p *readerAtSource) Size() int64 {
+	return p.limit
+}
+
 func (p *readerAtSource) Next() (*SourceReader, error) {
 	if p.offset >= p.limit {
 		return nil, io.EOF
@@ -222,6 +264,7 @@ func (p *tempfSource) Next() (*SourceReader, error) {
 	sr := &SourceReader{
 		SectionReader: io.NewSectionReader(rc, 0, size),
 		closer:        rc.Close,
+		tempfile:      true,
 	}
 
 	return sr, nil
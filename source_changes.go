@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrSourceModified is recorded for objects whose source file changed while
+// it was being uploaded, in which case the object may not match the file.
+var ErrSourceModified = errors.New("source modified during transfer")
+
+// sourceStat records the size and modification time of a source file.
+type sourceStat struct {
+	size    int64
+	modTime time.Time
+}
+
+// statSource returns the sourceStat for r if it is a file, otherwise it
+// returns nil.
+func statSource(r io.Reader) *sourceStat {
+	fh, ok := r.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return nil
+	}
+
+	fi, err := fh.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	return &sourceStat{
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+	}
+}
+
+// changed stats r again, returning an error wrapping ErrSourceModified if its
+// size or modification time differ from p.  A nil sourceStat never changes.
+func (p *sourceStat) changed(r io.Reader) error {
+	if p == nil {
+		return nil
+	}
+
+	now := statSource(r)
+	if now == nil {
+		return fmt.Errorf("%w: unable to stat source", ErrSourceModified)
+	}
+
+	if now.size != p.size {
+		return fmt.Errorf("%w: size changed from %d to %d",
+			ErrSourceModified, p.size, now.size)
+	}
+
+	if !now.modTime.Equal(p.modTime) {
+		return fmt.Errorf("%w: modification time changed from %s to %s",
+			ErrSourceModified, p.modTime.Format(time.RFC3339Nano),
+			now.modTime.Format(time.RFC3339Nano))
+	}
+
+	return nil
+}
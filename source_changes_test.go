@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Validate that changes to a source file are detected
+func TestSourceChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "source.dat")
+	if err := os.WriteFile(name, []byte("Hello, World!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	before := statSource(fh)
+	if before == nil {
+		t.Fatalf("expected sourceStat for %s", name)
+	}
+
+	if err := before.changed(fh); err != nil {
+		t.Errorf("expected unchanged source got %v", err)
+	}
+
+	// the same size, but a different modification time
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := before.changed(fh); !errors.Is(err, ErrSourceModified) {
+		t.Errorf("expected ErrSourceModified got %v", err)
+	}
+
+	// a different size
+	before = statSource(fh)
+	if err := os.WriteFile(name, []byte("Hello, World! Again"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := before.changed(fh); !errors.Is(err, ErrSourceModified) {
+		t.Errorf("expected ErrSourceModified got %v", err)
+	}
+
+	// streams are not checked
+	if p := statSource(bytes.NewReader(nil)); p != nil {
+		t.Errorf("expected nil sourceStat for a stream got %v", p)
+	}
+
+	var p *sourceStat
+	if err := p.changed(bytes.NewReader(nil)); err != nil {
+		t.Errorf("expected nil sourceStat to be unchanged got %v", err)
+	}
+}
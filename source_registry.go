@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var errUnknownSource = errors.New("unknown source")
+
+var errSourceURI = errors.New(
+	"source is only read by the backend registered for its scheme")
+
+// SourceFactory returns a Source generating SourceReader of Options.PartSize,
+// for use by Uploader.upload.  A backend registered for a URI scheme is given
+// the uri of the source (e.g., s3://bucket/key), and reads it itself, e.g.,
+// fetching each part as a range, otherwise uri is empty and the Source reads
+// the parts from r.
+type SourceFactory func(uri string, r io.Reader, opts *Options) (Source, error)
+
+// sourceFactories lists the registered SourceFactory by name.
+var sourceFactories = map[string]SourceFactory{
+	"tempfile": func(uri string, r io.Reader, opts *Options) (Source, error) {
+		return TempfileSource(r, opts.PartSize, opts.UseTempDir)
+	},
+	"memory": func(uri string, r io.Reader, opts *Options) (Source, error) {
+		return MemorySource(r, opts.PartSize, opts.partBuf)
+	},
+}
+
+var sourceFactoriesMu = &sync.RWMutex{}
+
+// RegisterSource makes a Source backend available by name, so that it may be
+// selected using -source (or ObjectOptions.Source) without modifying the
+// Uploader.  If the name is a URI scheme (e.g., "s3" or "https") then source
+// arguments with that scheme are not globbed (or fetched), the backend is
+// given their URI to read instead.  Names are case-insensitive, and
+// RegisterSource panics if the name is already registered.
+func RegisterSource(name string, factory SourceFactory) {
+	sourceFactoriesMu.Lock()
+	defer sourceFactoriesMu.Unlock()
+
+	name = strings.ToLower(name)
+
+	if factory == nil {
+		panic("RegisterSource: factory is nil")
+	}
+
+	if _, ok := sourceFactories[name]; ok {
+		panic("RegisterSource: called twice for " + name)
+	}
+
+	sourceFactories[name] = factory
+}
+
+// lookupSource returns the SourceFactory registered by name.
+func lookupSource(name string) (SourceFactory, error) {
+	sourceFactoriesMu.RLock()
+	defer sourceFactoriesMu.RUnlock()
+
+	factory, ok := sourceFactories[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (registered: %s)",
+			errUnknownSource, name, strings.Join(sourceNames(), ", "))
+	}
+
+	return factory, nil
+}
+
+// sourceNames returns the sorted names of the registered sources, the caller
+// must hold sourceFactoriesMu.
+func sourceNames() []string {
+	names := make([]string, 0, len(sourceFactories))
+	for name := range sourceFactories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// newSource returns the Source for r using the backend selected by name, or
+// if name is empty then the memory or tempfile backend per
+// Options.UseMemoryBuffers.  If r stands in for a source named by a URI (see
+// openURI) then the backend is given the URI.
+func newSource(name string, r io.Reader, opts *Options) (Source, error) {
+	if name == "" {
+		name = "tempfile"
+		if opts.UseMemoryBuffers {
+			name = "memory"
+		}
+	}
+
+	factory, err := lookupSource(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var uri string
+	if src, ok := r.(*sourceURI); ok {
+		uri = src.uri
+	}
+
+	return factory(uri, r, opts)
+}
+
+// schemeSource returns the name of the Source backend registered for the
+// scheme of s, if s is a URI (i.e., scheme://...) and one is registered,
+// otherwise "".
+func schemeSource(s string) string {
+	scheme, _, found := strings.Cut(s, "://")
+	if !found || scheme == "" {
+		return ""
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || !strings.EqualFold(u.Scheme, scheme) {
+		return ""
+	}
+
+	if _, err := lookupSource(u.Scheme); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Scheme)
+}
+
+// withSchemeSource returns ObjectOptions selecting the Source backend
+// registered for the scheme of rawURL, if there is one, which takes
+// precedence over any other backend selected as only it can read the source.
+func (p *ObjectOptions) withSchemeSource(rawURL string) *ObjectOptions {
+	name := schemeSource(rawURL)
+	if name == "" {
+		return p
+	}
+
+	objOpt := &ObjectOptions{}
+	if p != nil {
+		*objOpt = *p
+	}
+	objOpt.Source = name
+
+	return objOpt
+}
+
+// sourceURI stands in for the reader of a source named by a URI whose scheme
+// has a registered Source backend, which is given the URI (see newSource).
+// It cannot be read otherwise, e.g., by -compress.
+type sourceURI struct {
+	uri string
+}
+
+func (p *sourceURI) Read(b []byte) (int, error) {
+	return 0, fmt.Errorf("%w: %s", errSourceURI, p.uri)
+}
+
+func (p *sourceURI) Close() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testSchemeSources counts the objects read using the "testscheme" source
+var testSchemeSources atomic.Int64
+
+func init() {
+	// the source is read from its URI, not from r
+	RegisterSource("TestScheme", func(uri string, r io.Reader, opts *Options) (Source, error) {
+		testSchemeSources.Add(1)
+		return MemorySource(strings.NewReader(uri), opts.PartSize, opts.partBuf)
+	})
+}
+
+func TestSourceRegistry(t *testing.T) {
+	for i, tst := range []struct {
+		objOpt *ObjectOptions
+		url    string
+		source string
+	}{
+		{nil, "testscheme://host/path", "testscheme"},
+		{nil, "https://host/path", ""},
+		{nil, "testscheme:path", ""},
+		{&ObjectOptions{Source: "memory"}, "testscheme://host/path", "testscheme"},
+		{&ObjectOptions{Source: "memory"}, "https://host/path", "memory"},
+		{&ObjectOptions{ContentType: "text/plain"}, "TestScheme://host/path", "testscheme"},
+	} {
+		objOpt := tst.objOpt.withSchemeSource(tst.url)
+
+		var source string
+		if objOpt != nil {
+			source = objOpt.Source
+		}
+
+		if source != tst.source {
+			t.Errorf("%d expected %q got %q", i, tst.source, source)
+		}
+	}
+
+	if _, err := lookupSource("missing"); !errors.Is(err, errUnknownSource) {
+		t.Errorf("expected errUnknownSource got %v", err)
+	}
+
+	objOpt := &ObjectOptions{}
+	if err := objOpt.set("source=missing"); !errors.Is(err, errUnknownSource) {
+		t.Errorf("expected errUnknownSource got %v", err)
+	}
+	if err := objOpt.set("source=TESTSCHEME"); err != nil || objOpt.Source != "testscheme" {
+		t.Errorf("expected testscheme got %q, %v", objOpt.Source, err)
+	}
+
+	// URIs with the scheme are not globbed, the backend is given the URI
+	ch, err := processGlobs(context.Background(), []string{"testscheme://host/a.dat"},
+		nil, nil, nil, "bucket", "z/", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	x := test_globs_gather(ch)
+	if len(x) != 1 || x[0].key != "z/a.dat" || x[0].objOpt == nil || x[0].objOpt.Source != "testscheme" {
+		t.Fatalf("expected z/a.dat using testscheme, got %+v", x)
+	}
+
+	// the selected source is used by the Uploader
+	opts := &Options{
+		PartSize:          64,
+		ConcurrentObjects: 1,
+		ChecksumAlgorithm: ChecksumAlgorithmSHA256,
+		ChecksumOnly:      true,
+		partBuf:           NewBufferPool(64),
+	}
+
+	uploader := NewUploader(context.Background(), opts)
+
+	before := testSchemeSources.Load()
+
+	res := <-uploader.Upload(context.Background(), x[0].rc, "bucket", "key", x[0].objOpt)
+	if res.Error != nil {
+		t.Fatalf("unexpected error: %s", res.Error)
+	}
+
+	if n := testSchemeSources.Load() - before; n != 1 {
+		t.Errorf("expected testscheme source to be used once, got %d", n)
+	}
+
+	if size := res.State.hr.Size(); size != int64(len("testscheme://host/a.dat")) {
+		t.Errorf("expected the source to be read from its URI, got %d bytes", size)
+	}
+}
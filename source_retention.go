@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var errSourceRetentionSnapshot = errors.New(
+	"-delete-source, -archive-source-to, and -truncate-source cannot be combined with -snapshot-cmd")
+
+var errSourceRetentionOptions = errors.New(
+	"only one of -delete-source, -archive-source-to, or -truncate-source may be specified")
+
+// errSourceUnverified is returned by retainSource if the checksum of the
+// object reported by GetObjectAttributes does not match the source.
+var errSourceUnverified = errors.New("object checksum not verified")
+
+// verifySource returns the name of the local file an object was uploaded
+// from, once the object is completed and the checksum S3 reports for it (via
+// GetObjectAttributes) matches the checksum calculated while reading the
+// file.  An empty name is returned for streams and URLs, and an error for
+// sources that changed while they were read or could not be verified.
+func verifySource(st *S3UploadState, obj *ObjectReporting) (string, error) {
+	if !obj.Completed || st.source == "" || st.source == "-" || isURI(st.source) {
+		return "", nil
+	}
+
+	if st.sourceError != nil {
+		return "", fmt.Errorf("source not retained: %w", st.sourceError)
+	}
+
+	multipart := st.create != nil && st.createOutput != nil
+
+	v := NewAttributesChecksumVerification(st.hr, st.objectAttributesOutput, multipart)
+	if v.Checksum != VerificationMatch {
+		return "", fmt.Errorf("%w (%s): %s", errSourceUnverified, v.Checksum, st.source)
+	}
+
+	fi, err := os.Lstat(longPath(st.source))
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("not a regular file: %s", st.source)
+	}
+
+	// the size of a sparse file uploaded by -sparse holes is that of
+	// the file, holes included, and the size of a source compressed by
+	// -compress is that read before it was compressed
+	size := st.hr.Size()
+	switch {
+	case st.sparseSize > 0:
+		size = st.sparseSize
+	case st.compression != nil && st.compression.Encoding != "":
+		size = st.compression.sourceSize
+	}
+
+	if fi.Size() != size {
+		return "", fmt.Errorf("source size changed: %s", st.source)
+	}
+
+	return st.source, nil
+}
+
+// retainSource applies the -delete-source, -archive-source-to, or
+// -truncate-source policy to the local file an object was uploaded from, once
+// it has been verified (see verifySource), recording the outcome in obj.
+func retainSource(st *S3UploadState, obj *ObjectReporting, opts *Options) error {
+	name, err := verifySource(st, obj)
+	if err != nil || name == "" {
+		return err
+	}
+
+	switch {
+	case opts.DeleteSource:
+		if err := os.Remove(longPath(name)); err != nil {
+			return err
+		}
+		obj.SourceDeleted = true
+	case opts.ArchiveSourceTo != "":
+		archived, err := archiveSource(name, opts.ArchiveSourceTo)
+		if err != nil {
+			return err
+		}
+		obj.SourceArchived = archived
+	case opts.TruncateSource:
+		if err := os.Truncate(longPath(name), 0); err != nil {
+			return err
+		}
+		obj.SourceTruncated = true
+	}
+
+	return nil
+}
+
+// archivePath returns the path a source is moved to under dir, keeping the
+// path of a relative source within dir, otherwise its absolute path.
+func archivePath(name, dir string) (string, error) {
+	clean := filepath.Clean(name)
+
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		abs, err := filepath.Abs(clean)
+		if err != nil {
+			return "", err
+		}
+		clean = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	}
+
+	return filepath.Join(dir, clean), nil
+}
+
+// archiveSource moves the file name under dir (see archivePath), copying it
+// if dir is on a different file system, and returns the path it was moved
+// to.  An existing file is never replaced.
+func archiveSource(name, dir string) (string, error) {
+	dst, err := archivePath(name, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Lstat(longPath(dst)); err == nil {
+		return "", fmt.Errorf("archived source already exists: %s", dst)
+	}
+
+	if err := os.MkdirAll(longPath(filepath.Dir(dst)), 0o755); err != nil {
+		return "", err
+	}
+
+	err = os.Rename(longPath(name), longPath(dst))
+	if errors.Is(err, syscall.EXDEV) {
+		err = copyArchivedSource(name, dst)
+		if err == nil {
+			err = os.Remove(longPath(name))
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// copyArchivedSource copies the file name to dst, which must not exist, preserving
+// its permissions.
+func copyArchivedSource(name, dst string) error {
+	src, err := os.Open(longPath(name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(longPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(fh, src); err != nil {
+		fh.Close()
+		os.Remove(longPath(dst))
+		return err
+	}
+
+	if err := fh.Close(); err != nil {
+		os.Remove(longPath(dst))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Validate that a source is deleted, archived, or truncated only once the
+// checksum reported by GetObjectAttributes matches it
+func TestRetainSource(t *testing.T) {
+	const partSize = 64
+
+	data := bytes.Repeat([]byte("x"), partSize/2)
+	sum := sha256.Sum256(data)
+
+	match := base64.StdEncoding.EncodeToString(sum[:])
+	mismatch := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	for i, tst := range []struct {
+		checksum string
+		source   string
+		policy   string
+		expect   string
+		err      error
+	}{
+		{match, "file", "delete", "deleted", nil},
+		{match, "file", "archive", "archived", nil},
+		{match, "file", "truncate", "truncated", nil},
+		{mismatch, "file", "delete", "kept", errSourceUnverified},
+		{"", "file", "archive", "kept", errSourceUnverified},
+		{match, "-", "delete", "kept", nil},
+		{match, "compressed", "delete", "deleted", nil},
+		{match, "compressed", "truncate", "truncated", nil},
+		{match, "sparse", "delete", "deleted", nil},
+		{match, "sparse", "archive", "archived", nil},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"etag"`)
+
+			if r.Method == http.MethodGet && r.URL.Query().Has("attributes") {
+				fmt.Fprint(w, `<GetObjectAttributesResponse>`)
+				if tst.checksum != "" {
+					fmt.Fprintf(w, `<Checksum><ChecksumSHA256>%s</ChecksumSHA256></Checksum>`, tst.checksum)
+				}
+				fmt.Fprint(w, `</GetObjectAttributesResponse>`)
+			}
+		}))
+
+		uploader := NewUploader(context.Background(), testUploaderOptions(srv.URL, partSize))
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		srv.Close()
+
+		if res.Error != nil {
+			t.Fatalf("%d unexpected error: %s", i, res.Error)
+		}
+
+		dir := t.TempDir()
+		name := filepath.Join(dir, "file")
+		source := data
+		if tst.source == "compressed" {
+			// the uploaded data was compressed from a larger source
+			source = bytes.Repeat(data, 4)
+			res.State.compression = &Compression{Encoding: "gzip", sourceSize: int64(len(source))}
+		}
+		if err := os.WriteFile(name, source, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if tst.source == "sparse" {
+			// the uploaded data was that of a sparse file with a hole
+			// at its end
+			res.State.sparseSize = 4 * int64(len(data))
+			if err := os.Truncate(name, res.State.sparseSize); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		opts := &Options{
+			DeleteSource:   tst.policy == "delete",
+			TruncateSource: tst.policy == "truncate",
+		}
+		if tst.policy == "archive" {
+			opts.ArchiveSourceTo = filepath.Join(dir, "archive")
+		}
+
+		res.State.source = tst.source
+		if tst.source != "-" {
+			res.State.source = name
+		}
+
+		obj, err := NewObjectReporting(res.State)
+		if err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+
+		if err := retainSource(res.State, obj, opts); !errors.Is(err, tst.err) {
+			t.Errorf("%d expected error %v, got %v", i, tst.err, err)
+		}
+
+		actual := "kept"
+		if fi, err := os.Stat(name); os.IsNotExist(err) {
+			actual = "deleted"
+			if obj.SourceArchived != "" {
+				actual = "archived"
+				if _, err := os.Stat(obj.SourceArchived); err != nil {
+					t.Errorf("%d expected archived source, got %v", i, err)
+				}
+			}
+		} else if err == nil && fi.Size() == 0 && obj.SourceTruncated {
+			actual = "truncated"
+		}
+
+		if actual != tst.expect || obj.SourceDeleted != (actual == "deleted") {
+			t.Errorf("%d expected source %s, got %s", i, tst.expect, actual)
+		}
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	abs := filepath.Join(string(filepath.Separator), "data", "up.dat")
+
+	for i, tst := range []struct {
+		name   string
+		expect string
+	}{
+		{filepath.Join("a", "b.dat"), filepath.Join("archive", "a", "b.dat")},
+		{filepath.Join("a", "..", "b.dat"), filepath.Join("archive", "b.dat")},
+		{abs, filepath.Join("archive", "data", "up.dat")},
+	} {
+		actual, err := archivePath(tst.name, "archive")
+		if err != nil || actual != tst.expect {
+			t.Errorf("%d expected %s, got %s %v", i, tst.expect, actual, err)
+		}
+	}
+}
@@ -192,6 +192,46 @@ func TestSourceBasics(t *testing.T) {
 
 // Benchmark iterating through an io.ReaderAt of st_benchmark_size in 4 parts
 // using Source
+// TestSourceReaderVerify validates that corruption of a temp file buffer after
+// it was hashed is detected by SourceReader.Verify
+func TestSourceReaderVerify(t *testing.T) {
+	data := []byte("Hello, World!")
+
+	// hide io.ReaderAt so that the data is buffered in a temp file
+	src, err := TempfileSource(io.MultiReader(bytes.NewReader(data)), int64(len(data)), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+
+	if !sr.tempfile {
+		t.Errorf("expected tempfile SourceReader")
+	}
+
+	h := NewHasher(ChecksumAlgorithmMD5)()
+	h.Write(data)
+	expect := HashSum(h.Sum(nil))
+
+	if err := sr.Verify(expect); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+
+	// corrupt the buffer behind the SourceReader
+	tb, _, _ := sr.SectionReader.Outer()
+	if _, err := tb.(*tempfBuffer).fh.WriteAt([]byte("J"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sr.Verify(expect); !errors.Is(err, ErrBufferCorrupt) {
+		t.Errorf("expected ErrBufferCorrupt got %v", err)
+	}
+}
+
 func BenchmarkSourceReaderAt(b *testing.B) {
 	b.StopTimer()
 
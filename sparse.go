@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errSparseSkipped = errors.New(
+	"sparse file (-sparse skip)")
+
+// sparseMode represents how sparse files, whose size is much larger than the
+// space allocated to them on disk, are uploaded.
+type sparseMode int
+
+const (
+	// Upload sparse files as they are read, holes included
+	SparseModeUpload sparseMode = iota
+
+	// Skip sparse files
+	SparseModeSkip
+
+	// Upload only the data of sparse files, recording the holes in the
+	// object metadata
+	SparseModeHoles
+)
+
+// SparseMode represents a sparseMode, with helper functions to parse and
+// produce human readable representations of the identifier for use via the
+// flag module.
+type SparseMode sparseMode
+
+func (p SparseMode) String() string {
+	switch sparseMode(p) {
+	case SparseModeSkip:
+		return "skip"
+	case SparseModeHoles:
+		return "holes"
+	default:
+		return "upload"
+	}
+}
+
+func (p *SparseMode) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "upload":
+		*p = SparseMode(SparseModeUpload)
+	case "skip":
+		*p = SparseMode(SparseModeSkip)
+	case "holes":
+		*p = SparseMode(SparseModeHoles)
+	default:
+		return fmt.Errorf("valid sparse modes: upload, skip, holes")
+	}
+
+	return nil
+}
+
+// sparseHolesMetadata and sparseSizeMetadata are the user-defined metadata
+// keys (x-amz-meta-s3up-holes and x-amz-meta-s3up-size) recording the holes
+// and size of a sparse file uploaded with -sparse holes.
+const (
+	sparseHolesMetadata = "s3up-holes"
+	sparseSizeMetadata  = "s3up-size"
+)
+
+// maxSparseHolesLength is the maximum length of the hole map, leaving room
+// within the 2KB of user-defined metadata S3 allows for the other keys.
+const maxSparseHolesLength = 1536
+
+// fileExtent is a range of bytes within a file.
+type fileExtent struct {
+	Offset int64
+	Length int64
+}
+
+// isSparse returns true if less than half of the size of a regular file is
+// allocated on disk.  Empty files are never sparse, nor are any files on
+// platforms where the allocated size is not known.
+func isSparse(fi os.FileInfo) bool {
+	allocated, ok := allocatedSize(fi)
+	return ok && fi.Mode().IsRegular() && fi.Size() > 0 && allocated < fi.Size()/2
+}
+
+// formatHoles encodes holes as a comma separated list of offset+length, e.g.,
+// "0+4096,1048576+8192".
+func formatHoles(holes []fileExtent) string {
+	var sb strings.Builder
+
+	for i, h := range holes {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatInt(h.Offset, 10))
+		sb.WriteByte('+')
+		sb.WriteString(strconv.FormatInt(h.Length, 10))
+	}
+
+	return sb.String()
+}
+
+// dataExtents returns the ranges of a file of size bytes not within holes,
+// which must be sorted and not overlap.
+func dataExtents(holes []fileExtent, size int64) []fileExtent {
+	var data []fileExtent
+
+	var offset int64
+	for _, h := range holes {
+		if h.Offset > offset {
+			data = append(data, fileExtent{offset, h.Offset - offset})
+		}
+		offset = h.Offset + h.Length
+	}
+
+	if offset < size {
+		data = append(data, fileExtent{offset, size - offset})
+	}
+
+	return data
+}
+
+// sparseReadCloser reads only the data extents of a file, concatenated,
+// closing the file once done.  The file may still be stat'ed and locked (see
+// statSource and lockSource).
+type sparseReadCloser struct {
+	fh      *os.File
+	extents []fileExtent
+
+	// starts holds the offset of each extent within the data read, and
+	// size the total length of the extents
+	starts []int64
+	size   int64
+
+	offset int64
+}
+
+// newSparseReadCloser returns a sparseReadCloser reading the extents of fh.
+func newSparseReadCloser(fh *os.File, extents []fileExtent) *sparseReadCloser {
+	p := &sparseReadCloser{
+		fh:      fh,
+		extents: extents,
+		starts:  make([]int64, len(extents)),
+	}
+
+	for i, e := range extents {
+		p.starts[i] = p.size
+		p.size += e.Length
+	}
+
+	return p
+}
+
+func (p *sparseReadCloser) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if off >= p.size {
+		return 0, io.EOF
+	}
+
+	// the last extent starting at or before off
+	i := sort.Search(len(p.starts), func(i int) bool {
+		return p.starts[i] > off
+	}) - 1
+
+	n := 0
+	for ; i >= 0 && i < len(p.extents) && n < len(b); i++ {
+		e := p.extents[i]
+
+		within := off + int64(n) - p.starts[i]
+		want := min(int64(len(b)-n), e.Length-within)
+
+		m, err := p.fh.ReadAt(b[n:n+int(want)], e.Offset+within)
+		n += m
+		if err != nil && !(errors.Is(err, io.EOF) && int64(m) == want) {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (p *sparseReadCloser) Read(b []byte) (int, error) {
+	if p.offset >= p.size {
+		return 0, io.EOF
+	}
+
+	n, err := p.ReadAt(b, p.offset)
+	p.offset += int64(n)
+
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (p *sparseReadCloser) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.offset
+	case io.SeekEnd:
+		offset += p.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	p.offset = offset
+
+	return offset, nil
+}
+
+func (p *sparseReadCloser) Stat() (os.FileInfo, error) {
+	return p.fh.Stat()
+}
+
+func (p *sparseReadCloser) Fd() uintptr {
+	return p.fh.Fd()
+}
+
+func (p *sparseReadCloser) Close() error {
+	return p.fh.Close()
+}
+
+// applySparse applies -sparse to obj if it is read from a sparse file,
+// returning errSparseSkipped if it should not be uploaded.  With
+// SparseModeHoles the source is replaced by one reading only the data of the
+// file, and the holes are recorded in the object metadata.  Files whose hole
+// map would not fit in the metadata are uploaded as they are.
+func applySparse(obj *uploadObject, mode sparseMode, verbose bool) error {
+	fh, ok := obj.rc.(*os.File)
+	if !ok || mode == SparseModeUpload {
+		return nil
+	}
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !isSparse(fi) {
+		return nil
+	}
+
+	if mode == SparseModeSkip {
+		return errSparseSkipped
+	}
+
+	holes, err := fileHoles(fh, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	if len(holes) == 0 {
+		return nil
+	}
+
+	encoded := formatHoles(holes)
+	if len(encoded) > maxSparseHolesLength {
+		log.Printf("warning for object %s/%s: %d holes do not fit in metadata, uploading holes",
+			obj.bucket, obj.key, len(holes))
+		return nil
+	}
+
+	data := dataExtents(holes, fi.Size())
+
+	if verbose {
+		log.Printf("uploading %d data extents of sparse file %s", len(data), obj.source)
+	}
+
+	obj.rc = newSparseReadCloser(fh, data)
+	obj.sparseSize = fi.Size()
+	obj.objOpt = obj.objOpt.withMetadata(map[string]string{
+		sparseHolesMetadata: encoded,
+		sparseSizeMetadata:  strconv.FormatInt(fi.Size(), 10),
+	})
+
+	return nil
+}
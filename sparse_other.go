@@ -0,0 +1,18 @@
+//go:build !(freebsd || linux)
+
+package main
+
+import (
+	"os"
+)
+
+// allocatedSize returns false, the space allocated on disk is not known on
+// this platform.
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+// fileHoles returns no holes, they cannot be found on this platform.
+func fileHoles(fh *os.File, size int64) ([]fileExtent, error) {
+	return nil, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Validate the data extents of a file are the complement of its holes
+func TestDataExtents(t *testing.T) {
+	for i, tst := range []struct {
+		holes  []fileExtent
+		size   int64
+		expect string
+	}{
+		{nil, 10, "0+10"},
+		{[]fileExtent{{0, 4}}, 10, "4+6"},
+		{[]fileExtent{{4, 6}}, 10, "0+4"},
+		{[]fileExtent{{2, 2}, {6, 2}}, 10, "0+2,4+2,8+2"},
+		{[]fileExtent{{0, 10}}, 10, ""},
+	} {
+		actual := formatHoles(dataExtents(tst.holes, tst.size))
+		if actual != tst.expect {
+			t.Errorf("%d expected %s, got %s", i, tst.expect, actual)
+		}
+	}
+}
+
+// Validate a sparseReadCloser reads the data extents of a file in order
+func TestSparseReadCloser(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := newSparseReadCloser(fh, []fileExtent{{1, 2}, {5, 3}})
+	defer rc.Close()
+
+	for i := 0; i < 2; i++ {
+		buf, err := io.ReadAll(rc)
+		if err != nil || string(buf) != "12567" {
+			t.Errorf("%d expected 12567, got %s %v", i, buf, err)
+		}
+
+		if _, err := rc.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 3)
+	n, err := rc.ReadAt(buf, 1)
+	if n != 3 || err != nil || string(buf) != "256" {
+		t.Errorf("expected 256, got %s %v", buf[:n], err)
+	}
+
+	n, err = rc.ReadAt(buf, 3)
+	if n != 2 || !errors.Is(err, io.EOF) || string(buf[:n]) != "67" {
+		t.Errorf("expected 67 EOF, got %s %v", buf[:n], err)
+	}
+}
+
+// Validate -sparse skips sparse files or uploads only their data, recording
+// holes that restore the file
+func TestApplySparse(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sparse.img")
+
+	const size = 64 * 1024 * 1024
+	if err := os.WriteFile(name, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(name, size); err != nil {
+		t.Fatal(err)
+	}
+
+	fh, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int64{0, size / 2} {
+		if _, err := fh.WriteAt([]byte("data"), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fh.Close()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSparse(fi) {
+		t.Skip("sparse files are not supported")
+	}
+
+	open := func() *uploadObject {
+		fh, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &uploadObject{bucket: "bucket", key: "sparse.img", rc: fh, source: name}
+	}
+
+	obj := open()
+	if err := applySparse(obj, SparseModeSkip, false); !errors.Is(err, errSparseSkipped) {
+		t.Errorf("expected errSparseSkipped, got %v", err)
+	}
+	obj.rc.Close()
+
+	obj = open()
+	if err := applySparse(obj, SparseModeUpload, false); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, ok := obj.rc.(*os.File); !ok {
+		t.Errorf("expected the file to be uploaded as is")
+	}
+	obj.rc.Close()
+
+	obj = open()
+	if err := applySparse(obj, SparseModeHoles, false); err != nil {
+		t.Fatal(err)
+	}
+	defer obj.rc.Close()
+
+	data, err := io.ReadAll(obj.rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= size/2 {
+		t.Errorf("expected less than %d bytes, got %d", size/2, len(data))
+	}
+
+	if obj.sparseSize != size {
+		t.Errorf("expected sparse size %d, got %d", size, obj.sparseSize)
+	}
+
+	md := obj.objOpt.metadata("")
+	if md[sparseSizeMetadata] != strconv.Itoa(size) {
+		t.Errorf("expected size %d, got %s", size, md[sparseSizeMetadata])
+	}
+
+	// restore the file from the holes and the data uploaded
+	restored := make([]byte, size)
+	var holes []fileExtent
+	for _, h := range strings.Split(md[sparseHolesMetadata], ",") {
+		off, length, _ := strings.Cut(h, "+")
+		o, _ := strconv.ParseInt(off, 10, 64)
+		l, _ := strconv.ParseInt(length, 10, 64)
+		holes = append(holes, fileExtent{o, l})
+	}
+	for _, e := range dataExtents(holes, size) {
+		copy(restored[e.Offset:], data[:e.Length])
+		data = data[e.Length:]
+	}
+
+	expect, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, expect) || len(data) != 0 {
+		t.Errorf("expected the restored file to match")
+	}
+}
@@ -0,0 +1,60 @@
+//go:build freebsd || linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// whence values for lseek(2) finding the data and holes of a file.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// allocatedSize returns the space allocated on disk for fi.
+func allocatedSize(fi os.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Blocks) * 512, true
+}
+
+// fileHoles returns the holes within the first size bytes of fh, found using
+// lseek(2) SEEK_HOLE and SEEK_DATA.  The offset of fh is restored afterwards.
+func fileHoles(fh *os.File, size int64) ([]fileExtent, error) {
+	var holes []fileExtent
+
+	var offset int64
+	for offset < size {
+		hole, err := fh.Seek(offset, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole >= size {
+			break
+		}
+
+		data, err := fh.Seek(hole, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// a hole extending to the end of the file
+			data = size
+		} else if err != nil {
+			return nil, err
+		}
+
+		data = min(data, size)
+		holes = append(holes, fileExtent{hole, data - hole})
+		offset = data
+	}
+
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return holes, nil
+}
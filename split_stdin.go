@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var errSplitSources = errors.New(
+	"-split-size splits standard input, it cannot be combined with globs or -jobs")
+
+var errSplitCheckKeys = errors.New(
+	"-check-keys cannot be combined with -split-size, as standard input cannot be read twice")
+
+var errSplitKeyTemplate = errors.New(
+	"-split-size requires a -key template using {{.Seq}} or {{.Offset}}")
+
+// DefaultSplitPad is the default number of digits the {{.Seq}} and {{.Offset}}
+// of a -key template are zero-padded to.
+const DefaultSplitPad int = 6
+
+// SplitRange records the range of standard input uploaded as an object when
+// it is split with -split-size, so that the stream may be reassembled from the
+// objects in order of Seq.
+type SplitRange struct {
+	Seq    int64
+	Offset int64
+	Size   int64
+}
+
+// SplitObject lists an object split from standard input in the RunEnd of a
+// json manifest.
+type SplitObject struct {
+	Bucket string
+	Key    string
+	SplitRange
+}
+
+// splitKeyData is the data a -key template is executed with, the values are
+// zero-padded to -split-pad digits.
+type splitKeyData struct {
+	Seq    string
+	Offset string
+}
+
+// splitKeyTemplate generates the keys of the objects split from standard
+// input from a -key template.
+type splitKeyTemplate struct {
+	tmpl *template.Template
+	pad  int
+}
+
+// newSplitKeyTemplate parses the -key template s, returning
+// errSplitKeyTemplate if it does not generate a distinct key for each object.
+func newSplitKeyTemplate(s string, pad int) (*splitKeyTemplate, error) {
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSplitKeyTemplate, err)
+	}
+
+	p := &splitKeyTemplate{
+		tmpl: tmpl,
+		pad:  pad,
+	}
+
+	first, err := p.key(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSplitKeyTemplate, err)
+	}
+
+	second, err := p.key(1, 1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSplitKeyTemplate, err)
+	}
+
+	if first == second || strings.HasSuffix(first, "/") {
+		return nil, errSplitKeyTemplate
+	}
+
+	return p, nil
+}
+
+// key returns the key of the object numbered seq, starting at offset bytes
+// into standard input.
+func (p *splitKeyTemplate) key(seq, offset int64) (string, error) {
+	var b strings.Builder
+
+	err := p.tmpl.Execute(&b, &splitKeyData{
+		Seq:    fmt.Sprintf("%0*d", p.pad, seq),
+		Offset: fmt.Sprintf("%0*d", p.pad, offset),
+	})
+
+	return b.String(), err
+}
+
+// splitReader reads the range of standard input uploaded as a single object,
+// recording its size in the SplitRange.  Once the range has been read, or the
+// reader is closed, done is closed so that the next range may be read.
+type splitReader struct {
+	r     io.Reader
+	split *SplitRange
+	done  chan struct{}
+	once  *sync.Once
+}
+
+func (p *splitReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.split.Size += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		p.once.Do(func() { close(p.done) })
+	}
+
+	return n, err
+}
+
+// Close discards any of the range not yet read (e.g., if the object was
+// skipped), so that the next range starts at the right offset.
+func (p *splitReader) Close() error {
+	p.once.Do(func() {
+		n, _ := io.Copy(io.Discard, p.r)
+		p.split.Size += n
+		close(p.done)
+	})
+
+	return nil
+}
+
+// processSplitStdin splits standard input into objects of up to
+// Options.SplitSize bytes (see splitStream).
+func processSplitStdin(ctx context.Context, opts *Options) (chan *uploadObject, error) {
+	if opts.Verbose {
+		log.Printf("reading from standard input, split every %s", opts.SplitSize)
+	}
+
+	return splitStream(ctx, os.Stdin, opts), nil
+}
+
+// splitStream splits stream into objects of up to Options.SplitSize bytes,
+// returning each via the returned channel in turn.  The keys are generated
+// from the -key template.  Each object is returned once the one before it has
+// been read, as they share the stream.
+func splitStream(ctx context.Context, stream io.Reader, opts *Options) chan *uploadObject {
+	ch := make(chan *uploadObject)
+
+	go func(ch chan *uploadObject) {
+		defer close(ch)
+
+		r := bufio.NewReader(stream)
+
+		var offset int64
+		for seq := int64(0); ; seq++ {
+			// every object after the first needs at least one
+			// byte, an empty stream is uploaded as one object
+			if seq > 0 {
+				if _, err := r.Peek(1); err != nil {
+					if !errors.Is(err, io.EOF) {
+						log.Printf("error reading standard input: %s", err)
+					}
+					return
+				}
+			}
+
+			key, err := opts.splitKey.key(seq, offset)
+			if err != nil {
+				log.Printf("error generating key: %s", err)
+				return
+			}
+
+			sr := &splitReader{
+				r:     io.LimitReader(r, int64(opts.SplitSize)),
+				split: &SplitRange{Seq: seq, Offset: offset},
+				done:  make(chan struct{}),
+				once:  &sync.Once{},
+			}
+
+			select {
+			case ch <- &uploadObject{
+				bucket: opts.bucket,
+				key:    key,
+				rc:     sr,
+				source: "-",
+				split:  sr.split,
+			}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-sr.done:
+			case <-ctx.Done():
+				return
+			}
+
+			offset += sr.split.Size
+		}
+	}(ch)
+
+	return ch
+}
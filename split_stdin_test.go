@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSplitKeyTemplate(t *testing.T) {
+	for i, tst := range []struct {
+		template string
+		pad      int
+		expect   string
+		err      error
+	}{
+		{"db/dump.{{.Seq}}", 6, "db/dump.000012", nil},
+		{"db/dump.{{.Seq}}", 0, "db/dump.12", nil},
+		{"db/{{.Offset}}-{{.Seq}}.part", 3, "db/1024-012.part", nil},
+		{"db/dump", 6, "", errSplitKeyTemplate},
+		{"db/{{.Seq}}/", 6, "", errSplitKeyTemplate},
+		{"db/{{.Seq", 6, "", errSplitKeyTemplate},
+		{"db/{{.Name}}", 6, "", errSplitKeyTemplate},
+	} {
+		tmpl, err := newSplitKeyTemplate(tst.template, tst.pad)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if key, err := tmpl.key(12, 1024); err != nil || key != tst.expect {
+			t.Errorf("%d expected %s, got %s (%v)", i, tst.expect, key, err)
+		}
+	}
+}
+
+func TestSplitStream(t *testing.T) {
+	tmpl, err := newSplitKeyTemplate("x.{{.Seq}}", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{
+		SplitSize: 4,
+		splitKey:  tmpl,
+		bucket:    "b",
+	}
+
+	ch := splitStream(context.Background(), strings.NewReader("0123456789"), opts)
+
+	expect := []struct {
+		key  string
+		data string
+		skip bool
+		seq  int64
+		off  int64
+	}{
+		{"x.00", "0123", false, 0, 0},
+		{"x.01", "", true, 1, 4},
+		{"x.02", "89", false, 2, 8},
+	}
+
+	i := 0
+	for obj := range ch {
+		if i >= len(expect) {
+			t.Fatalf("expected %d objects", len(expect))
+		}
+
+		e := expect[i]
+
+		var data []byte
+		if !e.skip {
+			data, _ = io.ReadAll(obj.rc)
+		}
+		obj.rc.Close()
+
+		if obj.key != e.key || string(data) != e.data || obj.bucket != "b" {
+			t.Errorf("%d expected %s %q, got %s %q", i, e.key, e.data, obj.key, data)
+		}
+
+		if obj.split.Seq != e.seq || obj.split.Offset != e.off {
+			t.Errorf("%d expected seq %d offset %d, got %+v", i, e.seq, e.off, obj.split)
+		}
+
+		i += 1
+	}
+
+	if i != len(expect) {
+		t.Errorf("expected %d objects, got %d", len(expect), i)
+	}
+
+	// an empty stream is uploaded as a single empty object
+	ch = splitStream(context.Background(), strings.NewReader(""), opts)
+
+	n := 0
+	for obj := range ch {
+		obj.rc.Close()
+		n += 1
+	}
+
+	if n != 1 {
+		t.Errorf("expected 1 object for an empty stream, got %d", n)
+	}
+}
+
+func TestSplitManifest(t *testing.T) {
+	buf := &bytes.Buffer{}
+	manifest := Manifest(JsonManifest, buf)
+	manifest.SetRunMetadata(&RunMetadata{RunID: "run-1"})
+
+	// completed out of order, and one that failed
+	for _, obj := range []*ObjectReporting{
+		{Bucket: "b", Key: "x.01", Completed: true, Split: &SplitRange{Seq: 1, Offset: 4, Size: 4}},
+		{Bucket: "b", Key: "x.00", Completed: true, Split: &SplitRange{Seq: 0, Offset: 0, Size: 4}},
+		{Bucket: "b", Key: "x.02", Split: &SplitRange{Seq: 2, Offset: 8, Size: 2}},
+	} {
+		if err := manifest.Write(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := manifest.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []struct {
+		RunEnd *RunEnd
+	}
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	end := records[len(records)-1].RunEnd
+	if end == nil || len(end.Split) != 2 {
+		t.Fatalf("expected 2 split objects, got %+v", end)
+	}
+
+	for i, key := range []string{"x.00", "x.01"} {
+		if end.Split[i].Key != key || end.Split[i].Seq != int64(i) {
+			t.Errorf("%d expected %s, got %+v", i, key, end.Split[i])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errSSECustomerKey = errors.New(
+	"-sse-c-key must name a file containing a 256-bit key, raw or base64 encoded")
+
+var errSSECustomerKeyOptions = errors.New(
+	"-sse-c-key cannot be combined with -sse or -sse-kms-key-id")
+
+// sseCustomerAlgorithm is the only algorithm S3 supports for encryption with
+// customer-provided keys (SSE-C).
+const sseCustomerAlgorithm = "AES256"
+
+// sseCustomerEncryption is recorded in the manifest for objects encrypted
+// with a customer-provided key.
+const sseCustomerEncryption = "SSE-C"
+
+// readSSECustomerKey reads the 256-bit key for SSE-C from the file at name,
+// which holds either the 32 bytes of the key or their base64 encoding.
+func readSSECustomerKey(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%w: %s", errSSECustomerKey, name)
+	}
+
+	return key, nil
+}
+
+// sseCustomer returns the SSECustomerAlgorithm, SSECustomerKey, and
+// SSECustomerKeyMD5 fields to set on every request for an object encrypted
+// with SSECustomerKey, or nil if it is not.
+func (p *ObjectOptions) sseCustomer() (algo, key, keyMD5 *string) {
+	if p == nil || p.SSECustomerKey == nil {
+		return nil, nil, nil
+	}
+
+	sum := md5.Sum(p.SSECustomerKey)
+
+	return aws.String(sseCustomerAlgorithm),
+		aws.String(base64.StdEncoding.EncodeToString(p.SSECustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// applyUploadPart sets the fields of an s3.UploadPartInput derived from the
+// ObjectOptions, i.e., the SSE-C key the upload was created with.
+func (p *ObjectOptions) applyUploadPart(part *s3.UploadPartInput) {
+	part.SSECustomerAlgorithm, part.SSECustomerKey, part.SSECustomerKeyMD5 = p.sseCustomer()
+}
+
+// objectEncryption returns the server-side encryption S3 reports was applied
+// to an object, e.g., AES256, aws:kms, or SSE-C, for the manifest.
+func objectEncryption(st *S3UploadState) string {
+	switch {
+	case st.objOutput != nil:
+		if st.objOutput.SSECustomerAlgorithm != nil {
+			return sseCustomerEncryption
+		}
+		return string(st.objOutput.ServerSideEncryption)
+	case st.createOutput != nil:
+		if st.createOutput.SSECustomerAlgorithm != nil {
+			return sseCustomerEncryption
+		}
+		if st.completedOutput != nil && st.completedOutput.ServerSideEncryption != "" {
+			return string(st.completedOutput.ServerSideEncryption)
+		}
+		return string(st.createOutput.ServerSideEncryption)
+	}
+
+	return ""
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Validate SSE-C keys are read raw or base64 encoded
+func TestReadSSECustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xa5}, 32)
+	dir := t.TempDir()
+
+	for i, tst := range []struct {
+		data []byte
+		err  error
+	}{
+		{key, nil},
+		{[]byte(base64.StdEncoding.EncodeToString(key) + "\n"), nil},
+		{key[0:16], errSSECustomerKey},
+		{[]byte(base64.StdEncoding.EncodeToString(key[0:16])), errSSECustomerKey},
+	} {
+		name := filepath.Join(dir, fmt.Sprintf("%d.key", i))
+		if err := os.WriteFile(name, tst.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := readSSECustomerKey(name)
+		if !errors.Is(err, tst.err) {
+			t.Errorf("%d expected error %v, got %v", i, tst.err, err)
+		}
+		if err == nil && !bytes.Equal(actual, key) {
+			t.Errorf("%d expected key %x, got %x", i, key, actual)
+		}
+	}
+}
+
+// Validate the SSE-C key is sent with every request for a multi-part object,
+// and the encryption is recorded for the manifest
+func TestUploadSSECustomerKey(t *testing.T) {
+	const partSize = 64
+
+	key := bytes.Repeat([]byte{0xa5}, 32)
+
+	var mu sync.Mutex
+	var missing []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var request string
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			request = "create"
+			w.Header().Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			request = "part " + query.Get("partNumber")
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			request = "complete"
+			fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodGet && query.Has("attributes"):
+			request = "attributes"
+			fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+		}
+
+		if r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "AES256" ||
+			r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key") != base64.StdEncoding.EncodeToString(key) ||
+			r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") == "" {
+			mu.Lock()
+			missing = append(missing, request)
+			mu.Unlock()
+		}
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.objOpt = &ObjectOptions{SSECustomerKey: key}
+
+	uploader := NewUploader(context.Background(), opts)
+
+	data := bytes.Repeat([]byte("x"), partSize*2)
+
+	res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+	if res.Error != nil {
+		t.Fatalf("expected no error, got %s", res.Error)
+	}
+
+	if len(missing) != 0 {
+		t.Errorf("expected the key with every request, missing from %v", slices.Compact(missing))
+	}
+
+	obj, err := NewObjectReporting(res.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj.Encryption != sseCustomerEncryption {
+		t.Errorf("expected encryption %s, got %q", sseCustomerEncryption, obj.Encryption)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errAbortStaleBucket = errors.New(
+	"-abort-stale without a -key aborts uploads in the whole bucket, which requires -abort-stale-bucket")
+
+// abortStaleUploads lists the multi-part uploads in Bucket under the prefix
+// Key and aborts any that were initiated more than age ago, so that parts left
+// behind by earlier failed runs do not continue to accrue storage charges.
+// Errors aborting individual uploads are logged, and the number of uploads
+// aborted is returned.
+func abortStaleUploads(ctx context.Context, Bucket, Key string, age time.Duration, opts *Options) (int, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	cutoff := time.Now().Add(-age)
+
+	if opts.Verbose {
+		log.Printf("checking for multi-part uploads under %s/%s initiated before %s",
+			Bucket, Key, cutoff.Format(time.RFC3339))
+	}
+
+	paginator := s3.NewListMultipartUploadsPaginator(s3client,
+		&s3.ListMultipartUploadsInput{
+			Bucket: &Bucket,
+			Prefix: &Key,
+		})
+
+	naborted := 0
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return naborted, err
+		}
+
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || !upload.Initiated.Before(cutoff) {
+				continue
+			}
+
+			// a non-prefix Key names a single object
+			if Key != "" && !strings.HasSuffix(Key, "/") && *upload.Key != Key {
+				continue
+			}
+
+			log.Printf("aborting stale upload: %s/%s (upload-id %s, initiated %s)",
+				Bucket, *upload.Key, *upload.UploadId,
+				upload.Initiated.Format(time.RFC3339))
+
+			if err := abortStaleUpload(ctx, s3client, Bucket, upload.Key, upload.UploadId, opts); err != nil {
+				log.Printf("unable to abort stale upload: %s/%s (upload-id %s): %s",
+					Bucket, *upload.Key, *upload.UploadId, err)
+				continue
+			}
+
+			naborted += 1
+		}
+	}
+
+	return naborted, nil
+}
+
+// abortStaleUpload aborts a single multi-part upload, applying
+// Options.AbortUploadTimeout if one was set.
+func abortStaleUpload(ctx context.Context, s3client *s3.Client, Bucket string, pKey, pUploadID *string, opts *Options) error {
+	if opts.AbortUploadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.AbortUploadTimeout)
+		defer cancel()
+	}
+
+	_, err := s3client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &Bucket,
+		Key:      pKey,
+		UploadId: pUploadID,
+	})
+
+	return err
+}
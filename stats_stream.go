@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errBadStatsFD = errors.New(
+	"-stats-fd must be an open file descriptor")
+
+var errBadStatsInterval = errors.New(
+	"-stats-interval must be greater than zero")
+
+// StatsSnapshot is a machine readable snapshot of the progress of a run,
+// written as a line of JSON by a StatsStream.
+type StatsSnapshot struct {
+	Time           time.Time
+	ElapsedSeconds float64
+
+	// request body bytes sent to S3 so far, and the rate they were sent
+	// since the previous snapshot
+	BytesSent      int64
+	BytesPerSecond float64
+
+	// objects queued for upload so far, those still in flight (i.e., the
+	// queue depth), and those that have completed or failed
+	ObjectsQueued    int64
+	ObjectsInFlight  int64
+	ObjectsCompleted int64
+	ObjectsFailed    int64
+
+	// Final is set on the last snapshot written, once the run has finished
+	Final bool `json:",omitempty"`
+}
+
+// StatsStream periodically writes StatsSnapshot to a file descriptor (see
+// -stats-fd), so that wrapper schedulers may make live decisions without
+// parsing the logs.
+type StatsStream struct {
+	w        io.Writer
+	interval time.Duration
+	started  time.Time
+
+	bytesSent atomic.Int64
+	queued    atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+
+	mu       *sync.Mutex
+	last     time.Time
+	lastSent int64
+}
+
+// NewStatsStream initializes a new StatsStream writing a snapshot to w every
+// interval.
+func NewStatsStream(w io.Writer, interval time.Duration) *StatsStream {
+	now := time.Now()
+
+	return &StatsStream{
+		w:        w,
+		interval: interval,
+		started:  now,
+		mu:       &sync.Mutex{},
+		last:     now,
+	}
+}
+
+// openStatsFD returns the already open file descriptor fd as an *os.File.
+func openStatsFD(fd int) (*os.File, error) {
+	if fd < 0 {
+		return nil, errBadStatsFD
+	}
+
+	fh := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+
+	if _, err := fh.Stat(); err != nil {
+		return nil, fmt.Errorf("%w: %d: %w", errBadStatsFD, fd, err)
+	}
+
+	return fh, nil
+}
+
+// queue records an object queued for upload.
+func (p *StatsStream) queue() {
+	if p == nil {
+		return
+	}
+	p.queued.Add(1)
+}
+
+// complete records the results of uploading an object.
+func (p *StatsStream) complete(res *UploadResults) {
+	if p == nil {
+		return
+	}
+
+	if res.Error != nil {
+		p.failed.Add(1)
+	} else {
+		p.completed.Add(1)
+	}
+}
+
+// snapshot returns a StatsSnapshot of the progress so far, p.mu must be held.
+func (p *StatsStream) snapshot(final bool) *StatsSnapshot {
+	now := time.Now()
+	sent := p.bytesSent.Load()
+
+	s := &StatsSnapshot{
+		Time:             now,
+		ElapsedSeconds:   now.Sub(p.started).Seconds(),
+		BytesSent:        sent,
+		ObjectsQueued:    p.queued.Load(),
+		ObjectsCompleted: p.completed.Load(),
+		ObjectsFailed:    p.failed.Load(),
+		Final:            final,
+	}
+
+	s.ObjectsInFlight = s.ObjectsQueued - s.ObjectsCompleted - s.ObjectsFailed
+
+	if d := now.Sub(p.last); d > 0 {
+		s.BytesPerSecond = float64(sent-p.lastSent) / d.Seconds()
+	}
+
+	p.last = now
+	p.lastSent = sent
+
+	return s
+}
+
+// write writes a snapshot to the stream as a line of JSON.
+func (p *StatsStream) write(final bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf, err := json.Marshal(p.snapshot(final))
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	_, err = p.w.Write(buf)
+
+	return err
+}
+
+// Run writes a snapshot every interval until ctx is canceled, or writing
+// fails.
+func (p *StatsStream) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := p.write(false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// HTTPClient wraps an s3.HTTPClient so that request body bytes sent to S3 are
+// counted.
+func (p *StatsStream) HTTPClient(client s3.HTTPClient) s3.HTTPClient {
+	return &statsHTTPClient{
+		client: client,
+		stats:  p,
+	}
+}
+
+// statsHTTPClient implements s3.HTTPClient, counting the request body bytes
+// read by the underlying client.
+type statsHTTPClient struct {
+	client s3.HTTPClient
+	stats  *StatsStream
+}
+
+func (c *statsHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return c.client.Do(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = &statsReader{
+		rc:    req.Body,
+		stats: c.stats,
+	}
+
+	return c.client.Do(req)
+}
+
+// statsReader counts the bytes read from a request body.
+type statsReader struct {
+	rc    io.ReadCloser
+	stats *StatsStream
+}
+
+func (r *statsReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b)
+	r.stats.bytesSent.Add(int64(n))
+	return n, err
+}
+
+func (r *statsReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type discardHTTPClient struct{}
+
+func (discardHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if _, err := io.Copy(io.Discard, req.Body); err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestStatsStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	stats := NewStatsStream(buf, 0)
+
+	client := stats.HTTPClient(discardHTTPClient{})
+
+	for i := 0; i < 3; i++ {
+		stats.queue()
+
+		req, err := http.NewRequest(http.MethodPut, "http://s3.test/bucket/key",
+			strings.NewReader("0123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.Do(req); err != nil {
+			t.Fatalf("%d unexpected error: %s", i, err)
+		}
+	}
+
+	stats.complete(&UploadResults{})
+	stats.complete(&UploadResults{Error: errors.New("failed")})
+
+	if err := stats.write(true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var s StatsSnapshot
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if s.BytesSent != 30 || s.ObjectsQueued != 3 || s.ObjectsInFlight != 1 ||
+		s.ObjectsCompleted != 1 || s.ObjectsFailed != 1 || !s.Final {
+		t.Errorf("unexpected snapshot: %+v", s)
+	}
+
+	if _, err := openStatsFD(-1); !errors.Is(err, errBadStatsFD) {
+		t.Errorf("expected errBadStatsFD got %v", err)
+	}
+}
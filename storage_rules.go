@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// storagePredicate reports whether an object named key, with the source file
+// information fi (nil if unknown, e.g., for URLs), matches a rule.
+type storagePredicate func(key string, fi os.FileInfo, now time.Time) bool
+
+// storageRule assigns a storage class to objects matching all its predicates.
+type storageRule struct {
+	preds []storagePredicate
+	class types.StorageClass
+}
+
+// StorageRules lists rules mapping glob, size, and age predicates to storage
+// classes, the first rule whose predicates all match an object applies.
+type StorageRules []*storageRule
+
+// ReadStorageRules parses rules from r, one rule per line, each listing one or
+// more predicates followed by a storage class, optionally separated by "->" or
+// "→".  Blank lines and lines starting with # are ignored.  Predicates are:
+//
+//	<op><size> or size<op><size>  the source size, e.g., <1MiB or size>=1GiB
+//	age<op><duration>             time since the source was modified, e.g.,
+//	                              age>90d (d for days, or as time.Duration)
+//	<glob>                        a glob matching the key's base name, or
+//	                              the whole key if the glob contains a /
+//
+// where <op> is one of <, <=, >, or >=.
+func ReadStorageRules(r io.Reader) (StorageRules, error) {
+	var rules StorageRules
+
+	scanner := bufio.NewScanner(r)
+
+	lineno := 0
+	for scanner.Scan() {
+		lineno += 1
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var fields []string
+		for _, field := range strings.Fields(line) {
+			if field != "->" && field != "→" {
+				fields = append(fields, field)
+			}
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected predicates and a storage class", lineno)
+		}
+
+		class, err := parseStorageClass(fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+
+		rule := &storageRule{class: class}
+
+		for _, field := range fields[:len(fields)-1] {
+			pred, err := parseStoragePredicate(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineno, err)
+			}
+			rule.preds = append(rule.preds, pred)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// parseStoragePredicate parses a single size, age, or glob predicate.
+func parseStoragePredicate(s string) (storagePredicate, error) {
+	switch {
+	case strings.HasPrefix(s, "age") && len(s) > 3 && strings.ContainsAny(s[3:4], "<>"):
+		cmp, value := cutComparison(s[3:])
+
+		age, err := parseAge(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age: %s: %w", s, err)
+		}
+
+		return func(key string, fi os.FileInfo, now time.Time) bool {
+			return fi != nil && cmp(int64(now.Sub(fi.ModTime())), int64(age))
+		}, nil
+
+	case strings.HasPrefix(s, "size") && len(s) > 4 && strings.ContainsAny(s[4:5], "<>"),
+		strings.ContainsAny(s[0:1], "<>"):
+		cmp, value := cutComparison(strings.TrimPrefix(s, "size"))
+
+		var size ByteSize
+		if err := size.Set(value); err != nil {
+			return nil, fmt.Errorf("invalid size: %s: %w", s, err)
+		}
+
+		return func(key string, fi os.FileInfo, now time.Time) bool {
+			return fi != nil && cmp(fi.Size(), int64(size))
+		}, nil
+	}
+
+	if _, err := path.Match(s, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob: %s: %w", s, err)
+	}
+
+	return func(key string, fi os.FileInfo, now time.Time) bool {
+		name := key
+		if !strings.Contains(s, "/") {
+			name = path.Base(key)
+		}
+		matched, _ := path.Match(s, name)
+		return matched
+	}, nil
+}
+
+// cutComparison splits a leading <, <=, >, or >= from s, returning the
+// comparison and the remainder of s.
+func cutComparison(s string) (func(a, b int64) bool, string) {
+	switch {
+	case strings.HasPrefix(s, "<="):
+		return func(a, b int64) bool { return a <= b }, s[2:]
+	case strings.HasPrefix(s, ">="):
+		return func(a, b int64) bool { return a >= b }, s[2:]
+	case strings.HasPrefix(s, "<"):
+		return func(a, b int64) bool { return a < b }, s[1:]
+	default:
+		return func(a, b int64) bool { return a > b }, strings.TrimPrefix(s, ">")
+	}
+}
+
+// parseAge parses a duration, additionally accepting a number of days with
+// the suffix d, e.g., 90d.
+func parseAge(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// readStorageRulesFile reads StorageRules from the file at name.
+func readStorageRulesFile(name string) (StorageRules, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	return ReadStorageRules(fh)
+}
+
+// apply returns ObjectOptions with the StorageClass of the first rule matching
+// the object named key, with source file information fi (which may be nil).
+// A StorageClass already set in objOpt (e.g., by -set) takes precedence.
+func (p StorageRules) apply(objOpt *ObjectOptions, key string, fi os.FileInfo) *ObjectOptions {
+	if len(p) == 0 || (objOpt != nil && objOpt.StorageClass != "") {
+		return objOpt
+	}
+
+	now := time.Now()
+
+	for _, rule := range p {
+		matched := true
+		for _, pred := range rule.preds {
+			if !pred(key, fi, now) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			copied := &ObjectOptions{}
+			if objOpt != nil {
+				*copied = *objOpt
+			}
+			copied.StorageClass = rule.class
+
+			return copied
+		}
+	}
+
+	return objOpt
+}
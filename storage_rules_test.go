@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestStorageRules(t *testing.T) {
+	rules, err := ReadStorageRules(strings.NewReader(`
+# raw instrument data
+*.raw -> DEEP_ARCHIVE
+<1KiB STANDARD
+size>=4KiB age>90d → GLACIER
+results/*.csv -> STANDARD_IA
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dir := t.TempDir()
+
+	stat := func(size int, age time.Duration) os.FileInfo {
+		name := filepath.Join(dir, "file")
+		if err := os.WriteFile(name, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fi
+	}
+
+	day := 24 * time.Hour
+
+	for i, tst := range []struct {
+		objOpt *ObjectOptions
+		key    string
+		fi     os.FileInfo
+		class  types.StorageClass
+	}{
+		{nil, "data/run1.raw", stat(8192, 0), types.StorageClassDeepArchive},
+		{nil, "data/run1.txt", stat(512, 0), types.StorageClassStandard},
+		{nil, "data/run1.txt", stat(2048, 0), ""},
+		{nil, "data/run1.txt", stat(8192, 100*day), types.StorageClassGlacier},
+		{nil, "data/run1.txt", stat(8192, 10*day), ""},
+		{nil, "results/a.csv", stat(2048, 0), types.StorageClassStandardIa},
+		{nil, "other/results/a.csv", stat(2048, 0), ""},
+		{nil, "data/run1.txt", nil, ""},
+		{nil, "data/run1.raw", nil, types.StorageClassDeepArchive},
+		{&ObjectOptions{StorageClass: types.StorageClassOnezoneIa}, "data/run1.raw", nil,
+			types.StorageClassOnezoneIa},
+	} {
+		objOpt := rules.apply(tst.objOpt, tst.key, tst.fi)
+
+		var class types.StorageClass
+		if objOpt != nil {
+			class = objOpt.StorageClass
+		}
+
+		if class != tst.class {
+			t.Errorf("%d expected %q got %q", i, tst.class, class)
+		}
+	}
+}
+
+func TestReadStorageRulesErrors(t *testing.T) {
+	for i, s := range []string{
+		"STANDARD",
+		"*.raw -> NOT_A_CLASS",
+		"<1XB -> STANDARD",
+		"age>soon -> GLACIER",
+		"[ -> STANDARD",
+	} {
+		if _, err := ReadStorageRules(strings.NewReader(s)); err == nil {
+			t.Errorf("%d expected error got nil", i)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errStreamPartsTLS = errors.New(
+	"-stream-parts requires an https -endpoint")
+
+// errShortPart is returned by a streamPart when the source ended before the
+// part was full, failing the request that was sent with the full part size.
+var errShortPart = errors.New("source ended before the part was full")
+
+// streamPart is a part of a source that cannot be read more than once (e.g.,
+// stdin) that is uploaded while it is still being read, rather than once it
+// has been buffered in full.  The request is sent with a trailing checksum,
+// as the checksum is not known until the part has been read.
+//
+// The part is also kept in a buffer, so that if the source ends before the
+// part is full (i.e., it is the last part) it can be sent again at its actual
+// size, and so that its checksums are available once it has been read.
+type streamPart struct {
+	mu   *sync.Mutex
+	cond *sync.Cond
+
+	bp       BufferPool
+	buf      []byte
+	partSize int64
+
+	// size is the number of bytes read into the part, which is retained
+	// once the buffer has been freed
+	size int64
+
+	// off is the position of the next Read by the request
+	off int
+
+	// done is set once the part has been read in full, or the source
+	// ended, or there was an error reading it
+	done bool
+	err  error
+
+	// checksums of the part, set once it has been read in full
+	algo     *ChecksumAlgorithm
+	md5, sum HashSum
+}
+
+// newStreamPart returns a streamPart of up to partSize bytes buffered using
+// bp, sent with a trailing checksum using algo.
+func newStreamPart(bp BufferPool, partSize int64, algo *ChecksumAlgorithm) *streamPart {
+	p := &streamPart{
+		mu:       &sync.Mutex{},
+		bp:       bp,
+		buf:      bp.Get(partSize)[0:0],
+		partSize: partSize,
+		algo:     algo,
+	}
+
+	p.cond = sync.NewCond(p.mu)
+
+	return p
+}
+
+// fill reads from r into the part until at least n bytes have been read, or
+// the part is full, writing the bytes read to w (e.g., an S3HashWriter).
+// io.EOF is returned if r ended first.
+func (p *streamPart) fill(r io.Reader, w io.Writer, n int) error {
+	chunk := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(chunk)
+
+	for {
+		p.mu.Lock()
+		size := len(p.buf)
+		p.mu.Unlock()
+
+		if size >= n || int64(size) >= p.partSize {
+			return nil
+		}
+
+		m, err := r.Read(chunk[0:min(int64(len(chunk)), p.partSize-int64(size))])
+		if m > 0 {
+			w.Write(chunk[0:m])
+
+			p.mu.Lock()
+			p.buf = append(p.buf, chunk[0:m]...)
+			p.size = int64(len(p.buf))
+			p.mu.Unlock()
+			p.cond.Broadcast()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// seal marks the part as read in full, recording its checksums.
+func (p *streamPart) seal(md5, sum HashSum) {
+	p.mu.Lock()
+	p.done = true
+	p.md5, p.sum = md5, sum
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// fail marks the part as failed, so that its request fails with err.
+func (p *streamPart) fail(err error) {
+	p.mu.Lock()
+	p.done = true
+	p.err = err
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// Read implements io.Reader for the request body, blocking until more of the
+// part has been read from the source.  The request is sent with the full part
+// size, so errShortPart is returned if the source ends before then.
+func (p *streamPart) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.off >= len(p.buf) && !p.done {
+		p.cond.Wait()
+	}
+
+	if p.off < len(p.buf) {
+		n := copy(b, p.buf[p.off:])
+		p.off += n
+		return n, nil
+	}
+
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	if int64(len(p.buf)) < p.partSize {
+		return 0, errShortPart
+	}
+
+	return 0, io.EOF
+}
+
+// Size returns the number of bytes in the part, once it has been read in
+// full.
+func (p *streamPart) Size() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.size
+}
+
+// wait blocks until the part has been read in full, returning any error
+// reading it.
+func (p *streamPart) wait() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.done {
+		p.cond.Wait()
+	}
+
+	return p.err
+}
+
+// free returns the buffer to the BufferPool once the part has been uploaded.
+func (p *streamPart) free() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.buf != nil {
+		p.bp.Put(p.buf)
+		p.buf = nil
+	}
+}
+
+// uploadPartInput sets the Body of part to send the part while it is read,
+// with the full part size and a trailing checksum.
+func (p *streamPart) uploadPartInput(part *s3.UploadPartInput) *s3.UploadPartInput {
+	part.Body = p
+	part.ContentLength = aws.Int64(p.partSize)
+	part.ChecksumAlgorithm = p.algo.Type()
+	return part
+}
+
+// upload sends the part with s3client once the request in has been sent
+// while the part was read, sending it again at its actual size if the source
+// ended before the part was full.  The checksums of the part are then set on
+// part, which records the part for the S3UploadState.
+func (p *streamPart) upload(ctx context.Context, s3client *s3.Client, part, in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	out, err := s3client.UploadPart(ctx, in)
+
+	if werr := p.wait(); werr != nil {
+		return nil, werr
+	}
+
+	size := p.Size()
+
+	if err != nil && size < p.partSize {
+		// the part was read while S3 was waiting for the rest of it,
+		// send it again from the buffer
+		resend := *in
+		resend.Body = bytes.NewReader(p.buf)
+		resend.ContentLength = aws.Int64(size)
+		resend.ChecksumAlgorithm = ""
+		setUploadPartChecksums(p.algo, p.md5, p.sum, &resend)
+
+		out, err = s3client.UploadPart(ctx, &resend)
+	}
+
+	setUploadPartChecksums(p.algo, p.md5, p.sum, part)
+
+	return out, err
+}
+
+// checkStreamParts returns errStreamPartsTLS if any of the endpoints is not
+// https, as parts can only be sent while they are read with a trailing
+// checksum over TLS.
+func checkStreamParts(opts *Options) error {
+	if !opts.StreamParts {
+		return nil
+	}
+
+	for _, endpoint := range opts.Endpoints {
+		if !strings.HasPrefix(strings.ToLower(endpoint), "https://") {
+			return errStreamPartsTLS
+		}
+	}
+
+	return nil
+}
+
+// streamSource returns true if the parts of src after the first may be read
+// directly from the underlying io.Reader and streamed (see streamPart).
+func streamSource(src Source) bool {
+	switch src.(type) {
+	case *memSource, *tempfSource:
+		return true
+	default:
+		return false
+	}
+}
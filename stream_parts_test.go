@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Validate that the parts of a stream after the first are sent while they are
+// read, and that a short last part is sent again at its actual size
+func TestStreamParts(t *testing.T) {
+	const partSize = 64
+
+	var mu sync.Mutex
+	var requests []string
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		w.Header().Set("ETag", `"etag"`)
+
+		body, err := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			requests = append(requests, "create")
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && query.Has("partNumber") && err == nil:
+			// a streamed part is sent aws-chunked with a
+			// trailing checksum
+			size := fmt.Sprint(len(body))
+			if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+				size = decoded + " streamed"
+			}
+			requests = append(requests, "part "+query.Get("partNumber")+" "+size)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			requests = append(requests, "complete")
+			fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+	opts.ConcurrentParts = 1
+	opts.ReadAhead = 1
+	opts.StreamParts = true
+	opts.s3 = NewS3ClientPool(true, aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  srv.Client(),
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.UsePathStyle = true
+	})
+
+	uploader := NewUploader(context.Background(), opts)
+
+	data := bytes.Repeat([]byte("x"), partSize*2+partSize/2)
+
+	// an io.Reader that is not an io.ReaderAt, like stdin
+	r := io.MultiReader(bytes.NewReader(data))
+
+	res := <-uploader.Upload(context.Background(), r, "bucket", "key", nil)
+	if res.Error != nil {
+		t.Fatalf("expected no error, got %s", res.Error)
+	}
+
+	// parts may be sent in any order
+	slices.Sort(requests)
+
+	expect := []string{"complete", "create", "part 1 64", "part 2 64 streamed", "part 3 32"}
+	if !slices.Equal(requests, expect) {
+		t.Errorf("expected %v, got %v", expect, requests)
+	}
+
+	rs := res.State.resumeState(partSize)
+	if len(rs.Parts) != 3 || rs.Parts[2].Size != partSize/2 || rs.Parts[2].Checksum == "" {
+		t.Errorf("expected 3 parts with checksums, got %+v", rs.Parts)
+	}
+}
+
+func TestCheckStreamParts(t *testing.T) {
+	for i, tst := range []struct {
+		endpoints []string
+		err       error
+	}{
+		{nil, nil},
+		{[]string{"https://s3.example.com"}, nil},
+		{[]string{"https://a.example.com", "http://b.example.com"}, errStreamPartsTLS},
+	} {
+		opts := &Options{StreamParts: true, Endpoints: tst.endpoints}
+		if err := checkStreamParts(opts); err != tst.err {
+			t.Errorf("%d expected %v, got %v", i, tst.err, err)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errDeleteWithoutSync = errors.New(
+	"-delete is only valid with -sync")
+
+var errSyncWithoutGlobs = errors.New(
+	"-sync requires one or more <globs>")
+
+var errDeleteIncomplete = errors.New(
+	"not deleting objects, some local sources were skipped or could not be read")
+
+// ErrMaxDelete is returned when the number of remote objects to delete exceeds
+// Options.MaxDelete
+var ErrMaxDelete = errors.New("too many objects to delete")
+
+// syncMode represents how local sources are compared against remote objects
+// by -sync.
+type syncMode int
+
+const (
+	// Compare the size and the predicted ETag of every source
+	SyncModeChecksum syncMode = iota
+
+	// Compare the size and modification time, only predicting the ETag of
+	// sources modified after the remote object
+	SyncModeQuick
+
+	// Compare the size and the checksum (or the ETag) of every source
+	// against the attributes of the object at the same key, fetched for
+	// each source instead of listing the remote objects
+	SyncModeHead
+)
+
+// SyncMode represents a syncMode, with helper functions to parse and produce
+// human readable representations of the identifier for use via the flag
+// module.
+type SyncMode syncMode
+
+func (p SyncMode) String() string {
+	switch syncMode(p) {
+	case SyncModeQuick:
+		return "quick"
+	case SyncModeHead:
+		return "head"
+	default:
+		return "checksum"
+	}
+}
+
+func (p *SyncMode) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "checksum":
+		*p = SyncMode(SyncModeChecksum)
+	case "quick":
+		*p = SyncMode(SyncModeQuick)
+	case "head":
+		*p = SyncMode(SyncModeHead)
+	default:
+		return fmt.Errorf("valid sync modes: checksum, quick, head")
+	}
+
+	return nil
+}
+
+// quickUnchanged compares the size and modification time of a local file
+// against a remote object.  If the sizes differ then the object has changed,
+// if the local file was not modified after the remote object was then it is
+// assumed to be unchanged, otherwise decided is false and the contents need
+// to be compared.
+func quickUnchanged(fi os.FileInfo, remote *types.Object) (same, decided bool) {
+	if remote.Size == nil || fi.Size() != *remote.Size {
+		return false, true
+	}
+
+	if remote.LastModified != nil && !fi.ModTime().After(*remote.LastModified) {
+		return true, true
+	}
+
+	return false, false
+}
+
+// maxDeleteObjects is the maximum number of keys per DeleteObjects request
+const maxDeleteObjects = 1000
+
+// DefaultMaxDelete is the default limit on the number of remote objects
+// -delete may remove
+const DefaultMaxDelete = 1000
+
+// syncState tracks the remote objects under the destination prefix, and which
+// of them have been seen locally, for -sync and -delete.  Unless recursive is
+// set only the objects directly under the prefix may be deleted, as only the
+// top level of directories is walked for local files.  If any local source
+// was skipped then incomplete is set, and nothing may be deleted.
+type syncState struct {
+	Bucket string
+	Key    string
+
+	remote     map[string]types.Object
+	seen       map[string]bool
+	recursive  bool
+	incomplete bool
+	mu         *sync.Mutex
+}
+
+// newSyncState lists the remote objects in Bucket under the prefix Key.  With
+// SyncModeHead the remote objects are only listed for -delete.
+func newSyncState(ctx context.Context, Bucket, Key string, opts *Options) (*syncState, error) {
+	remote := map[string]types.Object{}
+
+	if opts.SyncMode != SyncModeHead || opts.Delete {
+		var err error
+		remote, err = listRemote(ctx, Bucket, Key, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list %s/%s: %w", Bucket, Key, err)
+		}
+
+		if opts.Verbose {
+			log.Printf("found %d objects under %s/%s", len(remote), Bucket, Key)
+		}
+	}
+
+	return &syncState{
+		Bucket:    Bucket,
+		Key:       Key,
+		remote:    remote,
+		seen:      map[string]bool{},
+		recursive: opts.Recursive,
+		mu:        &sync.Mutex{},
+	}, nil
+}
+
+// see records that the object at key exists locally, as soon as the source is
+// found and before it may be skipped, so that its remote object is not
+// deleted.
+func (p *syncState) see(key string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seen[key] = true
+}
+
+// skip records that a local source was skipped, so that its remote object may
+// not have been seen and nothing is deleted.
+func (p *syncState) skip() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.incomplete = true
+}
+
+// unchanged records that obj exists locally, and returns true if the remote
+// object at the same key appears to be the same so that the upload may be
+// skipped.  Sources that cannot be rewound after being compared are always
+// treated as changed.
+func (p *syncState) unchanged(ctx context.Context, obj *uploadObject, opts *Options) bool {
+	p.mu.Lock()
+	p.seen[obj.key] = true
+	remote, ok := p.remote[obj.key]
+	p.mu.Unlock()
+
+	if obj.bucket != p.Bucket || (!ok && opts.SyncMode != SyncModeHead) {
+		return false
+	}
+
+	if opts.SyncMode == SyncModeQuick {
+		if fi, ok := localFileInfo(obj.rc); ok {
+			if same, decided := quickUnchanged(fi, &remote); decided {
+				return same
+			}
+		}
+	}
+
+	seeker, ok := obj.rc.(io.Seeker)
+	if !ok {
+		return false
+	}
+
+	var same bool
+	var err error
+
+	if opts.SyncMode == SyncModeHead {
+		same, err = headUnchanged(ctx, obj, opts)
+	} else {
+		var status diffStatus
+		status, err = compareObject(obj, &remote, opts)
+		same = status == DiffSame
+	}
+
+	if err != nil {
+		log.Printf("error comparing %s/%s: %s", obj.bucket, obj.key, err)
+	}
+
+	if err == nil && same {
+		return true
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		log.Printf("error rewinding %s/%s: %s", obj.bucket, obj.key, err)
+	}
+
+	return false
+}
+
+// syncAttributes are requested by headUnchanged, the first part is listed to
+// find the part size of a multi-part object.
+var syncAttributes = []types.ObjectAttributes{
+	types.ObjectAttributesEtag,
+	types.ObjectAttributesChecksum,
+	types.ObjectAttributesObjectParts,
+	types.ObjectAttributesObjectSize,
+}
+
+// headUnchanged compares obj against the attributes of the object at the same
+// key, returning false if there is none.  If the sizes match then the source
+// is read to compare the checksum using the configured ChecksumAlgorithm, if
+// the object has one and the size of its parts is known, otherwise the ETag
+// (see matchETag).
+func headUnchanged(ctx context.Context, obj *uploadObject, opts *Options) (bool, error) {
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	attrCtx, cancel := withTimeout(ctx, opts.ObjectAttributesTimeout)
+	defer cancel()
+
+	params := &s3.GetObjectAttributesInput{
+		Bucket:           &obj.bucket,
+		Key:              &obj.key,
+		MaxParts:         aws.Int32(1),
+		ObjectAttributes: syncAttributes,
+	}
+	params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5 = opts.objOpt.sseCustomer()
+
+	attrs, err := s3client.GetObjectAttributes(attrCtx, params)
+	if preflightStatusCode(err) == http.StatusNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if size, ok := localSize(obj.rc); ok && attrs.ObjectSize != nil && size != *attrs.ObjectSize {
+		return false, nil
+	}
+
+	checksum := objectChecksum(opts.ChecksumAlgorithm, attrs.Checksum)
+
+	// a multi-part object is hashed using the size of its first part,
+	// and an object uploaded in a single request as a single part
+	partSize := int64(MaxPartSize)
+	multipart := false
+	if parts := attrs.ObjectParts; parts != nil && parts.TotalPartsCount != nil && *parts.TotalPartsCount > 0 {
+		multipart = true
+		if len(parts.Parts) > 0 && parts.Parts[0].Size != nil {
+			partSize = *parts.Parts[0].Size
+		} else {
+			checksum = nil
+		}
+	}
+
+	if checksum == nil {
+		if attrs.ETag == nil {
+			return false, nil
+		}
+		return matchETag(obj.rc, *attrs.ETag, opts)
+	}
+
+	s3hw := NewS3HashWriter(opts.ChecksumAlgorithm, partSize)
+
+	buf := copyBuf.Get(copyBufSize)
+	defer copyBuf.Put(buf)
+
+	if _, err := io.CopyBuffer(s3hw, obj.rc, buf); err != nil {
+		return false, err
+	}
+
+	// the size of a source that is not a file is only known once read
+	if attrs.ObjectSize != nil && s3hw.Size() != *attrs.ObjectSize {
+		return false, nil
+	}
+
+	var status VerificationStatus
+	if multipart {
+		status, _, _ = verifyMultipartChecksum(s3hw.S3Hasher, checksum)
+	} else {
+		status, _, _ = verifyChecksum(s3hw.S3Hasher, checksum)
+	}
+
+	return status == VerificationMatch, nil
+}
+
+// objectChecksum returns the Checksum<algo> field of a types.Checksum, or nil
+// if there is none.
+func objectChecksum(algo *ChecksumAlgorithm, checksum *types.Checksum) *string {
+	if checksum == nil {
+		return nil
+	}
+
+	switch algo {
+	case ChecksumAlgorithmSHA256:
+		return checksum.ChecksumSHA256
+	case ChecksumAlgorithmSHA1:
+		return checksum.ChecksumSHA1
+	case ChecksumAlgorithmCRC32C:
+		return checksum.ChecksumCRC32C
+	case ChecksumAlgorithmCRC32:
+		return checksum.ChecksumCRC32
+	}
+	return nil
+}
+
+// missing returns the remote keys that were not seen locally, sorted.  Unless
+// recursive is set only keys directly under the prefix are returned.
+func (p *syncState) missing() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var keys []string
+	for key := range p.remote {
+		if p.seen[key] {
+			continue
+		}
+		if !p.recursive && strings.Contains(strings.TrimPrefix(key, p.Key), "/") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// deleteMissing deletes the remote objects that were not seen locally.  If any
+// local source was skipped or could not be read nothing is deleted and
+// errDeleteIncomplete is returned.  If Options.MaxDelete is not negative and
+// more objects than that would be deleted then nothing is deleted and an error
+// wrapping ErrMaxDelete is returned.  The number of objects deleted is
+// returned.
+func (p *syncState) deleteMissing(ctx context.Context, opts *Options) (int, error) {
+	p.mu.Lock()
+	incomplete := p.incomplete
+	p.mu.Unlock()
+
+	if incomplete || sourceErrors.Load() > 0 {
+		return 0, errDeleteIncomplete
+	}
+
+	keys := p.missing()
+
+	if opts.MaxDelete >= 0 && len(keys) > opts.MaxDelete {
+		return 0, fmt.Errorf("%w: %d objects under %s/%s exceeds -max-delete %d",
+			ErrMaxDelete, len(keys), p.Bucket, p.Key, opts.MaxDelete)
+	}
+
+	s3client := opts.s3.Get()
+	defer opts.s3.Put(s3client)
+
+	ndeleted := 0
+
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), maxDeleteObjects)]
+		keys = keys[len(batch):]
+
+		var objects []types.ObjectIdentifier
+		for i := range batch {
+			log.Printf("deleting object %s/%s", p.Bucket, batch[i])
+			objects = append(objects, types.ObjectIdentifier{Key: &batch[i]})
+		}
+
+		out, err := s3client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &p.Bucket,
+			Delete: &types.Delete{
+				Objects: objects,
+			},
+		})
+		if err != nil {
+			return ndeleted, err
+		}
+
+		for _, e := range out.Errors {
+			log.Printf("error deleting object %s/%s: %s",
+				p.Bucket, *e.Key, *e.Message)
+		}
+
+		ndeleted += len(out.Deleted)
+	}
+
+	return ndeleted, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestSyncStateDeleteMissing(t *testing.T) {
+	sourceErrors.Store(0)
+
+	p := &syncState{
+		Bucket: "bucket",
+		Key:    "prefix/",
+		remote: map[string]types.Object{
+			"prefix/a":     {},
+			"prefix/b":     {},
+			"prefix/c":     {},
+			"prefix/sub/d": {},
+		},
+		seen: map[string]bool{},
+		mu:   &sync.Mutex{},
+	}
+
+	p.see("prefix/b")
+
+	if got := p.missing(); !slices.Equal(got, []string{"prefix/a", "prefix/c"}) {
+		t.Errorf("expected missing [prefix/a prefix/c] got %v", got)
+	}
+
+	p.recursive = true
+
+	if got := p.missing(); !slices.Equal(got, []string{"prefix/a", "prefix/c", "prefix/sub/d"}) {
+		t.Errorf("expected missing [prefix/a prefix/c prefix/sub/d] got %v", got)
+	}
+
+	opts := &Options{MaxDelete: 1}
+
+	n, err := p.deleteMissing(context.Background(), opts)
+	if !errors.Is(err, ErrMaxDelete) {
+		t.Errorf("expected ErrMaxDelete got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected 0 deleted got %d", n)
+	}
+
+	// nothing is deleted once a local source was skipped
+	opts.MaxDelete = -1
+	p.skip()
+
+	n, err = p.deleteMissing(context.Background(), opts)
+	if !errors.Is(err, errDeleteIncomplete) {
+		t.Errorf("expected errDeleteIncomplete got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected 0 deleted got %d", n)
+	}
+
+	// or a local source could not be read
+	p.incomplete = false
+	sourceErrors.Add(1)
+	defer sourceErrors.Store(0)
+
+	if _, err := p.deleteMissing(context.Background(), opts); !errors.Is(err, errDeleteIncomplete) {
+		t.Errorf("expected errDeleteIncomplete got %v", err)
+	}
+}
+
+func TestQuickUnchanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(name, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tst := range []struct {
+		remote  *types.Object
+		same    bool
+		decided bool
+	}{
+		{&types.Object{Size: aws.Int64(10), LastModified: aws.Time(mtime)}, false, true},
+		{&types.Object{Size: aws.Int64(11), LastModified: aws.Time(mtime)}, true, true},
+		{&types.Object{Size: aws.Int64(11), LastModified: aws.Time(mtime.Add(time.Hour))}, true, true},
+		{&types.Object{Size: aws.Int64(11), LastModified: aws.Time(mtime.Add(-time.Hour))}, false, false},
+		{&types.Object{Size: aws.Int64(11)}, false, false},
+	} {
+		same, decided := quickUnchanged(fi, tst.remote)
+		if same != tst.same || decided != tst.decided {
+			t.Errorf("%d expected %t, %t got %t, %t",
+				i, tst.same, tst.decided, same, decided)
+		}
+	}
+}
+
+// Validate -sync-mode head compares each source against the size and the
+// checksum, or the ETag, of the object at the same key
+func TestHeadUnchanged(t *testing.T) {
+	const partSize = 64
+
+	data := make([]byte, partSize*2+1)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	single := NewS3HashWriter(ChecksumAlgorithmSHA256, MaxPartSize)
+	single.Write(data)
+
+	multi := NewS3HashWriter(ChecksumAlgorithmSHA256, partSize)
+	multi.Write(data)
+
+	attrs := map[string]string{
+		"single": fmt.Sprintf(`<Checksum><ChecksumSHA256>%s</ChecksumSHA256></Checksum><ObjectSize>%d</ObjectSize>`,
+			single.Sum().Base64(), len(data)),
+		"multi": fmt.Sprintf(`<Checksum><ChecksumSHA256>%s</ChecksumSHA256></Checksum><ObjectSize>%d</ObjectSize>`+
+			`<ObjectParts><PartsCount>3</PartsCount><Part><PartNumber>1</PartNumber><Size>%d</Size></Part></ObjectParts>`,
+			multi.SumOfSums().Base64(), len(data), partSize),
+		"etag": fmt.Sprintf(`<ETag>%s</ETag><ObjectSize>%d</ObjectSize>`,
+			single.MD5Sum().Hex(), len(data)),
+		"changed": fmt.Sprintf(`<Checksum><ChecksumSHA256>%s</ChecksumSHA256></Checksum><ObjectSize>%d</ObjectSize>`,
+			multi.SumPart(1).Base64(), len(data)),
+		"size": fmt.Sprintf(`<Checksum><ChecksumSHA256>%s</ChecksumSHA256></Checksum><ObjectSize>%d</ObjectSize>`,
+			single.Sum().Base64(), len(data)-1),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attr, ok := attrs[filepath.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		fmt.Fprintf(w, `<GetObjectAttributesResponse>%s</GetObjectAttributesResponse>`, attr)
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+
+	for i, tst := range []struct {
+		key    string
+		expect bool
+	}{
+		{"single", true},
+		{"multi", true},
+		{"etag", true},
+		{"changed", false},
+		{"size", false},
+		{"missing", false},
+	} {
+		obj := &uploadObject{bucket: "bucket", key: tst.key, rc: io.NopCloser(bytes.NewReader(data))}
+
+		same, err := headUnchanged(context.Background(), obj, opts)
+		if err != nil || same != tst.expect {
+			t.Errorf("%d expected %t, got %t %v", i, tst.expect, same, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// truncateKeyHash is the number of hex characters of a hash of the original
+// key appended to truncated keys.
+const truncateKeyHash = 16
+
+// maxTruncateKeyExt is the longest extension preserved by truncated keys.
+const maxTruncateKeyExt = 16
+
+// keyTruncation represents how keys longer than MaxKeyLength are handled.
+type keyTruncation int
+
+const (
+	// Keys that are too long are rejected
+	KeyTruncationNone keyTruncation = iota
+
+	// Keys that are too long are truncated and a hash of the original key
+	// appended, preserving the extension
+	KeyTruncationHash
+)
+
+// KeyTruncation represents a keyTruncation, with helper functions to parse and
+// produce human readable representations of the identifier for use via the
+// flag module.
+type KeyTruncation keyTruncation
+
+func (p KeyTruncation) String() string {
+	switch keyTruncation(p) {
+	case KeyTruncationHash:
+		return "hash"
+	default:
+		return "none"
+	}
+}
+
+func (p *KeyTruncation) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "none":
+		*p = KeyTruncation(KeyTruncationNone)
+	case "hash":
+		*p = KeyTruncation(KeyTruncationHash)
+	default:
+		return fmt.Errorf("valid key truncations: none, hash")
+	}
+
+	return nil
+}
+
+// truncateKey returns key unchanged if it is no longer than MaxKeyLength bytes
+// or if mode is KeyTruncationNone.  Otherwise, with KeyTruncationHash, the key
+// is truncated (at a UTF-8 character boundary) and a '-' followed by a hash of
+// the whole key is appended, along with the extension of the key, so that
+// distinct long keys remain distinct.
+//
+// e.g., a key of 2000 bytes ending in ".dat" is truncated to 1003 bytes,
+// followed by "-<16 hex characters>.dat"
+func truncateKey(key string, mode keyTruncation) string {
+	if len(key) <= MaxKeyLength || mode != KeyTruncationHash {
+		return key
+	}
+
+	ext := path.Ext(key)
+	if len(ext) > maxTruncateKeyExt || strings.Contains(ext, "/") {
+		ext = ""
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(sum[:])[:truncateKeyHash] + ext
+
+	n := MaxKeyLength - len(suffix)
+	for n > 0 && !utf8.RuneStart(key[n]) {
+		n -= 1
+	}
+
+	return key[:n] + suffix
+}
+
+// objectKey returns the key obj is uploaded to, after any -key-replace,
+// -key-encoding, -shard-prefix and -truncate-keys have been applied.
+func objectKey(obj *uploadObject, opts *Options) string {
+	key := opts.keyReplacer.replace(obj.key)
+	key = encodeKey(key, opts.KeyEncoding)
+	key = shardKey(key, opts.key, opts.ShardPrefix)
+	return truncateKey(key, opts.TruncateKeys)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKey(t *testing.T) {
+	long := strings.Repeat("a/", MaxKeyLength)
+
+	for i, tst := range []struct {
+		key    string
+		mode   keyTruncation
+		suffix string
+		same   bool
+	}{
+		{"a/b/c.txt", KeyTruncationHash, ".txt", true},
+		{long + "c.txt", KeyTruncationNone, ".txt", true},
+		{long + "c.txt", KeyTruncationHash, ".txt", false},
+		{long + "c", KeyTruncationHash, "", false},
+		{long + "c.averyveryverylongextension", KeyTruncationHash, "", false},
+		{strings.Repeat("ü", MaxKeyLength) + ".dat", KeyTruncationHash, ".dat", false},
+	} {
+		got := truncateKey(tst.key, tst.mode)
+
+		if tst.same {
+			if got != tst.key {
+				t.Errorf("%d expected key unchanged, got %q", i, got)
+			}
+			continue
+		}
+
+		if len(got) > MaxKeyLength {
+			t.Errorf("%d expected at most %d bytes, got %d", i, MaxKeyLength, len(got))
+		}
+
+		if !utf8.ValidString(got) {
+			t.Errorf("%d expected valid UTF-8, got %q", i, got)
+		}
+
+		if !strings.HasSuffix(got, tst.suffix) {
+			t.Errorf("%d expected suffix %q, got %q", i, tst.suffix, got)
+		}
+	}
+
+	// distinct long keys remain distinct
+	a := truncateKey(long+"a.txt", KeyTruncationHash)
+	b := truncateKey(long+"b.txt", KeyTruncationHash)
+	if a == b {
+		t.Errorf("expected distinct keys, got %q", a)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+// UploadHooks lists functions called by an Uploader as uploads progress, so
+// that an application embedding the Uploader may drive its own progress
+// reporting.  Any of the functions may be nil.  The functions are called from
+// the goroutines processing uploads, and so must be safe for concurrent use
+// and should return promptly.
+type UploadHooks struct {
+	// OnObjectStart is called when processing of an object starts
+	OnObjectStart func(Bucket, Key string)
+
+	// OnPartComplete is called as each part of a multi-part object is
+	// uploaded, and once with the whole object for objects uploaded using
+	// PutObject, with the size of the part in bytes
+	OnPartComplete func(Bucket, Key string, partID int32, size int64)
+
+	// OnObjectDone is called with the results once processing of an
+	// object has finished, before they are returned by Upload
+	OnObjectDone func(res *UploadResults)
+}
+
+// objectStart calls OnObjectStart, if set.
+func (p *UploadHooks) objectStart(Bucket, Key string) {
+	if p != nil && p.OnObjectStart != nil {
+		p.OnObjectStart(Bucket, Key)
+	}
+}
+
+// partComplete calls OnPartComplete, if set.
+func (p *UploadHooks) partComplete(Bucket, Key string, partID int32, size int64) {
+	if p != nil && p.OnPartComplete != nil {
+		p.OnPartComplete(Bucket, Key, partID, size)
+	}
+}
+
+// objectDone calls OnObjectDone, if set.
+func (p *UploadHooks) objectDone(res *UploadResults) {
+	if p != nil && p.OnObjectDone != nil {
+		p.OnObjectDone(res)
+	}
+}
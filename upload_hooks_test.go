@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Validate that the UploadHooks are called for single and multi-part objects,
+// using a server that accepts every request
+func TestUploadHooks(t *testing.T) {
+	const partSize = 64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		w.Header().Set("ETag", `"etag"`)
+
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+		}
+	}))
+	defer srv.Close()
+
+	opts := testUploaderOptions(srv.URL, partSize)
+
+	var mu sync.Mutex
+	var events []string
+
+	record := func(format string, a ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf(format, a...))
+	}
+
+	uploader := NewUploader(context.Background(), opts)
+	uploader.SetHooks(&UploadHooks{
+		OnObjectStart: func(Bucket, Key string) {
+			record("start %s/%s", Bucket, Key)
+		},
+		OnPartComplete: func(Bucket, Key string, partID int32, size int64) {
+			record("part %s/%s %d %d", Bucket, Key, partID, size)
+		},
+		OnObjectDone: func(res *UploadResults) {
+			record("done %s/%s %v", res.Bucket, res.Key, res.Error)
+		},
+	})
+
+	for i, tst := range []struct {
+		size   int
+		expect []string
+	}{
+		{10, []string{
+			"done bucket/key <nil>",
+			"part bucket/key 1 10",
+			"start bucket/key",
+		}},
+		{partSize*2 + 10, []string{
+			"done bucket/key <nil>",
+			"part bucket/key 1 64",
+			"part bucket/key 2 64",
+			"part bucket/key 3 10",
+			"start bucket/key",
+		}},
+	} {
+		events = nil
+
+		data := bytes.Repeat([]byte("x"), tst.size)
+
+		res := <-uploader.Upload(context.Background(), bytes.NewReader(data), "bucket", "key", nil)
+		if res.Error != nil {
+			t.Fatalf("%d unexpected error: %s", i, res.Error)
+		}
+
+		mu.Lock()
+		sort.Strings(events)
+		if fmt.Sprint(events) != fmt.Sprint(tst.expect) {
+			t.Errorf("%d expected %v got %v", i, tst.expect, events)
+		}
+		mu.Unlock()
+	}
+}
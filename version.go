@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// buildInfo returns the version of the s3up module, "(devel)" if it was not
+// built from a tagged release, and the VCS revision it was built from if
+// known.
+func buildInfo() (version, revision string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown", ""
+	}
+
+	version = info.Main.Version
+	if version == "" {
+		version = "(devel)"
+	}
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			revision = s.Value
+		}
+	}
+
+	return version, revision
+}
+
+// buildVersion returns the version of the s3up module, followed by the VCS
+// revision it was built from if known, e.g., "v1.2.3" or "(devel) 0a1b2c3d".
+func buildVersion() string {
+	version, revision := buildInfo()
+	if revision != "" {
+		version += " " + revision
+	}
+
+	return version
+}
+
+// versionString returns the text printed by -version.
+func versionString() string {
+	return fmt.Sprintf("s3up %s (%s %s/%s)\n",
+		buildVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// userAgentVersion returns the version noted in the User-Agent of requests,
+// the revision (abbreviated) for development builds.
+func userAgentVersion() string {
+	version, revision := buildInfo()
+	if version != "(devel)" {
+		return version
+	}
+
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+
+	if revision == "" {
+		return "devel"
+	}
+
+	return revision
+}
+
+// addUserAgent adds "s3up/<version>" to the User-Agent of requests, so that
+// the client version may be identified in server access logs.
+func addUserAgent(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions,
+		awsmiddleware.AddUserAgentKeyValue("s3up", userAgentVersion()))
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestVersion(t *testing.T) {
+	s := versionString()
+	if !strings.HasPrefix(s, "s3up ") || !strings.Contains(s, runtime.Version()) {
+		t.Errorf("expected s3up and the go version, got %q", s)
+	}
+
+	if v := userAgentVersion(); v == "" || strings.ContainsAny(v, " ()") {
+		t.Errorf("expected a User-Agent token, got %q", v)
+	}
+
+	o := &s3.Options{}
+	addUserAgent(o)
+	if len(o.APIOptions) != 1 {
+		t.Errorf("expected 1 APIOption, got %d", len(o.APIOptions))
+	}
+}
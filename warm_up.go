@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errBadWarmUp = errors.New(
+	"-warm-up must not be negative")
+
+// warmUp opens n connections to S3 before any object is uploaded, so that the
+// first parts do not wait on TCP and TLS handshakes, by making n concurrent
+// HeadBucket requests for Bucket.  Every client taken from the pool is held
+// until all the requests have finished, so that if the pool does not share a
+// single client each request is made by a different client, and with
+// -endpoints they are spread across the endpoints.  Any response, even an
+// error status, leaves an open connection, so only requests that received no
+// response fail.
+func warmUp(ctx context.Context, Bucket string, n int, opts *Options) error {
+	if opts.Verbose {
+		log.Printf("warming up %d connections to bucket %s", n, Bucket)
+	}
+
+	start := time.Now()
+
+	clients := make([]*s3.Client, n)
+	for i := range clients {
+		clients[i] = opts.s3.Get()
+	}
+
+	errs := make([]error, n)
+	wg := &sync.WaitGroup{}
+
+	for i, s3client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+				Bucket: &Bucket,
+			})
+			if err != nil && preflightStatusCode(err) == 0 {
+				errs[i] = err
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, s3client := range clients {
+		opts.s3.Put(s3client)
+	}
+
+	if opts.Verbose {
+		log.Printf("warmed up %d connections in %s", n, time.Since(start).Round(time.Millisecond))
+	}
+
+	return errors.Join(errs...)
+}
+
+// idleConnsHTTPClient returns client configured to keep at least n idle
+// connections to each host open, rather than only the AWS SDK default of
+// awshttp.DefaultHTTPTransportMaxIdleConnsPerHost, so that the connections
+// opened by warmUp are kept for the upload.  Only the AWS SDK default client
+// may be configured, any other client is returned unchanged.
+func idleConnsHTTPClient(client s3.HTTPClient, n int) s3.HTTPClient {
+	if bc, ok := client.(*awshttp.BuildableClient); ok {
+		return bc.WithTransportOptions(func(tr *http.Transport) {
+			tr.MaxIdleConnsPerHost = max(tr.MaxIdleConnsPerHost, n)
+		})
+	}
+	return client
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Validate warmUp opens a connection for each concurrent HeadBucket request,
+// and fails only if no response was received
+func TestWarmUp(t *testing.T) {
+	const n = 4
+
+	var mu sync.Mutex
+	addrs := map[string]bool{}
+	arrived := make(chan struct{}, n)
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		addrs[r.RemoteAddr] = true
+		mu.Unlock()
+
+		// hold every request until all have arrived, so that each
+		// needs its own connection
+		arrived <- struct{}{}
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	go func() {
+		for i := 0; i < n; i++ {
+			<-arrived
+		}
+		close(release)
+	}()
+
+	opts := testUploaderOptions(srv.URL, 64)
+
+	if err := warmUp(context.Background(), "bucket", n, opts); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+
+	if len(addrs) != n {
+		t.Errorf("expected %d connections, got %d", n, len(addrs))
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	opts = testUploaderOptions(closed.URL, 64)
+	opts.s3 = NewS3ClientPool(true, aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(closed.URL)
+		o.UsePathStyle = true
+		o.RetryMaxAttempts = 1
+	})
+
+	if err := warmUp(context.Background(), "bucket", n, opts); err == nil {
+		t.Errorf("expected an error without a server")
+	}
+}